@@ -40,6 +40,11 @@ const UpdateDetails = ({
     enabled: !!update?.updateId,
     queryFn: () => api.getUpdateDetails(branch, runtimeVersion, update?.updateId as string),
   });
+  const { data: updateErrors } = useQuery({
+    queryKey: [`update-errors-${update?.updateUUID}`],
+    enabled: !!update?.updateId,
+    queryFn: () => api.getUpdateErrors(branch, runtimeVersion, update?.updateId as string),
+  });
   const updateDetails = data;
   if (!update) {
     return (
@@ -148,6 +153,57 @@ const UpdateDetails = ({
             {updateDetails.type === 0 ? 'Normal update' : 'Rollback'}
           </Badge>
         </div>
+        {!!updateDetails.message && (
+          <div className="grid grid-cols-4 items-start gap-4">
+            <Label>Message</Label>
+            <p className="col-span-3 text-sm whitespace-pre-wrap break-words">
+              {updateDetails.message}
+            </p>
+          </div>
+        )}
+        {!!updateDetails.metadata && Object.keys(updateDetails.metadata).length > 0 && (
+          <div className="grid grid-cols-4 items-start gap-4">
+            <Label>Metadata</Label>
+            <div className="col-span-3 flex flex-col gap-2">
+              {Object.entries(updateDetails.metadata).map(([key, value]) => (
+                <div key={key} className="flex items-start gap-2">
+                  <Badge
+                    variant={updateDetails.manifestFields?.includes(key) ? 'default' : 'secondary'}
+                    title={
+                      updateDetails.manifestFields?.includes(key)
+                        ? 'Sent to the app in the manifest'
+                        : undefined
+                    }>
+                    {key}
+                  </Badge>
+                  <code className="text-xs break-all">{value}</code>
+                </div>
+              ))}
+            </div>
+          </div>
+        )}
+        {updateErrors && (
+          <div className="grid grid-cols-4 items-center gap-4">
+            <Label>Error rate</Label>
+            <Badge variant="outline" className="col-span-3">
+              {(updateErrors.errorRate * 100).toFixed(2)}% ({updateErrors.errorUsers} /{' '}
+              {updateErrors.activeUsers} users)
+            </Badge>
+          </div>
+        )}
+        {!!updateErrors?.topErrors.length && (
+          <div className="grid grid-cols-4 items-start gap-4">
+            <Label>Top errors</Label>
+            <div className="col-span-3 flex flex-col gap-2">
+              {updateErrors.topErrors.map(topError => (
+                <div key={topError.message} className="flex items-start gap-2">
+                  <Badge variant="secondary">{topError.users}</Badge>
+                  <code className="text-xs break-all">{topError.message}</code>
+                </div>
+              ))}
+            </div>
+          </div>
+        )}
       </div>
     </SheetContent>
   );
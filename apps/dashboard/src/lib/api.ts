@@ -1,5 +1,13 @@
 import { getRefreshToken, getToken, logout, setTokens } from '@/lib/auth.ts';
 
+export type UpdateApproval = {
+  status: 'pending' | 'approved';
+  requestedBy?: string;
+  requestedAt?: string;
+  approvedBy?: string;
+  approvedAt?: string;
+};
+
 export class ApiClient {
   private baseUrl: string;
 
@@ -61,9 +69,12 @@ export class ApiClient {
     }
   }
 
-  public async login(password: string) {
+  public async login(password: string, username?: string) {
     const form = new URLSearchParams();
     form.append('password', password);
+    if (username) {
+      form.append('username', username);
+    }
     return this.request<{ token: string; refreshToken: string }>(`/auth/login`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
@@ -125,6 +136,15 @@ export class ApiClient {
         updateId: string;
         platform: string;
         commitHash: string;
+        isServed: boolean;
+        servedReason?: 'latest' | 'rollback' | 'fallback';
+        haltedReason?: string;
+        groupId?: string;
+        activateAt?: string;
+        expireAt?: string;
+        approval?: UpdateApproval;
+        message?: string;
+        metadata?: Record<string, string>;
       }[]
     >(`/api/branch/${branch}/runtimeVersion/${runtimeVersion}/updates`, {
       method: 'GET',
@@ -139,10 +159,74 @@ export class ApiClient {
       commitHash: string;
       type: number;
       expoConfig: string;
+      approval?: UpdateApproval;
+      message?: string;
+      metadata?: Record<string, string>;
+      manifestFields?: string[];
     }>(`/api/branch/${branch}/runtimeVersion/${runtimeVersion}/updates/${updateId}`, {
       method: 'GET',
     });
   }
+  public async approveUpdate(branch: string, runtimeVersion: string, updateId: string) {
+    return this.request(
+      `/api/branch/${branch}/runtimeVersion/${runtimeVersion}/updates/${updateId}/approve`,
+      {
+        method: 'POST',
+      }
+    );
+  }
+  public async rejectUpdate(branch: string, runtimeVersion: string, updateId: string) {
+    return this.request(
+      `/api/branch/${branch}/runtimeVersion/${runtimeVersion}/updates/${updateId}/reject`,
+      {
+        method: 'POST',
+      }
+    );
+  }
+  public async getBranchProtection(branch: string) {
+    return this.request<{ protected: boolean }>(`/api/branch/${branch}/protection`, {
+      method: 'GET',
+    });
+  }
+  public async setBranchProtection(branch: string, payload: { protected: boolean }) {
+    return this.request<{ protected: boolean }>(`/api/branch/${branch}/protection`, {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(payload),
+    });
+  }
+  public async getUpdateErrors(branch: string, runtimeVersion: string, updateId: string) {
+    return this.request<{
+      activeUsers: number;
+      errorUsers: number;
+      errorRate: number;
+      topErrors: {
+        message: string;
+        users: number;
+      }[];
+    }>(`/api/branch/${branch}/runtimeVersion/${runtimeVersion}/updates/${updateId}/errors`, {
+      method: 'GET',
+    });
+  }
+  public async getAdoption(branch: string, runtimeVersion: string, days = 30, platform?: string) {
+    const params = new URLSearchParams({ days: String(days) });
+    if (platform) {
+      params.set('platform', platform);
+    }
+    return this.request<
+      {
+        date: string;
+        totalDevices: number;
+        updates: {
+          updateUUID: string;
+          devices: number;
+          share: number;
+        }[];
+      }[]
+    >(`/api/branch/${branch}/runtimeVersion/${runtimeVersion}/adoption?${params.toString()}`, {
+      method: 'GET',
+    });
+  }
   public async getSettings() {
     return this.request<{
       BASE_URL: string;
@@ -11,6 +11,7 @@ import { useNavigate } from 'react-router';
 import { api } from '@/lib/api.ts';
 
 const FormSchema = z.object({
+  username: z.string(),
   password: z.string().min(1, {
     message: 'Password is required',
   }),
@@ -20,6 +21,7 @@ export const Login = () => {
   const form = useForm<z.infer<typeof FormSchema>>({
     resolver: zodResolver(FormSchema),
     defaultValues: {
+      username: '',
       password: '',
     },
   });
@@ -28,7 +30,7 @@ export const Login = () => {
   const onSubmit = useCallback(
     async (data: z.infer<typeof FormSchema>) => {
       try {
-        const response = await api.login(data.password);
+        const response = await api.login(data.password, data.username);
         setTokens(response.token, response.refreshToken);
         navigate('/');
       } catch {
@@ -45,11 +47,24 @@ export const Login = () => {
     <div className="flex-1 w-full h-screen flex items-center justify-center">
       <Card className="w-[350px]">
         <CardHeader>
-          <CardTitle>Admin password</CardTitle>
+          <CardTitle>Login</CardTitle>
         </CardHeader>
         <CardContent>
           <Form {...form}>
             <form onSubmit={form.handleSubmit(onSubmit)} className="w-full gap-5 flex flex-col">
+              <FormField
+                control={form.control}
+                name="username"
+                render={({ field }) => {
+                  return (
+                    <FormItem>
+                      <FormControl>
+                        <Input placeholder="Username (empty for the admin password)" {...field} />
+                      </FormControl>
+                    </FormItem>
+                  );
+                }}
+              />
               <FormField
                 control={form.control}
                 name="password"
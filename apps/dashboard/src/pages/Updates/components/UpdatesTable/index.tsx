@@ -1,4 +1,4 @@
-import { useQuery } from '@tanstack/react-query';
+import { useQuery, useQueryClient } from '@tanstack/react-query';
 import { api } from '@/lib/api.ts';
 import { ApiError } from '@/components/APIError';
 import { DataTable } from '@/components/DataTable';
@@ -15,7 +15,14 @@ import { Badge } from '@/components/ui/badge.tsx';
 import apple from '@/assets/apple.svg';
 import android from '@/assets/android.svg';
 import { UpdateDetailsRef, UpdateDetailsSheet } from '@/components/UpdateDetailsSheet';
-import { useRef } from 'react';
+import { useCallback, useRef } from 'react';
+import { Button } from '@/components/ui/button.tsx';
+
+const servedReasonLabels: Record<string, string> = {
+  latest: 'Served · latest',
+  rollback: 'Served · rolled back',
+  fallback: 'Served · newer halted',
+};
 
 export const UpdatesTable = ({
   branch,
@@ -29,6 +36,18 @@ export const UpdatesTable = ({
     queryKey: ['updates'],
     queryFn: () => api.getUpdates(branch, runtimeVersion),
   });
+  const queryClient = useQueryClient();
+  const review = useCallback(
+    async (updateId: string, approve: boolean) => {
+      if (approve) {
+        await api.approveUpdate(branch, runtimeVersion, updateId);
+      } else {
+        await api.rejectUpdate(branch, runtimeVersion, updateId);
+      }
+      await queryClient.invalidateQueries({ queryKey: ['updates'] });
+    },
+    [branch, runtimeVersion, queryClient]
+  );
 
   return (
     <div className="w-full flex-1">
@@ -91,10 +110,26 @@ export const UpdatesTable = ({
                 <div className="flex flex-row items-center gap-2">
                   {isIos && <img src={apple} className="w-4" alt="apple" />}
                   {isAndroid && <img src={android} className="w-4" alt="android" />}
+                  {!!value.row.original.groupId && (
+                    <Badge variant="outline" className="text-xs" title={value.row.original.groupId}>
+                      Group
+                    </Badge>
+                  )}
                 </div>
               );
             },
           },
+          {
+            header: 'Message',
+            accessorKey: 'message',
+            cell: value => {
+              return (
+                <span className="line-clamp-2 text-sm" title={value.row.original.message}>
+                  {value.row.original.message}
+                </span>
+              );
+            },
+          },
           {
             header: 'Commit',
             accessorKey: 'commitHash',
@@ -106,6 +141,70 @@ export const UpdatesTable = ({
               );
             },
           },
+          {
+            header: 'Status',
+            accessorKey: 'isServed',
+            cell: ({ row }) => {
+              if (row.original.approval?.status === 'pending') {
+                return (
+                  <div className="flex flex-row items-center gap-2">
+                    <Badge
+                      variant="outline"
+                      className="text-xs"
+                      title={`Published by ${row.original.approval.requestedBy ?? 'unknown'}`}>
+                      Pending approval
+                    </Badge>
+                    <Button
+                      size="sm"
+                      onClick={event => {
+                        event.stopPropagation();
+                        review(row.original.updateId, true);
+                      }}>
+                      Approve
+                    </Button>
+                    <Button
+                      size="sm"
+                      variant="destructive"
+                      onClick={event => {
+                        event.stopPropagation();
+                        review(row.original.updateId, false);
+                      }}>
+                      Reject
+                    </Button>
+                  </div>
+                );
+              }
+              if (row.original.isServed) {
+                return (
+                  <Badge variant="default" className="text-xs">
+                    {servedReasonLabels[row.original.servedReason ?? 'latest']}
+                  </Badge>
+                );
+              }
+              if (row.original.haltedReason) {
+                return (
+                  <Badge variant="destructive" className="text-xs" title={row.original.haltedReason}>
+                    Halted
+                  </Badge>
+                );
+              }
+              if (row.original.activateAt && new Date(row.original.activateAt) > new Date()) {
+                return (
+                  <Badge variant="outline" className="text-xs" title={row.original.activateAt}>
+                    Scheduled
+                  </Badge>
+                );
+              }
+              if (row.original.expireAt && new Date(row.original.expireAt) <= new Date()) {
+                return (
+                  <Badge variant="secondary" className="text-xs" title={row.original.expireAt}>
+                    Expired
+                  </Badge>
+                );
+              }
+              return null;
+            },
+          },
           {
             header: 'Published at',
             accessorKey: 'createdAt',
@@ -0,0 +1,150 @@
+import { Env } from '@expo/eas-build-job';
+import { Command, Flags } from '@oclif/core';
+import ora from 'ora';
+
+import { getAuthExpoHeaders, retrieveExpoCredentials } from '../lib/auth';
+import { getExpoConfigUpdateUrl, getPrivateExpoConfigAsync } from '../lib/expoConfig';
+import { fetchWithRetries } from '../lib/fetch';
+import Log from '../lib/log';
+import { isExpoInstalled } from '../lib/package';
+import { promptAsync } from '../lib/prompts';
+
+export default class Promote extends Command {
+  static override args = {};
+  static override description = 'Promote an update from a branch to another';
+  static override examples = [
+    '<%= config.bin %> <%= command.id %> --from staging --to production --platform ios',
+  ];
+  static override flags = {
+    from: Flags.string({
+      description: 'Name of the branch to promote the update from',
+      required: true,
+    }),
+    to: Flags.string({
+      description: 'Name of the branch to promote the update to',
+      required: true,
+    }),
+    platform: Flags.string({
+      type: 'option',
+      options: ['ios', 'android'],
+      required: true,
+    }),
+  };
+  public async run(): Promise<void> {
+    const credentials = retrieveExpoCredentials();
+    if (!credentials.token && !credentials.sessionSecret) {
+      Log.error('You are not logged to eas, please run `eas login`');
+      process.exit(1);
+    }
+    const { flags } = await this.parse(Promote);
+    const { from, to, platform } = flags;
+    if (from === to) {
+      Log.error('The target branch must differ from the source branch, use republish instead');
+      process.exit(1);
+    }
+    const projectDir = process.cwd();
+    const hasExpo = isExpoInstalled(projectDir);
+    if (!hasExpo) {
+      Log.error('Expo is not installed in this project. Please install Expo first.');
+      process.exit(1);
+    }
+    const privateConfig = await getPrivateExpoConfigAsync(projectDir, {
+      env: process.env as Env,
+    });
+    const updateUrl = getExpoConfigUpdateUrl(privateConfig);
+    if (!updateUrl) {
+      Log.error(
+        "Update url is not setup in your config. Please run 'eoas init' to setup the update url"
+      );
+      process.exit(1);
+    }
+    let baseUrl: string;
+    try {
+      const parsedUrl = new URL(updateUrl);
+      baseUrl = parsedUrl.origin;
+    } catch (e) {
+      Log.error('Invalid URL', e);
+      process.exit(1);
+    }
+    const runtimeVersionsEndpoint = `${baseUrl}/api/branch/${from}/runtimeVersions`;
+    const response = await fetchWithRetries(runtimeVersionsEndpoint, {
+      headers: { ...getAuthExpoHeaders(credentials), 'use-expo-auth': 'true' },
+    });
+    if (!response.ok) {
+      Log.error(`Failed to fetch runtime versions: ${await response.text()}`);
+      process.exit(1);
+    }
+    const runtimeVersions = (await response.json()) as {
+      runtimeVersion: string;
+      numberOfUpdates: number;
+    }[];
+    if (runtimeVersions.length === 0) {
+      Log.error('No runtime versions found');
+      process.exit(1);
+    }
+    const selectedRuntimeVersion = await promptAsync({
+      type: 'select',
+      name: 'runtimeVersion',
+      message: 'Select a runtime version',
+      choices: runtimeVersions.map(runtimeVersion => ({
+        title: runtimeVersion.runtimeVersion,
+        value: runtimeVersion.runtimeVersion,
+      })),
+    });
+    const updatesEndpoint = `${baseUrl}/api/branch/${from}/runtimeVersion/${selectedRuntimeVersion.runtimeVersion}/updates`;
+    const updatesResponse = await fetchWithRetries(updatesEndpoint, {
+      headers: { ...getAuthExpoHeaders(credentials), 'use-expo-auth': 'true' },
+    });
+    if (!updatesResponse.ok) {
+      Log.error(`Failed to fetch updates: ${await updatesResponse.text()}`);
+      process.exit(1);
+    }
+    const updates = (
+      (await updatesResponse.json()) as {
+        updateUUID: string;
+        createdAt: string;
+        updateId: string;
+        platform: string;
+        commitHash: string;
+      }[]
+    ).filter(u => {
+      return u.updateUUID !== 'Rollback to embedded' && u.platform === platform;
+    });
+    if (updates.length === 0) {
+      Log.error('No updates found');
+      process.exit(1);
+    }
+    const selectedUpdate = await promptAsync({
+      type: 'select',
+      name: 'update',
+      message: 'Select an update to promote',
+      choices: updates.map(update => ({
+        title: update.updateUUID,
+        value: update,
+        description: `Created at: ${update.createdAt}, Platform: ${update.platform}, Commit hash: ${update.commitHash}`,
+      })),
+    });
+    const promoteEndpoint = `${baseUrl}/promote/${from}?platform=${platform}&runtimeVersion=${selectedRuntimeVersion.runtimeVersion}&updateId=${selectedUpdate.update.updateId}&targetBranch=${to}`;
+    const promoteSpinner = ora(`🔄 Promoting update to ${to}...`).start();
+    const promoteResponse = await fetchWithRetries(promoteEndpoint, {
+      method: 'POST',
+      headers: {
+        ...getAuthExpoHeaders(credentials),
+        'Content-Type': 'application/json',
+      },
+    });
+    if (!promoteResponse.ok) {
+      promoteSpinner.fail('❌ Promote failed');
+      Log.error(`Failed to promote update: ${await promoteResponse.text()}`);
+      process.exit(1);
+    }
+    const { updateUUID } = (await promoteResponse.json()) as { updateUUID: string };
+    if (promoteResponse.status === 202) {
+      promoteSpinner.succeed(
+        `⏳ Update promoted to ${to} as ${updateUUID}, pending approval on the dashboard`
+      );
+      return;
+    }
+    promoteSpinner.succeed(`✅ Update promoted to ${to} as ${updateUUID}`);
+  }
+}
@@ -5,7 +5,16 @@ import FormData from 'form-data';
 import fs from 'fs-extra';
 import path from 'path';
 
-import { RequestUploadUrlItem, computeFilesRequests, requestUploadUrls } from '../lib/assets';
+import {
+  RequestUploadUrlItem,
+  UpdateDescription,
+  UpdateSchedule,
+  computeFilesRequests,
+  computeSourceMaps,
+  parseMetadataFlags,
+  requestUploadGroup,
+  requestUploadUrls,
+} from '../lib/assets';
 import { getAuthExpoHeaders, retrieveExpoCredentials } from '../lib/auth';
 import {
   RequestedPlatform,
@@ -60,6 +69,35 @@ export default class Publish extends Command {
         "Where to write build output. You can override the default dist output directory if it's being used by something else",
       default: 'dist',
     }),
+    activateAt: Flags.string({
+      description: 'Date (RFC3339) from which the update is served, e.g. 2025-06-01T09:00:00Z',
+      required: false,
+    }),
+    expireAt: Flags.string({
+      description: 'Date (RFC3339) from which the update is no longer served',
+      required: false,
+    }),
+    message: Flags.string({
+      description: 'Message describing the update',
+      required: false,
+    }),
+    metadata: Flags.string({
+      description:
+        'Custom metadata stored with the update as key=value, e.g. author=jane, can be repeated',
+      required: false,
+      multiple: true,
+    }),
+    manifestField: Flags.string({
+      description:
+        'Metadata key, or "message", sent to the app in the metadata of the manifest, can be repeated',
+      required: false,
+      multiple: true,
+    }),
+    sourceMaps: Flags.boolean({
+      description:
+        'Export source maps and upload them as private files, used to symbolicate crash stack traces',
+      default: false,
+    }),
   };
   private sanitizeFlags(flags: any): {
     platform: RequestedPlatform;
@@ -68,6 +106,9 @@ export default class Publish extends Command {
     disableRepositoryCheck: boolean;
     outputDir: string;
     providedDeprecatedChannel?: string;
+    schedule: UpdateSchedule;
+    description: UpdateDescription;
+    sourceMaps: boolean;
   } {
     return {
       disableRepositoryCheck: flags.disableRepositoryCheck,
@@ -76,6 +117,13 @@ export default class Publish extends Command {
       nonInteractive: flags.nonInteractive,
       outputDir: flags.outputDir,
       providedDeprecatedChannel: flags.channel,
+      schedule: { activateAt: flags.activateAt, expireAt: flags.expireAt },
+      description: {
+        message: flags.message,
+        metadata: parseMetadataFlags(flags.metadata),
+        manifestFields: flags.manifestField,
+      },
+      sourceMaps: flags.sourceMaps,
     };
   }
   public async run(): Promise<void> {
@@ -93,6 +141,9 @@ export default class Publish extends Command {
       outputDir,
       providedDeprecatedChannel,
       disableRepositoryCheck,
+      schedule,
+      description,
+      sourceMaps,
     } = this.sanitizeFlags(flags);
     if (!branch) {
       Log.error('Branch name is required');
@@ -195,13 +246,17 @@ export default class Publish extends Command {
     const exportSpinner = ora('📦 Exporting project files...').start();
     try {
       await spawnAsync('rm', ['-rf', outputDir], { cwd: projectDir });
-      const { stdout } = await spawnAsync('npx', ['expo', 'export', '--output-dir', outputDir], {
-        cwd: projectDir,
-        env: {
-          ...process.env,
-          EXPO_NO_DOTENV: '1',
-        },
-      });
+      const { stdout } = await spawnAsync(
+        'npx',
+        ['expo', 'export', '--output-dir', outputDir, ...(sourceMaps ? ['--source-maps'] : [])],
+        {
+          cwd: projectDir,
+          env: {
+            ...process.env,
+            EXPO_NO_DOTENV: '1',
+          },
+        }
+      );
       exportSpinner.succeed('🚀 Project exported successfully');
       Log.withInfo(stdout);
     } catch (e) {
@@ -228,6 +283,15 @@ export default class Publish extends Command {
       uploadFilesSpinner.fail('No files to upload');
       process.exit(1);
     }
+    // Source maps are not in fileNames, the server stores them as private files never served
+    const sourceMapPaths = sourceMaps
+      ? computeSourceMaps(projectDir, outputDir, platform || RequestedPlatform.All)
+      : {};
+    const sourceMapFiles = Object.values(sourceMapPaths).map(sourceMapPath => ({
+      path: sourceMapPath,
+      name: path.basename(sourceMapPath),
+      ext: 'map',
+    }));
     let uploadUrls: {
       uploadRequests: RequestUploadUrlItem[];
       updateId: string;
@@ -235,27 +299,52 @@ export default class Publish extends Command {
       runtimeVersion: string;
     }[] = [];
     try {
-      uploadUrls = await Promise.all(
-        runtimeVersions.map(async ({ runtimeVersion, platform }) => {
-          if (!runtimeVersion) {
-            throw new Error('Runtime version is not resolved');
-          }
-          return {
-            ...(await requestUploadUrls({
-              body: {
-                fileNames: files.map(file => file.path),
-              },
-              requestUploadUrl: `${serverUrl}/requestUploadUrl/${branch}`,
-              auth: credentials,
+      // Several platforms are published as an update group, served together once all are uploaded
+      if (runtimeVersions.length > 1) {
+        const group = await requestUploadGroup({
+          body: {
+            fileNames: files.map(file => file.path),
+            sourceMaps: sourceMapPaths,
+            ...description,
+          },
+          requestUploadGroupUrl: `${serverUrl}/requestUploadGroup/${branch}`,
+          auth: credentials,
+          updates: runtimeVersions.map(({ runtimeVersion, platform }) => {
+            if (!runtimeVersion) {
+              throw new Error('Runtime version is not resolved');
+            }
+            return { runtimeVersion, platform };
+          }),
+          commitHash,
+          schedule,
+        });
+        uploadUrls = group.updates;
+      } else {
+        uploadUrls = await Promise.all(
+          runtimeVersions.map(async ({ runtimeVersion, platform }) => {
+            if (!runtimeVersion) {
+              throw new Error('Runtime version is not resolved');
+            }
+            return {
+              ...(await requestUploadUrls({
+                body: {
+                  fileNames: files.map(file => file.path),
+                  sourceMaps: sourceMapPaths,
+                  ...description,
+                },
+                requestUploadUrl: `${serverUrl}/requestUploadUrl/${branch}`,
+                auth: credentials,
+                runtimeVersion,
+                platform,
+                commitHash,
+                schedule,
+              })),
               runtimeVersion,
               platform,
-              commitHash,
-            })),
-            runtimeVersion,
-            platform,
-          };
-        })
-      );
+            };
+          })
+        );
+      }
       const allItems = uploadUrls.flatMap(({ uploadRequests }) => uploadRequests);
       await Promise.all(
         allItems.map(async itm => {
@@ -286,7 +375,9 @@ export default class Publish extends Command {
             file.close();
             return;
           }
-          const findFile = files.find(f => f.path === itm.filePath || f.name === itm.fileName);
+          const findFile = [...files, ...sourceMapFiles].find(
+            f => f.path === itm.filePath || f.name === itm.fileName
+          );
           if (!findFile) {
             Log.error(`File ${itm.filePath} not found`);
             throw new Error(`File ${itm.filePath} not found`);
@@ -330,6 +421,11 @@ export default class Publish extends Command {
             },
           }
         );
+        // If response.status === 202 the branch is protected, the update waits for an approval
+        if (response.status === 202) {
+          Log.withInfo(`⏳ Update for ${platform} is pending approval on the dashboard`);
+          return 'pending';
+        }
         // If success and status code = 200
         if (response.ok) {
           Log.withInfo(`✅ Update ready for ${platform}`);
@@ -347,7 +443,8 @@ export default class Publish extends Command {
       })
     );
     const erroredUpdates = results.filter(result => result === 'error');
-    const hasSuccess = results.some(result => result === 'deployed');
+    const hasSuccess = results.some(result => result === 'deployed' || result === 'pending');
+    const hasPending = results.some(result => result === 'pending');
     const allIdentical = results.every(result => result === 'identical');
     if (allIdentical) {
       markAsFinishedSpinner.warn('⚠️ No changes found in the update, nothing to deploy');
@@ -364,7 +461,11 @@ export default class Publish extends Command {
     if (hasSuccess) {
       Log.withInfo(`🌿 Branch: \`${branch}\``);
       Log.withInfo(`⏳ Deployed at: \`${new Date().toUTCString()}\`\n`);
-      Log.withInfo('🔥 Your users will receive the latest update automatically!');
+      if (hasPending) {
+        Log.withInfo('🔒 The branch is protected, an approver has to approve the update first');
+      } else {
+        Log.withInfo('🔥 Your users will receive the latest update automatically!');
+      }
     }
   }
 }
@@ -31,14 +31,21 @@ export default class Publish extends Command {
       description: 'Name of the branch to point to',
       required: true,
     }),
+    'update-id': Flags.string({
+      description:
+        'ID of a previous update to serve again instead of the embedded update, requires a single platform',
+      required: false,
+    }),
   };
   private sanitizeFlags(flags: any): {
     platform: RequestedPlatform;
     branch: string;
+    updateId?: string;
   } {
     return {
       platform: flags.platform,
       branch: flags.branch,
+      updateId: flags['update-id'],
     };
   }
   public async run(): Promise<void> {
@@ -48,11 +55,15 @@ export default class Publish extends Command {
       process.exit(1);
     }
     const { flags } = await this.parse(Publish);
-    const { platform, branch } = this.sanitizeFlags(flags);
+    const { platform, branch, updateId } = this.sanitizeFlags(flags);
     if (!branch) {
       Log.error('Branch name is required');
       process.exit(1);
     }
+    if (updateId && platform === RequestedPlatform.All) {
+      Log.error('Update IDs are specific to a platform, please specify --platform ios or android');
+      process.exit(1);
+    }
     const vcsClient = resolveVcsClient(true);
     await vcsClient.ensureRepoExistsAsync();
     const commitHash = await vcsClient.getCommitHashAsync();
@@ -63,7 +74,9 @@ export default class Publish extends Command {
       process.exit(1);
     }
     const confirmed = await confirmAsync({
-      message: `Are you sure you want to publish a rollback to the branch ${branch} ?`,
+      message: updateId
+        ? `Are you sure you want to roll back the branch ${branch} to the update ${updateId} ?`
+        : `Are you sure you want to publish a rollback to the branch ${branch} ?`,
       name: 'export',
       type: 'confirm',
     });
@@ -75,7 +88,7 @@ export default class Publish extends Command {
     const privateConfig = await getPrivateExpoConfigAsync(projectDir, {
       env: process.env as Env,
     });
-    if (privateConfig?.updates?.disableAntiBrickingMeasures) {
+    if (!updateId && privateConfig?.updates?.disableAntiBrickingMeasures) {
       Log.error(
         'When using disableAntiBrickingMeasures, expo-updates is ignoring the embeded update of the app, please use republish command instead'
       );
@@ -141,7 +154,7 @@ export default class Publish extends Command {
     const erroredPlatforms: { platform: string; reason: string }[] = [];
     await Promise.all(
       runtimeVersions.map(async ({ runtimeVersion, platform }) => {
-        const endpoint = `${baseUrl}/rollback/${branch}?commitHash=${commitHash}&platform=${platform}&runtimeVersion=${runtimeVersion}`;
+        const endpoint = `${baseUrl}/rollback/${branch}?commitHash=${commitHash}&platform=${platform}&runtimeVersion=${runtimeVersion}${updateId ? `&updateId=${updateId}` : ''}`;
         const response = await fetchWithRetries(endpoint, {
           method: 'POST',
           headers: {
@@ -92,12 +92,86 @@ export function computeFilesRequests(
   return assets;
 }
 
+// findSourceMap returns the source map exported next to a bundle, e.g. index-abc.hbc.map or
+// index-abc.js.map for index-abc.hbc
+function findSourceMap(distRoot: string, bundle: string): string | undefined {
+  const bundleDir = path.dirname(bundle);
+  const stem = path.basename(bundle, path.extname(bundle));
+  if (!fs.existsSync(path.join(distRoot, bundleDir))) {
+    return undefined;
+  }
+  const candidates = fs
+    .readdirSync(path.join(distRoot, bundleDir))
+    .filter(file => file.endsWith('.map') && file.startsWith(stem));
+  const exact = candidates.find(file => file === `${path.basename(bundle)}.map`);
+  const found = exact ?? candidates[0];
+  return found ? path.join(bundleDir, found) : undefined;
+}
+
+// computeSourceMaps returns the source map of the bundle of each requested platform, uploaded as
+// private files of the update
+export function computeSourceMaps(
+  projectDir: string,
+  outputDir: string,
+  requestedPlatform: RequestedPlatform
+): Record<string, string> {
+  const distRoot = path.join(projectDir, outputDir);
+  const metadata = loadMetadata(distRoot);
+  const sourceMaps: Record<string, string> = {};
+  for (const platform of Object.keys(metadata.fileMetadata) as Platform[]) {
+    if (platform === 'web') {
+      continue;
+    }
+    if (requestedPlatform !== RequestedPlatform.All && requestedPlatform !== platform) {
+      continue;
+    }
+    const sourceMap = findSourceMap(distRoot, metadata.fileMetadata[platform].bundle);
+    if (!sourceMap) {
+      Log.warn(`No source map found for the ${platform} bundle`);
+      continue;
+    }
+    sourceMaps[platform] = sourceMap;
+  }
+  return sourceMaps;
+}
+
 export interface RequestUploadUrlItem {
   requestUploadUrl: string;
   fileName: string;
   filePath: string;
 }
 
+export interface UpdateSchedule {
+  activateAt?: string;
+  expireAt?: string;
+}
+
+export interface UpdateDescription {
+  message?: string;
+  metadata?: Record<string, string>;
+  manifestFields?: string[];
+}
+
+// parseMetadataFlags turns repeated key=value flags into the custom metadata of an update
+export function parseMetadataFlags(entries: string[] = []): Record<string, string> {
+  const metadata: Record<string, string> = {};
+  for (const entry of entries) {
+    const separator = entry.indexOf('=');
+    if (separator <= 0) {
+      throw new Error(`Invalid metadata "${entry}", expected key=value`);
+    }
+    metadata[entry.slice(0, separator)] = entry.slice(separator + 1);
+  }
+  return metadata;
+}
+
+function computeScheduleQuery(schedule?: UpdateSchedule): string {
+  return [
+    schedule?.activateAt ? `&activateAt=${encodeURIComponent(schedule.activateAt)}` : '',
+    schedule?.expireAt ? `&expireAt=${encodeURIComponent(schedule.expireAt)}` : '',
+  ].join('');
+}
+
 export async function requestUploadUrls({
   body,
   requestUploadUrl,
@@ -105,18 +179,20 @@ export async function requestUploadUrls({
   runtimeVersion,
   platform,
   commitHash,
+  schedule,
 }: {
-  body: { fileNames: string[] };
+  body: { fileNames: string[]; sourceMaps?: Record<string, string> } & UpdateDescription;
   requestUploadUrl: string;
   auth: ExpoCredentials;
   runtimeVersion: string;
   platform: string;
   commitHash?: string;
+  schedule?: UpdateSchedule;
 }): Promise<{ uploadRequests: RequestUploadUrlItem[]; updateId: string }> {
   const response = await fetchWithRetries(
     `${requestUploadUrl}?runtimeVersion=${runtimeVersion}&platform=${platform}&commitHash=${
       commitHash || ''
-    }`,
+    }${computeScheduleQuery(schedule)}`,
     {
       method: 'POST',
       headers: {
@@ -132,3 +208,44 @@ export async function requestUploadUrls({
   }
   return await response.json();
 }
+
+export async function requestUploadGroup({
+  body,
+  requestUploadGroupUrl,
+  auth,
+  updates,
+  commitHash,
+  schedule,
+}: {
+  body: { fileNames: string[]; sourceMaps?: Record<string, string> } & UpdateDescription;
+  requestUploadGroupUrl: string;
+  auth: ExpoCredentials;
+  updates: { platform: string; runtimeVersion: string }[];
+  commitHash?: string;
+  schedule?: UpdateSchedule;
+}): Promise<{
+  groupId: string;
+  updates: {
+    platform: string;
+    runtimeVersion: string;
+    updateId: string;
+    uploadRequests: RequestUploadUrlItem[];
+  }[];
+}> {
+  const response = await fetchWithRetries(
+    `${requestUploadGroupUrl}?commitHash=${commitHash || ''}${computeScheduleQuery(schedule)}`,
+    {
+      method: 'POST',
+      headers: {
+        ...getAuthExpoHeaders(auth),
+        'Content-Type': 'application/json',
+      },
+      body: JSON.stringify({ ...body, updates }),
+    }
+  );
+  if (!response.ok) {
+    const text = await response.text();
+    throw new Error(`Failed to request upload group: ${text}`);
+  }
+  return await response.json();
+}
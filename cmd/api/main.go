@@ -1,13 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"expo-open-ota/config"
+	"expo-open-ota/internal/health"
+	"expo-open-ota/internal/logging"
 	"expo-open-ota/internal/metrics"
 	"expo-open-ota/internal/migration"
 	infrastructure "expo-open-ota/internal/router"
+	"expo-open-ota/internal/tracing"
+	"expo-open-ota/internal/update"
+	"expo-open-ota/internal/webhooks"
 	"github.com/gorilla/handlers"
 	"log"
+	"log/slog"
 	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 import (
@@ -16,21 +27,75 @@ import (
 
 func init() {
 	config.LoadConfig()
+	logging.Init()
 	metrics.InitMetrics()
 }
 
+func newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              "0.0.0.0:" + config.GetPort(),
+		Handler:           handler,
+		ReadHeaderTimeout: config.GetDurationEnv("SERVER_READ_HEADER_TIMEOUT_MS", 10*time.Second),
+		ReadTimeout:       config.GetDurationEnv("SERVER_READ_TIMEOUT_MS", 2*time.Minute),
+		WriteTimeout:      config.GetDurationEnv("SERVER_WRITE_TIMEOUT_MS", 2*time.Minute),
+		IdleTimeout:       config.GetDurationEnv("SERVER_IDLE_TIMEOUT_MS", 2*time.Minute),
+	}
+}
+
+// shutdown fails readiness first, optionally waits for load balancers to notice, then drains
+// in-flight requests, background pre-warms and webhook deliveries before returning. Deliveries
+// still pending at the deadline are recorded as failed.
+func shutdown(server *http.Server) {
+	health.MarkShuttingDown()
+	if delay := config.GetDurationEnv("SHUTDOWN_DELAY_MS", 0); delay > 0 {
+		slog.Info("Waiting before draining connections", "delay", delay)
+		time.Sleep(delay)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.GetDurationEnv("SHUTDOWN_TIMEOUT_MS", 30*time.Second))
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Error draining connections", "error", err)
+	} else {
+		update.WaitPrewarms()
+	}
+	if err := webhooks.Wait(ctx); err != nil {
+		slog.Warn("Webhook deliveries still pending at shutdown were recorded as failed", "error", err)
+	}
+	slog.Info("Server stopped")
+}
+
 func main() {
+	shutdownTracing := tracing.InitTracing(context.Background())
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("Error shutting down tracing", "error", err)
+		}
+	}()
 	migration.RunMigrationsWithLock()
 	router := infrastructure.NewRouter()
-	log.Println("Server is running on port " + config.GetPort())
+	slog.Info("Server is running", "port", config.GetPort())
 	corsOptions := handlers.CORS(
 		handlers.AllowedHeaders([]string{"Authorization", "Content-Type"}),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
 		handlers.AllowedOrigins([]string{"*"}),
 		handlers.AllowCredentials(),
 	)
-	err := http.ListenAndServe("0.0.0.0:"+config.GetPort(), corsOptions(router))
-	if err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	server := newServer(corsOptions(router))
+	serverErrors := make(chan error, 1)
+	go func() {
+		serverErrors <- server.ListenAndServe()
+	}()
+
+	signals, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	select {
+	case err := <-serverErrors:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed to start: %v", err)
+		}
+	case <-signals.Done():
+		stop()
+		slog.Info("Shutdown signal received, draining connections")
+		shutdown(server)
 	}
 }
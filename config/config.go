@@ -5,6 +5,8 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -101,6 +103,7 @@ var DefaultEnvValues = map[string]string{
 	"JWT_SECRET":                  "",
 	"AWS_REGION":                  "eu-west-3",
 	"AWS_BASE_ENDPOINT":           "",
+	"CACHE_BOLT_PATH":             "./cache/expo-open-ota.db",
 }
 
 
@@ -115,3 +118,13 @@ func GetEnv(key string) string {
 	}
 	return value
 }
+
+// GetDurationEnv reads a duration expressed in milliseconds, falling back to defaultValue
+// when the variable is unset or not a positive integer.
+func GetDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value, err := strconv.Atoi(GetEnv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return time.Duration(value) * time.Millisecond
+}
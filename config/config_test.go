@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	testing2 "testing"
+	"time"
 )
 
 func setup(t *testing2.T) func() {
@@ -166,3 +167,15 @@ func TestTestMode(t *testing2.T) {
 	assert.True(t, testMode)
 }
 
+
+func TestGetDurationEnv(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("TEST_TIMEOUT_MS", "1500")
+	defer os.Unsetenv("TEST_TIMEOUT_MS")
+	assert.Equal(t, 1500*time.Millisecond, GetDurationEnv("TEST_TIMEOUT_MS", time.Second))
+	os.Setenv("TEST_TIMEOUT_MS", "invalid")
+	assert.Equal(t, time.Second, GetDurationEnv("TEST_TIMEOUT_MS", time.Second))
+	os.Setenv("TEST_TIMEOUT_MS", "0")
+	assert.Equal(t, time.Second, GetDurationEnv("TEST_TIMEOUT_MS", time.Second))
+}
@@ -0,0 +1,133 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/cache"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	dayLayout            = "2006-01-02"
+	defaultRetentionDays = 90
+	maxDays              = 365
+	unknownUpdate        = "unknown"
+)
+
+var (
+	now          = time.Now
+	isPersistent = cache.IsPersistent
+)
+
+// ErrNotPersistent is returned when the cache would lose the history on restart.
+var ErrNotPersistent = errors.New("adoption history requires a persistent cache, set CACHE_MODE to redis or bolt")
+
+type UpdateAdoption struct {
+	UpdateUUID string  `json:"updateUUID"`
+	Devices    int64   `json:"devices"`
+	Share      float64 `json:"share"`
+}
+
+type AdoptionPoint struct {
+	Date         string           `json:"date"`
+	TotalDevices int64            `json:"totalDevices"`
+	Updates      []UpdateAdoption `json:"updates"`
+}
+
+// Analytics keys are not scoped by server version so history survives upgrades.
+func ComputeDailyDevicesKey(day, branch, runtimeVersion, platform, updateUUID string) string {
+	return fmt.Sprintf("analytics:devices:%s:%s:%s:%s:%s", day, branch, runtimeVersion, platform, updateUUID)
+}
+
+func ComputeDailyUpdatesKey(day, branch, runtimeVersion, platform string) string {
+	return fmt.Sprintf("analytics:updates:%s:%s:%s:%s", day, branch, runtimeVersion, platform)
+}
+
+func getRetentionDays() int {
+	days, err := strconv.Atoi(config.GetEnv("ANALYTICS_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		return defaultRetentionDays
+	}
+	return days
+}
+
+// TrackManifestCheck records that the device checked for updates today while running the given update.
+// Only the published updates are tracked, other update UUIDs sent by clients are counted as unknown,
+// and nothing is recorded for a runtime version without updates.
+func TrackManifestCheck(ctx context.Context, clientId, branch, runtimeVersion, platform, updateUUID string, publishedUpdateUUIDs []string) {
+	if !isPersistent() || clientId == "" || branch == "" || runtimeVersion == "" || platform == "" || len(publishedUpdateUUIDs) == 0 {
+		return
+	}
+	if !slices.Contains(publishedUpdateUUIDs, updateUUID) {
+		updateUUID = unknownUpdate
+	}
+	day := now().UTC().Format(dayLayout)
+	ttl := getRetentionDays() * 24 * 3600
+	resolvedCache := cache.GetCache()
+	_ = resolvedCache.Sadd(ctx, ComputeDailyUpdatesKey(day, branch, runtimeVersion, platform), []string{updateUUID}, &ttl)
+	_ = resolvedCache.Pfadd(ctx, ComputeDailyDevicesKey(day, branch, runtimeVersion, platform, updateUUID), []string{clientId}, &ttl)
+}
+
+// GetAdoptionCurve returns, for each of the last days, the share of devices running each update.
+// An empty platform aggregates every platform.
+func GetAdoptionCurve(ctx context.Context, branch, runtimeVersion, platform string, days int) ([]AdoptionPoint, error) {
+	if !isPersistent() {
+		return nil, ErrNotPersistent
+	}
+	if days <= 0 {
+		days = 30
+	}
+	if days > maxDays {
+		days = maxDays
+	}
+	platforms := []string{platform}
+	if platform == "" {
+		platforms = []string{"ios", "android"}
+	}
+	resolvedCache := cache.GetCache()
+	today := now().UTC()
+	points := make([]AdoptionPoint, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, -i).Format(dayLayout)
+		devicesByUpdate := map[string]int64{}
+		var total int64
+		for _, p := range platforms {
+			updateUUIDs, err := resolvedCache.Smembers(ctx, ComputeDailyUpdatesKey(day, branch, runtimeVersion, p))
+			if err != nil {
+				return nil, err
+			}
+			for _, updateUUID := range updateUUIDs {
+				devices, err := resolvedCache.Pfcount(ctx, ComputeDailyDevicesKey(day, branch, runtimeVersion, p, updateUUID))
+				if err != nil {
+					return nil, err
+				}
+				devicesByUpdate[updateUUID] += devices
+				total += devices
+			}
+		}
+		point := AdoptionPoint{Date: day, TotalDevices: total, Updates: []UpdateAdoption{}}
+		for updateUUID, devices := range devicesByUpdate {
+			if devices == 0 {
+				continue
+			}
+			point.Updates = append(point.Updates, UpdateAdoption{
+				UpdateUUID: updateUUID,
+				Devices:    devices,
+				Share:      float64(devices) / float64(total),
+			})
+		}
+		sort.Slice(point.Updates, func(a, b int) bool {
+			if point.Updates[a].Devices == point.Updates[b].Devices {
+				return point.Updates[a].UpdateUUID < point.Updates[b].UpdateUUID
+			}
+			return point.Updates[a].Devices > point.Updates[b].Devices
+		})
+		points = append(points, point)
+	}
+	return points, nil
+}
@@ -0,0 +1,84 @@
+package analytics
+
+import (
+	"context"
+	"expo-open-ota/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testing2 "testing"
+	"time"
+)
+
+func TestGetAdoptionCurve(t *testing2.T) {
+	day := time.Date(2025, 5, 2, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return day.AddDate(0, 0, -1) }
+	isPersistent = func() bool { return true }
+	defer func() { now, isPersistent = time.Now, cache.IsPersistent }()
+	published := []string{"update-a", "update-b"}
+
+	TrackManifestCheck(context.Background(), "client-1", "adoption", "1", "ios", "update-a", published)
+	TrackManifestCheck(context.Background(), "client-2", "adoption", "1", "ios", "update-a", published)
+	TrackManifestCheck(context.Background(), "client-2", "adoption", "1", "ios", "update-a", published)
+
+	now = func() time.Time { return day }
+	TrackManifestCheck(context.Background(), "client-1", "adoption", "1", "ios", "update-b", published)
+	TrackManifestCheck(context.Background(), "client-2", "adoption", "1", "ios", "update-a", published)
+	TrackManifestCheck(context.Background(), "client-3", "adoption", "1", "android", "update-b", published)
+	TrackManifestCheck(context.Background(), "client-4", "adoption", "1", "android", "", published)
+
+	points, err := GetAdoptionCurve(context.Background(), "adoption", "1", "", 3)
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+
+	assert.Equal(t, "2025-04-30", points[0].Date)
+	assert.Equal(t, int64(0), points[0].TotalDevices)
+	assert.Empty(t, points[0].Updates)
+
+	assert.Equal(t, "2025-05-01", points[1].Date)
+	assert.Equal(t, int64(2), points[1].TotalDevices)
+	assert.Equal(t, []UpdateAdoption{{UpdateUUID: "update-a", Devices: 2, Share: 1}}, points[1].Updates)
+
+	assert.Equal(t, "2025-05-02", points[2].Date)
+	assert.Equal(t, int64(4), points[2].TotalDevices)
+	assert.Equal(t, []UpdateAdoption{
+		{UpdateUUID: "update-b", Devices: 2, Share: 0.5},
+		{UpdateUUID: "unknown", Devices: 1, Share: 0.25},
+		{UpdateUUID: "update-a", Devices: 1, Share: 0.25},
+	}, points[2].Updates)
+
+	iosPoints, err := GetAdoptionCurve(context.Background(), "adoption", "1", "ios", 1)
+	require.NoError(t, err)
+	require.Len(t, iosPoints, 1)
+	assert.Equal(t, int64(2), iosPoints[0].TotalDevices)
+}
+
+func TestTrackManifestCheckOnlyRecordsPublishedUpdates(t *testing2.T) {
+	isPersistent = func() bool { return true }
+	defer func() { isPersistent = cache.IsPersistent }()
+
+	TrackManifestCheck(context.Background(), "client-1", "spoofed", "1", "ios", "update-a", []string{"update-a"})
+	TrackManifestCheck(context.Background(), "client-2", "spoofed", "1", "ios", "made-up", []string{"update-a"})
+	TrackManifestCheck(context.Background(), "client-3", "spoofed", "404", "ios", "update-a", []string{})
+
+	points, err := GetAdoptionCurve(context.Background(), "spoofed", "1", "ios", 1)
+	require.NoError(t, err)
+	assert.Equal(t, []UpdateAdoption{
+		{UpdateUUID: "unknown", Devices: 1, Share: 0.5},
+		{UpdateUUID: "update-a", Devices: 1, Share: 0.5},
+	}, points[0].Updates)
+	updates, err := cache.GetCache().Smembers(context.Background(), ComputeDailyUpdatesKey(points[0].Date, "spoofed", "404", "ios"))
+	require.NoError(t, err)
+	assert.Empty(t, updates, "Expected nothing to be recorded for a runtime version without updates")
+}
+
+func TestAdoptionRequiresPersistentCache(t *testing2.T) {
+	isPersistent = func() bool { return false }
+	defer func() { isPersistent = cache.IsPersistent }()
+
+	TrackManifestCheck(context.Background(), "client-1", "volatile", "1", "ios", "update-a", []string{"update-a"})
+	_, err := GetAdoptionCurve(context.Background(), "volatile", "1", "ios", 1)
+	assert.ErrorIs(t, err, ErrNotPersistent)
+	updates, err := cache.GetCache().Smembers(context.Background(), ComputeDailyUpdatesKey(time.Now().UTC().Format(dayLayout), "volatile", "1", "ios"))
+	require.NoError(t, err)
+	assert.Empty(t, updates)
+}
@@ -1,11 +1,12 @@
 package assets
 
 import (
+	"context"
 	"expo-open-ota/internal/bucket"
 	"expo-open-ota/internal/cdn"
 	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/update"
-	"log"
+	"log/slog"
 	"mime"
 	"net/http"
 )
@@ -15,7 +16,6 @@ type AssetsRequest struct {
 	AssetName      string
 	RuntimeVersion string
 	Platform       string
-	RequestID      string
 }
 
 type AssetsResponse struct {
@@ -26,27 +26,30 @@ type AssetsResponse struct {
 	URL         string
 }
 
-func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *types.BucketFile, string, error) {
-	requestID := req.RequestID
-
+func getAssetMetadata(ctx context.Context, req AssetsRequest, returnAsset bool) (AssetsResponse, *types.BucketFile, string, error) {
 	if req.AssetName == "" {
-		log.Printf("[RequestID: %s] No asset name provided", requestID)
+		slog.WarnContext(ctx, "No asset name provided")
 		return AssetsResponse{StatusCode: http.StatusBadRequest, Body: []byte("No asset name provided")}, nil, "", nil
 	}
 
+	if update.IsPrivateFile(req.AssetName) {
+		slog.WarnContext(ctx, "Private asset requested", "asset", req.AssetName)
+		return AssetsResponse{StatusCode: http.StatusNotFound, Body: []byte("Asset not found")}, nil, "", nil
+	}
+
 	if req.Platform == "" || (req.Platform != "ios" && req.Platform != "android") {
-		log.Printf("[RequestID: %s] Invalid platform: %s", requestID, req.Platform)
+		slog.WarnContext(ctx, "Invalid platform", "platform", req.Platform)
 		return AssetsResponse{StatusCode: http.StatusBadRequest, Body: []byte("Invalid platform")}, nil, "", nil
 	}
 
 	if req.RuntimeVersion == "" {
-		log.Printf("[RequestID: %s] No runtime version provided", requestID)
+		slog.WarnContext(ctx, "No runtime version provided")
 		return AssetsResponse{StatusCode: http.StatusBadRequest, Body: []byte("No runtime version provided")}, nil, "", nil
 	}
 
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(req.Branch, req.RuntimeVersion, req.Platform)
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(ctx, req.Branch, req.RuntimeVersion, req.Platform)
 	if err != nil || lastUpdate == nil {
-		log.Printf("[RequestID: %s] No update found for runtimeVersion: %s", requestID, req.RuntimeVersion)
+		slog.WarnContext(ctx, "No update found", "runtimeVersion", req.RuntimeVersion, "branch", req.Branch)
 		return AssetsResponse{StatusCode: http.StatusNotFound, Body: []byte("No update found")}, nil, "", nil
 	}
 
@@ -62,9 +65,9 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 		}, nil, lastUpdate.UpdateId, nil
 	}
 
-	metadata, err := update.GetMetadata(*lastUpdate)
+	metadata, err := update.GetMetadata(ctx, *lastUpdate)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error getting metadata: %v", requestID, err)
+		slog.ErrorContext(ctx, "Error getting metadata", "error", err)
 		return AssetsResponse{StatusCode: http.StatusInternalServerError, Body: []byte("Error getting metadata")}, nil, "", nil
 	}
 
@@ -89,9 +92,9 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 	}
 
 	resolvedBucket := bucket.GetBucket()
-	asset, err := resolvedBucket.GetFile(*lastUpdate, req.AssetName)
+	asset, err := resolvedBucket.GetFile(ctx, *lastUpdate, req.AssetName)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error getting asset: %v", requestID, err)
+		slog.ErrorContext(ctx, "Error getting asset", "error", err)
 		return AssetsResponse{StatusCode: http.StatusInternalServerError, Body: []byte("Error getting asset")}, nil, "", nil
 	}
 
@@ -116,8 +119,8 @@ func getAssetMetadata(req AssetsRequest, returnAsset bool) (AssetsResponse, *typ
 	}, asset, lastUpdate.UpdateId, nil
 }
 
-func HandleAssetsWithFile(req AssetsRequest) (AssetsResponse, error) {
-	resp, asset, _, err := getAssetMetadata(req, true)
+func HandleAssetsWithFile(ctx context.Context, req AssetsRequest) (AssetsResponse, error) {
+	resp, asset, _, err := getAssetMetadata(ctx, req, true)
 	if err != nil {
 		return resp, err
 	}
@@ -129,7 +132,7 @@ func HandleAssetsWithFile(req AssetsRequest) (AssetsResponse, error) {
 	}
 
 	if asset == nil {
-		log.Printf("[RequestID: %s] Resolved file is nil", req.RequestID)
+		slog.ErrorContext(ctx, "Resolved file is nil")
 		return AssetsResponse{
 			StatusCode: http.StatusInternalServerError,
 			Body:       []byte("Resolved file is nil"),
@@ -139,7 +142,7 @@ func HandleAssetsWithFile(req AssetsRequest) (AssetsResponse, error) {
 	buffer, err := bucket.ConvertReadCloserToBytes(asset.Reader)
 	defer asset.Reader.Close()
 	if err != nil {
-		log.Printf("[RequestID: %s] Error converting asset to buffer: %v", req.RequestID, err)
+		slog.ErrorContext(ctx, "Error converting asset to buffer", "error", err)
 		return AssetsResponse{
 			StatusCode: http.StatusInternalServerError,
 			Body:       []byte("Error converting asset to buffer"),
@@ -150,8 +153,8 @@ func HandleAssetsWithFile(req AssetsRequest) (AssetsResponse, error) {
 	return resp, nil
 }
 
-func HandleAssetsWithURL(req AssetsRequest, resolvedCDN cdn.CDN) (AssetsResponse, error) {
-	resp, _, updateId, err := getAssetMetadata(req, false)
+func HandleAssetsWithURL(ctx context.Context, req AssetsRequest, resolvedCDN cdn.CDN) (AssetsResponse, error) {
+	resp, _, updateId, err := getAssetMetadata(ctx, req, false)
 	if err != nil {
 		return resp, err
 	}
@@ -161,9 +164,9 @@ func HandleAssetsWithURL(req AssetsRequest, resolvedCDN cdn.CDN) (AssetsResponse
 			Body:       resp.Body,
 		}, nil
 	}
-	resp.URL, err = resolvedCDN.ComputeRedirectionURLForAsset(req.Branch, req.RuntimeVersion, updateId, req.AssetName)
+	resp.URL, err = resolvedCDN.ComputeRedirectionURLForAsset(ctx, req.Branch, req.RuntimeVersion, updateId, req.AssetName)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error computing redirection URL: %v", req.RequestID, err)
+		slog.ErrorContext(ctx, "Error computing redirection URL", "error", err)
 		return AssetsResponse{
 			StatusCode: http.StatusInternalServerError,
 			Body:       []byte("Error computing redirection URL"),
@@ -0,0 +1,89 @@
+package assignment
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"expo-open-ota/internal/helpers"
+	"expo-open-ota/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// The server sends these headers in expo-server-defined-headers, expo-updates stores them and sends
+// them back with every following manifest request.
+const (
+	CohortHeader = "expo-open-ota-cohort"
+	BranchHeader = "expo-open-ota-branch"
+)
+
+// Assignment is the branch a client is served on a channel.
+type Assignment struct {
+	Branch string
+	// Cohort places the client in rollouts, a client is served a rollout branch when its cohort is
+	// below the rollout percentage.
+	Cohort float64
+}
+
+// CohortForClient derives a stable cohort in [0, 1) from the client ID. Clients without one get a
+// random cohort, kept once it is pinned.
+func CohortForClient(clientId string) float64 {
+	if clientId == "" {
+		clientId = uuid.NewString()
+	}
+	sum := sha256.Sum256([]byte(clientId))
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
+
+func parseCohort(value string) (float64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	cohort, err := strconv.ParseFloat(value, 64)
+	if err != nil || cohort < 0 || cohort >= 1 {
+		return 0, false
+	}
+	return cohort, true
+}
+
+// Resolve assigns the client of the request to a branch of the channel. The pinned cohort is reused
+// so that raising a rollout percentage only moves clients onto the rollout branch, and a client
+// pinned to a rollout branch stays on it while the rollout is mapped, even if the percentage drops.
+func Resolve(r *http.Request, mapping *services.ExpoChannelMapping) Assignment {
+	cohort, ok := parseCohort(r.Header.Get(CohortHeader))
+	if !ok {
+		cohort = CohortForClient(r.Header.Get("EAS-Client-ID"))
+	}
+	pinnedBranch := r.Header.Get(BranchHeader)
+	for _, rollout := range mapping.Rollouts {
+		if rollout.BranchName == pinnedBranch {
+			return Assignment{Branch: pinnedBranch, Cohort: cohort}
+		}
+	}
+	for _, rollout := range mapping.Rollouts {
+		if cohort < rollout.Percentage {
+			return Assignment{Branch: rollout.BranchName, Cohort: cohort}
+		}
+	}
+	return Assignment{Branch: mapping.BranchName, Cohort: cohort}
+}
+
+// Headers are the request headers pinning the assignment.
+func (a Assignment) Headers() map[string]string {
+	return map[string]string{
+		CohortHeader: strconv.FormatFloat(a.Cohort, 'f', -1, 64),
+		BranchHeader: a.Branch,
+	}
+}
+
+func (a Assignment) ServerDefinedHeaders() string {
+	return helpers.FormatStructuredDictionary(a.Headers())
+}
+
+// ManifestFilters ties the served manifest to the assigned branch, so that a client assigned to
+// another branch stops launching it. expo-updates only filters on keys of the manifest metadata,
+// which holds the branch but not the cohort.
+func (a Assignment) ManifestFilters() string {
+	return helpers.FormatStructuredDictionary(map[string]string{"branch": a.Branch})
+}
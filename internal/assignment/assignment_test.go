@@ -0,0 +1,58 @@
+package assignment
+
+import (
+	"expo-open-ota/internal/services"
+	"net/http/httptest"
+	testing2 "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var rolloutMapping = &services.ExpoChannelMapping{
+	BranchName: "production",
+	Rollouts:   []services.ExpoBranchRollout{{BranchName: "canary", Percentage: 0.2}},
+}
+
+func resolve(headers map[string]string, mapping *services.ExpoChannelMapping) Assignment {
+	r := httptest.NewRequest("GET", "/manifest", nil)
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+	return Resolve(r, mapping)
+}
+
+func TestCohortForClient(t *testing2.T) {
+	cohort := CohortForClient("client-a")
+	assert.Equal(t, cohort, CohortForClient("client-a"))
+	assert.NotEqual(t, cohort, CohortForClient("client-b"))
+	assert.GreaterOrEqual(t, cohort, 0.0)
+	assert.Less(t, cohort, 1.0)
+}
+
+func TestResolveFollowsRolloutPercentage(t *testing2.T) {
+	assert.Equal(t, Assignment{Branch: "canary", Cohort: 0.1}, resolve(map[string]string{CohortHeader: "0.1"}, rolloutMapping))
+	assert.Equal(t, Assignment{Branch: "production", Cohort: 0.5}, resolve(map[string]string{CohortHeader: "0.5"}, rolloutMapping))
+	assert.Equal(t, "production", resolve(map[string]string{CohortHeader: "0.1"}, &services.ExpoChannelMapping{BranchName: "production"}).Branch)
+}
+
+func TestResolveIgnoresInvalidCohort(t *testing2.T) {
+	assigned := resolve(map[string]string{CohortHeader: "1.5", "EAS-Client-ID": "client-a"}, rolloutMapping)
+	assert.Equal(t, CohortForClient("client-a"), assigned.Cohort)
+}
+
+func TestResolveKeepsPinnedRolloutBranch(t *testing2.T) {
+	pinned := map[string]string{CohortHeader: "0.5", BranchHeader: "canary"}
+	assert.Equal(t, "canary", resolve(pinned, rolloutMapping).Branch, "Expected the pin to survive a lower percentage")
+	assert.Equal(t, "production", resolve(pinned, &services.ExpoChannelMapping{BranchName: "production"}).Branch, "Expected the pin to be dropped once the rollout ends")
+	assert.Equal(t, "canary", resolve(map[string]string{CohortHeader: "0.1", BranchHeader: "production"}, rolloutMapping).Branch, "Expected a raised percentage to move clients onto the rollout")
+}
+
+func TestServerDefinedHeaders(t *testing2.T) {
+	assigned := Assignment{Branch: `my "branch"`, Cohort: 0.25}
+	assert.Equal(t, `expo-open-ota-branch="my \"branch\"", expo-open-ota-cohort="0.25"`, assigned.ServerDefinedHeaders())
+}
+
+func TestManifestFilters(t *testing2.T) {
+	assigned := Assignment{Branch: "canary", Cohort: 0.25}
+	assert.Equal(t, `branch="canary"`, assigned.ManifestFilters())
+}
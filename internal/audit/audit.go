@@ -0,0 +1,150 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	"fmt"
+	"log/slog"
+	"math"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const legacyAuditLogFile = ".auditlog"
+
+type Action string
+
+const (
+	CrashGuardHalt     Action = "crashGuard.halt"
+	CrashGuardRollback Action = "crashGuard.rollback"
+	RollbackToUpdate   Action = "update.rollbackToUpdate"
+	Promote            Action = "update.promote"
+	ApproveUpdate      Action = "update.approve"
+	RejectUpdate       Action = "update.reject"
+	ProtectBranch      Action = "branch.protect"
+)
+
+type Entry struct {
+	Action         Action            `json:"action"`
+	Actor          string            `json:"actor"`
+	Branch         string            `json:"branch,omitempty"`
+	RuntimeVersion string            `json:"runtimeVersion,omitempty"`
+	Platform       string            `json:"platform,omitempty"`
+	UpdateId       string            `json:"updateId,omitempty"`
+	Details        map[string]string `json:"details,omitempty"`
+	CreatedAt      string            `json:"createdAt"`
+}
+
+// entriesFolder holds one object per entry. Names start with the time of the entry inverted, so
+// that listing them in ascending order returns the newest entries first.
+const entriesFolder = "auditlog"
+
+// Page is a page of audit log entries, NextCursor being empty on the last page.
+type Page struct {
+	Entries    []Entry
+	NextCursor string
+}
+
+func computeEntryName(createdAt time.Time) string {
+	return fmt.Sprintf("%019d-%s.json", math.MaxInt64-createdAt.UnixNano(), uuid.NewString())
+}
+
+// Record stores the entry as its own object at the root of the bucket, so that instances
+// recording concurrently never overwrite each other.
+func Record(ctx context.Context, entry Entry) error {
+	now := time.Now().UTC()
+	if entry.CreatedAt == "" {
+		entry.CreatedAt = now.Format(time.RFC3339)
+	}
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return bucket.GetBucket().UploadRootFile(ctx, path.Join(entriesFolder, computeEntryName(now)), bytes.NewReader(content))
+}
+
+// GetEntries returns a page of at most limit audit log entries for the given branch, newest
+// first, starting after cursor. An empty branch returns every entry. Entries of the legacy single
+// file log are returned on the last page.
+func GetEntries(ctx context.Context, branch string, cursor string, limit int) (Page, error) {
+	page := Page{Entries: make([]Entry, 0, limit)}
+	resolvedBucket := bucket.GetBucket()
+	for {
+		names, err := resolvedBucket.ListRootFiles(ctx, entriesFolder, cursor, limit)
+		if err != nil {
+			return Page{}, err
+		}
+		for _, name := range names {
+			cursor = name
+			entry, err := readEntry(ctx, name)
+			if err != nil {
+				return Page{}, err
+			}
+			if entry == nil || (branch != "" && entry.Branch != branch) {
+				continue
+			}
+			page.Entries = append(page.Entries, *entry)
+			if len(page.Entries) == limit {
+				page.NextCursor = cursor
+				return page, nil
+			}
+		}
+		if len(names) < limit {
+			break
+		}
+	}
+	legacyEntries, err := readLegacyEntries(ctx)
+	if err != nil {
+		return Page{}, err
+	}
+	for i := len(legacyEntries) - 1; i >= 0; i-- {
+		if branch == "" || legacyEntries[i].Branch == branch {
+			page.Entries = append(page.Entries, legacyEntries[i])
+		}
+	}
+	return page, nil
+}
+
+func readEntry(ctx context.Context, name string) (*Entry, error) {
+	file, err := bucket.GetBucket().GetRootFile(ctx, path.Join(entriesFolder, name))
+	if err != nil || file == nil {
+		return nil, err
+	}
+	defer file.Reader.Close()
+	var entry Entry
+	if err := json.NewDecoder(file.Reader).Decode(&entry); err != nil {
+		slog.WarnContext(ctx, "Skipping malformed audit log entry", "name", name, "error", err)
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// readLegacyEntries reads the single file the audit log was kept in before entries were stored
+// as their own objects.
+func readLegacyEntries(ctx context.Context) ([]Entry, error) {
+	file, err := bucket.GetBucket().GetRootFile(ctx, legacyAuditLogFile)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, nil
+	}
+	defer file.Reader.Close()
+	var entries []Entry
+	scanner := bufio.NewScanner(file.Reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			slog.WarnContext(ctx, "Skipping malformed audit log entry", "error", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"crypto/subtle"
 	"errors"
 	"expo-open-ota/config"
 	"expo-open-ota/internal/services"
@@ -23,7 +24,59 @@ func isPasswordValid(password string) bool {
 		fmt.Errorf("admin password is not set, all requests will be rejected")
 		return false
 	}
-	return password == getAdminPassword()
+	return passwordsMatch(password, adminPassword)
+}
+
+func passwordsMatch(given string, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// authenticate returns the identity of the credentials, an empty username being the admin login.
+func authenticate(username string, password string) (*Identity, error) {
+	if username == "" {
+		if !isPasswordValid(password) {
+			return nil, errors.New("invalid password")
+		}
+		return &Identity{Name: AdminUsername, Role: RoleAdmin}, nil
+	}
+	user, ok := getDashboardUsers()[username]
+	if !ok || !passwordsMatch(password, user.password) {
+		return nil, errors.New("invalid credentials")
+	}
+	return &Identity{Name: username, Role: user.role}, nil
+}
+
+// identityFromClaims returns the identity of a token. Tokens issued before users existed carry no
+// name nor role, they get an identity without role that can't approve nor administrate.
+func identityFromClaims(claims jwt.MapClaims) Identity {
+	name, _ := claims["name"].(string)
+	role, _ := claims["role"].(string)
+	if name == "" || role == "" {
+		return Identity{Name: name}
+	}
+	return Identity{Name: name, Role: Role(role)}
+}
+
+// checkIdentity verifies that the identity of a token still matches the configuration, so users
+// removed from DASHBOARD_USERS or given another role can't keep refreshing their tokens.
+func checkIdentity(identity Identity) error {
+	if identity.Name == "" || identity.Role == "" {
+		return errors.New("token has no identity")
+	}
+	if identity.Name == AdminUsername && identity.Role == RoleAdmin {
+		if getAdminPassword() == "" {
+			return errors.New("admin login is disabled")
+		}
+		return nil
+	}
+	user, ok := getDashboardUsers()[identity.Name]
+	if !ok {
+		return errors.New("user no longer exists")
+	}
+	if user.role != identity.Role {
+		return errors.New("user role has changed")
+	}
+	return nil
 }
 
 type AuthResponse struct {
@@ -35,12 +88,14 @@ func NewAuth() *Auth {
 	return &Auth{Secret: config.GetEnv("JWT_SECRET")}
 }
 
-func (a *Auth) generateAuthToken() (*string, error) {
+func (a *Auth) generateAuthToken(identity Identity) (*string, error) {
 	token, err := services.GenerateJWTToken(a.Secret, jwt.MapClaims{
 		"sub":  "admin-dashboard",
 		"exp":  time.Now().Add(time.Hour * 2).Unix(),
 		"iat":  time.Now().Unix(),
 		"type": "token",
+		"name": identity.Name,
+		"role": string(identity.Role),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error while generating the jwt token: %w", err)
@@ -48,12 +103,14 @@ func (a *Auth) generateAuthToken() (*string, error) {
 	return &token, nil
 }
 
-func (a *Auth) generateRefreshToken() (*string, error) {
+func (a *Auth) generateRefreshToken(identity Identity) (*string, error) {
 	refreshToken, err := services.GenerateJWTToken(a.Secret, jwt.MapClaims{
 		"sub":  "admin-dashboard",
 		"exp":  time.Now().Add(time.Hour * 24 * 7).Unix(),
 		"iat":  time.Now().Unix(),
 		"type": "refreshToken",
+		"name": identity.Name,
+		"role": string(identity.Role),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error while generating the jwt token: %w", err)
@@ -62,14 +119,20 @@ func (a *Auth) generateRefreshToken() (*string, error) {
 }
 
 func (a *Auth) LoginWithPassword(password string) (*AuthResponse, error) {
-	if !isPasswordValid(password) {
-		return nil, errors.New("invalid password")
+	return a.Login("", password)
+}
+
+// Login authenticates a dashboard user of DASHBOARD_USERS, or the admin when username is empty.
+func (a *Auth) Login(username string, password string) (*AuthResponse, error) {
+	identity, err := authenticate(username, password)
+	if err != nil {
+		return nil, err
 	}
-	token, err := a.generateAuthToken()
+	token, err := a.generateAuthToken(*identity)
 	if err != nil {
 		return nil, err
 	}
-	refreshToken, err := a.generateRefreshToken()
+	refreshToken, err := a.generateRefreshToken(*identity)
 	if err != nil {
 		return nil, err
 	}
@@ -95,6 +158,15 @@ func (a *Auth) ValidateToken(tokenString string) (*jwt.Token, error) {
 	return token, nil
 }
 
+// IdentityFromToken returns the dashboard user a validated token was issued to.
+func IdentityFromToken(token *jwt.Token) Identity {
+	claims, ok := token.Claims.(*jwt.MapClaims)
+	if !ok {
+		return identityFromClaims(jwt.MapClaims{})
+	}
+	return identityFromClaims(*claims)
+}
+
 func (a *Auth) RefreshToken(tokenString string) (*AuthResponse, error) {
 	claims := jwt.MapClaims{}
 	_, err := services.DecodeAndExtractJWTToken(a.Secret, tokenString, &claims)
@@ -107,11 +179,15 @@ func (a *Auth) RefreshToken(tokenString string) (*AuthResponse, error) {
 	if claims["sub"] != "admin-dashboard" {
 		return nil, errors.New("invalid token subject")
 	}
-	newToken, err := a.generateAuthToken()
+	identity := identityFromClaims(claims)
+	if err := checkIdentity(identity); err != nil {
+		return nil, err
+	}
+	newToken, err := a.generateAuthToken(identity)
 	if err != nil {
 		return nil, err
 	}
-	refreshToken, err := a.generateRefreshToken()
+	refreshToken, err := a.generateRefreshToken(identity)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"expo-open-ota/config"
+	"strings"
+)
+
+type Role string
+
+const (
+	// RoleAdmin is the role of the ADMIN_PASSWORD login, it can do everything.
+	RoleAdmin Role = "admin"
+	// RoleApprover can approve or reject the updates uploaded to protected branches.
+	RoleApprover Role = "approver"
+	// RoleMember can use the dashboard without approving updates.
+	RoleMember Role = "member"
+)
+
+// AdminUsername is the identity of the ADMIN_PASSWORD login.
+const AdminUsername = "admin"
+
+// Identity is who performs an authenticated /api request. Requests authenticated with Expo auth
+// carry the Expo username and no role.
+type Identity struct {
+	Name string `json:"name"`
+	Role Role   `json:"role,omitempty"`
+}
+
+func (i Identity) CanApprove() bool {
+	return i.Role == RoleAdmin || i.Role == RoleApprover
+}
+
+func (i Identity) IsAdmin() bool {
+	return i.Role == RoleAdmin
+}
+
+type dashboardUser struct {
+	password string
+	role     Role
+}
+
+func isValidRole(role Role) bool {
+	return role == RoleAdmin || role == RoleApprover || role == RoleMember
+}
+
+// getDashboardUsers parses DASHBOARD_USERS, a comma separated list of username:role:password
+// entries. The password comes last so that it may contain colons, malformed entries are ignored.
+func getDashboardUsers() map[string]dashboardUser {
+	users := map[string]dashboardUser{}
+	for _, entry := range strings.Split(config.GetEnv("DASHBOARD_USERS"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" || !isValidRole(Role(parts[1])) {
+			continue
+		}
+		users[parts[0]] = dashboardUser{password: parts[2], role: Role(parts[1])}
+	}
+	return users
+}
+
+type identityContextKey struct{}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the identity the auth middleware attached to the request.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(Identity)
+	return identity, ok
+}
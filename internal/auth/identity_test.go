@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	testing2 "testing"
+)
+
+func TestGetDashboardUsers(t *testing2.T) {
+	os.Setenv("DASHBOARD_USERS", "alice:approver:pass:with:colons, bob:member:secret,eve:owner:secret,broken")
+	defer os.Unsetenv("DASHBOARD_USERS")
+	users := getDashboardUsers()
+	require.Len(t, users, 2)
+	assert.Equal(t, dashboardUser{password: "pass:with:colons", role: RoleApprover}, users["alice"])
+	assert.Equal(t, dashboardUser{password: "secret", role: RoleMember}, users["bob"])
+}
+
+func TestLoginCarriesIdentity(t *testing2.T) {
+	os.Setenv("DASHBOARD_USERS", "alice:approver:secret")
+	os.Setenv("ADMIN_PASSWORD", "admin")
+	defer os.Unsetenv("DASHBOARD_USERS")
+	defer os.Unsetenv("ADMIN_PASSWORD")
+	a := &Auth{Secret: "test_jwt_secret"}
+
+	response, err := a.Login("alice", "secret")
+	require.NoError(t, err)
+	token, err := a.ValidateToken(response.Token)
+	require.NoError(t, err)
+	assert.Equal(t, Identity{Name: "alice", Role: RoleApprover}, IdentityFromToken(token))
+
+	refreshed, err := a.RefreshToken(response.RefreshToken)
+	require.NoError(t, err)
+	token, err = a.ValidateToken(refreshed.Token)
+	require.NoError(t, err)
+	assert.Equal(t, Identity{Name: "alice", Role: RoleApprover}, IdentityFromToken(token), "Expected the identity to survive a refresh")
+
+	response, err = a.Login("", "admin")
+	require.NoError(t, err)
+	token, err = a.ValidateToken(response.Token)
+	require.NoError(t, err)
+	assert.Equal(t, Identity{Name: AdminUsername, Role: RoleAdmin}, IdentityFromToken(token))
+
+	_, err = a.Login("alice", "admin")
+	assert.Error(t, err)
+	_, err = a.Login("mallory", "secret")
+	assert.Error(t, err)
+}
+
+func TestRefreshRechecksDashboardUsers(t *testing2.T) {
+	os.Setenv("DASHBOARD_USERS", "alice:approver:secret")
+	defer os.Unsetenv("DASHBOARD_USERS")
+	a := &Auth{Secret: "test_jwt_secret"}
+	response, err := a.Login("alice", "secret")
+	require.NoError(t, err)
+
+	os.Setenv("DASHBOARD_USERS", "alice:member:secret")
+	_, err = a.RefreshToken(response.RefreshToken)
+	assert.Error(t, err, "Expected a demoted user not to keep their role on refresh")
+
+	os.Setenv("DASHBOARD_USERS", "bob:approver:secret")
+	_, err = a.RefreshToken(response.RefreshToken)
+	assert.Error(t, err, "Expected a removed user not to be able to refresh")
+}
+
+func TestClaimlessTokenIsNotAdmin(t *testing2.T) {
+	identity := identityFromClaims(jwt.MapClaims{"sub": "admin-dashboard", "type": "token"})
+	assert.False(t, identity.CanApprove())
+	assert.False(t, identity.IsAdmin())
+	assert.Error(t, checkIdentity(identity))
+}
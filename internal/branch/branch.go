@@ -1,17 +1,18 @@
 package branch
 
 import (
+	"context"
 	"expo-open-ota/internal/helpers"
 	"expo-open-ota/internal/services"
 )
 
-func UpsertBranch(branch string) error {
-	branches, err := services.FetchExpoBranches()
+func UpsertBranch(ctx context.Context, branch string) error {
+	branches, err := services.FetchExpoBranches(ctx)
 	if err != nil {
 		return err
 	}
 	if !helpers.StringInSlice(branch, branches) {
-		return services.CreateBranch(branch)
+		return services.CreateBranch(ctx, branch)
 	}
 	return nil
 }
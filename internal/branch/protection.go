@@ -0,0 +1,81 @@
+package branch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/version"
+	"fmt"
+	"path"
+)
+
+const ProtectionFileName = "branch-protection.json"
+
+// protectionCacheTTL bounds how long a protection edited directly in the bucket takes to apply.
+const protectionCacheTTL = 1800
+
+// Protection holds the branch protection settings of a branch. Updates uploaded to a protected
+// branch are pending until a dashboard approver approves them.
+type Protection struct {
+	Protected bool `json:"protected"`
+}
+
+func ComputeProtectionCacheKey(branch string) string {
+	return fmt.Sprintf("branchProtection:%s:%s", version.Version, branch)
+}
+
+func protectionPath(branch string) string {
+	return path.Join(branch, ProtectionFileName)
+}
+
+// GetProtection returns the protection settings of the branch, unprotected when none are stored.
+func GetProtection(ctx context.Context, branch string) (*Protection, error) {
+	cache := cache2.GetCache()
+	cacheKey := ComputeProtectionCacheKey(branch)
+	content := cache.Get(ctx, cacheKey)
+	if content == "" {
+		file, err := bucket.GetBucket().GetRootFile(ctx, protectionPath(branch))
+		if err != nil {
+			return nil, err
+		}
+		content = "{}"
+		if file != nil {
+			var buffer bytes.Buffer
+			_, err = buffer.ReadFrom(file.Reader)
+			file.Reader.Close()
+			if err != nil {
+				return nil, err
+			}
+			content = buffer.String()
+		}
+		ttl := protectionCacheTTL
+		_ = cache.Set(ctx, cacheKey, content, &ttl)
+	}
+	var protection Protection
+	if err := json.Unmarshal([]byte(content), &protection); err != nil {
+		return nil, err
+	}
+	return &protection, nil
+}
+
+// IsBranchProtected reports whether the updates uploaded to the branch need an approval. A
+// protection that can't be read counts as protected, so that nothing skips the approval.
+func IsBranchProtected(ctx context.Context, branch string) bool {
+	protection, err := GetProtection(ctx, branch)
+	return err != nil || protection.Protected
+}
+
+// SetProtection stores the protection settings next to the branch.
+func SetProtection(ctx context.Context, branch string, protection *Protection) error {
+	content, err := json.Marshal(protection)
+	if err != nil {
+		return err
+	}
+	if err := bucket.GetBucket().UploadRootFile(ctx, protectionPath(branch), bytes.NewReader(content)); err != nil {
+		return err
+	}
+	cache2.GetCache().Delete(ctx, ComputeProtectionCacheKey(branch))
+	return nil
+}
@@ -2,6 +2,7 @@ package bucket
 
 import (
 	"bytes"
+	"context"
 	"expo-open-ota/config"
 	"expo-open-ota/internal/types"
 	"fmt"
@@ -18,17 +19,22 @@ type RuntimeVersionWithStats struct {
 }
 
 type Bucket interface {
-	GetBranches() ([]string, error)
-	GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error)
-	GetUpdates(branch string, runtimeVersion string) ([]types.Update, error)
-	GetFile(update types.Update, assetPath string) (*types.BucketFile, error)
-	RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string) (string, error)
-	UploadFileIntoUpdate(update types.Update, fileName string, file io.Reader) error
-	DeleteUpdateFolder(branch string, runtimeVersion string, updateId string) error
-	CreateUpdateFrom(previousUpdate *types.Update, newUpdateId string) (*types.Update, error)
-	RetrieveMigrationHistory() ([]string, error)
-	ApplyMigration(migrationId string) error
-	RemoveMigrationFromHistory(migrationId string) error
+	GetBranches(ctx context.Context) ([]string, error)
+	GetRuntimeVersions(ctx context.Context, branch string) ([]RuntimeVersionWithStats, error)
+	GetUpdates(ctx context.Context, branch string, runtimeVersion string) ([]types.Update, error)
+	GetFile(ctx context.Context, update types.Update, assetPath string) (*types.BucketFile, error)
+	RequestUploadUrlForFileUpdate(ctx context.Context, branch string, runtimeVersion string, updateId string, fileName string) (string, error)
+	UploadFileIntoUpdate(ctx context.Context, update types.Update, fileName string, file io.Reader) error
+	DeleteUpdateFolder(ctx context.Context, branch string, runtimeVersion string, updateId string) error
+	CreateUpdateFrom(ctx context.Context, previousUpdate *types.Update, newBranch string, newUpdateId string) (*types.Update, error)
+	RetrieveMigrationHistory(ctx context.Context) ([]string, error)
+	ApplyMigration(ctx context.Context, migrationId string) error
+	RemoveMigrationFromHistory(ctx context.Context, migrationId string) error
+	GetRootFile(ctx context.Context, filePath string) (*types.BucketFile, error)
+	UploadRootFile(ctx context.Context, filePath string, file io.Reader) error
+	// ListRootFiles returns, in ascending order, at most limit names of the files directly in a
+	// root folder that sort after startAfter.
+	ListRootFiles(ctx context.Context, folder string, startAfter string, limit int) ([]string, error)
 }
 
 type BucketType string
@@ -77,6 +83,7 @@ func GetBucket() Bucket {
 			default:
 				panic(fmt.Sprintf("Unknown bucket type: %s", bucketType))
 			}
+			bucketInstance = &tracedBucket{bucket: bucketInstance, bucketType: bucketType}
 		}
 	})
 	return bucketInstance
@@ -102,7 +109,7 @@ type FileUploadRequest struct {
 	FilePath         string `json:"filePath"`
 }
 
-func RequestUploadUrlsForFileUpdates(branch string, runtimeVersion string, updateId string, fileNames []string) ([]FileUploadRequest, error) {
+func RequestUploadUrlsForFileUpdates(ctx context.Context, branch string, runtimeVersion string, updateId string, fileNames []string) ([]FileUploadRequest, error) {
 	uniqueFileNames := make(map[string]struct{})
 	for _, fileName := range fileNames {
 		uniqueFileNames[fileName] = struct{}{}
@@ -119,7 +126,7 @@ func RequestUploadUrlsForFileUpdates(branch string, runtimeVersion string, updat
 	for fileName := range uniqueFileNames {
 		go func(fileName string) {
 			defer wg.Done()
-			requestUploadUrl, err := bucket.RequestUploadUrlForFileUpdate(branch, runtimeVersion, updateId, fileName)
+			requestUploadUrl, err := bucket.RequestUploadUrlForFileUpdate(ctx, branch, runtimeVersion, updateId, fileName)
 			if err != nil {
 				errChan <- err
 				return
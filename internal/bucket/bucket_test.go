@@ -2,11 +2,14 @@ package bucket
 
 import (
 	"bytes"
+	"context"
+	"expo-open-ota/internal/types"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"os"
 	testing2 "testing"
+	"time"
 )
 
 func setup(t *testing2.T) func() {
@@ -74,7 +77,8 @@ func TestGetS3Bucket(t *testing2.T) {
 	os.Setenv("STORAGE_MODE", "s3")
 	os.Setenv("S3_BUCKET_NAME", "test")
 	bucket := GetBucket()
-	assert.IsType(t, &S3Bucket{}, bucket)
+	assert.IsType(t, &tracedBucket{}, bucket)
+	assert.IsType(t, &S3Bucket{}, bucket.(*tracedBucket).bucket)
 }
 
 func TestGetLocalBucket(t *testing2.T) {
@@ -83,5 +87,37 @@ func TestGetLocalBucket(t *testing2.T) {
 	os.Setenv("STORAGE_MODE", "local")
 	os.Setenv("LOCAL_BUCKET_BASE_PATH", "test")
 	bucket := GetBucket()
-	assert.IsType(t, &LocalBucket{}, bucket)
+	assert.IsType(t, &tracedBucket{}, bucket)
+	assert.IsType(t, &LocalBucket{}, bucket.(*tracedBucket).bucket)
+}
+
+func TestOperationTimeoutFromEnv(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("BUCKET_OPERATION_TIMEOUT_MS", "250")
+	defer os.Unsetenv("BUCKET_OPERATION_TIMEOUT_MS")
+	ctx, cancel := withOperationTimeout(context.Background())
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(250*time.Millisecond), deadline, 100*time.Millisecond)
+}
+
+func TestFileContextReleasedOnClose(t *testing2.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	file, err := releaseWithFile(&types.BucketFile{Reader: io.NopCloser(bytes.NewReader([]byte("content")))}, nil, cancel)
+	assert.Nil(t, err)
+	assert.Nil(t, ctx.Err())
+	content, err := io.ReadAll(file.Reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "content", string(content))
+	assert.Nil(t, file.Reader.Close())
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+}
+
+func TestFileContextReleasedOnError(t *testing2.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := releaseWithFile(nil, fmt.Errorf("not found"), cancel)
+	assert.NotNil(t, err)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
 }
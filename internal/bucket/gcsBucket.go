@@ -2,6 +2,7 @@ package bucket
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
@@ -11,6 +12,7 @@ import (
 	"expo-open-ota/internal/types"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -84,7 +86,7 @@ func (b *GCSBucket) generateSignature(method, resource string, contentType strin
 	return authHeader, nil
 }
 
-func (b *GCSBucket) makeRequest(method, path string, body io.Reader) (*http.Response, error) {
+func (b *GCSBucket) makeRequest(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
 	var bodyBytes []byte
 	if body != nil {
 		var err error
@@ -118,7 +120,7 @@ func (b *GCSBucket) makeRequest(method, path string, body io.Reader) (*http.Resp
 	}
 
 	fullURL := b.BaseURL + path
-	req, err := http.NewRequest(method, fullURL, bytes.NewReader(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, bytes.NewReader(bodyBytes))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -135,13 +137,13 @@ func (b *GCSBucket) makeRequest(method, path string, body io.Reader) (*http.Resp
 	return client.Do(req)
 }
 
-func (b *GCSBucket) GetBranches() ([]string, error) {
+func (b *GCSBucket) GetBranches(ctx context.Context) ([]string, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
 
 	path := fmt.Sprintf("/%s/?delimiter=/", b.BucketName)
-	resp, err := b.makeRequest("GET", path, nil)
+	resp, err := b.makeRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error making request: %w", err)
 	}
@@ -169,13 +171,13 @@ func (b *GCSBucket) GetBranches() ([]string, error) {
 	return branches, nil
 }
 
-func (b *GCSBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error) {
+func (b *GCSBucket) GetRuntimeVersions(ctx context.Context, branch string) ([]RuntimeVersionWithStats, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
 
 	path := fmt.Sprintf("/%s/?prefix=%s/&delimiter=/", b.BucketName, url.QueryEscape(branch))
-	resp, err := b.makeRequest("GET", path, nil)
+	resp, err := b.makeRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error making request: %w", err)
 	}
@@ -201,7 +203,7 @@ func (b *GCSBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats
 
 				// Get stats for this runtime version
 				updatePath := fmt.Sprintf("/%s/?prefix=%s&delimiter=/", b.BucketName, url.QueryEscape(prefix.Prefix))
-				updateResp, err := b.makeRequest("GET", updatePath, nil)
+				updateResp, err := b.makeRequest(ctx, "GET", updatePath, nil)
 				if err != nil {
 					continue
 				}
@@ -248,7 +250,7 @@ func (b *GCSBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats
 	return runtimeVersions, nil
 }
 
-func (b *GCSBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
+func (b *GCSBucket) GetUpdates(ctx context.Context, branch string, runtimeVersion string) ([]types.Update, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
@@ -256,7 +258,7 @@ func (b *GCSBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Up
 	prefix := fmt.Sprintf("%s/%s/", branch, runtimeVersion)
 	path := fmt.Sprintf("/%s/?prefix=%s&delimiter=/", b.BucketName, url.QueryEscape(prefix))
 
-	resp, err := b.makeRequest("GET", path, nil)
+	resp, err := b.makeRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error making request: %w", err)
 	}
@@ -294,7 +296,7 @@ func (b *GCSBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Up
 	return updates, nil
 }
 
-func (b *GCSBucket) GetFile(update types.Update, assetPath string) (*types.BucketFile, error) {
+func (b *GCSBucket) GetFile(ctx context.Context, update types.Update, assetPath string) (*types.BucketFile, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
@@ -302,7 +304,7 @@ func (b *GCSBucket) GetFile(update types.Update, assetPath string) (*types.Bucke
 	key := fmt.Sprintf("%s/%s/%s/%s", update.Branch, update.RuntimeVersion, update.UpdateId, assetPath)
 	path := fmt.Sprintf("/%s/%s", b.BucketName, key)
 
-	resp, err := b.makeRequest("GET", path, nil)
+	resp, err := b.makeRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error making request: %w", err)
 	}
@@ -332,7 +334,7 @@ func (b *GCSBucket) GetFile(update types.Update, assetPath string) (*types.Bucke
 	}, nil
 }
 
-func (b *GCSBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string) (string, error) {
+func (b *GCSBucket) RequestUploadUrlForFileUpdate(ctx context.Context, branch string, runtimeVersion string, updateId string, fileName string) (string, error) {
 	if b.BucketName == "" {
 		return "", errors.New("BucketName not set")
 	}
@@ -356,15 +358,13 @@ func (b *GCSBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion
 	contentType := "application/octet-stream"
 	stringToSign := fmt.Sprintf("PUT\n\n%s\n%d\n%s", contentType, expirationUnix, resource)
 	
-	// Debug logging - keep until issue resolved
-	fmt.Printf("=== GCS SIGNATURE DEBUG ===\n")
-	fmt.Printf("Resource: %s\n", resource)
-	fmt.Printf("Expiration: %d\n", expirationUnix)
-	fmt.Printf("FileName: %s\n", fileName)
-	fmt.Printf("ContentType: %s\n", contentType)
-	fmt.Printf("StringToSign (quoted): %q\n", stringToSign)
-	fmt.Printf("StringToSign length: %d\n", len(stringToSign))
-	fmt.Printf("=========================\n")
+	slog.DebugContext(ctx, "Signing GCS upload URL",
+		"resource", resource,
+		"expiration", expirationUnix,
+		"fileName", fileName,
+		"contentType", contentType,
+		"stringToSign", stringToSign,
+	)
 	
 	// Calculate HMAC-SHA1 signature
 	h := hmac.New(sha1.New, []byte(b.SecretKey))
@@ -383,7 +383,7 @@ func (b *GCSBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion
 	return signedURL, nil
 }
 
-func (b *GCSBucket) UploadFileIntoUpdate(update types.Update, fileName string, file io.Reader) error {
+func (b *GCSBucket) UploadFileIntoUpdate(ctx context.Context, update types.Update, fileName string, file io.Reader) error {
 	if b.BucketName == "" {
 		return errors.New("BucketName not set")
 	}
@@ -391,7 +391,7 @@ func (b *GCSBucket) UploadFileIntoUpdate(update types.Update, fileName string, f
 	key := fmt.Sprintf("%s/%s/%s/%s", update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
 	path := fmt.Sprintf("/%s/%s", b.BucketName, key)
 
-	resp, err := b.makeRequest("PUT", path, file)
+	resp, err := b.makeRequest(ctx, "PUT", path, file)
 	if err != nil {
 		return fmt.Errorf("error making request: %w", err)
 	}
@@ -405,7 +405,7 @@ func (b *GCSBucket) UploadFileIntoUpdate(update types.Update, fileName string, f
 	return nil
 }
 
-func (b *GCSBucket) DeleteUpdateFolder(branch string, runtimeVersion string, updateId string) error {
+func (b *GCSBucket) DeleteUpdateFolder(ctx context.Context, branch string, runtimeVersion string, updateId string) error {
 	if b.BucketName == "" {
 		return errors.New("BucketName not set")
 	}
@@ -413,7 +413,7 @@ func (b *GCSBucket) DeleteUpdateFolder(branch string, runtimeVersion string, upd
 	prefix := fmt.Sprintf("%s/%s/%s/", branch, runtimeVersion, updateId)
 	path := fmt.Sprintf("/%s/?prefix=%s", b.BucketName, url.QueryEscape(prefix))
 
-	resp, err := b.makeRequest("GET", path, nil)
+	resp, err := b.makeRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return fmt.Errorf("error listing objects: %w", err)
 	}
@@ -433,7 +433,7 @@ func (b *GCSBucket) DeleteUpdateFolder(branch string, runtimeVersion string, upd
 	for _, obj := range result.Contents {
 		if obj.Key != "" {
 			objPath := fmt.Sprintf("/%s/%s", b.BucketName, obj.Key)
-			delResp, err := b.makeRequest("DELETE", objPath, nil)
+			delResp, err := b.makeRequest(ctx, "DELETE", objPath, nil)
 			if err != nil {
 				return fmt.Errorf("error deleting object %s: %w", obj.Key, err)
 			}
@@ -444,7 +444,7 @@ func (b *GCSBucket) DeleteUpdateFolder(branch string, runtimeVersion string, upd
 	return nil
 }
 
-func (b *GCSBucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId string) (*types.Update, error) {
+func (b *GCSBucket) CreateUpdateFrom(ctx context.Context, previousUpdate *types.Update, newBranch string, newUpdateId string) (*types.Update, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
@@ -454,16 +454,19 @@ func (b *GCSBucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId s
 	if previousUpdate.UpdateId == "" {
 		return nil, errors.New("previousUpdate.UpdateId is empty")
 	}
+	if newBranch == "" {
+		return nil, errors.New("newBranch is empty")
+	}
 	if newUpdateId == "" {
 		return nil, errors.New("newUpdateId is empty")
 	}
 
 	sourcePrefix := fmt.Sprintf("%s/%s/%s/", previousUpdate.Branch, previousUpdate.RuntimeVersion, previousUpdate.UpdateId)
-	targetPrefix := fmt.Sprintf("%s/%s/%s/", previousUpdate.Branch, previousUpdate.RuntimeVersion, newUpdateId)
+	targetPrefix := fmt.Sprintf("%s/%s/%s/", newBranch, previousUpdate.RuntimeVersion, newUpdateId)
 
 	// List objects in the source folder
 	path := fmt.Sprintf("/%s/?prefix=%s", b.BucketName, url.QueryEscape(sourcePrefix))
-	resp, err := b.makeRequest("GET", path, nil)
+	resp, err := b.makeRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error listing objects: %w", err)
 	}
@@ -487,13 +490,13 @@ func (b *GCSBucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId s
 
 		// Skip metadata files
 		relPath := strings.TrimPrefix(obj.Key, sourcePrefix)
-		if relPath == "update-metadata.json" || relPath == ".check" {
+		if relPath == "update-metadata.json" || relPath == ".check" || relPath == "halted" {
 			continue
 		}
 
 		// Get the source object
 		srcPath := fmt.Sprintf("/%s/%s", b.BucketName, obj.Key)
-		srcResp, err := b.makeRequest("GET", srcPath, nil)
+		srcResp, err := b.makeRequest(ctx, "GET", srcPath, nil)
 		if err != nil {
 			continue // Skip this object on error
 		}
@@ -502,7 +505,7 @@ func (b *GCSBucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId s
 			// Upload to new location
 			newKey := targetPrefix + relPath
 			dstPath := fmt.Sprintf("/%s/%s", b.BucketName, newKey)
-			dstResp, err := b.makeRequest("PUT", dstPath, srcResp.Body)
+			dstResp, err := b.makeRequest(ctx, "PUT", dstPath, srcResp.Body)
 			if err == nil {
 				dstResp.Body.Close()
 			}
@@ -515,20 +518,20 @@ func (b *GCSBucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId s
 		return nil, fmt.Errorf("error parsing update ID: %w", err)
 	}
 	return &types.Update{
-		Branch:         previousUpdate.Branch,
+		Branch:         newBranch,
 		RuntimeVersion: previousUpdate.RuntimeVersion,
 		UpdateId:       newUpdateId,
 		CreatedAt:      time.Duration(updateId) * time.Millisecond,
 	}, nil
 }
 
-func (b *GCSBucket) RetrieveMigrationHistory() ([]string, error) {
+func (b *GCSBucket) RetrieveMigrationHistory(ctx context.Context) ([]string, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
 
 	path := fmt.Sprintf("/%s/.migrationhistory", b.BucketName)
-	resp, err := b.makeRequest("GET", path, nil)
+	resp, err := b.makeRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error making request: %w", err)
 	}
@@ -561,12 +564,12 @@ func (b *GCSBucket) RetrieveMigrationHistory() ([]string, error) {
 	return migrations, nil
 }
 
-func (b *GCSBucket) ApplyMigration(migrationId string) error {
+func (b *GCSBucket) ApplyMigration(ctx context.Context, migrationId string) error {
 	if b.BucketName == "" {
 		return errors.New("BucketName not set")
 	}
 
-	migrationHistory, err := b.RetrieveMigrationHistory()
+	migrationHistory, err := b.RetrieveMigrationHistory(ctx)
 	if err != nil {
 		return fmt.Errorf("RetrieveMigrationHistory error: %w", err)
 	}
@@ -580,7 +583,7 @@ func (b *GCSBucket) ApplyMigration(migrationId string) error {
 
 	// Get current content
 	path := fmt.Sprintf("/%s/.migrationhistory", b.BucketName)
-	resp, err := b.makeRequest("GET", path, nil)
+	resp, err := b.makeRequest(ctx, "GET", path, nil)
 	var currentContent []byte
 	if err == nil && resp.StatusCode == 200 {
 		currentContent, _ = io.ReadAll(resp.Body)
@@ -593,7 +596,7 @@ func (b *GCSBucket) ApplyMigration(migrationId string) error {
 	newContent := append(currentContent, []byte(migrationId+"\n")...)
 
 	// Upload updated content
-	uploadResp, err := b.makeRequest("PUT", path, bytes.NewReader(newContent))
+	uploadResp, err := b.makeRequest(ctx, "PUT", path, bytes.NewReader(newContent))
 	if err != nil {
 		return fmt.Errorf("error uploading migration history: %w", err)
 	}
@@ -607,12 +610,12 @@ func (b *GCSBucket) ApplyMigration(migrationId string) error {
 	return nil
 }
 
-func (b *GCSBucket) RemoveMigrationFromHistory(migrationId string) error {
+func (b *GCSBucket) RemoveMigrationFromHistory(ctx context.Context, migrationId string) error {
 	if b.BucketName == "" {
 		return errors.New("BucketName not set")
 	}
 
-	migrationHistory, err := b.RetrieveMigrationHistory()
+	migrationHistory, err := b.RetrieveMigrationHistory(ctx)
 	if err != nil {
 		return fmt.Errorf("RetrieveMigrationHistory error: %w", err)
 	}
@@ -639,7 +642,7 @@ func (b *GCSBucket) RemoveMigrationFromHistory(migrationId string) error {
 
 	// Upload updated content
 	path := fmt.Sprintf("/%s/.migrationhistory", b.BucketName)
-	resp, err := b.makeRequest("PUT", path, bytes.NewReader(newContent))
+	resp, err := b.makeRequest(ctx, "PUT", path, bytes.NewReader(newContent))
 	if err != nil {
 		return fmt.Errorf("error uploading migration history: %w", err)
 	}
@@ -652,3 +655,94 @@ func (b *GCSBucket) RemoveMigrationFromHistory(migrationId string) error {
 
 	return nil
 }
+
+func (b *GCSBucket) GetRootFile(ctx context.Context, filePath string) (*types.BucketFile, error) {
+	if b.BucketName == "" {
+		return nil, errors.New("BucketName not set")
+	}
+
+	path := fmt.Sprintf("/%s/%s", b.BucketName, filePath)
+	resp, err := b.makeRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+
+	if resp.StatusCode == 404 {
+		resp.Body.Close()
+		return nil, nil
+	}
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("GCS API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var lastModified time.Time
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		if parsed, err := time.Parse(time.RFC1123, lm); err == nil {
+			lastModified = parsed
+		}
+	}
+
+	return &types.BucketFile{
+		Reader:    resp.Body,
+		CreatedAt: lastModified,
+	}, nil
+}
+
+func (b *GCSBucket) UploadRootFile(ctx context.Context, filePath string, file io.Reader) error {
+	if b.BucketName == "" {
+		return errors.New("BucketName not set")
+	}
+
+	path := fmt.Sprintf("/%s/%s", b.BucketName, filePath)
+	resp, err := b.makeRequest(ctx, "PUT", path, file)
+	if err != nil {
+		return fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("GCS API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+func (b *GCSBucket) ListRootFiles(ctx context.Context, folder string, startAfter string, limit int) ([]string, error) {
+	if b.BucketName == "" {
+		return nil, errors.New("BucketName not set")
+	}
+
+	prefix := folder + "/"
+	query := url.Values{}
+	query.Set("prefix", prefix)
+	query.Set("delimiter", "/")
+	query.Set("max-keys", strconv.Itoa(limit))
+	if startAfter != "" {
+		query.Set("marker", prefix+startAfter)
+	}
+	path := fmt.Sprintf("/%s/?%s", b.BucketName, query.Encode())
+	resp, err := b.makeRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("GCS API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result ListBucketResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing XML response: %w", err)
+	}
+	names := make([]string, 0, len(result.Contents))
+	for _, object := range result.Contents {
+		names = append(names, strings.TrimPrefix(object.Key, prefix))
+	}
+	return names, nil
+}
@@ -2,6 +2,7 @@ package bucket
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"expo-open-ota/config"
 	"expo-open-ota/internal/services"
@@ -25,7 +26,7 @@ type LocalBucket struct {
 	BasePath string
 }
 
-func (b *LocalBucket) DeleteUpdateFolder(branch string, runtimeVersion string, updateId string) error {
+func (b *LocalBucket) DeleteUpdateFolder(ctx context.Context, branch string, runtimeVersion string, updateId string) error {
 	if b.BasePath == "" {
 		return errors.New("BasePath not set")
 	}
@@ -33,7 +34,7 @@ func (b *LocalBucket) DeleteUpdateFolder(branch string, runtimeVersion string, u
 	return os.RemoveAll(dirPath)
 }
 
-func (b *LocalBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string) (string, error) {
+func (b *LocalBucket) RequestUploadUrlForFileUpdate(ctx context.Context, branch string, runtimeVersion string, updateId string, fileName string) (string, error) {
 	if b.BasePath == "" {
 		return "", errors.New("BasePath not set")
 	}
@@ -43,7 +44,7 @@ func (b *LocalBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersio
 		return "", err
 	}
 	token, err := services.GenerateJWTToken(config.GetEnv("JWT_SECRET"), jwt.MapClaims{
-		"sub":      services.FetchSelfExpoUsername(),
+		"sub":      services.FetchSelfExpoUsername(ctx),
 		"exp":      time.Now().Add(time.Minute * 10).Unix(),
 		"filePath": filepath.Join(dirPath, fileName),
 		"action":   "uploadLocalFile",
@@ -65,7 +66,7 @@ func (b *LocalBucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersio
 	return parsedURL.String(), nil
 }
 
-func (b *LocalBucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
+func (b *LocalBucket) GetUpdates(ctx context.Context, branch string, runtimeVersion string) ([]types.Update, error) {
 	if b.BasePath == "" {
 		return nil, errors.New("BasePath not set")
 	}
@@ -91,7 +92,7 @@ func (b *LocalBucket) GetUpdates(branch string, runtimeVersion string) ([]types.
 	return updates, nil
 }
 
-func (b *LocalBucket) GetFile(update types.Update, assetPath string) (*types.BucketFile, error) {
+func (b *LocalBucket) GetFile(ctx context.Context, update types.Update, assetPath string) (*types.BucketFile, error) {
 	if b.BasePath == "" {
 		return nil, errors.New("BasePath not set")
 	}
@@ -117,7 +118,7 @@ func (b *LocalBucket) GetFile(update types.Update, assetPath string) (*types.Buc
 		CreatedAt: info.ModTime(),
 	}, nil
 }
-func (b *LocalBucket) GetBranches() ([]string, error) {
+func (b *LocalBucket) GetBranches(ctx context.Context) ([]string, error) {
 	if b.BasePath == "" {
 		return nil, errors.New("BasePath not set")
 	}
@@ -134,7 +135,7 @@ func (b *LocalBucket) GetBranches() ([]string, error) {
 	return branches, nil
 }
 
-func (b *LocalBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error) {
+func (b *LocalBucket) GetRuntimeVersions(ctx context.Context, branch string) ([]RuntimeVersionWithStats, error) {
 	if b.BasePath == "" {
 		return nil, errors.New("BasePath not set")
 	}
@@ -182,7 +183,7 @@ func (b *LocalBucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithSta
 	return runtimeVersions, nil
 }
 
-func (b *LocalBucket) UploadFileIntoUpdate(update types.Update, fileName string, file io.Reader) error {
+func (b *LocalBucket) UploadFileIntoUpdate(ctx context.Context, update types.Update, fileName string, file io.Reader) error {
 	filePath := filepath.Join(b.BasePath, update.Branch, update.RuntimeVersion, update.UpdateId, fileName)
 	err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
 	if err != nil {
@@ -200,7 +201,7 @@ func (b *LocalBucket) UploadFileIntoUpdate(update types.Update, fileName string,
 	return nil
 }
 
-func ValidateUploadTokenAndResolveFilePath(token string) (string, error) {
+func ValidateUploadTokenAndResolveFilePath(ctx context.Context, token string) (string, error) {
 	claims := jwt.MapClaims{}
 	decodedToken, err := services.DecodeAndExtractJWTToken(config.GetEnv("JWT_SECRET"), token, claims)
 	if err != nil {
@@ -212,7 +213,7 @@ func ValidateUploadTokenAndResolveFilePath(token string) (string, error) {
 	action := claims["action"].(string)
 	filePath := claims["filePath"].(string)
 	sub := claims["sub"].(string)
-	if sub != services.FetchSelfExpoUsername() {
+	if sub != services.FetchSelfExpoUsername(ctx) {
 		return "", errors.New("invalid token sub")
 	}
 	if action != "uploadLocalFile" {
@@ -238,19 +239,22 @@ func HandleUploadFile(filePath string, body multipart.File) (bool, error) {
 	return true, nil
 }
 
-func (b *LocalBucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId string) (*types.Update, error) {
+func (b *LocalBucket) CreateUpdateFrom(ctx context.Context, previousUpdate *types.Update, newBranch string, newUpdateId string) (*types.Update, error) {
 	if previousUpdate == nil {
 		return nil, errors.New("previousUpdate is nil")
 	}
 	if previousUpdate.UpdateId == "" {
 		return nil, errors.New("previousUpdate.UpdateId is empty")
 	}
+	if newBranch == "" {
+		return nil, errors.New("newBranch is empty")
+	}
 	if newUpdateId == "" {
 		return nil, errors.New("newUpdateId is empty")
 	}
 
 	previousUpdatePath := filepath.Join(b.BasePath, previousUpdate.Branch, previousUpdate.RuntimeVersion, previousUpdate.UpdateId)
-	newUpdatePath := filepath.Join(b.BasePath, previousUpdate.Branch, previousUpdate.RuntimeVersion, newUpdateId)
+	newUpdatePath := filepath.Join(b.BasePath, newBranch, previousUpdate.RuntimeVersion, newUpdateId)
 
 	err := os.MkdirAll(newUpdatePath, os.ModePerm)
 	if err != nil {
@@ -268,7 +272,7 @@ func (b *LocalBucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId
 
 	for _, entry := range entries {
 		name := entry.Name()
-		if name == "update-metadata.json" || name == ".check" {
+		if name == "update-metadata.json" || name == ".check" || name == "halted" {
 			continue
 		}
 
@@ -307,7 +311,7 @@ func (b *LocalBucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId
 		return nil, fmt.Errorf("error parsing update ID: %w", err)
 	}
 	return &types.Update{
-		Branch:         previousUpdate.Branch,
+		Branch:         newBranch,
 		RuntimeVersion: previousUpdate.RuntimeVersion,
 		UpdateId:       newUpdateId,
 		CreatedAt:      time.Duration(updateId) * time.Millisecond,
@@ -334,7 +338,7 @@ func copyFile(src, dst string) error {
 	return out.Sync()
 }
 
-func (b *LocalBucket) RetrieveMigrationHistory() ([]string, error) {
+func (b *LocalBucket) RetrieveMigrationHistory(ctx context.Context) ([]string, error) {
 	if b.BasePath == "" {
 		return nil, errors.New("BasePath not set")
 	}
@@ -355,14 +359,14 @@ func (b *LocalBucket) RetrieveMigrationHistory() ([]string, error) {
 	return migrations, nil
 }
 
-func (b *LocalBucket) ApplyMigration(migrationId string) error {
+func (b *LocalBucket) ApplyMigration(ctx context.Context, migrationId string) error {
 	if b.BasePath == "" {
 		return errors.New("BasePath not set")
 	}
 
 	migrationHistoryPath := filepath.Join(b.BasePath, ".migrationhistory")
 
-	migrations, err := b.RetrieveMigrationHistory()
+	migrations, err := b.RetrieveMigrationHistory(ctx)
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("RetrieveMigrationHistory error: %w", err)
 	}
@@ -385,14 +389,14 @@ func (b *LocalBucket) ApplyMigration(migrationId string) error {
 	return nil
 }
 
-func (b *LocalBucket) RemoveMigrationFromHistory(migrationId string) error {
+func (b *LocalBucket) RemoveMigrationFromHistory(ctx context.Context, migrationId string) error {
 	if b.BasePath == "" {
 		return errors.New("BasePath not set")
 	}
 
 	migrationHistoryPath := filepath.Join(b.BasePath, ".migrationhistory")
 
-	migrations, err := b.RetrieveMigrationHistory()
+	migrations, err := b.RetrieveMigrationHistory(ctx)
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("RetrieveMigrationHistory error: %w", err)
 	}
@@ -473,3 +477,67 @@ func copyDirParallel(srcDir, dstDir string) error {
 	}
 	return nil
 }
+
+func (b *LocalBucket) GetRootFile(ctx context.Context, filePath string) (*types.BucketFile, error) {
+	if b.BasePath == "" {
+		return nil, errors.New("BasePath not set")
+	}
+	file, err := os.Open(filepath.Join(b.BasePath, filePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &types.BucketFile{
+		Reader:    file,
+		CreatedAt: info.ModTime(),
+	}, nil
+}
+
+func (b *LocalBucket) UploadRootFile(ctx context.Context, filePath string, file io.Reader) error {
+	if b.BasePath == "" {
+		return errors.New("BasePath not set")
+	}
+	fullPath := filepath.Join(b.BasePath, filePath)
+	err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(fullPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, file)
+	return err
+}
+
+func (b *LocalBucket) ListRootFiles(ctx context.Context, folder string, startAfter string, limit int) ([]string, error) {
+	if b.BasePath == "" {
+		return nil, errors.New("BasePath not set")
+	}
+	entries, err := os.ReadDir(filepath.Join(b.BasePath, folder))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := make([]string, 0, limit)
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() <= startAfter {
+			continue
+		}
+		names = append(names, entry.Name())
+		if len(names) == limit {
+			break
+		}
+	}
+	return names, nil
+}
@@ -23,7 +23,7 @@ type S3Bucket struct {
 	BucketName string
 }
 
-func (b *S3Bucket) DeleteUpdateFolder(branch, runtimeVersion, updateId string) error {
+func (b *S3Bucket) DeleteUpdateFolder(ctx context.Context, branch, runtimeVersion, updateId string) error {
 	if b.BucketName == "" {
 		return errors.New("BucketName not set")
 	}
@@ -44,7 +44,7 @@ func (b *S3Bucket) DeleteUpdateFolder(branch, runtimeVersion, updateId string) e
 
 	paginator := s3.NewListObjectsV2Paginator(s3Client, listInput)
 	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(context.TODO())
+		page, err := paginator.NextPage(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to list objects: %w", err)
 		}
@@ -75,7 +75,7 @@ func (b *S3Bucket) DeleteUpdateFolder(branch, runtimeVersion, updateId string) e
 			},
 		}
 
-		_, err := s3Client.DeleteObjects(context.TODO(), deleteInput)
+		_, err := s3Client.DeleteObjects(ctx, deleteInput)
 		if err != nil {
 			return fmt.Errorf("failed to delete objects: %w", err)
 		}
@@ -84,7 +84,7 @@ func (b *S3Bucket) DeleteUpdateFolder(branch, runtimeVersion, updateId string) e
 	return nil
 }
 
-func (b *S3Bucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats, error) {
+func (b *S3Bucket) GetRuntimeVersions(ctx context.Context, branch string) ([]RuntimeVersionWithStats, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
@@ -98,7 +98,7 @@ func (b *S3Bucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats,
 		Prefix:    aws.String(branch + "/"),
 		Delimiter: aws.String("/"),
 	}
-	resp, err := s3Client.ListObjectsV2(context.TODO(), input)
+	resp, err := s3Client.ListObjectsV2(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
 	}
@@ -114,7 +114,7 @@ func (b *S3Bucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats,
 			Prefix:    aws.String(updatesPath),
 			Delimiter: aws.String("/"),
 		}
-		updateResp, err := s3Client.ListObjectsV2(context.TODO(), updateInput)
+		updateResp, err := s3Client.ListObjectsV2(ctx, updateInput)
 		if err != nil {
 			return nil, fmt.Errorf("ListObjectsV2 error in updates: %w", err)
 		}
@@ -146,7 +146,7 @@ func (b *S3Bucket) GetRuntimeVersions(branch string) ([]RuntimeVersionWithStats,
 	return runtimeVersions, nil
 }
 
-func (b *S3Bucket) GetBranches() ([]string, error) {
+func (b *S3Bucket) GetBranches(ctx context.Context) ([]string, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
@@ -158,7 +158,7 @@ func (b *S3Bucket) GetBranches() ([]string, error) {
 		Bucket:    aws.String(b.BucketName),
 		Delimiter: aws.String("/"),
 	}
-	resp, err := s3Client.ListObjectsV2(context.TODO(), input)
+	resp, err := s3Client.ListObjectsV2(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
 	}
@@ -170,7 +170,7 @@ func (b *S3Bucket) GetBranches() ([]string, error) {
 	return branches, nil
 }
 
-func (b *S3Bucket) GetUpdates(branch string, runtimeVersion string) ([]types.Update, error) {
+func (b *S3Bucket) GetUpdates(ctx context.Context, branch string, runtimeVersion string) ([]types.Update, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
@@ -184,7 +184,7 @@ func (b *S3Bucket) GetUpdates(branch string, runtimeVersion string) ([]types.Upd
 		Prefix:    aws.String(prefix),
 		Delimiter: aws.String("/"),
 	}
-	resp, err := s3Client.ListObjectsV2(context.TODO(), input)
+	resp, err := s3Client.ListObjectsV2(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
 	}
@@ -203,7 +203,7 @@ func (b *S3Bucket) GetUpdates(branch string, runtimeVersion string) ([]types.Upd
 	return updates, nil
 }
 
-func (b *S3Bucket) GetFile(update types.Update, assetPath string) (*types.BucketFile, error) {
+func (b *S3Bucket) GetFile(ctx context.Context, update types.Update, assetPath string) (*types.BucketFile, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
@@ -218,7 +218,7 @@ func (b *S3Bucket) GetFile(update types.Update, assetPath string) (*types.Bucket
 		Bucket: aws.String(b.BucketName),
 		Key:    aws.String(key),
 	}
-	resp, err := s3Client.GetObject(context.TODO(), input)
+	resp, err := s3Client.GetObject(ctx, input)
 	if err != nil {
 		var noSuchKey *s3types.NoSuchKey
 		if errors.As(err, &noSuchKey) {
@@ -233,7 +233,7 @@ func (b *S3Bucket) GetFile(update types.Update, assetPath string) (*types.Bucket
 	}, nil
 }
 
-func (b *S3Bucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion string, updateId string, fileName string) (string, error) {
+func (b *S3Bucket) RequestUploadUrlForFileUpdate(ctx context.Context, branch string, runtimeVersion string, updateId string, fileName string) (string, error) {
 	if b.BucketName == "" {
 		return "", errors.New("BucketName not set")
 	}
@@ -252,7 +252,7 @@ func (b *S3Bucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion s
 		Key:    aws.String(key),
 	}
 
-	presignResult, err := presignClient.PresignPutObject(context.TODO(), input, func(opt *s3.PresignOptions) {
+	presignResult, err := presignClient.PresignPutObject(ctx, input, func(opt *s3.PresignOptions) {
 		opt.Expires = 15 * time.Minute
 	})
 	if err != nil {
@@ -262,7 +262,7 @@ func (b *S3Bucket) RequestUploadUrlForFileUpdate(branch string, runtimeVersion s
 	return presignResult.URL, nil
 }
 
-func (b *S3Bucket) UploadFileIntoUpdate(update types.Update, fileName string, file io.Reader) error {
+func (b *S3Bucket) UploadFileIntoUpdate(ctx context.Context, update types.Update, fileName string, file io.Reader) error {
 	if b.BucketName == "" {
 		return errors.New("BucketName not set")
 	}
@@ -276,14 +276,14 @@ func (b *S3Bucket) UploadFileIntoUpdate(update types.Update, fileName string, fi
 		Key:    aws.String(key),
 		Body:   file,
 	}
-	_, err = s3Client.PutObject(context.TODO(), input)
+	_, err = s3Client.PutObject(ctx, input)
 	if err != nil {
 		return fmt.Errorf("PutObject error: %w", err)
 	}
 	return nil
 }
 
-func (b *S3Bucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId string) (*types.Update, error) {
+func (b *S3Bucket) CreateUpdateFrom(ctx context.Context, previousUpdate *types.Update, newBranch string, newUpdateId string) (*types.Update, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
@@ -293,6 +293,9 @@ func (b *S3Bucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId st
 	if previousUpdate.UpdateId == "" {
 		return nil, errors.New("previousUpdate.UpdateId is empty")
 	}
+	if newBranch == "" {
+		return nil, errors.New("newBranch is empty")
+	}
 	if newUpdateId == "" {
 		return nil, errors.New("newUpdateId is empty")
 	}
@@ -303,7 +306,7 @@ func (b *S3Bucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId st
 	}
 
 	sourcePrefix := fmt.Sprintf("%s/%s/%s/", previousUpdate.Branch, previousUpdate.RuntimeVersion, previousUpdate.UpdateId)
-	targetPrefix := fmt.Sprintf("%s/%s/%s/", previousUpdate.Branch, previousUpdate.RuntimeVersion, newUpdateId)
+	targetPrefix := fmt.Sprintf("%s/%s/%s/", newBranch, previousUpdate.RuntimeVersion, newUpdateId)
 
 	paginator := s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
 		Bucket: aws.String(b.BucketName),
@@ -315,7 +318,7 @@ func (b *S3Bucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId st
 	sem := make(chan struct{}, runtime.NumCPU())
 
 	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(context.TODO())
+		page, err := paginator.NextPage(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to list objects: %w", err)
 		}
@@ -324,7 +327,7 @@ func (b *S3Bucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId st
 			key := *object.Key
 			relPath := strings.TrimPrefix(key, sourcePrefix)
 
-			if relPath == "update-metadata.json" || relPath == ".check" || strings.HasSuffix(relPath, "/") {
+			if relPath == "update-metadata.json" || relPath == ".check" || relPath == "halted" || strings.HasSuffix(relPath, "/") {
 				continue
 			}
 
@@ -337,7 +340,7 @@ func (b *S3Bucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId st
 				sem <- struct{}{}
 				defer func() { <-sem }()
 
-				getObjOutput, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+				getObjOutput, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
 					Bucket: aws.String(b.BucketName),
 					Key:    aws.String(srcKey),
 				})
@@ -347,7 +350,7 @@ func (b *S3Bucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId st
 				}
 				defer getObjOutput.Body.Close()
 
-				_, err = s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+				_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
 					Bucket: aws.String(b.BucketName),
 					Key:    aws.String(dstKey),
 					Body:   getObjOutput.Body,
@@ -374,14 +377,14 @@ func (b *S3Bucket) CreateUpdateFrom(previousUpdate *types.Update, newUpdateId st
 		return nil, fmt.Errorf("error parsing update ID: %w", err)
 	}
 	return &types.Update{
-		Branch:         previousUpdate.Branch,
+		Branch:         newBranch,
 		RuntimeVersion: previousUpdate.RuntimeVersion,
 		UpdateId:       newUpdateId,
 		CreatedAt:      time.Duration(updateId) * time.Millisecond,
 	}, nil
 }
 
-func (b *S3Bucket) RetrieveMigrationHistory() ([]string, error) {
+func (b *S3Bucket) RetrieveMigrationHistory(ctx context.Context) ([]string, error) {
 	if b.BucketName == "" {
 		return nil, errors.New("BucketName not set")
 	}
@@ -393,7 +396,7 @@ func (b *S3Bucket) RetrieveMigrationHistory() ([]string, error) {
 		Bucket: aws.String(b.BucketName),
 		Key:    aws.String(".migrationhistory"),
 	}
-	resp, err := s3Client.GetObject(context.TODO(), input)
+	resp, err := s3Client.GetObject(ctx, input)
 	if err != nil {
 		var noSuchKey *s3types.NoSuchKey
 		if errors.As(err, &noSuchKey) {
@@ -415,12 +418,12 @@ func (b *S3Bucket) RetrieveMigrationHistory() ([]string, error) {
 	return migrationHistory, nil
 }
 
-func (b *S3Bucket) ApplyMigration(migrationId string) error {
+func (b *S3Bucket) ApplyMigration(ctx context.Context, migrationId string) error {
 	if b.BucketName == "" {
 		return errors.New("BucketName not set")
 	}
 
-	migrationHistory, err := b.RetrieveMigrationHistory()
+	migrationHistory, err := b.RetrieveMigrationHistory(ctx)
 	if err != nil {
 		return fmt.Errorf("RetrieveMigrationHistory error: %w", err)
 	}
@@ -441,7 +444,7 @@ func (b *S3Bucket) ApplyMigration(migrationId string) error {
 	}
 
 	var currentContent []byte
-	obj, err := s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
+	obj, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(b.BucketName),
 		Key:    aws.String(".migrationhistory"),
 	})
@@ -452,7 +455,7 @@ func (b *S3Bucket) ApplyMigration(migrationId string) error {
 
 	newContent := append(currentContent, []byte(migrationId+"\n")...)
 
-	_, err = s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(b.BucketName),
 		Key:    aws.String(".migrationhistory"),
 		Body:   bytes.NewReader(newContent),
@@ -464,12 +467,12 @@ func (b *S3Bucket) ApplyMigration(migrationId string) error {
 	return nil
 }
 
-func (b *S3Bucket) RemoveMigrationFromHistory(migrationId string) error {
+func (b *S3Bucket) RemoveMigrationFromHistory(ctx context.Context, migrationId string) error {
 	if b.BucketName == "" {
 		return errors.New("BucketName not set")
 	}
 
-	migrationHistory, err := b.RetrieveMigrationHistory()
+	migrationHistory, err := b.RetrieveMigrationHistory(ctx)
 	if err != nil {
 		return fmt.Errorf("RetrieveMigrationHistory error: %w", err)
 	}
@@ -497,7 +500,7 @@ func (b *S3Bucket) RemoveMigrationFromHistory(migrationId string) error {
 		return errS3
 	}
 
-	_, err = s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(b.BucketName),
 		Key:    aws.String(".migrationhistory"),
 		Body:   bytes.NewReader(newContent),
@@ -508,3 +511,76 @@ func (b *S3Bucket) RemoveMigrationFromHistory(migrationId string) error {
 
 	return nil
 }
+
+func (b *S3Bucket) GetRootFile(ctx context.Context, filePath string) (*types.BucketFile, error) {
+	if b.BucketName == "" {
+		return nil, errors.New("BucketName not set")
+	}
+	s3Client, err := services.GetS3Client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(filePath),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("GetObject error: %w", err)
+	}
+	return &types.BucketFile{
+		Reader:    resp.Body,
+		CreatedAt: *resp.LastModified,
+	}, nil
+}
+
+func (b *S3Bucket) UploadRootFile(ctx context.Context, filePath string, file io.Reader) error {
+	if b.BucketName == "" {
+		return errors.New("BucketName not set")
+	}
+	s3Client, err := services.GetS3Client()
+	if err != nil {
+		return err
+	}
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(b.BucketName),
+		Key:    aws.String(filePath),
+		Body:   file,
+	})
+	if err != nil {
+		return fmt.Errorf("PutObject error: %w", err)
+	}
+	return nil
+}
+
+func (b *S3Bucket) ListRootFiles(ctx context.Context, folder string, startAfter string, limit int) ([]string, error) {
+	if b.BucketName == "" {
+		return nil, errors.New("BucketName not set")
+	}
+	s3Client, err := services.GetS3Client()
+	if err != nil {
+		return nil, err
+	}
+	prefix := folder + "/"
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(b.BucketName),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int32(int32(limit)),
+	}
+	if startAfter != "" {
+		input.StartAfter = aws.String(prefix + startAfter)
+	}
+	resp, err := s3Client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("ListObjectsV2 error: %w", err)
+	}
+	names := make([]string, 0, len(resp.Contents))
+	for _, object := range resp.Contents {
+		names = append(names, strings.TrimPrefix(*object.Key, prefix))
+	}
+	return names, nil
+}
@@ -0,0 +1,42 @@
+package bucket
+
+import (
+	"context"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/types"
+	"io"
+	"time"
+)
+
+const defaultOperationTimeout = 60 * time.Second
+
+func operationTimeout() time.Duration {
+	return config.GetDurationEnv("BUCKET_OPERATION_TIMEOUT_MS", defaultOperationTimeout)
+}
+
+// withOperationTimeout bounds a single bucket operation so a hung storage backend cannot hold
+// the calling goroutine indefinitely.
+func withOperationTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, operationTimeout())
+}
+
+// cancelOnClose keeps the operation context alive while the caller streams the file and
+// releases it once the reader is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelOnClose) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+func releaseWithFile(file *types.BucketFile, err error, cancel context.CancelFunc) (*types.BucketFile, error) {
+	if err != nil || file == nil || file.Reader == nil {
+		cancel()
+		return file, err
+	}
+	file.Reader = &cancelOnClose{ReadCloser: file.Reader, cancel: cancel}
+	return file, nil
+}
@@ -0,0 +1,153 @@
+package bucket
+
+import (
+	"context"
+	"expo-open-ota/internal/tracing"
+	"expo-open-ota/internal/types"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedBucket wraps a Bucket implementation with one span and one deadline per operation.
+type tracedBucket struct {
+	bucket     Bucket
+	bucketType BucketType
+}
+
+func (b *tracedBucket) startSpan(ctx context.Context, operation string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	attributes = append(attributes, attribute.String("bucket.type", string(b.bucketType)))
+	return tracing.StartSpan(ctx, "bucket."+operation, attributes...)
+}
+
+func updateAttributes(branch, runtimeVersion, updateId string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("expo.branch", branch),
+		attribute.String("expo.runtime_version", runtimeVersion),
+		attribute.String("expo.update_id", updateId),
+	}
+}
+
+func (b *tracedBucket) GetBranches(ctx context.Context) (branches []string, err error) {
+	ctx, span := b.startSpan(ctx, "GetBranches")
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.GetBranches(ctx)
+}
+
+func (b *tracedBucket) GetRuntimeVersions(ctx context.Context, branch string) (runtimeVersions []RuntimeVersionWithStats, err error) {
+	ctx, span := b.startSpan(ctx, "GetRuntimeVersions", attribute.String("expo.branch", branch))
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.GetRuntimeVersions(ctx, branch)
+}
+
+func (b *tracedBucket) GetUpdates(ctx context.Context, branch string, runtimeVersion string) (updates []types.Update, err error) {
+	ctx, span := b.startSpan(ctx, "GetUpdates",
+		attribute.String("expo.branch", branch),
+		attribute.String("expo.runtime_version", runtimeVersion),
+	)
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.GetUpdates(ctx, branch, runtimeVersion)
+}
+
+func (b *tracedBucket) GetFile(ctx context.Context, update types.Update, assetPath string) (file *types.BucketFile, err error) {
+	attributes := append(updateAttributes(update.Branch, update.RuntimeVersion, update.UpdateId), attribute.String("bucket.path", assetPath))
+	ctx, span := b.startSpan(ctx, "GetFile", attributes...)
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	file, err = b.bucket.GetFile(ctx, update, assetPath)
+	return releaseWithFile(file, err, cancel)
+}
+
+func (b *tracedBucket) RequestUploadUrlForFileUpdate(ctx context.Context, branch string, runtimeVersion string, updateId string, fileName string) (url string, err error) {
+	attributes := append(updateAttributes(branch, runtimeVersion, updateId), attribute.String("bucket.path", fileName))
+	ctx, span := b.startSpan(ctx, "RequestUploadUrlForFileUpdate", attributes...)
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.RequestUploadUrlForFileUpdate(ctx, branch, runtimeVersion, updateId, fileName)
+}
+
+func (b *tracedBucket) UploadFileIntoUpdate(ctx context.Context, update types.Update, fileName string, file io.Reader) (err error) {
+	attributes := append(updateAttributes(update.Branch, update.RuntimeVersion, update.UpdateId), attribute.String("bucket.path", fileName))
+	ctx, span := b.startSpan(ctx, "UploadFileIntoUpdate", attributes...)
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.UploadFileIntoUpdate(ctx, update, fileName, file)
+}
+
+func (b *tracedBucket) DeleteUpdateFolder(ctx context.Context, branch string, runtimeVersion string, updateId string) (err error) {
+	ctx, span := b.startSpan(ctx, "DeleteUpdateFolder", updateAttributes(branch, runtimeVersion, updateId)...)
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.DeleteUpdateFolder(ctx, branch, runtimeVersion, updateId)
+}
+
+func (b *tracedBucket) CreateUpdateFrom(ctx context.Context, previousUpdate *types.Update, newBranch string, newUpdateId string) (newUpdate *types.Update, err error) {
+	var attributes []attribute.KeyValue
+	if previousUpdate != nil {
+		attributes = updateAttributes(previousUpdate.Branch, previousUpdate.RuntimeVersion, previousUpdate.UpdateId)
+	}
+	attributes = append(attributes, attribute.String("expo.new_branch", newBranch), attribute.String("expo.new_update_id", newUpdateId))
+	ctx, span := b.startSpan(ctx, "CreateUpdateFrom", attributes...)
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.CreateUpdateFrom(ctx, previousUpdate, newBranch, newUpdateId)
+}
+
+func (b *tracedBucket) RetrieveMigrationHistory(ctx context.Context) (history []string, err error) {
+	ctx, span := b.startSpan(ctx, "RetrieveMigrationHistory")
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.RetrieveMigrationHistory(ctx)
+}
+
+func (b *tracedBucket) ApplyMigration(ctx context.Context, migrationId string) (err error) {
+	ctx, span := b.startSpan(ctx, "ApplyMigration", attribute.String("migration.id", migrationId))
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.ApplyMigration(ctx, migrationId)
+}
+
+func (b *tracedBucket) RemoveMigrationFromHistory(ctx context.Context, migrationId string) (err error) {
+	ctx, span := b.startSpan(ctx, "RemoveMigrationFromHistory", attribute.String("migration.id", migrationId))
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.RemoveMigrationFromHistory(ctx, migrationId)
+}
+
+func (b *tracedBucket) GetRootFile(ctx context.Context, filePath string) (file *types.BucketFile, err error) {
+	ctx, span := b.startSpan(ctx, "GetRootFile", attribute.String("bucket.path", filePath))
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	file, err = b.bucket.GetRootFile(ctx, filePath)
+	return releaseWithFile(file, err, cancel)
+}
+
+func (b *tracedBucket) UploadRootFile(ctx context.Context, filePath string, file io.Reader) (err error) {
+	ctx, span := b.startSpan(ctx, "UploadRootFile", attribute.String("bucket.path", filePath))
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.UploadRootFile(ctx, filePath, file)
+}
+
+func (b *tracedBucket) ListRootFiles(ctx context.Context, folder string, startAfter string, limit int) (names []string, err error) {
+	ctx, span := b.startSpan(ctx, "ListRootFiles", attribute.String("bucket.path", folder))
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, cancel := withOperationTimeout(ctx)
+	defer cancel()
+	return b.bucket.ListRootFiles(ctx, folder, startAfter, limit)
+}
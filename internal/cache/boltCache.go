@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/version"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("cache")
+
+// boltSweepInterval is how often expired records are removed from disk. Reads ignore expired
+// records in between.
+const boltSweepInterval = time.Minute
+
+// BoltCache persists the cache in a single bbolt file, so that a single-instance deployment keeps
+// its manifests, metrics sets and locks across restarts.
+type BoltCache struct {
+	db   *bolt.DB
+	stop chan struct{}
+}
+
+func NewBoltCache(path string) *BoltCache {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		panic(err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: operationTimeout()})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		panic(err)
+	}
+	c := &BoltCache{db: db, stop: make(chan struct{})}
+	go c.sweep()
+	return c
+}
+
+// Close stops the sweeper and releases the file lock.
+func (c *BoltCache) Close() error {
+	close(c.stop)
+	return c.db.Close()
+}
+
+func (c *BoltCache) sweep() {
+	ticker := time.NewTicker(boltSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			err := c.db.Update(func(tx *bolt.Tx) error {
+				bucket := tx.Bucket(boltBucket)
+				// Deleting while iterating makes the cursor skip entries.
+				var expired [][]byte
+				_ = bucket.ForEach(func(key, value []byte) error {
+					if _, ok := decodeRecord(value); !ok {
+						expired = append(expired, append([]byte{}, key...))
+					}
+					return nil
+				})
+				for _, key := range expired {
+					if err := bucket.Delete(key); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				slog.Warn("Error removing expired cache entries", "error", err)
+			}
+		}
+	}
+}
+
+func decodeRecord(value []byte) (record, bool) {
+	var r record
+	if value == nil || json.Unmarshal(value, &r) != nil || r.expired() {
+		return record{}, false
+	}
+	return r, true
+}
+
+func (c *BoltCache) read(key string) (record, bool) {
+	var (
+		r  record
+		ok bool
+	)
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		r, ok = decodeRecord(tx.Bucket(boltBucket).Get([]byte(withPrefix(key))))
+		return nil
+	})
+	return r, ok
+}
+
+// mutate applies apply to the record stored at key in a single transaction. apply returns false
+// when nothing needs to be written.
+func (c *BoltCache) mutate(key string, apply func(r *record, exists bool) (bool, error)) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		fullKey := []byte(withPrefix(key))
+		r, exists := decodeRecord(bucket.Get(fullKey))
+		write, err := apply(&r, exists)
+		if err != nil || !write {
+			return err
+		}
+		value, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(fullKey, value)
+	})
+}
+
+func (c *BoltCache) Get(ctx context.Context, key string) string {
+	r, _ := c.read(key)
+	return r.Value
+}
+
+func (c *BoltCache) Set(ctx context.Context, key string, value string, ttl *int) error {
+	return c.MSet(ctx, map[string]string{key: value}, ttl)
+}
+
+func (c *BoltCache) Delete(ctx context.Context, key string) {
+	_ = c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(withPrefix(key)))
+	})
+}
+
+func (c *BoltCache) Clear(ctx context.Context) error {
+	if version.Version != "development" {
+		slog.WarnContext(ctx, "Cache can only be cleared in development mode")
+		return nil
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(boltBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(boltBucket)
+		return err
+	})
+}
+
+func (c *BoltCache) TryLock(ctx context.Context, key string, token string, ttl int) (bool, error) {
+	acquired := false
+	err := c.mutate(key, func(r *record, exists bool) (bool, error) {
+		acquired = applyTryLock(r, exists, token, ttl)
+		return acquired, nil
+	})
+	return acquired, err
+}
+
+func (c *BoltCache) Unlock(ctx context.Context, key string, token string) error {
+	return c.mutate(key, func(r *record, exists bool) (bool, error) {
+		return applyUnlock(r, exists, token), nil
+	})
+}
+
+func (c *BoltCache) LockHeld(ctx context.Context, key string) (bool, error) {
+	return c.Get(ctx, key) != "", nil
+}
+
+func (c *BoltCache) Sadd(ctx context.Context, key string, members []string, ttl *int) error {
+	if len(members) == 0 {
+		return nil
+	}
+	return c.mutate(key, func(r *record, exists bool) (bool, error) {
+		return applySadd(r, exists, members, ttl), nil
+	})
+}
+
+func (c *BoltCache) Scard(ctx context.Context, key string) (int64, error) {
+	r, _ := c.read(key)
+	return int64(len(r.Members)), nil
+}
+
+func (c *BoltCache) Smembers(ctx context.Context, key string) ([]string, error) {
+	r, _ := c.read(key)
+	if r.Members == nil {
+		return []string{}, nil
+	}
+	return r.Members, nil
+}
+
+func (c *BoltCache) Pfadd(ctx context.Context, key string, members []string, ttl *int) error {
+	if len(members) == 0 {
+		return nil
+	}
+	return c.mutate(key, func(r *record, exists bool) (bool, error) {
+		return applyPfadd(r, exists, members, ttl), nil
+	})
+}
+
+func (c *BoltCache) Pfcount(ctx context.Context, keys ...string) (int64, error) {
+	union := &hyperLogLog{}
+	for _, key := range keys {
+		if r, ok := c.read(key); ok {
+			union.merge(r.sketch())
+		}
+	}
+	return union.count(), nil
+}
+
+func (c *BoltCache) Incr(ctx context.Context, key string, ttl *int) (int64, error) {
+	var count int64
+	err := c.mutate(key, func(r *record, exists bool) (bool, error) {
+		var err error
+		count, err = applyIncr(r, exists, key, ttl)
+		return err == nil, err
+	})
+	return count, err
+}
+
+func (c *BoltCache) MGet(ctx context.Context, keys []string) []string {
+	values := make([]string, len(keys))
+	_ = c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		for i, key := range keys {
+			r, _ := decodeRecord(bucket.Get([]byte(withPrefix(key))))
+			values[i] = r.Value
+		}
+		return nil
+	})
+	return values
+}
+
+func (c *BoltCache) MSet(ctx context.Context, values map[string]string, ttl *int) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		for key, value := range values {
+			encoded, err := json.Marshal(newValueRecord(value, ttl))
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(withPrefix(key)), encoded); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
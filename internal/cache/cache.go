@@ -1,29 +1,56 @@
 package cache
 
 import (
+	"context"
 	"expo-open-ota/config"
+	"log/slog"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Cache interface {
-	Get(key string) string
-	Set(key string, value string, ttl *int) error
-	Delete(key string)
-	Clear() error
-	TryLock(key string, ttl int) (bool, error)
-	Sadd(key string, members []string, ttl *int) error
-	Scard(key string) (int64, error)
+	Get(ctx context.Context, key string) string
+	Set(ctx context.Context, key string, value string, ttl *int) error
+	Delete(ctx context.Context, key string)
+	Clear(ctx context.Context) error
+	// TryLock holds the lock at key for ttl seconds when it is free, storing token as its value.
+	TryLock(ctx context.Context, key string, token string, ttl int) (bool, error)
+	// Unlock releases the lock at key only when it is still held with token, so a holder whose
+	// lock expired can't release the lock of the next one.
+	Unlock(ctx context.Context, key string, token string) error
+	// LockHeld reports whether the lock at key is held. It always reads the shared cache, unlike Get.
+	LockHeld(ctx context.Context, key string) (bool, error)
+	Sadd(ctx context.Context, key string, members []string, ttl *int) error
+	Scard(ctx context.Context, key string) (int64, error)
+	Smembers(ctx context.Context, key string) ([]string, error)
+	Pfadd(ctx context.Context, key string, members []string, ttl *int) error
+	// Pfcount returns the approximate number of unique members in the union of the sketches at keys.
+	// With Redis Cluster, the keys must share a hash tag.
+	Pfcount(ctx context.Context, keys ...string) (int64, error)
+	Incr(ctx context.Context, key string, ttl *int) (int64, error)
+	// MGet returns the value of each key in order, "" for missing keys.
+	MGet(ctx context.Context, keys []string) []string
+	MSet(ctx context.Context, values map[string]string, ttl *int) error
 }
 
 type CacheType string
 
 const (
-	LocalCacheType CacheType = "local"
-	RedisCacheType CacheType = "redis"
+	LocalCacheType     CacheType = "local"
+	RedisCacheType     CacheType = "redis"
+	MemcachedCacheType CacheType = "memcached"
+	BoltCacheType      CacheType = "bolt"
 )
 
 const defaultPrefix = "expoopenota"
 
+const (
+	defaultLocalTierMaxSizeMB = 64
+	defaultLocalTierTTL       = 5 * time.Minute
+)
+
 func withPrefix(key string) string {
 	prefix := config.GetEnv("CACHE_KEY_PREFIX")
 	if prefix == "" {
@@ -33,13 +60,27 @@ func withPrefix(key string) string {
 }
 
 func ResolveCacheType() CacheType {
-	cacheType := config.GetEnv("CACHE_MODE")
-	if cacheType == "redis" {
+	switch CacheType(config.GetEnv("CACHE_MODE")) {
+	case RedisCacheType:
 		return RedisCacheType
+	case MemcachedCacheType:
+		return MemcachedCacheType
+	case BoltCacheType:
+		return BoltCacheType
 	}
 	return LocalCacheType
 }
 
+// IsPersistent reports whether the configured cache keeps its data across server restarts.
+// Memcached may evict any key, it is not counted as persistent.
+func IsPersistent() bool {
+	switch ResolveCacheType() {
+	case RedisCacheType, BoltCacheType:
+		return true
+	}
+	return false
+}
+
 var (
 	cacheInstance Cache
 	once          sync.Once
@@ -57,10 +98,35 @@ func GetCache() Cache {
 			port := config.GetEnv("REDIS_PORT")
 			useTLS := config.GetEnv("REDIS_USE_TLS") == "true"
 			useCluster := config.GetEnv("REDIS_USE_CLUSTER") == "true"
-			cacheInstance = NewRedisCache(host, password, port, useTLS, useCluster)
+			redisCache := NewRedisCache(host, password, port, useTLS, useCluster)
+			cacheInstance = withLocalTier(redisCache)
+		case MemcachedCacheType:
+			cacheInstance = NewMemcachedCache(strings.Split(config.GetEnv("MEMCACHED_SERVERS"), ","))
+		case BoltCacheType:
+			cacheInstance = NewBoltCache(config.GetEnv("CACHE_BOLT_PATH"))
 		default:
 			panic("Unknown cache type")
 		}
+		cacheInstance = &tracedCache{cache: cacheInstance, cacheType: cacheType}
 	})
 	return cacheInstance
 }
+
+// withLocalTier puts an in-process LRU in front of the Redis cache unless CACHE_LOCAL_TIER is
+// false. Without pub/sub invalidations, the Redis cache is used alone.
+func withLocalTier(redisCache *RedisCache) Cache {
+	if config.GetEnv("CACHE_LOCAL_TIER") == "false" {
+		return redisCache
+	}
+	maxSizeMB, err := strconv.Atoi(config.GetEnv("CACHE_LOCAL_TIER_MAX_SIZE_MB"))
+	if err != nil || maxSizeMB <= 0 {
+		maxSizeMB = defaultLocalTierMaxSizeMB
+	}
+	ttl := config.GetDurationEnv("CACHE_LOCAL_TIER_TTL_MS", defaultLocalTierTTL)
+	layeredCache, err := NewLayeredCache(context.Background(), redisCache, redisCache, maxSizeMB*1024*1024, ttl)
+	if err != nil {
+		slog.Error("Unable to subscribe to cache invalidations, local cache tier disabled", "error", err)
+		return redisCache
+	}
+	return layeredCache
+}
@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	testing2 "testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// runConformanceSuite checks the behaviour every Cache implementation must share. Backends
+// relying on an external server use a random key prefix so runs don't collide.
+func runConformanceSuite(t *testing2.T, newCache func(t *testing2.T) Cache) {
+	ttl := 1
+	expire := func() { time.Sleep(2100 * time.Millisecond) }
+
+	t.Run("GetSetDelete", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		assert.Equal(t, "", c.Get(ctx, "missing"))
+		assert.Nil(t, c.Set(ctx, "key", "value", nil))
+		assert.Equal(t, "value", c.Get(ctx, "key"))
+		assert.Nil(t, c.Set(ctx, "key", "updated", nil))
+		assert.Equal(t, "updated", c.Get(ctx, "key"))
+		c.Delete(ctx, "key")
+		assert.Equal(t, "", c.Get(ctx, "key"))
+	})
+
+	t.Run("LongAndSpacedKeys", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		key := "asset:" + strings.Repeat("a", 300) + "/with space.png"
+		assert.Nil(t, c.Set(ctx, key, "value", nil))
+		assert.Equal(t, "value", c.Get(ctx, key))
+	})
+
+	t.Run("MGetMSet", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		assert.Equal(t, []string{}, c.MGet(ctx, []string{}))
+		assert.Nil(t, c.MSet(ctx, map[string]string{"a": "1", "b": "2"}, nil))
+		assert.Equal(t, []string{"1", "", "2"}, c.MGet(ctx, []string{"a", "missing", "b"}))
+	})
+
+	t.Run("SetWithTTL", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		assert.Nil(t, c.Set(ctx, "expiring", "value", &ttl))
+		assert.Nil(t, c.MSet(ctx, map[string]string{"expiringBatch": "value"}, &ttl))
+		assert.Equal(t, "value", c.Get(ctx, "expiring"))
+		expire()
+		assert.Equal(t, "", c.Get(ctx, "expiring"))
+		assert.Equal(t, []string{""}, c.MGet(ctx, []string{"expiringBatch"}))
+	})
+
+	t.Run("TryLock", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		var (
+			acquired int
+			mu       sync.Mutex
+			wg       sync.WaitGroup
+		)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := c.TryLock(ctx, "lock", "holder", ttl)
+				assert.Nil(t, err)
+				if ok {
+					mu.Lock()
+					acquired++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 1, acquired)
+		expire()
+		ok, err := c.TryLock(ctx, "lock", "holder", ttl)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("TryLockReleasedByDelete", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		ok, err := c.TryLock(ctx, "lock", "holder", 60)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		c.Delete(ctx, "lock")
+		ok, err = c.TryLock(ctx, "lock", "holder", 60)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("UnlockChecksToken", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		ok, err := c.TryLock(ctx, "lock", "first", 60)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Nil(t, c.Unlock(ctx, "lock", "second"))
+		ok, err = c.TryLock(ctx, "lock", "second", 60)
+		assert.Nil(t, err)
+		assert.False(t, ok, "Expected the lock not to be released with another token")
+		held, err := c.LockHeld(ctx, "lock")
+		assert.Nil(t, err)
+		assert.True(t, held)
+		assert.Nil(t, c.Unlock(ctx, "lock", "first"))
+		held, err = c.LockHeld(ctx, "lock")
+		assert.Nil(t, err)
+		assert.False(t, held)
+		ok, err = c.TryLock(ctx, "lock", "second", 60)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("Sets", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		count, err := c.Scard(ctx, "set")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), count)
+		assert.Nil(t, c.Sadd(ctx, "set", []string{"a", "b"}, nil))
+		assert.Nil(t, c.Sadd(ctx, "set", []string{"b", "c"}, nil))
+		assert.Nil(t, c.Sadd(ctx, "set", []string{}, nil))
+		count, err = c.Scard(ctx, "set")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), count)
+		members, err := c.Smembers(ctx, "set")
+		assert.Nil(t, err)
+		sort.Strings(members)
+		assert.Equal(t, []string{"a", "b", "c"}, members)
+		members, err = c.Smembers(ctx, "missing")
+		assert.Nil(t, err)
+		assert.Empty(t, members)
+	})
+
+	t.Run("SetsWithTTL", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		assert.Nil(t, c.Sadd(ctx, "set", []string{"a", "b"}, &ttl))
+		count, err := c.Scard(ctx, "set")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), count)
+		expire()
+		count, err = c.Scard(ctx, "set")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), count)
+		assert.Nil(t, c.Sadd(ctx, "set", []string{"c"}, &ttl))
+		count, err = c.Scard(ctx, "set")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("ConcurrentSadd", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				assert.Nil(t, c.Sadd(ctx, "set", []string{fmt.Sprintf("member-%d", i)}, nil))
+			}(i)
+		}
+		wg.Wait()
+		count, err := c.Scard(ctx, "set")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(20), count)
+	})
+
+	t.Run("HyperLogLog", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		assert.Nil(t, c.Pfadd(ctx, "sketch", []string{"a", "b", "a"}, nil))
+		assert.Nil(t, c.Pfadd(ctx, "sketch", []string{"c"}, nil))
+		count, err := c.Pfcount(ctx, "sketch")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(3), count)
+		count, err = c.Pfcount(ctx, "missing")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), count)
+		assert.Nil(t, c.Pfadd(ctx, "other", []string{"c", "d"}, nil))
+		count, err = c.Pfcount(ctx, "sketch", "other", "missing")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(4), count, "Expected the union of the sketches to be counted")
+	})
+
+	t.Run("Incr", func(t *testing2.T) {
+		c := newCache(t)
+		ctx := context.Background()
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.Incr(ctx, "counter", &ttl)
+				assert.Nil(t, err)
+			}()
+		}
+		wg.Wait()
+		count, err := c.Incr(ctx, "counter", &ttl)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(11), count)
+		expire()
+		count, err = c.Incr(ctx, "counter", &ttl)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), count)
+	})
+}
+
+func isolatePrefix(t *testing2.T) {
+	t.Setenv("CACHE_KEY_PREFIX", "conformance-"+uuid.NewString())
+}
+
+func TestLocalCacheConformance(t *testing2.T) {
+	runConformanceSuite(t, func(t *testing2.T) Cache {
+		return NewLocalCache()
+	})
+}
+
+func TestLayeredCacheConformance(t *testing2.T) {
+	runConformanceSuite(t, func(t *testing2.T) Cache {
+		c, err := NewLayeredCache(context.Background(), NewLocalCache(), &memoryBus{}, 1024*1024, time.Minute)
+		assert.Nil(t, err)
+		return c
+	})
+}
+
+func TestBoltCacheConformance(t *testing2.T) {
+	runConformanceSuite(t, func(t *testing2.T) Cache {
+		c := NewBoltCache(filepath.Join(t.TempDir(), "cache.db"))
+		t.Cleanup(func() { _ = c.Close() })
+		return c
+	})
+}
+
+func TestBoltCachePersistsAcrossRestarts(t *testing2.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	ctx := context.Background()
+	c := NewBoltCache(path)
+	assert.Nil(t, c.Set(ctx, "manifest", "value", nil))
+	assert.Nil(t, c.Sadd(ctx, "clients", []string{"a"}, nil))
+	ok, err := c.TryLock(ctx, "lock", "holder", 60)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, c.Close())
+
+	c = NewBoltCache(path)
+	defer c.Close()
+	assert.Equal(t, "value", c.Get(ctx, "manifest"))
+	count, err := c.Scard(ctx, "clients")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	ok, err = c.TryLock(ctx, "lock", "holder", 60)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+// The Redis and Memcached suites need a running server, e.g. REDIS_TEST_ADDR=localhost:6379.
+func TestRedisCacheConformance(t *testing2.T) {
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR not set")
+	}
+	host, port, _ := strings.Cut(addr, ":")
+	runConformanceSuite(t, func(t *testing2.T) Cache {
+		isolatePrefix(t)
+		return NewRedisCache(host, "", port, false, false)
+	})
+}
+
+func TestMemcachedCacheConformance(t *testing2.T) {
+	servers := os.Getenv("MEMCACHED_TEST_SERVERS")
+	if servers == "" {
+		t.Skip("MEMCACHED_TEST_SERVERS not set")
+	}
+	runConformanceSuite(t, func(t *testing2.T) Cache {
+		isolatePrefix(t)
+		return NewMemcachedCache(strings.Split(servers, ","))
+	})
+}
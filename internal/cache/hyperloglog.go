@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision trades accuracy for memory: 2^12 registers use 4KB per key with a ~1.6% standard error.
+const (
+	hllPrecision = 12
+	hllRegisters = 1 << hllPrecision
+)
+
+type hyperLogLog struct {
+	registers [hllRegisters]uint8
+}
+
+func hashMember(member string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(member))
+	// FNV alone spreads poorly over the high bits, finish with the splitmix64 mixer.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// add returns true when the sketch changed.
+func (h *hyperLogLog) add(member string) bool {
+	x := hashMember(member)
+	index := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+		return true
+	}
+	return false
+}
+
+// merge folds other into h, so h counts the union of both sketches.
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for i, register := range other.registers {
+		if register > h.registers[i] {
+			h.registers[i] = register
+		}
+	}
+}
+
+func (h *hyperLogLog) count() int64 {
+	m := float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, register := range h.registers {
+		sum += 1 / float64(uint64(1)<<register)
+		if register == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is far more accurate for small cardinalities.
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
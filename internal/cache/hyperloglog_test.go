@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	testing2 "testing"
+)
+
+func TestHyperLogLogSmallCardinalityIsExact(t *testing2.T) {
+	sketch := &hyperLogLog{}
+	for i := 0; i < 3; i++ {
+		sketch.add("client-1")
+		sketch.add("client-2")
+	}
+	if got := sketch.count(); got != 2 {
+		t.Errorf("Expected 2 unique members, got %d", got)
+	}
+}
+
+func TestHyperLogLogLargeCardinality(t *testing2.T) {
+	sketch := &hyperLogLog{}
+	const members = 200000
+	for i := 0; i < members; i++ {
+		sketch.add(fmt.Sprintf("client-%d", i))
+	}
+	relativeError := math.Abs(float64(sketch.count()-members)) / members
+	if relativeError > 0.05 {
+		t.Errorf("Expected estimate within 5%% of %d, got %d", members, sketch.count())
+	}
+}
@@ -0,0 +1,263 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const invalidationChannel = "invalidations"
+
+// invalidationBus broadcasts the keys written or deleted by one instance to every other one.
+type invalidationBus interface {
+	publish(ctx context.Context, channel string, message string) error
+	subscribe(ctx context.Context, channel string, onMessage func(message string), onResubscribe func()) error
+}
+
+// expiringGetter is implemented by remote caches able to report the remaining TTL of the keys
+// they return, so local copies never outlive the remote entry.
+type expiringGetter interface {
+	mgetWithTTL(ctx context.Context, keys []string) ([]string, []time.Duration)
+}
+
+type invalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+	// All drops every local copy, it is published by Clear.
+	All bool `json:"all,omitempty"`
+}
+
+// LayeredCache serves plain values from a memory-bounded in-process LRU in front of a shared
+// remote cache. Writes and deletes go to the remote cache and are broadcast so that every
+// instance drops its local copy. Sets, counters, sketches and locks always hit the remote cache.
+type LayeredCache struct {
+	local    *lru
+	remote   Cache
+	bus      invalidationBus
+	localTTL time.Duration
+	origin   string
+	// generation is bumped by every write, delete or invalidation, under fillMu. A local copy is
+	// only filled from the remote cache when no generation passed since the remote read, so a
+	// fill racing a delete can't bring a stale value back.
+	fillMu     sync.Mutex
+	generation uint64
+}
+
+// NewLayeredCache subscribes to invalidations before returning, as serving local copies without
+// them could return stale values for up to localTTL.
+func NewLayeredCache(ctx context.Context, remote Cache, bus invalidationBus, maxBytes int, localTTL time.Duration) (*LayeredCache, error) {
+	c := &LayeredCache{
+		local:    newLRU(maxBytes),
+		remote:   remote,
+		bus:      bus,
+		localTTL: localTTL,
+		origin:   uuid.NewString(),
+	}
+	if err := bus.subscribe(ctx, invalidationChannel, c.handleInvalidation, c.clearLocal); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *LayeredCache) handleInvalidation(message string) {
+	var payload invalidation
+	if err := json.Unmarshal([]byte(message), &payload); err != nil {
+		slog.Warn("Ignoring malformed cache invalidation", "error", err)
+		return
+	}
+	if payload.Origin == c.origin {
+		return
+	}
+	if payload.All {
+		c.clearLocal()
+		return
+	}
+	c.deleteLocal(payload.Keys...)
+}
+
+// currentGeneration is read before a remote read, to be given to fillLocal.
+func (c *LayeredCache) currentGeneration() uint64 {
+	c.fillMu.Lock()
+	defer c.fillMu.Unlock()
+	return c.generation
+}
+
+// fillLocal keeps a copy of a remote value unless the local tier changed since generation.
+func (c *LayeredCache) fillLocal(generation uint64, key string, value string, ttl time.Duration) {
+	c.fillMu.Lock()
+	defer c.fillMu.Unlock()
+	if c.generation != generation {
+		return
+	}
+	c.local.set(key, value, ttl)
+}
+
+func (c *LayeredCache) deleteLocal(keys ...string) {
+	c.fillMu.Lock()
+	defer c.fillMu.Unlock()
+	c.generation++
+	for _, key := range keys {
+		c.local.delete(key)
+	}
+}
+
+func (c *LayeredCache) clearLocal() {
+	c.fillMu.Lock()
+	defer c.fillMu.Unlock()
+	c.generation++
+	c.local.clear()
+}
+
+func (c *LayeredCache) invalidate(ctx context.Context, keys ...string) {
+	c.publish(ctx, invalidation{Origin: c.origin, Keys: keys})
+}
+
+func (c *LayeredCache) publish(ctx context.Context, payload invalidation) {
+	message, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	if err := c.bus.publish(ctx, invalidationChannel, string(message)); err != nil {
+		// Other instances keep their copy until it expires.
+		slog.WarnContext(ctx, "Error publishing cache invalidation", "error", err)
+	}
+}
+
+// localTTLFor bounds the local copy by the remote TTL, a negative remoteTTL meaning no expiry.
+func (c *LayeredCache) localTTLFor(remoteTTL time.Duration) time.Duration {
+	if remoteTTL >= 0 && remoteTTL < c.localTTL {
+		return remoteTTL
+	}
+	return c.localTTL
+}
+
+func ttlDuration(ttl *int) time.Duration {
+	if ttl == nil {
+		return -1
+	}
+	return time.Duration(*ttl) * time.Second
+}
+
+func (c *LayeredCache) Get(ctx context.Context, key string) string {
+	return c.MGet(ctx, []string{key})[0]
+}
+
+func (c *LayeredCache) MGet(ctx context.Context, keys []string) []string {
+	values := make([]string, len(keys))
+	missing := make([]string, 0, len(keys))
+	missingIndexes := make([]int, 0, len(keys))
+	for i, key := range keys {
+		if value, ok := c.local.get(key); ok {
+			values[i] = value
+			continue
+		}
+		missing = append(missing, key)
+		missingIndexes = append(missingIndexes, i)
+	}
+	if len(missing) == 0 {
+		return values
+	}
+
+	generation := c.currentGeneration()
+	var remoteValues []string
+	ttls := make([]time.Duration, len(missing))
+	if getter, ok := c.remote.(expiringGetter); ok {
+		remoteValues, ttls = getter.mgetWithTTL(ctx, missing)
+	} else {
+		remoteValues = c.remote.MGet(ctx, missing)
+		for i := range ttls {
+			ttls[i] = -1
+		}
+	}
+	for i, value := range remoteValues {
+		values[missingIndexes[i]] = value
+		if value != "" {
+			c.fillLocal(generation, missing[i], value, c.localTTLFor(ttls[i]))
+		}
+	}
+	return values
+}
+
+func (c *LayeredCache) Set(ctx context.Context, key string, value string, ttl *int) error {
+	return c.MSet(ctx, map[string]string{key: value}, ttl)
+}
+
+func (c *LayeredCache) MSet(ctx context.Context, values map[string]string, ttl *int) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if err := c.remote.MSet(ctx, values, ttl); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(values))
+	c.fillMu.Lock()
+	c.generation++
+	for key, value := range values {
+		c.local.set(key, value, c.localTTLFor(ttlDuration(ttl)))
+		keys = append(keys, key)
+	}
+	c.fillMu.Unlock()
+	c.invalidate(ctx, keys...)
+	return nil
+}
+
+// Delete removes the remote entry before the local copy, so that a concurrent Get can't copy the
+// remote value back after the local delete.
+func (c *LayeredCache) Delete(ctx context.Context, key string) {
+	c.remote.Delete(ctx, key)
+	c.deleteLocal(key)
+	c.invalidate(ctx, key)
+}
+
+func (c *LayeredCache) Clear(ctx context.Context) error {
+	err := c.remote.Clear(ctx)
+	c.clearLocal()
+	c.publish(ctx, invalidation{Origin: c.origin, All: true})
+	return err
+}
+
+func (c *LayeredCache) TryLock(ctx context.Context, key string, token string, ttl int) (bool, error) {
+	return c.remote.TryLock(ctx, key, token, ttl)
+}
+
+// Unlock also drops local copies of the lock, in case it was read with Get.
+func (c *LayeredCache) Unlock(ctx context.Context, key string, token string) error {
+	if err := c.remote.Unlock(ctx, key, token); err != nil {
+		return err
+	}
+	c.deleteLocal(key)
+	c.invalidate(ctx, key)
+	return nil
+}
+
+func (c *LayeredCache) LockHeld(ctx context.Context, key string) (bool, error) {
+	return c.remote.LockHeld(ctx, key)
+}
+
+func (c *LayeredCache) Sadd(ctx context.Context, key string, members []string, ttl *int) error {
+	return c.remote.Sadd(ctx, key, members, ttl)
+}
+
+func (c *LayeredCache) Scard(ctx context.Context, key string) (int64, error) {
+	return c.remote.Scard(ctx, key)
+}
+
+func (c *LayeredCache) Smembers(ctx context.Context, key string) ([]string, error) {
+	return c.remote.Smembers(ctx, key)
+}
+
+func (c *LayeredCache) Pfadd(ctx context.Context, key string, members []string, ttl *int) error {
+	return c.remote.Pfadd(ctx, key, members, ttl)
+}
+
+func (c *LayeredCache) Pfcount(ctx context.Context, keys ...string) (int64, error) {
+	return c.remote.Pfcount(ctx, keys...)
+}
+
+func (c *LayeredCache) Incr(ctx context.Context, key string, ttl *int) (int64, error) {
+	return c.remote.Incr(ctx, key, ttl)
+}
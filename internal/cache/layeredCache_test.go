@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	testing2 "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryBus delivers published messages synchronously to every subscriber.
+type memoryBus struct {
+	mu          sync.Mutex
+	subscribers []func(message string)
+}
+
+func (b *memoryBus) publish(_ context.Context, _ string, message string) error {
+	b.mu.Lock()
+	subscribers := append([]func(string){}, b.subscribers...)
+	b.mu.Unlock()
+	for _, subscriber := range subscribers {
+		subscriber(message)
+	}
+	return nil
+}
+
+func (b *memoryBus) subscribe(_ context.Context, _ string, onMessage func(message string), _ func()) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, onMessage)
+	return nil
+}
+
+func newTestLayeredCaches(t *testing2.T, count int) ([]*LayeredCache, *LocalCache) {
+	remote := NewLocalCache()
+	bus := &memoryBus{}
+	caches := make([]*LayeredCache, count)
+	for i := range caches {
+		c, err := NewLayeredCache(context.Background(), remote, bus, 1024, time.Minute)
+		assert.Nil(t, err)
+		caches[i] = c
+	}
+	return caches, remote
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing2.T) {
+	c := newLRU(12)
+	c.set("a", "1234", time.Minute)
+	c.set("b", "1234", time.Minute)
+	_, _ = c.get("a")
+	c.set("c", "1234", time.Minute)
+
+	_, hasA := c.get("a")
+	_, hasB := c.get("b")
+	_, hasC := c.get("c")
+	assert.True(t, hasA)
+	assert.False(t, hasB)
+	assert.True(t, hasC)
+	assert.LessOrEqual(t, c.size, 12)
+}
+
+func TestLRUSkipsOversizedAndExpiredEntries(t *testing2.T) {
+	c := newLRU(4)
+	c.set("key", "too large", time.Minute)
+	_, exists := c.get("key")
+	assert.False(t, exists)
+
+	c.set("k", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	_, exists = c.get("k")
+	assert.False(t, exists)
+	assert.Equal(t, 0, c.size)
+}
+
+func TestLayeredCacheServesLocalCopy(t *testing2.T) {
+	caches, remote := newTestLayeredCaches(t, 1)
+	ctx := context.Background()
+	assert.Nil(t, remote.Set(ctx, "manifest", "v1", nil))
+	assert.Equal(t, "v1", caches[0].Get(ctx, "manifest"))
+
+	// Written behind the layered cache's back, so only the local copy is returned.
+	assert.Nil(t, remote.Set(ctx, "manifest", "v2", nil))
+	assert.Equal(t, "v1", caches[0].Get(ctx, "manifest"))
+}
+
+func TestLayeredCacheDeleteInvalidatesOtherInstances(t *testing2.T) {
+	caches, _ := newTestLayeredCaches(t, 2)
+	ctx := context.Background()
+	assert.Nil(t, caches[0].Set(ctx, "lastUpdate", "v1", nil))
+	assert.Equal(t, "v1", caches[1].Get(ctx, "lastUpdate"))
+
+	caches[0].Delete(ctx, "lastUpdate")
+	assert.Equal(t, "", caches[1].Get(ctx, "lastUpdate"))
+
+	assert.Nil(t, caches[1].Set(ctx, "lastUpdate", "v2", nil))
+	assert.Equal(t, "v2", caches[0].Get(ctx, "lastUpdate"))
+}
+
+func TestLayeredCacheLockReleaseSeenByOtherInstances(t *testing2.T) {
+	caches, _ := newTestLayeredCaches(t, 2)
+	ctx := context.Background()
+	ok, err := caches[0].TryLock(ctx, "buildLock", "holder", 30)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// A stale local copy of the lock, read with Get, must not hide its release.
+	assert.Equal(t, "holder", caches[1].Get(ctx, "buildLock"))
+	held, err := caches[1].LockHeld(ctx, "buildLock")
+	assert.Nil(t, err)
+	assert.True(t, held)
+
+	assert.Nil(t, caches[0].Unlock(ctx, "buildLock", "holder"))
+	held, err = caches[1].LockHeld(ctx, "buildLock")
+	assert.Nil(t, err)
+	assert.False(t, held, "Expected the release to be seen by the other instance")
+	assert.Equal(t, "", caches[1].Get(ctx, "buildLock"), "Expected the local copy of the lock to be dropped")
+}
+
+func TestLayeredCacheMGetMixesTiers(t *testing2.T) {
+	caches, remote := newTestLayeredCaches(t, 1)
+	ctx := context.Background()
+	assert.Nil(t, caches[0].MSet(ctx, map[string]string{"a": "1"}, nil))
+	assert.Nil(t, remote.Set(ctx, "b", "2", nil))
+
+	assert.Equal(t, []string{"1", "2", ""}, caches[0].MGet(ctx, []string{"a", "b", "c"}))
+	value, exists := caches[0].local.get("b")
+	assert.True(t, exists)
+	assert.Equal(t, "2", value)
+}
+
+func TestLayeredCacheBoundsLocalCopyByTTL(t *testing2.T) {
+	caches, _ := newTestLayeredCaches(t, 1)
+	caches[0].localTTL = time.Minute
+	assert.Equal(t, time.Second, caches[0].localTTLFor(time.Second))
+	assert.Equal(t, time.Minute, caches[0].localTTLFor(-1))
+	assert.Equal(t, time.Minute, caches[0].localTTLFor(time.Hour))
+}
+
+// racingRemote runs afterRead once a remote MGet has read its values, to interleave a delete.
+type racingRemote struct {
+	*LocalCache
+	afterRead func()
+}
+
+func (r *racingRemote) MGet(ctx context.Context, keys []string) []string {
+	values := r.LocalCache.MGet(ctx, keys)
+	if r.afterRead != nil {
+		afterRead := r.afterRead
+		r.afterRead = nil
+		afterRead()
+	}
+	return values
+}
+
+func TestLayeredCacheDropsFillRacingDelete(t *testing2.T) {
+	ctx := context.Background()
+	remote := &racingRemote{LocalCache: NewLocalCache()}
+	c, err := NewLayeredCache(ctx, remote, &memoryBus{}, 1024, time.Minute)
+	assert.Nil(t, err)
+	assert.Nil(t, remote.Set(ctx, "lastUpdate", "stale", nil))
+
+	remote.afterRead = func() { c.Delete(ctx, "lastUpdate") }
+	assert.Equal(t, "stale", c.Get(ctx, "lastUpdate"))
+	assert.Equal(t, "", c.Get(ctx, "lastUpdate"), "Expected the fill started before the delete to be dropped")
+}
+
+func TestLayeredCacheClearInvalidatesOtherInstances(t *testing2.T) {
+	caches, _ := newTestLayeredCaches(t, 2)
+	ctx := context.Background()
+	assert.Nil(t, caches[0].Set(ctx, "lastUpdate", "v1", nil))
+	assert.Equal(t, "v1", caches[1].Get(ctx, "lastUpdate"))
+
+	assert.Nil(t, caches[0].Clear(ctx))
+	_, exists := caches[1].local.get("lastUpdate")
+	assert.False(t, exists, "Expected Clear to drop the local copies of other instances")
+}
@@ -1,19 +1,29 @@
 package cache
 
 import (
+	"context"
 	"expo-open-ota/internal/version"
 	"fmt"
+	"log/slog"
+	"strconv"
 	"sync"
 	"time"
 )
 
 type LocalCache struct {
-	items          map[string]CacheItem
-	setItems       map[string]map[string]struct{}
-	setExpirations map[string]*time.Time
-	mu             sync.RWMutex // RWMutex for safe concurrent access
+	items             map[string]CacheItem
+	setItems          map[string]map[string]struct{}
+	setExpirations    map[string]*time.Time
+	sketches          map[string]*hyperLogLog
+	sketchExpirations map[string]*time.Time
+	lastSweep         time.Time
+	mu                sync.RWMutex // RWMutex for safe concurrent access
 }
 
+// localSweepInterval is how often writes drop every expired entry. Keys written once and never
+// read again, like the rate limit counters of each window, would otherwise stay forever.
+const localSweepInterval = time.Minute
+
 type CacheItem struct {
 	Value      string
 	Expiration *time.Time // nil if no TTL
@@ -21,13 +31,42 @@ type CacheItem struct {
 
 func NewLocalCache() *LocalCache {
 	return &LocalCache{
-		items:          make(map[string]CacheItem),
-		setItems:       make(map[string]map[string]struct{}),
-		setExpirations: make(map[string]*time.Time),
+		items:             make(map[string]CacheItem),
+		setItems:          make(map[string]map[string]struct{}),
+		setExpirations:    make(map[string]*time.Time),
+		sketches:          make(map[string]*hyperLogLog),
+		sketchExpirations: make(map[string]*time.Time),
+		lastSweep:         time.Now(),
+	}
+}
+
+// sweepExpired drops the expired entries at most once per localSweepInterval. c.mu must be held
+// for writing.
+func (c *LocalCache) sweepExpired(now time.Time) {
+	if now.Sub(c.lastSweep) < localSweepInterval {
+		return
+	}
+	c.lastSweep = now
+	for key, item := range c.items {
+		if item.Expiration != nil && now.After(*item.Expiration) {
+			delete(c.items, key)
+		}
+	}
+	for key, exp := range c.setExpirations {
+		if now.After(*exp) {
+			delete(c.setItems, key)
+			delete(c.setExpirations, key)
+		}
+	}
+	for key, exp := range c.sketchExpirations {
+		if now.After(*exp) {
+			delete(c.sketches, key)
+			delete(c.sketchExpirations, key)
+		}
 	}
 }
 
-func (c *LocalCache) Get(key string) string {
+func (c *LocalCache) Get(ctx context.Context, key string) string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -44,9 +83,10 @@ func (c *LocalCache) Get(key string) string {
 	return item.Value
 }
 
-func (c *LocalCache) Set(key string, value string, ttl *int) error {
+func (c *LocalCache) Set(ctx context.Context, key string, value string, ttl *int) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.sweepExpired(time.Now())
 
 	var expiration *time.Time
 	if ttl != nil {
@@ -61,7 +101,7 @@ func (c *LocalCache) Set(key string, value string, ttl *int) error {
 	return nil
 }
 
-func (c *LocalCache) Delete(key string) {
+func (c *LocalCache) Delete(ctx context.Context, key string) {
 	if c == nil {
 		return
 	}
@@ -72,44 +112,55 @@ func (c *LocalCache) Delete(key string) {
 	delete(c.items, withPrefix(key))
 }
 
-func (c *LocalCache) Clear() error {
+func (c *LocalCache) Clear(ctx context.Context) error {
 	if version.Version != "development" {
-		fmt.Println("Cache can only be cleared in development mode.")
+		slog.WarnContext(ctx, "Cache can only be cleared in development mode")
 		return nil
 	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.items = make(map[string]CacheItem)
+	c.sketches = make(map[string]*hyperLogLog)
+	c.sketchExpirations = make(map[string]*time.Time)
 	return nil
 }
 
-func (c *LocalCache) TryLock(key string, ttl int) (bool, error) {
+func (c *LocalCache) TryLock(ctx context.Context, key string, token string, ttl int) (bool, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	now := time.Now()
+	c.sweepExpired(now)
 
-	if _, exists := c.items[withPrefix(key)]; exists {
+	if item, exists := c.items[withPrefix(key)]; exists && (item.Expiration == nil || !now.After(*item.Expiration)) {
 		return false, nil
 	}
 
-	exp := time.Now().Add(time.Duration(ttl) * time.Second)
+	exp := now.Add(time.Duration(ttl) * time.Second)
 	c.items[withPrefix(key)] = CacheItem{
-		Value:      "locked",
+		Value:      token,
 		Expiration: &exp,
 	}
+	return true, nil
+}
 
-	go func() {
-		time.Sleep(time.Duration(ttl) * time.Second)
-		c.mu.Lock()
-		delete(c.items, withPrefix(key))
-		c.mu.Unlock()
-	}()
+func (c *LocalCache) LockHeld(ctx context.Context, key string) (bool, error) {
+	return c.Get(ctx, key) != "", nil
+}
 
-	return true, nil
+func (c *LocalCache) Unlock(ctx context.Context, key string, token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if item, exists := c.items[withPrefix(key)]; exists && item.Value == token {
+		delete(c.items, withPrefix(key))
+	}
+	return nil
 }
 
-func (c *LocalCache) Sadd(key string, members []string, ttl *int) error {
+func (c *LocalCache) Sadd(ctx context.Context, key string, members []string, ttl *int) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.sweepExpired(time.Now())
 
 	prefixedKey := withPrefix(key)
 
@@ -137,7 +188,7 @@ func (c *LocalCache) Sadd(key string, members []string, ttl *int) error {
 	return nil
 }
 
-func (c *LocalCache) Scard(key string) (int64, error) {
+func (c *LocalCache) Scard(ctx context.Context, key string) (int64, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -153,3 +204,117 @@ func (c *LocalCache) Scard(key string) (int64, error) {
 	}
 	return int64(len(set)), nil
 }
+
+func (c *LocalCache) Smembers(ctx context.Context, key string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	prefixedKey := withPrefix(key)
+
+	if exp, ok := c.setExpirations[prefixedKey]; ok && time.Now().After(*exp) {
+		return []string{}, nil
+	}
+
+	members := make([]string, 0, len(c.setItems[prefixedKey]))
+	for member := range c.setItems[prefixedKey] {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func (c *LocalCache) Pfadd(ctx context.Context, key string, members []string, ttl *int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweepExpired(time.Now())
+
+	prefixedKey := withPrefix(key)
+
+	if exp, ok := c.sketchExpirations[prefixedKey]; ok && time.Now().After(*exp) {
+		delete(c.sketches, prefixedKey)
+		delete(c.sketchExpirations, prefixedKey)
+	}
+
+	sketch, exists := c.sketches[prefixedKey]
+	if !exists {
+		sketch = &hyperLogLog{}
+		c.sketches[prefixedKey] = sketch
+	}
+
+	changed := false
+	for _, member := range members {
+		if sketch.add(member) {
+			changed = true
+		}
+	}
+
+	if ttl != nil && (changed || !exists) {
+		exp := time.Now().Add(time.Duration(*ttl) * time.Second)
+		c.sketchExpirations[prefixedKey] = &exp
+	}
+	return nil
+}
+
+func (c *LocalCache) Pfcount(ctx context.Context, keys ...string) (int64, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	union := &hyperLogLog{}
+	for _, key := range keys {
+		prefixedKey := withPrefix(key)
+		if exp, ok := c.sketchExpirations[prefixedKey]; ok && now.After(*exp) {
+			continue
+		}
+		if sketch, exists := c.sketches[prefixedKey]; exists {
+			union.merge(sketch)
+		}
+	}
+	return union.count(), nil
+}
+
+func (c *LocalCache) Incr(ctx context.Context, key string, ttl *int) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sweepExpired(time.Now())
+
+	fullKey := withPrefix(key)
+	item, exists := c.items[fullKey]
+	if exists && item.Expiration != nil && time.Now().After(*item.Expiration) {
+		exists = false
+	}
+	var count int64
+	if exists {
+		value, err := strconv.ParseInt(item.Value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value of %s is not an integer", key)
+		}
+		count = value
+	} else {
+		item = CacheItem{}
+		if ttl != nil {
+			exp := time.Now().Add(time.Duration(*ttl) * time.Second)
+			item.Expiration = &exp
+		}
+	}
+	count++
+	item.Value = strconv.FormatInt(count, 10)
+	c.items[fullKey] = item
+	return count, nil
+}
+
+func (c *LocalCache) MGet(ctx context.Context, keys []string) []string {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = c.Get(ctx, key)
+	}
+	return values
+}
+
+func (c *LocalCache) MSet(ctx context.Context, values map[string]string, ttl *int) error {
+	for key, value := range values {
+		if err := c.Set(ctx, key, value, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
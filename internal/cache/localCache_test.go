@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	testing2 "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalCacheSweepsExpiredCounters(t *testing2.T) {
+	c := NewLocalCache()
+	ctx := context.Background()
+	ttl := 1
+	for i := 0; i < 100; i++ {
+		_, err := c.Incr(ctx, fmt.Sprintf("ratelimit:api:client-%d:0", i), &ttl)
+		assert.Nil(t, err)
+	}
+	assert.Len(t, c.items, 100)
+
+	time.Sleep(1100 * time.Millisecond)
+	c.lastSweep = time.Now().Add(-localSweepInterval)
+	_, err := c.Incr(ctx, "ratelimit:api:client-0:1", &ttl)
+	assert.Nil(t, err)
+	assert.Len(t, c.items, 1, "Expected the counters of past windows to be swept")
+}
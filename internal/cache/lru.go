@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lru is a memory-bounded in-process store evicting the least recently used entries once the
+// total size of keys and values exceeds maxBytes.
+type lru struct {
+	maxBytes int
+	size     int
+	order    *list.List
+	entries  map[string]*list.Element
+	mu       sync.Mutex
+}
+
+type lruEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+func (e *lruEntry) bytes() int {
+	return len(e.key) + len(e.value)
+}
+
+func newLRU(maxBytes int) *lru {
+	return &lru{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *lru) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		return "", false
+	}
+	entry := element.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.removeElement(element)
+		return "", false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *lru) set(key string, value string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		c.removeElement(element)
+	}
+	entry := &lruEntry{key: key, value: value, expiresAt: time.Now().Add(ttl)}
+	if ttl <= 0 || entry.bytes() > c.maxBytes {
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	c.size += entry.bytes()
+	for c.size > c.maxBytes {
+		c.removeElement(c.order.Back())
+	}
+}
+
+func (c *lru) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		c.removeElement(element)
+	}
+}
+
+func (c *lru) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.size = 0
+}
+
+func (c *lru) removeElement(element *list.Element) {
+	entry := c.order.Remove(element).(*lruEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.bytes()
+}
@@ -0,0 +1,255 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// maxCASAttempts bounds the read-modify-write retries of a single operation under contention.
+const maxCASAttempts = 16
+
+const (
+	maxMemcachedKeyLength          = 250
+	maxMemcachedRelativeExpiration = 30 * 24 * time.Hour
+)
+
+type MemcachedCache struct {
+	client *memcache.Client
+}
+
+func NewMemcachedCache(servers []string) *MemcachedCache {
+	client := memcache.New(servers...)
+	client.Timeout = operationTimeout()
+	if err := client.Ping(); err != nil {
+		panic(err)
+	}
+	return &MemcachedCache{client: client}
+}
+
+// memcachedKey hashes keys Memcached would reject because of their length or characters.
+func memcachedKey(key string) string {
+	fullKey := withPrefix(key)
+	valid := len(fullKey) <= maxMemcachedKeyLength && !strings.ContainsFunc(fullKey, func(r rune) bool {
+		return r <= ' ' || r == 0x7f
+	})
+	if valid {
+		return fullKey
+	}
+	sum := sha256.Sum256([]byte(key))
+	return withPrefix("sha256:" + hex.EncodeToString(sum[:]))
+}
+
+// memcachedExpiration converts the record expiry to Memcached's format: a number of seconds up to
+// 30 days, a unix timestamp beyond.
+func memcachedExpiration(r record) int32 {
+	if r.ExpiresAt == 0 {
+		return 0
+	}
+	expiresAt := time.Unix(0, r.ExpiresAt)
+	remaining := time.Until(expiresAt)
+	if remaining > maxMemcachedRelativeExpiration {
+		return int32(expiresAt.Unix() + 1)
+	}
+	if remaining <= 0 {
+		return 1
+	}
+	return int32((remaining + time.Second - 1) / time.Second)
+}
+
+func decodeItem(item *memcache.Item) (record, bool) {
+	var r record
+	if err := json.Unmarshal(item.Value, &r); err != nil || r.expired() {
+		return record{}, false
+	}
+	return r, true
+}
+
+func (c *MemcachedCache) write(key string, r record) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(&memcache.Item{Key: memcachedKey(key), Value: value, Expiration: memcachedExpiration(r)})
+}
+
+// mutate applies apply to the record stored at key with compare-and-swap, retrying when another
+// client modified it in between. apply returns false when nothing needs to be written.
+func (c *MemcachedCache) mutate(key string, apply func(r *record, exists bool) (bool, error)) error {
+	fullKey := memcachedKey(key)
+	for attempt := 0; attempt < maxCASAttempts; attempt++ {
+		item, err := c.client.Get(fullKey)
+		if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			return err
+		}
+		var r record
+		exists := false
+		if item != nil {
+			r, exists = decodeItem(item)
+		}
+		write, err := apply(&r, exists)
+		if err != nil || !write {
+			return err
+		}
+		value, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			err = c.client.Add(&memcache.Item{Key: fullKey, Value: value, Expiration: memcachedExpiration(r)})
+		} else {
+			item.Value = value
+			item.Expiration = memcachedExpiration(r)
+			err = c.client.CompareAndSwap(item)
+		}
+		if errors.Is(err, memcache.ErrNotStored) || errors.Is(err, memcache.ErrCASConflict) {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("too many concurrent updates of %s", key)
+}
+
+func (c *MemcachedCache) Get(ctx context.Context, key string) string {
+	item, err := c.client.Get(memcachedKey(key))
+	if err != nil {
+		return ""
+	}
+	r, ok := decodeItem(item)
+	if !ok {
+		return ""
+	}
+	return r.Value
+}
+
+func (c *MemcachedCache) Set(ctx context.Context, key string, value string, ttl *int) error {
+	return c.write(key, newValueRecord(value, ttl))
+}
+
+func (c *MemcachedCache) Delete(ctx context.Context, key string) {
+	_ = c.client.Delete(memcachedKey(key))
+}
+
+func (c *MemcachedCache) Clear(ctx context.Context) error {
+	slog.WarnContext(ctx, "Cache can only be cleared in development mode")
+	return nil
+}
+
+func (c *MemcachedCache) TryLock(ctx context.Context, key string, token string, ttl int) (bool, error) {
+	acquired := false
+	err := c.mutate(key, func(r *record, exists bool) (bool, error) {
+		acquired = applyTryLock(r, exists, token, ttl)
+		return acquired, nil
+	})
+	return acquired, err
+}
+
+func (c *MemcachedCache) Unlock(ctx context.Context, key string, token string) error {
+	return c.mutate(key, func(r *record, exists bool) (bool, error) {
+		return applyUnlock(r, exists, token), nil
+	})
+}
+
+func (c *MemcachedCache) LockHeld(ctx context.Context, key string) (bool, error) {
+	return c.Get(ctx, key) != "", nil
+}
+
+func (c *MemcachedCache) Sadd(ctx context.Context, key string, members []string, ttl *int) error {
+	if len(members) == 0 {
+		return nil
+	}
+	return c.mutate(key, func(r *record, exists bool) (bool, error) {
+		return applySadd(r, exists, members, ttl), nil
+	})
+}
+
+func (c *MemcachedCache) Scard(ctx context.Context, key string) (int64, error) {
+	members, err := c.Smembers(ctx, key)
+	return int64(len(members)), err
+}
+
+func (c *MemcachedCache) Smembers(ctx context.Context, key string) ([]string, error) {
+	item, err := c.client.Get(memcachedKey(key))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	r, _ := decodeItem(item)
+	if r.Members == nil {
+		return []string{}, nil
+	}
+	return r.Members, nil
+}
+
+func (c *MemcachedCache) Pfadd(ctx context.Context, key string, members []string, ttl *int) error {
+	if len(members) == 0 {
+		return nil
+	}
+	return c.mutate(key, func(r *record, exists bool) (bool, error) {
+		return applyPfadd(r, exists, members, ttl), nil
+	})
+}
+
+func (c *MemcachedCache) Pfcount(ctx context.Context, keys ...string) (int64, error) {
+	union := &hyperLogLog{}
+	for _, key := range keys {
+		item, err := c.client.Get(memcachedKey(key))
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		if r, ok := decodeItem(item); ok {
+			union.merge(r.sketch())
+		}
+	}
+	return union.count(), nil
+}
+
+func (c *MemcachedCache) Incr(ctx context.Context, key string, ttl *int) (int64, error) {
+	var count int64
+	err := c.mutate(key, func(r *record, exists bool) (bool, error) {
+		var err error
+		count, err = applyIncr(r, exists, key, ttl)
+		return err == nil, err
+	})
+	return count, err
+}
+
+func (c *MemcachedCache) MGet(ctx context.Context, keys []string) []string {
+	values := make([]string, len(keys))
+	fullKeys := make([]string, len(keys))
+	for i, key := range keys {
+		fullKeys[i] = memcachedKey(key)
+	}
+	items, err := c.client.GetMulti(fullKeys)
+	if err != nil {
+		return values
+	}
+	for i, fullKey := range fullKeys {
+		if item, exists := items[fullKey]; exists {
+			if r, ok := decodeItem(item); ok {
+				values[i] = r.Value
+			}
+		}
+	}
+	return values
+}
+
+func (c *MemcachedCache) MSet(ctx context.Context, values map[string]string, ttl *int) error {
+	for key, value := range values {
+		if err := c.write(key, newValueRecord(value, ttl)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// record is how the persistent backends serialize a value, set or sketch along with its expiry,
+// so that every operation can be applied in a single read-modify-write.
+type record struct {
+	Value     string   `json:"value,omitempty"`
+	Members   []string `json:"members,omitempty"`
+	Registers []byte   `json:"registers,omitempty"`
+	ExpiresAt int64    `json:"expiresAt,omitempty"` // unix nanoseconds, 0 if no TTL
+}
+
+func expirationFromTTL(ttl int) int64 {
+	return time.Now().Add(time.Duration(ttl) * time.Second).UnixNano()
+}
+
+func (r *record) expired() bool {
+	return r.ExpiresAt != 0 && time.Now().UnixNano() > r.ExpiresAt
+}
+
+func newValueRecord(value string, ttl *int) record {
+	r := record{Value: value}
+	if ttl != nil {
+		r.ExpiresAt = expirationFromTTL(*ttl)
+	}
+	return r
+}
+
+// applyTryLock returns true when the lock was free and is now held with token for ttl seconds.
+func applyTryLock(r *record, exists bool, token string, ttl int) bool {
+	if exists {
+		return false
+	}
+	*r = record{Value: token, ExpiresAt: expirationFromTTL(ttl)}
+	return true
+}
+
+// applyUnlock expires the lock when it is still held with token.
+func applyUnlock(r *record, exists bool, token string) bool {
+	if !exists || r.Value != token {
+		return false
+	}
+	*r = record{ExpiresAt: 1}
+	return true
+}
+
+// applySadd adds members to the set and, like Redis, refreshes its TTL when it changed.
+func applySadd(r *record, exists bool, members []string, ttl *int) bool {
+	if !exists {
+		*r = record{}
+	}
+	known := make(map[string]struct{}, len(r.Members))
+	for _, member := range r.Members {
+		known[member] = struct{}{}
+	}
+	added := false
+	for _, member := range members {
+		if _, ok := known[member]; ok {
+			continue
+		}
+		known[member] = struct{}{}
+		r.Members = append(r.Members, member)
+		added = true
+	}
+	if added && ttl != nil {
+		r.ExpiresAt = expirationFromTTL(*ttl)
+	}
+	return added
+}
+
+// applyPfadd adds members to the sketch and refreshes its TTL when it changed.
+func applyPfadd(r *record, exists bool, members []string, ttl *int) bool {
+	if !exists {
+		*r = record{}
+	}
+	sketch := r.sketch()
+	changed := !exists
+	for _, member := range members {
+		if sketch.add(member) {
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+	r.Registers = sketch.registers[:]
+	if ttl != nil {
+		r.ExpiresAt = expirationFromTTL(*ttl)
+	}
+	return true
+}
+
+func (r *record) sketch() *hyperLogLog {
+	sketch := &hyperLogLog{}
+	copy(sketch.registers[:], r.Registers)
+	return sketch
+}
+
+// applyIncr increments the counter, setting its TTL when the counter is created.
+func applyIncr(r *record, exists bool, key string, ttl *int) (int64, error) {
+	var count int64
+	if exists {
+		value, err := strconv.ParseInt(r.Value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value of %s is not an integer", key)
+		}
+		count = value
+	} else {
+		*r = record{}
+		if ttl != nil {
+			r.ExpiresAt = expirationFromTTL(*ttl)
+		}
+	}
+	count++
+	r.Value = strconv.FormatInt(count, 10)
+	return count, nil
+}
@@ -4,12 +4,21 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
-	"fmt"
+	"expo-open-ota/config"
+	"log/slog"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+const defaultOperationTimeout = 2 * time.Second
+
+// operationTimeout bounds every Redis round trip so an unresponsive server fails the
+// operation instead of blocking the caller.
+func operationTimeout() time.Duration {
+	return config.GetDurationEnv("CACHE_OPERATION_TIMEOUT_MS", defaultOperationTimeout)
+}
+
 type RedisCache struct {
 	client   redis.Cmdable // Changed from *redis.Client to interface
 	host     string
@@ -56,8 +65,8 @@ func NewRedisCache(host, password, port string, useTLS bool, useCluster bool) *R
 	return &RedisCache{client: client}
 }
 
-func (c *RedisCache) Get(key string) string {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+func (c *RedisCache) Get(ctx context.Context, key string) string {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
 	defer cancel()
 
 	val, err := c.client.Get(ctx, withPrefix(key)).Result()
@@ -69,41 +78,61 @@ func (c *RedisCache) Get(key string) string {
 	return val
 }
 
-func (c *RedisCache) Set(key string, value string, ttl *int) error {
+func (c *RedisCache) Set(ctx context.Context, key string, value string, ttl *int) error {
 	expiration := time.Duration(0)
 	if ttl != nil {
 		expiration = time.Duration(*ttl) * time.Second
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
 	defer cancel()
 
 	return c.client.Set(ctx, withPrefix(key), value, expiration).Err()
 }
 
-func (c *RedisCache) Delete(key string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+func (c *RedisCache) Delete(ctx context.Context, key string) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
 	defer cancel()
 
 	c.client.Del(ctx, withPrefix(key))
 }
 
-func (c *RedisCache) Clear() error {
-	fmt.Println("Cache can only be cleared in development mode.")
+func (c *RedisCache) Clear(ctx context.Context) error {
+	slog.WarnContext(ctx, "Cache can only be cleared in development mode")
 	return nil
 }
 
-func (r *RedisCache) TryLock(key string, ttl int) (bool, error) {
-	ctx := context.Background()
-	ok, err := r.client.SetNX(ctx, withPrefix(key), "locked", time.Duration(ttl)*time.Second).Result()
+func (r *RedisCache) TryLock(ctx context.Context, key string, token string, ttl int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+
+	ok, err := r.client.SetNX(ctx, withPrefix(key), token, time.Duration(ttl)*time.Second).Result()
 	return ok, err
 }
 
-func (c *RedisCache) Sadd(key string, members []string, ttl *int) error {
+// unlockScript deletes the lock only when it still holds the token, atomically.
+var unlockScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+func (r *RedisCache) Unlock(ctx context.Context, key string, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+
+	return unlockScript.Run(ctx, r.client, []string{withPrefix(key)}, token).Err()
+}
+
+func (r *RedisCache) LockHeld(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+
+	count, err := r.client.Exists(ctx, withPrefix(key)).Result()
+	return count > 0, err
+}
+
+func (c *RedisCache) Sadd(ctx context.Context, key string, members []string, ttl *int) error {
 	if len(members) == 0 {
 		return nil
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
 	defer cancel()
 
 	fullKey := withPrefix(key)
@@ -125,9 +154,167 @@ func (c *RedisCache) Sadd(key string, members []string, ttl *int) error {
 	return nil
 }
 
-func (c *RedisCache) Scard(key string) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+func (c *RedisCache) Scard(ctx context.Context, key string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
 	defer cancel()
 
 	return c.client.SCard(ctx, withPrefix(key)).Result()
-}
\ No newline at end of file
+}
+func (c *RedisCache) Smembers(ctx context.Context, key string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+
+	return c.client.SMembers(ctx, withPrefix(key)).Result()
+}
+
+func (c *RedisCache) Pfadd(ctx context.Context, key string, members []string, ttl *int) error {
+	if len(members) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+
+	fullKey := withPrefix(key)
+
+	vals := make([]interface{}, len(members))
+	for i, m := range members {
+		vals[i] = m
+	}
+
+	changed, err := c.client.PFAdd(ctx, fullKey, vals...).Result()
+	if err != nil {
+		return err
+	}
+
+	if ttl != nil && changed > 0 {
+		_ = c.client.Expire(ctx, fullKey, time.Duration(*ttl)*time.Second).Err()
+	}
+
+	return nil
+}
+
+func (c *RedisCache) Pfcount(ctx context.Context, keys ...string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+
+	fullKeys := make([]string, len(keys))
+	for i, key := range keys {
+		fullKeys[i] = withPrefix(key)
+	}
+	return c.client.PFCount(ctx, fullKeys...).Result()
+}
+
+// Incr increments the counter stored at key and sets its TTL when the counter is created.
+// incrScript increments the counter and sets its TTL in one step, so a counter is never left
+// without one. Counters missing their TTL are given one on their next increment.
+var incrScript = redis.NewScript(`local count = redis.call("INCR", KEYS[1]) if tonumber(ARGV[1]) > 0 and redis.call("TTL", KEYS[1]) == -1 then redis.call("EXPIRE", KEYS[1], ARGV[1]) end return count`)
+
+func (c *RedisCache) Incr(ctx context.Context, key string, ttl *int) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+
+	seconds := 0
+	if ttl != nil {
+		seconds = *ttl
+	}
+	return incrScript.Run(ctx, c.client, []string{withPrefix(key)}, seconds).Int64()
+}
+
+// MGet reads all keys in a single pipelined round trip, which unlike MGET also works when the keys
+// live in different cluster slots.
+func (c *RedisCache) MGet(ctx context.Context, keys []string) []string {
+	values, _ := c.mgetWithTTL(ctx, keys)
+	return values
+}
+
+// mgetWithTTL returns the values of keys along with their remaining TTL, negative when the key
+// does not expire.
+func (c *RedisCache) mgetWithTTL(ctx context.Context, keys []string) ([]string, []time.Duration) {
+	values := make([]string, len(keys))
+	ttls := make([]time.Duration, len(keys))
+	if len(keys) == 0 {
+		return values, ttls
+	}
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+
+	getCmds := make([]*redis.StringCmd, len(keys))
+	ttlCmds := make([]*redis.DurationCmd, len(keys))
+	_, _ = c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			getCmds[i] = pipe.Get(ctx, withPrefix(key))
+			ttlCmds[i] = pipe.PTTL(ctx, withPrefix(key))
+		}
+		return nil
+	})
+	for i := range keys {
+		if value, err := getCmds[i].Result(); err == nil {
+			values[i] = value
+		}
+		ttls[i] = ttlCmds[i].Val()
+	}
+	return values, ttls
+}
+
+func (c *RedisCache) MSet(ctx context.Context, values map[string]string, ttl *int) error {
+	if len(values) == 0 {
+		return nil
+	}
+	expiration := time.Duration(0)
+	if ttl != nil {
+		expiration = time.Duration(*ttl) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, value := range values {
+			pipe.Set(ctx, withPrefix(key), value, expiration)
+		}
+		return nil
+	})
+	return err
+}
+
+func (c *RedisCache) publish(ctx context.Context, channel string, message string) error {
+	ctx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+
+	return c.client.Publish(ctx, withPrefix(channel), message).Err()
+}
+
+// subscribe delivers every message published on channel to onMessage until ctx is done.
+// onResubscribe is called when the connection was lost and restored, as messages may have been
+// missed in between.
+func (c *RedisCache) subscribe(ctx context.Context, channel string, onMessage func(message string), onResubscribe func()) error {
+	subscriber, ok := c.client.(interface {
+		Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+	})
+	if !ok {
+		return errors.New("redis client does not support pub/sub")
+	}
+	pubsub := subscriber.Subscribe(ctx, withPrefix(channel))
+	receiveCtx, cancel := context.WithTimeout(ctx, operationTimeout())
+	defer cancel()
+	if _, err := pubsub.Receive(receiveCtx); err != nil {
+		_ = pubsub.Close()
+		return err
+	}
+	messages := pubsub.ChannelWithSubscriptions()
+	go func() {
+		<-ctx.Done()
+		_ = pubsub.Close()
+	}()
+	go func() {
+		for message := range messages {
+			switch m := message.(type) {
+			case *redis.Message:
+				onMessage(m.Payload)
+			case *redis.Subscription:
+				onResubscribe()
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"expo-open-ota/internal/tracing"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedCache wraps a Cache implementation with one span per operation.
+type tracedCache struct {
+	cache     Cache
+	cacheType CacheType
+}
+
+func (c *tracedCache) startSpan(ctx context.Context, operation string, key string) (context.Context, trace.Span) {
+	return tracing.StartSpan(ctx, "cache."+operation,
+		attribute.String("cache.type", string(c.cacheType)),
+		attribute.String("cache.key", key),
+	)
+}
+
+func (c *tracedCache) Get(ctx context.Context, key string) string {
+	ctx, span := c.startSpan(ctx, "Get", key)
+	defer span.End()
+	value := c.cache.Get(ctx, key)
+	span.SetAttributes(attribute.Bool("cache.hit", value != ""))
+	return value
+}
+
+func (c *tracedCache) Set(ctx context.Context, key string, value string, ttl *int) (err error) {
+	ctx, span := c.startSpan(ctx, "Set", key)
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.Set(ctx, key, value, ttl)
+}
+
+func (c *tracedCache) Delete(ctx context.Context, key string) {
+	ctx, span := c.startSpan(ctx, "Delete", key)
+	defer span.End()
+	c.cache.Delete(ctx, key)
+}
+
+func (c *tracedCache) Clear(ctx context.Context) (err error) {
+	ctx, span := c.startSpan(ctx, "Clear", "")
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.Clear(ctx)
+}
+
+func (c *tracedCache) TryLock(ctx context.Context, key string, token string, ttl int) (acquired bool, err error) {
+	ctx, span := c.startSpan(ctx, "TryLock", key)
+	defer func() {
+		span.SetAttributes(attribute.Bool("cache.lock_acquired", acquired))
+		tracing.EndSpan(span, err)
+	}()
+	return c.cache.TryLock(ctx, key, token, ttl)
+}
+
+func (c *tracedCache) Unlock(ctx context.Context, key string, token string) (err error) {
+	ctx, span := c.startSpan(ctx, "Unlock", key)
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.Unlock(ctx, key, token)
+}
+
+func (c *tracedCache) LockHeld(ctx context.Context, key string) (held bool, err error) {
+	ctx, span := c.startSpan(ctx, "LockHeld", key)
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.LockHeld(ctx, key)
+}
+
+func (c *tracedCache) Sadd(ctx context.Context, key string, members []string, ttl *int) (err error) {
+	ctx, span := c.startSpan(ctx, "Sadd", key)
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.Sadd(ctx, key, members, ttl)
+}
+
+func (c *tracedCache) Scard(ctx context.Context, key string) (count int64, err error) {
+	ctx, span := c.startSpan(ctx, "Scard", key)
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.Scard(ctx, key)
+}
+
+func (c *tracedCache) Smembers(ctx context.Context, key string) (members []string, err error) {
+	ctx, span := c.startSpan(ctx, "Smembers", key)
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.Smembers(ctx, key)
+}
+
+func (c *tracedCache) Pfadd(ctx context.Context, key string, members []string, ttl *int) (err error) {
+	ctx, span := c.startSpan(ctx, "Pfadd", key)
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.Pfadd(ctx, key, members, ttl)
+}
+
+func (c *tracedCache) Pfcount(ctx context.Context, keys ...string) (count int64, err error) {
+	ctx, span := c.startSpan(ctx, "Pfcount", strings.Join(keys, ","))
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.Pfcount(ctx, keys...)
+}
+
+func (c *tracedCache) Incr(ctx context.Context, key string, ttl *int) (count int64, err error) {
+	ctx, span := c.startSpan(ctx, "Incr", key)
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.Incr(ctx, key, ttl)
+}
+
+func (c *tracedCache) MGet(ctx context.Context, keys []string) []string {
+	ctx, span := c.startSpan(ctx, "MGet", strings.Join(keys, ","))
+	defer span.End()
+	values := c.cache.MGet(ctx, keys)
+	hits := 0
+	for _, value := range values {
+		if value != "" {
+			hits++
+		}
+	}
+	span.SetAttributes(attribute.Int("cache.keys", len(keys)), attribute.Int("cache.hits", hits))
+	return values
+}
+
+func (c *tracedCache) MSet(ctx context.Context, values map[string]string, ttl *int) (err error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	ctx, span := c.startSpan(ctx, "MSet", strings.Join(keys, ","))
+	defer func() { tracing.EndSpan(span, err) }()
+	return c.cache.MSet(ctx, values, ttl)
+}
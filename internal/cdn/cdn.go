@@ -1,10 +1,13 @@
 package cdn
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 type CDN interface {
-	isCDNAvailable() bool
-	ComputeRedirectionURLForAsset(branch, runtimeVersion, updateId, asset string) (string, error)
+	isCDNAvailable(ctx context.Context) bool
+	ComputeRedirectionURLForAsset(ctx context.Context, branch, runtimeVersion, updateId, asset string) (string, error)
 }
 
 var (
@@ -15,7 +18,7 @@ var (
 func GetCDN() CDN {
 	once.Do(func() {
 		cloudfrontCDN := CloudfrontCDN{}
-		isCloudfrontCDNavailable := (&cloudfrontCDN).isCDNAvailable()
+		isCloudfrontCDNavailable := (&cloudfrontCDN).isCDNAvailable(context.Background())
 		if isCloudfrontCDNavailable {
 			cdnInstance = &cloudfrontCDN
 		}
@@ -2,6 +2,7 @@ package cdn
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"errors"
 	"expo-open-ota/config"
@@ -21,8 +22,8 @@ func getCloudfrontKeyPairId() string {
 	return config.GetEnv("CLOUDFRONT_KEY_PAIR_ID")
 }
 
-func (c *CloudfrontCDN) isCDNAvailable() bool {
-	privateCloudfrontCert := keyStore.GetPrivateCloudfrontKey()
+func (c *CloudfrontCDN) isCDNAvailable(ctx context.Context) bool {
+	privateCloudfrontCert := keyStore.GetPrivateCloudfrontKey(ctx)
 	domain := getCloudfrontDomain()
 	keyPairId := getCloudfrontKeyPairId()
 	return privateCloudfrontCert != "" && domain != "" && keyPairId != ""
@@ -40,10 +41,10 @@ func getSigner(key string) (crypto.Signer, error) {
 	return privateKey, nil
 }
 
-func (c *CloudfrontCDN) ComputeRedirectionURLForAsset(branch, runtimeVersion, updateId, asset string) (string, error) {
+func (c *CloudfrontCDN) ComputeRedirectionURLForAsset(ctx context.Context, branch, runtimeVersion, updateId, asset string) (string, error) {
 	domain := getCloudfrontDomain()
 	keyPairId := getCloudfrontKeyPairId()
-	privateCloudfrontCert := keyStore.GetPrivateCloudfrontKey()
+	privateCloudfrontCert := keyStore.GetPrivateCloudfrontKey(ctx)
 
 	if domain == "" || keyPairId == "" || privateCloudfrontCert == "" {
 		return "", errors.New("CloudFront configuration is incomplete")
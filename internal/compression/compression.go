@@ -2,55 +2,56 @@ package compression
 
 import (
 	"compress/gzip"
+	"context"
 	"github.com/andybalholm/brotli"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 )
 
-func compressWithGzip(w http.ResponseWriter, data []byte, requestID string) error {
+func compressWithGzip(ctx context.Context, w http.ResponseWriter, data []byte) error {
 	w.Header().Set("Content-Encoding", "gzip")
 	gz := gzip.NewWriter(w)
 	defer gz.Close()
 
 	_, err := gz.Write(data)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error compressing with Gzip: %v", requestID, err)
+		slog.ErrorContext(ctx, "Error compressing with Gzip", "error", err)
 	}
 	return err
 }
 
-func compressWithBrotli(w http.ResponseWriter, data []byte, requestID string) error {
+func compressWithBrotli(ctx context.Context, w http.ResponseWriter, data []byte) error {
 	w.Header().Set("Content-Encoding", "br")
 	br := brotli.NewWriter(w)
 	defer br.Close()
 
 	_, err := br.Write(data)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error compressing with Brotli: %v", requestID, err)
+		slog.ErrorContext(ctx, "Error compressing with Brotli", "error", err)
 	}
 	return err
 }
 
-func ServeCompressedAsset(w http.ResponseWriter, r *http.Request, data []byte, contentType, requestID string) {
+func ServeCompressedAsset(w http.ResponseWriter, r *http.Request, data []byte, contentType string) {
 	w.Header().Set("Content-Type", contentType)
 	acceptEncoding := r.Header.Get("Accept-Encoding")
-	log.Printf("[RequestID: %s] Serving asset with content type: %s", requestID, contentType)
+	slog.DebugContext(r.Context(), "Serving asset", "contentType", contentType)
 
 	if strings.Contains(acceptEncoding, "br") {
-		if err := compressWithBrotli(w, data, requestID); err != nil {
+		if err := compressWithBrotli(r.Context(), w, data); err != nil {
 			http.Error(w, "Error compressing with Brotli", http.StatusInternalServerError)
 			return
 		}
 	} else if strings.Contains(acceptEncoding, "gzip") {
-		if err := compressWithGzip(w, data, requestID); err != nil {
+		if err := compressWithGzip(r.Context(), w, data); err != nil {
 			http.Error(w, "Error compressing with Gzip", http.StatusInternalServerError)
 			return
 		}
 	} else {
 		_, err := w.Write(data)
 		if err != nil {
-			log.Printf("[RequestID: %s] Error writing uncompressed response: %v", requestID, err)
+			slog.ErrorContext(r.Context(), "Error writing uncompressed response", "error", err)
 		}
 	}
 }
@@ -0,0 +1,234 @@
+package crashguard
+
+import (
+	"context"
+	"encoding/json"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/audit"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/crypto"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"expo-open-ota/internal/version"
+	"expo-open-ota/internal/webhooks"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Action string
+
+const (
+	// Fallback halts the faulty update so clients receive the previous valid one.
+	Fallback Action = "fallback"
+	// Rollback publishes a rollback to the embedded update.
+	Rollback Action = "rollback"
+)
+
+type Settings struct {
+	Threshold      float64 `json:"threshold"`
+	WindowSeconds  int     `json:"windowSeconds"`
+	MinActiveUsers int64   `json:"minActiveUsers"`
+	Action         Action  `json:"action"`
+}
+
+const (
+	defaultWindowSeconds  = 3600
+	defaultMinActiveUsers = 50
+)
+
+var (
+	settingsByBranch map[string]Settings
+	settingsOnce     sync.Once
+)
+
+// loadSettings parses CRASH_GUARD_CONFIG on first use, so manifest requests don't parse it again.
+func loadSettings() map[string]Settings {
+	settingsOnce.Do(func() {
+		settingsByBranch = nil
+		rawConfig := config.GetEnv("CRASH_GUARD_CONFIG")
+		if rawConfig == "" {
+			return
+		}
+		if err := json.Unmarshal([]byte(rawConfig), &settingsByBranch); err != nil {
+			slog.Error("Invalid CRASH_GUARD_CONFIG", "error", err)
+			settingsByBranch = nil
+		}
+	})
+	return settingsByBranch
+}
+
+// ResetSettings makes the next call read CRASH_GUARD_CONFIG again.
+func ResetSettings() {
+	settingsByBranch = nil
+	settingsOnce = sync.Once{}
+}
+
+// GetSettings returns the crash guard settings of a branch, or nil when the branch is not guarded.
+func GetSettings(branch string) *Settings {
+	settings, ok := loadSettings()[branch]
+	if !ok || settings.Threshold <= 0 {
+		return nil
+	}
+	if settings.WindowSeconds <= 0 {
+		settings.WindowSeconds = defaultWindowSeconds
+	}
+	if settings.MinActiveUsers <= 0 {
+		settings.MinActiveUsers = defaultMinActiveUsers
+	}
+	if settings.Action != Rollback {
+		settings.Action = Fallback
+	}
+	return &settings
+}
+
+// Window returns the index of the time bucket users are counted in. Buckets are keyed by index
+// so a bucket stops receiving users once its window is over, whatever its TTL.
+func Window(windowSeconds int, now time.Time) int64 {
+	return now.Unix() / int64(windowSeconds)
+}
+
+// The update part of the user keys is a Redis Cluster hash tag, so the buckets of an update can be
+// counted together.
+func ComputeActiveUsersCacheKey(branch, runtimeVersion, platform, updateUUID string, window int64) string {
+	return fmt.Sprintf("crashGuard:%s:activeUsers:{%s:%s:%s:%s}:%d", version.Version, branch, runtimeVersion, platform, updateUUID, window)
+}
+
+func ComputeErrorUsersCacheKey(branch, runtimeVersion, platform, updateUUID string, window int64) string {
+	return fmt.Sprintf("crashGuard:%s:errorUsers:{%s:%s:%s:%s}:%d", version.Version, branch, runtimeVersion, platform, updateUUID, window)
+}
+
+func ComputeTriggerLockKey(branch, runtimeVersion, platform, updateUUID string) string {
+	return fmt.Sprintf("crashGuard:%s:trigger:%s:%s:%s:%s", version.Version, branch, runtimeVersion, platform, updateUUID)
+}
+
+// ParseFailedUpdateIds parses the Expo-Recent-Failed-Update-Ids header, a list of quoted update ids.
+func ParseFailedUpdateIds(header string) []string {
+	var ids []string
+	for _, id := range strings.Split(header, ",") {
+		id = strings.Trim(strings.TrimSpace(id), "\"")
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Evaluate records the client against the latest update of the branch and reverts
+// that update once its error rate crosses the configured threshold.
+func Evaluate(ctx context.Context, branch, runtimeVersion, platform, clientId, currentUpdateId string, failedUpdateIds []string) {
+	settings := GetSettings(branch)
+	if settings == nil || clientId == "" {
+		return
+	}
+	latestUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(ctx, branch, runtimeVersion, platform)
+	if err != nil || latestUpdate == nil {
+		return
+	}
+	if update.GetUpdateType(ctx, *latestUpdate) == types.Rollback {
+		return
+	}
+	metadata, err := update.GetMetadata(ctx, *latestUpdate)
+	if err != nil {
+		return
+	}
+	updateUUID := crypto.ConvertSHA256HashToUUID(metadata.ID)
+
+	failed := false
+	for _, id := range failedUpdateIds {
+		if strings.EqualFold(id, updateUUID) {
+			failed = true
+			break
+		}
+	}
+	if !failed && !strings.EqualFold(currentUpdateId, updateUUID) {
+		return
+	}
+
+	// Users are counted over the current and previous buckets, so the window slides by whole
+	// buckets and the previous one must outlive the current one.
+	cache := cache2.GetCache()
+	ttl := 2 * settings.WindowSeconds
+	window := Window(settings.WindowSeconds, time.Now())
+	activeUsersKey := ComputeActiveUsersCacheKey(branch, runtimeVersion, platform, updateUUID, window)
+	errorUsersKey := ComputeErrorUsersCacheKey(branch, runtimeVersion, platform, updateUUID, window)
+	_ = cache.Pfadd(ctx, activeUsersKey, []string{clientId}, &ttl)
+	if failed {
+		_ = cache.Pfadd(ctx, errorUsersKey, []string{clientId}, &ttl)
+	}
+
+	activeUsers, err := cache.Pfcount(ctx, activeUsersKey, ComputeActiveUsersCacheKey(branch, runtimeVersion, platform, updateUUID, window-1))
+	if err != nil || activeUsers < settings.MinActiveUsers {
+		return
+	}
+	errorUsers, err := cache.Pfcount(ctx, errorUsersKey, ComputeErrorUsersCacheKey(branch, runtimeVersion, platform, updateUUID, window-1))
+	if err != nil {
+		return
+	}
+	errorRate := float64(errorUsers) / float64(activeUsers)
+	if errorRate < settings.Threshold {
+		return
+	}
+	acquired, err := cache.TryLock(ctx, ComputeTriggerLockKey(branch, runtimeVersion, platform, updateUUID), clientId, settings.WindowSeconds)
+	if err != nil || !acquired {
+		return
+	}
+	trigger(ctx, *latestUpdate, updateUUID, platform, *settings, errorRate, activeUsers, errorUsers)
+}
+
+func trigger(ctx context.Context, faultyUpdate types.Update, updateUUID, platform string, settings Settings, errorRate float64, activeUsers, errorUsers int64) {
+	logger := slog.With("component", "crashGuard", "branch", faultyUpdate.Branch, "runtimeVersion", faultyUpdate.RuntimeVersion, "platform", platform, "updateId", faultyUpdate.UpdateId)
+	reason := fmt.Sprintf("error rate %.4f over %d active users exceeded threshold %.4f", errorRate, activeUsers, settings.Threshold)
+	logger.WarnContext(ctx, "Crash guard triggered", "reason", reason, "action", settings.Action)
+
+	auditAction := audit.CrashGuardHalt
+	details := map[string]string{
+		"updateUUID":  updateUUID,
+		"errorRate":   fmt.Sprintf("%.4f", errorRate),
+		"activeUsers": fmt.Sprintf("%d", activeUsers),
+		"errorUsers":  fmt.Sprintf("%d", errorUsers),
+		"threshold":   fmt.Sprintf("%.4f", settings.Threshold),
+	}
+	if settings.Action == Rollback {
+		auditAction = audit.CrashGuardRollback
+		commitHash := ""
+		if storedMetadata, err := update.RetrieveUpdateStoredMetadata(ctx, faultyUpdate); err == nil && storedMetadata != nil {
+			commitHash = storedMetadata.CommitHash
+		}
+		rollback, err := update.CreateRollback(ctx, platform, commitHash, faultyUpdate.RuntimeVersion, faultyUpdate.Branch)
+		if err != nil {
+			logger.ErrorContext(ctx, "Error creating rollback", "error", err)
+			return
+		}
+		details["rollbackUpdateId"] = rollback.UpdateId
+	} else {
+		if err := update.HaltUpdate(ctx, faultyUpdate, platform, reason); err != nil {
+			logger.ErrorContext(ctx, "Error halting update", "error", err)
+			return
+		}
+	}
+
+	err := audit.Record(ctx, audit.Entry{
+		Action:         auditAction,
+		Actor:          "crashGuard",
+		Branch:         faultyUpdate.Branch,
+		RuntimeVersion: faultyUpdate.RuntimeVersion,
+		Platform:       platform,
+		UpdateId:       faultyUpdate.UpdateId,
+		Details:        details,
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "Error recording audit entry", "error", err)
+	}
+	webhooks.Dispatch(webhooks.Payload{
+		Event:          webhooks.UpdateCrashGuardTriggered,
+		Branch:         faultyUpdate.Branch,
+		RuntimeVersion: faultyUpdate.RuntimeVersion,
+		UpdateId:       faultyUpdate.UpdateId,
+		UpdateUUID:     updateUUID,
+		Platform:       platform,
+		Reason:         reason,
+	})
+}
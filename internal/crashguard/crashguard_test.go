@@ -0,0 +1,51 @@
+package crashguard
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	testing2 "testing"
+)
+
+func TestParseFailedUpdateIds(t *testing2.T) {
+	assert.Equal(t, []string{"a-1", "b-2"}, ParseFailedUpdateIds(`"a-1", "b-2"`))
+	assert.Equal(t, []string{"a-1"}, ParseFailedUpdateIds("a-1"))
+	assert.Empty(t, ParseFailedUpdateIds(""))
+}
+
+func TestGetSettings(t *testing2.T) {
+	os.Setenv("CRASH_GUARD_CONFIG", `{"production":{"threshold":0.1,"action":"rollback"},"staging":{"threshold":0.2,"action":"unknown"},"preview":{}}`)
+	ResetSettings()
+	defer ResetSettings()
+	defer os.Unsetenv("CRASH_GUARD_CONFIG")
+
+	production := GetSettings("production")
+	require.NotNil(t, production)
+	assert.Equal(t, 0.1, production.Threshold)
+	assert.Equal(t, Rollback, production.Action)
+	assert.Equal(t, defaultWindowSeconds, production.WindowSeconds)
+	assert.Equal(t, int64(defaultMinActiveUsers), production.MinActiveUsers)
+
+	staging := GetSettings("staging")
+	require.NotNil(t, staging)
+	assert.Equal(t, Fallback, staging.Action)
+
+	assert.Nil(t, GetSettings("preview"))
+	assert.Nil(t, GetSettings("unknown"))
+}
+
+func TestGetSettingsParsesConfigOnce(t *testing2.T) {
+	os.Setenv("CRASH_GUARD_CONFIG", `{"production":{"threshold":0.1}}`)
+	ResetSettings()
+	defer ResetSettings()
+	defer os.Unsetenv("CRASH_GUARD_CONFIG")
+	require.NotNil(t, GetSettings("production"))
+
+	os.Setenv("CRASH_GUARD_CONFIG", `{"staging":{"threshold":0.1}}`)
+	assert.NotNil(t, GetSettings("production"))
+	assert.Nil(t, GetSettings("staging"))
+
+	ResetSettings()
+	assert.Nil(t, GetSettings("production"))
+	assert.NotNil(t, GetSettings("staging"))
+}
@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"crypto"
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/rsa"
@@ -44,6 +45,12 @@ func CreateHash(data []byte, hashingAlgorithm, encoding string) (string, error)
 	}
 }
 
+func SignHMACSHA256(data []byte, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func ConvertSHA256HashToUUID(value string) string {
 	if len(value) < 32 {
 		return ""
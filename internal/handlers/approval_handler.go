@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/branch"
+	"expo-open-ota/internal/types"
+	update2 "expo-open-ota/internal/update"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// requireIdentity returns the identity of the request, answering 403 when allowed refuses it.
+// Requests authenticated with Expo auth have no role, so CI tokens are always refused.
+func requireIdentity(w http.ResponseWriter, r *http.Request, allowed func(auth.Identity) bool) (auth.Identity, bool) {
+	identity, ok := auth.IdentityFromContext(r.Context())
+	if !ok || !allowed(identity) {
+		slog.WarnContext(r.Context(), "Forbidden", "actor", identity.Name, "role", identity.Role)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return identity, false
+	}
+	return identity, true
+}
+
+func GetBranchProtectionHandler(w http.ResponseWriter, r *http.Request) {
+	protection, err := branch.GetProtection(r.Context(), mux.Vars(r)["BRANCH"])
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting branch protection", "error", err)
+		http.Error(w, "Error getting branch protection", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(protection)
+}
+
+func SetBranchProtectionHandler(w http.ResponseWriter, r *http.Request) {
+	identity, ok := requireIdentity(w, r, auth.Identity.IsAdmin)
+	if !ok {
+		return
+	}
+	branchName := mux.Vars(r)["BRANCH"]
+	var protection branch.Protection
+	if err := json.NewDecoder(r.Body).Decode(&protection); err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		http.Error(w, "Error decoding request body", http.StatusBadRequest)
+		return
+	}
+	if err := branch.SetProtection(r.Context(), branchName, &protection); err != nil {
+		slog.ErrorContext(r.Context(), "Error storing branch protection", "error", err)
+		http.Error(w, "Error storing branch protection", http.StatusInternalServerError)
+		return
+	}
+	err := audit.Record(r.Context(), audit.Entry{
+		Action:  audit.ProtectBranch,
+		Actor:   identity.Name,
+		Branch:  branchName,
+		Details: map[string]string{"protected": strconv.FormatBool(protection.Protected)},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error recording audit entry", "error", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(protection)
+}
+
+// resolvePendingUpdate returns the update of the route, answering 404 when it doesn't exist and
+// 409 when it is not pending approval.
+func resolvePendingUpdate(w http.ResponseWriter, r *http.Request) (*types.Update, *types.UpdateStoredMetadata, bool) {
+	vars := mux.Vars(r)
+	update, err := update2.GetUpdate(vars["BRANCH"], vars["RUNTIME_VERSION"], vars["UPDATE_ID"])
+	if err != nil {
+		http.Error(w, "Update not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	storedMetadata, err := update2.RetrieveUpdateStoredMetadata(r.Context(), *update)
+	if err != nil || storedMetadata == nil {
+		http.Error(w, "Update not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if !update2.IsUpdatePending(r.Context(), *update) {
+		http.Error(w, "Update is not pending approval", http.StatusConflict)
+		return nil, nil, false
+	}
+	return update, storedMetadata, true
+}
+
+func recordApprovalEntries(r *http.Request, action audit.Action, actor string, updates []types.Update, storedMetadata *types.UpdateStoredMetadata) {
+	details := map[string]string{"requestedBy": storedMetadata.Approval.RequestedBy}
+	if storedMetadata.Group != nil {
+		details["groupId"] = storedMetadata.Group.Id
+	}
+	for _, update := range updates {
+		err := audit.Record(r.Context(), audit.Entry{
+			Action:         action,
+			Actor:          actor,
+			Branch:         update.Branch,
+			RuntimeVersion: update.RuntimeVersion,
+			UpdateId:       update.UpdateId,
+			Details:        details,
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error recording audit entry", "error", err)
+		}
+	}
+}
+
+func ApproveUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	identity, ok := requireIdentity(w, r, auth.Identity.CanApprove)
+	if !ok {
+		return
+	}
+	update, storedMetadata, ok := resolvePendingUpdate(w, r)
+	if !ok {
+		return
+	}
+	approved, err := update2.ApproveUpdate(r.Context(), *update, identity.Name)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error approving update", "error", err)
+		http.Error(w, "Error approving update", http.StatusConflict)
+		return
+	}
+	recordApprovalEntries(r, audit.ApproveUpdate, identity.Name, approved, storedMetadata)
+	slog.InfoContext(r.Context(), "Update approved", "updateId", update.UpdateId, "approvedBy", identity.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(approved)
+}
+
+func RejectUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	identity, ok := requireIdentity(w, r, auth.Identity.CanApprove)
+	if !ok {
+		return
+	}
+	update, storedMetadata, ok := resolvePendingUpdate(w, r)
+	if !ok {
+		return
+	}
+	rejected, err := update2.RejectUpdate(r.Context(), *update)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error rejecting update", "error", err)
+		http.Error(w, "Error rejecting update", http.StatusConflict)
+		return
+	}
+	recordApprovalEntries(r, audit.RejectUpdate, identity.Name, rejected, storedMetadata)
+	slog.InfoContext(r.Context(), "Update rejected", "updateId", update.UpdateId, "rejectedBy", identity.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rejected)
+}
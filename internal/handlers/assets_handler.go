@@ -2,41 +2,39 @@ package handlers
 
 import (
 	"expo-open-ota/internal/assets"
+	"expo-open-ota/internal/assignment"
 	cdn2 "expo-open-ota/internal/cdn"
 	"expo-open-ota/internal/compression"
 	"expo-open-ota/internal/services"
-	"github.com/google/uuid"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
 func AssetsHandler(w http.ResponseWriter, r *http.Request) {
-	requestID := uuid.New().String()
 	channelName := r.Header.Get("expo-channel-name")
 	preventCDNRedirection := r.Header.Get("prevent-cdn-redirection") == "true"
-	branchMap, err := services.FetchExpoChannelMapping(channelName)
+	branchMap, err := services.FetchExpoChannelMapping(r.Context(), channelName)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error fetching channel mapping: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error fetching channel mapping", "error", err)
 		http.Error(w, "Error fetching channel mapping", http.StatusInternalServerError)
 		return
 	}
 	if branchMap == nil {
-		log.Printf("[RequestID: %s] No branch mapping found for channel: %s", requestID, channelName)
+		slog.WarnContext(r.Context(), "No branch mapping found for channel", "channel", channelName)
 		http.Error(w, "No branch mapping found", http.StatusNotFound)
 		return
 	}
 
 	req := assets.AssetsRequest{
-		Branch:         branchMap.BranchName,
+		Branch:         assignment.Resolve(r, branchMap).Branch,
 		AssetName:      r.URL.Query().Get("asset"),
 		RuntimeVersion: r.URL.Query().Get("runtimeVersion"),
 		Platform:       r.URL.Query().Get("platform"),
-		RequestID:      requestID,
 	}
 
 	cdn := cdn2.GetCDN()
 	if cdn == nil || preventCDNRedirection {
-		resp, err := assets.HandleAssetsWithFile(req)
+		resp, err := assets.HandleAssetsWithFile(r.Context(), req)
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
@@ -49,10 +47,10 @@ func AssetsHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, string(resp.Body), resp.StatusCode)
 			return
 		}
-		compression.ServeCompressedAsset(w, r, resp.Body, resp.ContentType, req.RequestID)
+		compression.ServeCompressedAsset(w, r, resp.Body, resp.ContentType)
 		return
 	}
-	resp, err := assets.HandleAssetsWithURL(req, cdn)
+	resp, err := assets.HandleAssetsWithURL(r.Context(), req, cdn)
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
@@ -18,7 +18,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	authService := auth.NewAuth()
-	authResponse, err := authService.LoginWithPassword(password)
+	authResponse, err := authService.Login(r.FormValue("username"), password)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
@@ -2,16 +2,20 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"expo-open-ota/config"
+	"expo-open-ota/internal/analytics"
+	"expo-open-ota/internal/audit"
 	"expo-open-ota/internal/bucket"
 	cache2 "expo-open-ota/internal/cache"
 	"expo-open-ota/internal/crypto"
 	"expo-open-ota/internal/dashboard"
+	"expo-open-ota/internal/metrics"
 	"expo-open-ota/internal/services"
 	"expo-open-ota/internal/types"
 	update2 "expo-open-ota/internal/update"
-	"fmt"
-	"log"
+	"expo-open-ota/internal/webhooks"
+	"log/slog"
 	"net/http"
 	"sort"
 	"strconv"
@@ -39,6 +43,20 @@ type UpdateItem struct {
 	CreatedAt  string `json:"createdAt"`
 	CommitHash string `json:"commitHash"`
 	Platform   string `json:"platform"`
+	// IsServed marks the update currently served for its platform, ServedReason tells why.
+	IsServed     bool   `json:"isServed"`
+	ServedReason string `json:"servedReason,omitempty"`
+	HaltedReason string `json:"haltedReason,omitempty"`
+	// GroupId links the updates published together for several platforms.
+	GroupId string `json:"groupId,omitempty"`
+	// ActivateAt and ExpireAt are set on scheduled updates.
+	ActivateAt *time.Time `json:"activateAt,omitempty"`
+	ExpireAt   *time.Time `json:"expireAt,omitempty"`
+	// Approval is set on updates published to a protected branch, pending ones are not served.
+	Approval *types.UpdateApproval `json:"approval,omitempty"`
+	// Message and Metadata are given on publish.
+	Message  string            `json:"message,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 type UpdateDetails struct {
@@ -49,6 +67,12 @@ type UpdateDetails struct {
 	Platform   string           `json:"platform"`
 	Type       types.UpdateType `json:"type"`
 	ExpoConfig string           `json:"expoConfig"`
+	// Approval records who published and approved an update of a protected branch.
+	Approval *types.UpdateApproval `json:"approval,omitempty"`
+	// Message and Metadata are given on publish, the ManifestFields are sent to the app.
+	Message        string            `json:"message,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	ManifestFields []string          `json:"manifestFields,omitempty"`
 }
 
 type SettingsEnv struct {
@@ -115,7 +139,7 @@ func GetSettingsHandler(w http.ResponseWriter, r *http.Request) {
 func GetChannelsHandler(w http.ResponseWriter, r *http.Request) {
 	cacheKey := dashboard.ComputeGetChannelsCacheKey()
 	cache := cache2.GetCache()
-	if cacheValue := cache.Get(cacheKey); cacheValue != "" {
+	if cacheValue := cache.Get(r.Context(), cacheKey); cacheValue != "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		var channels []ChannelMapping
@@ -123,12 +147,12 @@ func GetChannelsHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(channels)
 		return
 	}
-	allChannels, err := services.FetchExpoChannels()
+	allChannels, err := services.FetchExpoChannels(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	branchesMapping, err := services.FetchExpoBranchesMapping()
+	branchesMapping, err := services.FetchExpoBranchesMapping(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -158,20 +182,20 @@ func GetChannelsHandler(w http.ResponseWriter, r *http.Request) {
 	ttl := 10 * time.Second
 	ttlMs := int(ttl.Milliseconds())
 	marshaledResponse, _ := json.Marshal(channels)
-	cache.Set(cacheKey, string(marshaledResponse), &ttlMs)
+	cache.Set(r.Context(), cacheKey, string(marshaledResponse), &ttlMs)
 }
 
 func GetBranchesHandler(w http.ResponseWriter, r *http.Request) {
 	resolvedBucket := bucket.GetBucket()
-	branches, err := resolvedBucket.GetBranches()
+	branches, err := resolvedBucket.GetBranches(r.Context())
 	if err != nil {
-		log.Printf("Error getting branches from bucket: %v", err)
+		slog.ErrorContext(r.Context(), "Error getting branches from bucket", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	branchesMapping, err := services.FetchExpoBranchesMapping()
+	branchesMapping, err := services.FetchExpoBranchesMapping(r.Context())
 	if err != nil {
-		log.Printf("Error fetching Expo branches mapping: %v", err)
+		slog.ErrorContext(r.Context(), "Error fetching Expo branches mapping", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -202,7 +226,7 @@ func GetRuntimeVersionsHandler(w http.ResponseWriter, r *http.Request) {
 	branchName := vars["BRANCH"]
 	cacheKey := dashboard.ComputeGetRuntimeVersionsCacheKey(branchName)
 	cache := cache2.GetCache()
-	if cacheValue := cache.Get(cacheKey); cacheValue != "" {
+	if cacheValue := cache.Get(r.Context(), cacheKey); cacheValue != "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		var runtimeVersions []bucket.RuntimeVersionWithStats
@@ -211,7 +235,7 @@ func GetRuntimeVersionsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	resolvedBucket := bucket.GetBucket()
-	runtimeVersions, err := resolvedBucket.GetRuntimeVersions(branchName)
+	runtimeVersions, err := resolvedBucket.GetRuntimeVersions(r.Context(), branchName)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(err.Error())
@@ -229,7 +253,7 @@ func GetRuntimeVersionsHandler(w http.ResponseWriter, r *http.Request) {
 	marshaledResponse, _ := json.Marshal(runtimeVersions)
 	ttl := 10 * time.Second
 	ttlMs := int(ttl.Milliseconds())
-	cache.Set(cacheKey, string(marshaledResponse), &ttlMs)
+	cache.Set(r.Context(), cacheKey, string(marshaledResponse), &ttlMs)
 }
 
 func GetUpdateDetails(w http.ResponseWriter, r *http.Request) {
@@ -239,7 +263,7 @@ func GetUpdateDetails(w http.ResponseWriter, r *http.Request) {
 	updateId := vars["UPDATE_ID"]
 	cacheKey := dashboard.ComputeGetUpdateDetailsCacheKey(branchName, runtimeVersion, updateId)
 	cache := cache2.GetCache()
-	if cacheValue := cache.Get(cacheKey); cacheValue != "" {
+	if cacheValue := cache.Get(r.Context(), cacheKey); cacheValue != "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		var updateDetailsResponse UpdateDetails
@@ -252,14 +276,14 @@ func GetUpdateDetails(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	metadata, err := update2.GetMetadata(*update)
+	metadata, err := update2.GetMetadata(r.Context(), *update)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	numberUpdate, _ := strconv.ParseInt(update.UpdateId, 10, 64)
-	storedMetadata, _ := update2.RetrieveUpdateStoredMetadata(*update)
-	expoConfig, err := update2.GetExpoConfig(*update)
+	storedMetadata, _ := update2.RetrieveUpdateStoredMetadata(r.Context(), *update)
+	expoConfig, err := update2.GetExpoConfig(r.Context(), *update)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -270,13 +294,17 @@ func GetUpdateDetails(w http.ResponseWriter, r *http.Request) {
 		updateUUID = crypto.ConvertSHA256HashToUUID(metadata.ID)
 	}
 	updatesResponse := UpdateDetails{
-		UpdateUUID: updateUUID,
-		UpdateId:   update.UpdateId,
-		CreatedAt:  time.UnixMilli(numberUpdate).UTC().Format(time.RFC3339),
-		CommitHash: storedMetadata.CommitHash,
-		Platform:   storedMetadata.Platform,
-		Type:       update2.GetUpdateType(*update),
-		ExpoConfig: string(expoConfig),
+		UpdateUUID:     updateUUID,
+		UpdateId:       update.UpdateId,
+		CreatedAt:      time.UnixMilli(numberUpdate).UTC().Format(time.RFC3339),
+		CommitHash:     storedMetadata.CommitHash,
+		Platform:       storedMetadata.Platform,
+		Type:           update2.GetUpdateType(r.Context(), *update),
+		ExpoConfig:     string(expoConfig),
+		Approval:       storedMetadata.Approval,
+		Message:        storedMetadata.Message,
+		Metadata:       storedMetadata.Metadata,
+		ManifestFields: storedMetadata.ManifestFields,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -284,7 +312,84 @@ func GetUpdateDetails(w http.ResponseWriter, r *http.Request) {
 	marshaledResponse, _ := json.Marshal(updatesResponse)
 	ttl := 120 * time.Second
 	ttlMs := int(ttl.Milliseconds())
-	cache.Set(cacheKey, string(marshaledResponse), &ttlMs)
+	cache.Set(r.Context(), cacheKey, string(marshaledResponse), &ttlMs)
+}
+
+func GetUpdateErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	branchName := vars["BRANCH"]
+	runtimeVersion := vars["RUNTIME_VERSION"]
+	updateId := vars["UPDATE_ID"]
+	limit := 10
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err != nil || parsedLimit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsedLimit
+	}
+	update, err := update2.GetUpdate(branchName, runtimeVersion, updateId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	storedMetadata, err := update2.RetrieveUpdateStoredMetadata(r.Context(), *update)
+	if err != nil || storedMetadata == nil {
+		http.Error(w, "Update not found", http.StatusNotFound)
+		return
+	}
+	updateUUID := storedMetadata.UpdateUUID
+	if updateUUID == "" {
+		metadata, err := update2.GetMetadata(r.Context(), *update)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		updateUUID = crypto.ConvertSHA256HashToUUID(metadata.ID)
+	}
+	stats, err := metrics.GetUpdateErrorStats(r.Context(), storedMetadata.Platform, runtimeVersion, branchName, updateUUID, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting update error stats", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+func GetAdoptionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	branchName := vars["BRANCH"]
+	runtimeVersion := vars["RUNTIME_VERSION"]
+	platform := r.URL.Query().Get("platform")
+	if platform != "" && platform != "ios" && platform != "android" {
+		http.Error(w, "Invalid platform", http.StatusBadRequest)
+		return
+	}
+	days := 30
+	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+		parsedDays, err := strconv.Atoi(daysParam)
+		if err != nil || parsedDays <= 0 {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		days = parsedDays
+	}
+	points, err := analytics.GetAdoptionCurve(r.Context(), branchName, runtimeVersion, platform, days)
+	if errors.Is(err, analytics.ErrNotPersistent) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting adoption curve", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(points)
 }
 
 func GetUpdatesHandler(w http.ResponseWriter, r *http.Request) {
@@ -293,7 +398,7 @@ func GetUpdatesHandler(w http.ResponseWriter, r *http.Request) {
 	runtimeVersion := vars["RUNTIME_VERSION"]
 	cacheKey := dashboard.ComputeGetUpdatesCacheKey(branchName, runtimeVersion)
 	cache := cache2.GetCache()
-	if cacheValue := cache.Get(cacheKey); cacheValue != "" {
+	if cacheValue := cache.Get(r.Context(), cacheKey); cacheValue != "" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		var updatesResponse []UpdateItem
@@ -302,33 +407,55 @@ func GetUpdatesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	resolvedBucket := bucket.GetBucket()
-	updates, err := resolvedBucket.GetUpdates(branchName, runtimeVersion)
+	updates, err := resolvedBucket.GetUpdates(r.Context(), branchName, runtimeVersion)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	servedReasons := map[string]string{}
+	for _, platform := range []string{"ios", "android"} {
+		served, reason, err := update2.GetServedUpdate(r.Context(), branchName, runtimeVersion, platform)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Error resolving served update", "platform", platform, "error", err)
+			continue
+		}
+		if served != nil {
+			servedReasons[served.UpdateId] = reason
+		}
+	}
+
 	var updatesResponse []UpdateItem
 	for _, update := range updates {
-		isValid := update2.IsUpdateValid(update)
-		if !isValid {
+		isValid := update2.IsUpdateValid(r.Context(), update)
+		if !isValid && !update2.IsUpdatePending(r.Context(), update) {
 			continue
 		}
 		numberUpdate, _ := strconv.ParseInt(update.UpdateId, 10, 64)
-		storedMetadata, _ := update2.RetrieveUpdateStoredMetadata(update)
-		updateType := update2.GetUpdateType(update)
+		storedMetadata, _ := update2.RetrieveUpdateStoredMetadata(r.Context(), update)
+		servedReason, isServed := servedReasons[update.UpdateId]
+		haltedReason, _ := update2.GetHaltReason(r.Context(), update)
+		groupId := ""
+		if storedMetadata.Group != nil {
+			groupId = storedMetadata.Group.Id
+		}
+		updateType := update2.GetUpdateType(r.Context(), update)
 		if updateType == types.Rollback {
 			updatesResponse = append(updatesResponse, UpdateItem{
-				UpdateUUID: "Rollback to embedded",
-				UpdateId:   update.UpdateId,
-				CreatedAt:  time.UnixMilli(numberUpdate).UTC().Format(time.RFC3339),
-				CommitHash: storedMetadata.CommitHash,
-				Platform:   storedMetadata.Platform,
+				UpdateUUID:   "Rollback to embedded",
+				UpdateId:     update.UpdateId,
+				CreatedAt:    time.UnixMilli(numberUpdate).UTC().Format(time.RFC3339),
+				CommitHash:   storedMetadata.CommitHash,
+				Platform:     storedMetadata.Platform,
+				IsServed:     isServed,
+				ServedReason: servedReason,
+				HaltedReason: haltedReason,
+				GroupId:      groupId,
 			})
 			continue
 		}
 
-		metadata, err := update2.GetMetadata(update)
+		metadata, err := update2.GetMetadata(r.Context(), update)
 		if err != nil {
 			continue
 		}
@@ -337,11 +464,20 @@ func GetUpdatesHandler(w http.ResponseWriter, r *http.Request) {
 			updateUUID = crypto.ConvertSHA256HashToUUID(metadata.ID)
 		}
 		updatesResponse = append(updatesResponse, UpdateItem{
-			UpdateUUID: updateUUID,
-			UpdateId:   update.UpdateId,
-			CreatedAt:  time.UnixMilli(numberUpdate).UTC().Format(time.RFC3339),
-			CommitHash: storedMetadata.CommitHash,
-			Platform:   storedMetadata.Platform,
+			UpdateUUID:   updateUUID,
+			UpdateId:     update.UpdateId,
+			CreatedAt:    time.UnixMilli(numberUpdate).UTC().Format(time.RFC3339),
+			CommitHash:   storedMetadata.CommitHash,
+			Platform:     storedMetadata.Platform,
+			IsServed:     isServed,
+			ServedReason: servedReason,
+			HaltedReason: haltedReason,
+			GroupId:      groupId,
+			ActivateAt:   storedMetadata.ActivateAt,
+			ExpireAt:     storedMetadata.ExpireAt,
+			Approval:     storedMetadata.Approval,
+			Message:      storedMetadata.Message,
+			Metadata:     storedMetadata.Metadata,
 		})
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -355,7 +491,7 @@ func GetUpdatesHandler(w http.ResponseWriter, r *http.Request) {
 	marshaledResponse, _ := json.Marshal(updatesResponse)
 	ttl := 10 * time.Second
 	ttlMs := int(ttl.Milliseconds())
-	cache.Set(cacheKey, string(marshaledResponse), &ttlMs)
+	cache.Set(r.Context(), cacheKey, string(marshaledResponse), &ttlMs)
 }
 
 func UpdateChannelBranchMappingHandler(w http.ResponseWriter, r *http.Request) {
@@ -366,21 +502,21 @@ func UpdateChannelBranchMappingHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	err := json.NewDecoder(r.Body).Decode(&requestBody)
 	if err != nil {
-		fmt.Println("Error decoding request body:", err)
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("Error decoding request body"))
 		return
 	}
 	releaseChannel := requestBody.ReleaseChannel
 	if releaseChannel == "" {
-		fmt.Println("Release channel is empty")
+		slog.WarnContext(r.Context(), "Release channel is empty")
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte("Release channel is empty"))
 		return
 	}
-	err = services.UpdateChannelBranchMapping(releaseChannel, branchId)
+	err = services.UpdateChannelBranchMapping(r.Context(), releaseChannel, branchId)
 	if err != nil {
-		fmt.Println("Error updating channel branch mapping:", err)
+		slog.ErrorContext(r.Context(), "Error updating channel branch mapping", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("Error updating channel branch mapping"))
 		return
@@ -393,6 +529,49 @@ func UpdateChannelBranchMappingHandler(w http.ResponseWriter, r *http.Request) {
 	branchesCacheKey := dashboard.ComputeGetBranchesCacheKey()
 	channelsCacheKey := dashboard.ComputeGetChannelsCacheKey()
 	cache := cache2.GetCache()
-	cache.Delete(branchesCacheKey)
-	cache.Delete(channelsCacheKey)
+	cache.Delete(r.Context(), branchesCacheKey)
+	cache.Delete(r.Context(), channelsCacheKey)
+
+	webhooks.Dispatch(webhooks.Payload{
+		Event:    webhooks.ChannelRemapped,
+		BranchId: branchId,
+		Channel:  releaseChannel,
+	})
+}
+
+func GetWebhookFailedDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(webhooks.GetFailedDeliveries(r.Context()))
+}
+
+const (
+	defaultAuditLogLimit = 100
+	maxAuditLogLimit     = 1000
+)
+
+// GetAuditLogHandler returns a page of the audit log, the cursor of the next page being sent in
+// the X-Next-Cursor header.
+func GetAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAuditLogLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err != nil || parsedLimit <= 0 || parsedLimit > maxAuditLogLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsedLimit
+	}
+	page, err := audit.GetEntries(r.Context(), r.URL.Query().Get("branch"), r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting audit log", "error", err)
+		http.Error(w, "Error getting audit log", http.StatusInternalServerError)
+		return
+	}
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page.Entries)
 }
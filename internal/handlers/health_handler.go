@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/health"
+	"log/slog"
+	"net/http"
+)
+
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]health.Status{"status": health.StatusOK})
+}
+
+func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := health.CheckReadiness(r.Context())
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		slog.WarnContext(r.Context(), "Instance is not ready", "status", report.Status, "checks", report.Checks)
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
@@ -2,121 +2,243 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"expo-open-ota/internal/analytics"
+	"expo-open-ota/internal/assignment"
+	"expo-open-ota/internal/crashguard"
 	"expo-open-ota/internal/crypto"
 	"expo-open-ota/internal/keyStore"
 	"expo-open-ota/internal/metrics"
 	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/targeting"
+	"expo-open-ota/internal/tracing"
 	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/update"
 	"fmt"
-	"log"
+	"log/slog"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"strconv"
+	"strings"
+)
 
-	"github.com/google/uuid"
+const (
+	multipartContentType    = "multipart/mixed"
+	expoJSONContentType     = "application/expo+json"
+	jsonContentType         = "application/json"
+	noAcceptedMediaPriority = -1
 )
 
-func createMultipartResponse(headers map[string][]string, jsonContent interface{}) (*multipart.Writer, *bytes.Buffer, error) {
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-	field, err := writer.CreatePart(headers)
-	if err != nil {
-		return nil, nil, fmt.Errorf("error creating multipart field: %w", err)
+// negotiateContentType picks the response format from the Accept header as the expo-updates
+// protocol describes it. Clients that don't send one, or accept multipart as much as JSON, get
+// multipart/mixed.
+func negotiateContentType(r *http.Request) string {
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return multipartContentType
+	}
+	priorities := map[string]float64{
+		multipartContentType: noAcceptedMediaPriority,
+		expoJSONContentType:  noAcceptedMediaPriority,
+		jsonContentType:      noAcceptedMediaPriority,
+	}
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		for contentType := range priorities {
+			if mediaRangeMatches(mediaType, contentType) && quality > priorities[contentType] {
+				priorities[contentType] = quality
+			}
+		}
 	}
-	contentJSON, err := json.Marshal(jsonContent)
-	if err != nil {
-		return nil, nil, fmt.Errorf("error marshaling JSON: %w", err)
+	best := multipartContentType
+	for _, contentType := range []string{expoJSONContentType, jsonContentType} {
+		if priorities[contentType] > 0 && priorities[contentType] > priorities[best] {
+			best = contentType
+		}
+	}
+	return best
+}
+
+func mediaRangeMatches(mediaRange string, contentType string) bool {
+	if mediaRange == "*/*" || mediaRange == contentType {
+		return true
 	}
-	if _, err := field.Write(contentJSON); err != nil {
-		return nil, nil, fmt.Errorf("error writing JSON content: %w", err)
+	mediaRangeType, subtype, _ := strings.Cut(mediaRange, "/")
+	return subtype == "*" && strings.HasPrefix(contentType, mediaRangeType+"/")
+}
+
+func createMultipartResponse(parts []multipartPart) (*multipart.Writer, *bytes.Buffer, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, part := range parts {
+		field, err := writer.CreatePart(part.headers)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating multipart field: %w", err)
+		}
+		contentJSON, err := json.Marshal(part.content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error marshaling JSON: %w", err)
+		}
+		if _, err := field.Write(contentJSON); err != nil {
+			return nil, nil, fmt.Errorf("error writing JSON content: %w", err)
+		}
 	}
 	return writer, &buf, nil
 }
 
-func signDirectiveOrManifest(content interface{}, expectSignatureHeader string) (string, error) {
+type multipartPart struct {
+	headers map[string][]string
+	content interface{}
+}
+
+func jsonPartHeaders(fieldName string) map[string][]string {
+	return map[string][]string{
+		"Content-Disposition": {fmt.Sprintf("form-data; name=\"%s\"", fieldName)},
+		"Content-Type":        {"application/json"},
+		"content-type":        {"application/json; charset=utf-8"},
+	}
+}
+
+func signDirectiveOrManifest(ctx context.Context, content interface{}, expectSignatureHeader string) (signedHash string, err error) {
 	if expectSignatureHeader == "" {
 		return "", nil
 	}
-	privateKey := keyStore.GetPrivateExpoKey()
+	_, span := tracing.StartSpan(ctx, "crypto.SignRSASHA256")
+	defer func() { tracing.EndSpan(span, err) }()
+	privateKey := keyStore.GetPrivateExpoKey(ctx)
 	contentJSON, err := json.Marshal(content)
 	if err != nil {
 		return "", fmt.Errorf("error stringifying content: %w", err)
 	}
-	signedHash, err := crypto.SignRSASHA256(string(contentJSON), privateKey)
+	signedHash, err = crypto.SignRSASHA256(string(contentJSON), privateKey)
 	if err != nil {
 		return "", fmt.Errorf("error signing content hash: %w", err)
 	}
 	return signedHash, nil
 }
 
-func writeResponse(w http.ResponseWriter, writer *multipart.Writer, buf *bytes.Buffer, protocolVersion int64, runtimeVersion string, requestID string) {
+func setProtocolHeaders(w http.ResponseWriter, protocolVersion int64) {
 	w.Header().Set("expo-protocol-version", strconv.FormatInt(protocolVersion, 10))
 	w.Header().Set("expo-sfv-version", "0")
 	w.Header().Set("cache-control", "private, max-age=0")
+}
+
+func formatSignature(signedHash string) string {
+	return fmt.Sprintf("sig=\"%s\", keyid=\"main\"", signedHash)
+}
+
+func writeResponse(w http.ResponseWriter, r *http.Request, writer *multipart.Writer, buf *bytes.Buffer, protocolVersion int64) {
+	setProtocolHeaders(w, protocolVersion)
 	w.Header().Set("content-type", "multipart/mixed; boundary="+writer.Boundary())
 	if err := writer.Close(); err != nil {
-		log.Printf("[RequestID: %s] Error closing multipart writer: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error closing multipart writer", "error", err)
 		http.Error(w, "Error closing multipart writer", http.StatusInternalServerError)
 		return
 	}
 	if _, err := w.Write(buf.Bytes()); err != nil {
-		log.Printf("[RequestID: %s] Error writing response: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error writing response", "error", err)
 	}
 }
 
-func putResponse(w http.ResponseWriter, r *http.Request, content interface{}, fieldName string, runtimeVersion string, protocolVersion int64, requestID string) {
-	signedHash, err := signDirectiveOrManifest(content, r.Header.Get("expo-expect-signature"))
+// writeJSONResponse answers clients that don't accept multipart with the manifest or directive
+// alone, its signature moving to the response headers.
+func writeJSONResponse(w http.ResponseWriter, r *http.Request, content interface{}, signedHash string, contentType string, protocolVersion int64) {
+	contentJSON, err := json.Marshal(content)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error signing content: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error marshaling JSON", "error", err)
+		http.Error(w, "Error marshaling JSON", http.StatusInternalServerError)
+		return
+	}
+	setProtocolHeaders(w, protocolVersion)
+	w.Header().Set("content-type", contentType+"; charset=utf-8")
+	if signedHash != "" {
+		w.Header().Set("expo-signature", formatSignature(signedHash))
+	}
+	if _, err := w.Write(contentJSON); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing response", "error", err)
+	}
+}
+
+// putResponse writes a manifest or a directive, followed by the extensions part when there is one.
+// Clients not accepting multipart receive the content alone as JSON.
+func putResponse(w http.ResponseWriter, r *http.Request, content interface{}, fieldName string, extensions *types.ManifestExtensions, protocolVersion int64) {
+	signedHash, err := signDirectiveOrManifest(r.Context(), content, r.Header.Get("expo-expect-signature"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error signing content", "error", err)
 		http.Error(w, "Error signing content", http.StatusInternalServerError)
 		return
 	}
-	headers := map[string][]string{
-		"Content-Disposition": {fmt.Sprintf("form-data; name=\"%s\"", fieldName)},
-		"Content-Type":        {"application/json"},
-		"content-type":        {"application/json; charset=utf-8"},
+	if contentType := negotiateContentType(r); contentType != multipartContentType {
+		writeJSONResponse(w, r, content, signedHash, contentType, protocolVersion)
+		return
 	}
+	headers := jsonPartHeaders(fieldName)
 	if signedHash != "" {
-		headers["expo-signature"] = []string{fmt.Sprintf("sig=\"%s\", keyid=\"main\"", signedHash)}
+		headers["expo-signature"] = []string{formatSignature(signedHash)}
+	}
+	parts := []multipartPart{{headers: headers, content: content}}
+	if extensions != nil {
+		parts = append(parts, multipartPart{headers: jsonPartHeaders("extensions"), content: extensions})
 	}
-	writer, buf, err := createMultipartResponse(headers, content)
+	writer, buf, err := createMultipartResponse(parts)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error creating multipart response: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error creating multipart response", "error", err)
 		http.Error(w, "Error creating multipart response", http.StatusInternalServerError)
 		return
 	}
-	writeResponse(w, writer, buf, protocolVersion, runtimeVersion, requestID)
+	writeResponse(w, r, writer, buf, protocolVersion)
+}
+
+// composeManifestExtensions forwards the channel and the assignment to asset requests, which resolve
+// the branch from them.
+func composeManifestExtensions(r *http.Request, manifest types.UpdateManifest, assigned assignment.Assignment) *types.ManifestExtensions {
+	assetRequestHeaders := make(map[string]map[string]string, len(manifest.Assets)+1)
+	for _, asset := range append([]types.ManifestAsset{manifest.LaunchAsset}, manifest.Assets...) {
+		headers := assigned.Headers()
+		headers["expo-channel-name"] = r.Header.Get("expo-channel-name")
+		assetRequestHeaders[asset.Key] = headers
+	}
+	return &types.ManifestExtensions{AssetRequestHeaders: assetRequestHeaders}
 }
 
-func putUpdateInResponse(w http.ResponseWriter, r *http.Request, lastUpdate types.Update, platform string, protocolVersion int64, requestID string) {
+func putUpdateInResponse(w http.ResponseWriter, r *http.Request, lastUpdate types.Update, assigned assignment.Assignment, platform string, protocolVersion int64) {
 	currentUpdateId := r.Header.Get("expo-current-update-id")
-	metadata, err := update.GetMetadata(lastUpdate)
+	metadata, err := update.GetMetadata(r.Context(), lastUpdate)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error getting metadata: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error getting metadata", "error", err)
 		http.Error(w, "Error getting metadata", http.StatusInternalServerError)
 		return
 	}
 
 	if currentUpdateId != "" && currentUpdateId == crypto.ConvertSHA256HashToUUID(metadata.ID) && protocolVersion == 1 {
-		putNoUpdateAvailableInResponse(w, r, lastUpdate.RuntimeVersion, protocolVersion, requestID)
+		putNoUpdateAvailableInResponse(w, r, protocolVersion)
 		return
 	}
-	manifest, err := update.ComposeUpdateManifest(&metadata, lastUpdate, platform)
+	manifest, err := update.ComposeUpdateManifest(r.Context(), &metadata, lastUpdate, platform)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error composing manifest: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error composing manifest", "error", err)
 		http.Error(w, "Error composing manifest", http.StatusInternalServerError)
 		return
 	}
 	if currentUpdateId != "" {
 		metrics.TrackUpdateDownload(platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, manifest.Id, "update")
 	}
-	w.Header().Set("expo-manifest-filters", `branch="`+lastUpdate.Branch+`"`)
-	putResponse(w, r, manifest, "manifest", lastUpdate.RuntimeVersion, protocolVersion, requestID)
+	w.Header().Set("expo-manifest-filters", assigned.ManifestFilters())
+	putResponse(w, r, manifest, "manifest", composeManifestExtensions(r, manifest, assigned), protocolVersion)
 }
 
-func putRollbackInResponse(w http.ResponseWriter, r *http.Request, lastUpdate types.Update, platform string, protocolVersion int64, requestID string) {
+func putRollbackInResponse(w http.ResponseWriter, r *http.Request, lastUpdate types.Update, platform string, protocolVersion int64) {
 	if protocolVersion == 0 {
 		http.Error(w, "Rollback not supported in protocol version 0", http.StatusBadRequest)
 		return
@@ -128,53 +250,54 @@ func putRollbackInResponse(w http.ResponseWriter, r *http.Request, lastUpdate ty
 	}
 	currentUpdateId := r.Header.Get("expo-current-update-id")
 	if currentUpdateId != "" && currentUpdateId == embeddedUpdateId {
-		putNoUpdateAvailableInResponse(w, r, lastUpdate.RuntimeVersion, protocolVersion, requestID)
+		putNoUpdateAvailableInResponse(w, r, protocolVersion)
 		return
 	}
-	directive, err := update.CreateRollbackDirective(lastUpdate)
+	directive, err := update.CreateRollbackDirective(r.Context(), lastUpdate)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error creating rollback directive: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error creating rollback directive", "error", err)
 		http.Error(w, "Error creating rollback directive", http.StatusInternalServerError)
 		return
 	}
 	metrics.TrackUpdateDownload(platform, lastUpdate.RuntimeVersion, lastUpdate.Branch, lastUpdate.UpdateId, "rollback")
-	putResponse(w, r, directive, "directive", lastUpdate.RuntimeVersion, protocolVersion, requestID)
+	putResponse(w, r, directive, "directive", nil, protocolVersion)
 }
 
-func putNoUpdateAvailableInResponse(w http.ResponseWriter, r *http.Request, runtimeVersion string, protocolVersion int64, requestID string) {
+func putNoUpdateAvailableInResponse(w http.ResponseWriter, r *http.Request, protocolVersion int64) {
 	if protocolVersion == 0 {
 		http.Error(w, "NoUpdateAvailable directive not available in protocol version 0", http.StatusNoContent)
 		return
 	}
 	directive := update.CreateNoUpdateAvailableDirective()
-	putResponse(w, r, directive, "directive", runtimeVersion, protocolVersion, requestID)
+	putResponse(w, r, directive, "directive", nil, protocolVersion)
 }
 
 func ManifestHandler(w http.ResponseWriter, r *http.Request) {
-	requestID := uuid.New().String()
 
 	channelName := r.Header.Get("expo-channel-name")
 	if channelName == "" {
-		log.Printf("[RequestID: %s] No channel name provided", requestID)
+		slog.WarnContext(r.Context(), "No channel name provided")
 		http.Error(w, "No channel name provided", http.StatusBadRequest)
 		return
 	}
-	branchMap, err := services.FetchExpoChannelMapping(channelName)
+	branchMap, err := services.FetchExpoChannelMapping(r.Context(), channelName)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error fetching channel mapping: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error fetching channel mapping", "error", err)
 		http.Error(w, fmt.Sprintf("Error fetching channel mapping: %v", err), http.StatusInternalServerError)
 		return
 	}
 	if branchMap == nil {
-		log.Printf("[RequestID: %s] No branch mapping found for channel: %s", requestID, channelName)
+		slog.WarnContext(r.Context(), "No branch mapping found for channel", "channel", channelName)
 		http.Error(w, "No branch mapping found", http.StatusNotFound)
 		return
 	}
 
-	branch := branchMap.BranchName
+	assigned := assignment.Resolve(r, branchMap)
+	branch := assigned.Branch
+	w.Header().Set("expo-server-defined-headers", assigned.ServerDefinedHeaders())
 	protocolVersion, err := strconv.ParseInt(r.Header.Get("expo-protocol-version"), 10, 64)
 	if err != nil {
-		log.Printf("[RequestID: %s] Invalid protocol version: %v", requestID, err)
+		slog.WarnContext(r.Context(), "Invalid protocol version", "error", err)
 		http.Error(w, "Invalid protocol version", http.StatusBadRequest)
 		return
 	}
@@ -183,7 +306,7 @@ func ManifestHandler(w http.ResponseWriter, r *http.Request) {
 		platform = r.URL.Query().Get("platform")
 	}
 	if platform == "" || (platform != "ios" && platform != "android") {
-		log.Printf("[RequestID: %s] Invalid platform: %s", requestID, platform)
+		slog.WarnContext(r.Context(), "Invalid platform", "platform", platform)
 		http.Error(w, "Invalid platform", http.StatusBadRequest)
 		return
 	}
@@ -195,38 +318,46 @@ func ManifestHandler(w http.ResponseWriter, r *http.Request) {
 	currentUpdateId := r.Header.Get("expo-current-update-id")
 	expoFatalError := r.Header.Get("expo-fatal-error")
 	hasJsonError := expoFatalError != ""
+	failedUpdateIds := []string{}
 	if hasJsonError {
+		failedUpdateIds = crashguard.ParseFailedUpdateIds(r.Header.Get("Expo-Recent-Failed-Update-Ids"))
 		if currentUpdateId != "" {
-			metrics.TrackUpdateErrorUsers(clientId, platform, runtimeVersion, branch, currentUpdateId)
+			metrics.TrackUpdateErrorUsers(r.Context(), clientId, platform, runtimeVersion, branch, currentUpdateId, expoFatalError)
+			failedUpdateIds = append(failedUpdateIds, currentUpdateId)
 		} else {
-			recentFailedUpdateId := r.Header.Get("Expo-Recent-Failed-Update-Ids")
-			if recentFailedUpdateId != "" {
-				metrics.TrackUpdateErrorUsers(clientId, platform, runtimeVersion, branch, recentFailedUpdateId)
+			for _, failedUpdateId := range failedUpdateIds {
+				metrics.TrackUpdateErrorUsers(r.Context(), clientId, platform, runtimeVersion, branch, failedUpdateId, expoFatalError)
 			}
 		}
 	}
-	metrics.TrackActiveUser(clientId, platform, runtimeVersion, branch, currentUpdateId)
+	metrics.TrackActiveUser(r.Context(), clientId, platform, runtimeVersion, branch, currentUpdateId)
 	if runtimeVersion == "" {
-		log.Printf("[RequestID: %s] No runtime version provided", requestID)
+		slog.WarnContext(r.Context(), "No runtime version provided")
 		http.Error(w, "No runtime version provided", http.StatusBadRequest)
 		return
 	}
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(branch, runtimeVersion, platform)
+	if updateUUIDs, err := update.GetUpdateUUIDs(r.Context(), branch, runtimeVersion, platform); err != nil {
+		slog.WarnContext(r.Context(), "Error getting update UUIDs, adoption not recorded", "error", err)
+	} else {
+		analytics.TrackManifestCheck(r.Context(), clientId, branch, runtimeVersion, platform, currentUpdateId, updateUUIDs)
+	}
+	crashguard.Evaluate(r.Context(), branch, runtimeVersion, platform, clientId, currentUpdateId, failedUpdateIds)
+	lastUpdate, err := update.GetLatestUpdateForClient(r.Context(), branch, runtimeVersion, platform, targeting.ClientFromRequest(r))
 	if err != nil {
-		log.Printf("[RequestID: %s] Error getting latest update: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error getting latest update", "error", err)
 		http.Error(w, "Error getting latest update", http.StatusInternalServerError)
 		return
 	}
 	if lastUpdate == nil {
-		log.Printf("[RequestID: %s] No update found for runtimeVersion: %s in branch: %s", requestID, runtimeVersion, branch)
-		putNoUpdateAvailableInResponse(w, r, runtimeVersion, protocolVersion, requestID)
+		slog.InfoContext(r.Context(), "No update found", "runtimeVersion", runtimeVersion, "branch", branch)
+		putNoUpdateAvailableInResponse(w, r, protocolVersion)
 		return
 	}
 
-	updateType := update.GetUpdateType(*lastUpdate)
+	updateType := update.GetUpdateType(r.Context(), *lastUpdate)
 	if updateType == types.NormalUpdate {
-		putUpdateInResponse(w, r, *lastUpdate, platform, protocolVersion, requestID)
+		putUpdateInResponse(w, r, *lastUpdate, assigned, platform, protocolVersion)
 	} else {
-		putRollbackInResponse(w, r, *lastUpdate, platform, protocolVersion, requestID)
+		putRollbackInResponse(w, r, *lastUpdate, platform, protocolVersion)
 	}
 }
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/branch"
+	"expo-open-ota/internal/helpers"
+	"expo-open-ota/internal/services"
+	types2 "expo-open-ota/internal/types"
+	update2 "expo-open-ota/internal/update"
+	"github.com/gorilla/mux"
+	"log/slog"
+	"net/http"
+)
+
+type PromoteResponse struct {
+	Update       types2.Update            `json:"update"`
+	UpdateUUID   string                   `json:"updateUUID"`
+	PromotedFrom *types2.UpdateProvenance `json:"promotedFrom"`
+	// Approval is set when the target branch is protected, the promoted update is then pending.
+	Approval *types2.UpdateApproval `json:"approval,omitempty"`
+}
+
+func PromoteHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	branchName := vars["BRANCH"]
+	platform := r.URL.Query().Get("platform")
+	if platform == "" || (platform != "ios" && platform != "android") {
+		slog.WarnContext(r.Context(), "Invalid platform", "platform", platform)
+		http.Error(w, "Invalid platform", http.StatusBadRequest)
+		return
+	}
+	if branchName == "" {
+		slog.WarnContext(r.Context(), "No branch provided")
+		http.Error(w, "No branch provided", http.StatusBadRequest)
+		return
+	}
+	targetBranch := r.URL.Query().Get("targetBranch")
+	if targetBranch == "" {
+		slog.WarnContext(r.Context(), "No target branch provided")
+		http.Error(w, "No target branch provided", http.StatusBadRequest)
+		return
+	}
+	if targetBranch == branchName {
+		slog.WarnContext(r.Context(), "Target branch is the source branch", "branch", branchName)
+		http.Error(w, "Target branch must differ from the source branch, use republish instead", http.StatusBadRequest)
+		return
+	}
+	expoAuth := helpers.GetExpoAuth(r)
+	expoAccount, err := services.FetchExpoUserAccountInformations(r.Context(), expoAuth)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching expo account informations", "error", err)
+		http.Error(w, "Error fetching expo account informations", http.StatusUnauthorized)
+		return
+	}
+	if expoAccount == nil {
+		slog.WarnContext(r.Context(), "No expo account found")
+		http.Error(w, "No expo account found", http.StatusUnauthorized)
+		return
+	}
+	runtimeVersion := r.URL.Query().Get("runtimeVersion")
+	if runtimeVersion == "" {
+		slog.WarnContext(r.Context(), "No runtime version provided")
+		http.Error(w, "No runtime version provided", http.StatusBadRequest)
+		return
+	}
+	updateId := r.URL.Query().Get("updateId")
+	if updateId == "" {
+		slog.WarnContext(r.Context(), "No updateId provided")
+		http.Error(w, "No updateId provided", http.StatusBadRequest)
+		return
+	}
+	update, err := update2.GetUpdate(branchName, runtimeVersion, updateId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting update", "error", err)
+		http.Error(w, "Error getting update", http.StatusBadRequest)
+		return
+	}
+	if update == nil {
+		slog.WarnContext(r.Context(), "No update found", "runtimeVersion", runtimeVersion, "branch", branchName)
+		http.Error(w, "No update found", http.StatusNotFound)
+		return
+	}
+	updateType := update2.GetUpdateType(r.Context(), *update)
+	if updateType != types2.NormalUpdate {
+		slog.WarnContext(r.Context(), "Update type is not normal update")
+		http.Error(w, "Update type is not normal update", http.StatusBadRequest)
+		return
+	}
+	storedMetadata, err := update2.RetrieveUpdateStoredMetadata(r.Context(), *update)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving update commit hash and platform", "error", err)
+		http.Error(w, "Error retrieving update commit hash and platform", http.StatusInternalServerError)
+		return
+	}
+	if storedMetadata == nil {
+		slog.WarnContext(r.Context(), "No stored metadata found for update", "updateId", updateId)
+		http.Error(w, "No stored metadata found for update", http.StatusNotFound)
+		return
+	}
+	if !update2.IsUpdateValid(r.Context(), *update) {
+		slog.WarnContext(r.Context(), "Update is not valid")
+		http.Error(w, "Update is not valid", http.StatusBadRequest)
+		return
+	}
+	if storedMetadata.Platform != platform {
+		slog.WarnContext(r.Context(), "Update platform mismatch", "updatePlatform", storedMetadata.Platform, "platform", platform)
+		http.Error(w, "Update platform mismatch", http.StatusBadRequest)
+		return
+	}
+	err = branch.UpsertBranch(r.Context(), targetBranch)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error upserting branch", "error", err)
+		http.Error(w, "Error upserting branch", http.StatusInternalServerError)
+		return
+	}
+	newUpdate, newMetadata, err := update2.PromoteUpdate(r.Context(), update, targetBranch, expoAccount.Username)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error promoting update", "error", err)
+		http.Error(w, "Error promoting update", http.StatusInternalServerError)
+		return
+	}
+	err = audit.Record(r.Context(), audit.Entry{
+		Action:         audit.Promote,
+		Actor:          expoAccount.Username,
+		Branch:         targetBranch,
+		RuntimeVersion: runtimeVersion,
+		Platform:       platform,
+		UpdateId:       newUpdate.UpdateId,
+		Details:        map[string]string{"sourceBranch": branchName, "sourceUpdateId": updateId},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error recording audit entry", "error", err)
+	}
+	slog.InfoContext(r.Context(), "Update promoted", "sourceBranch", branchName, "sourceUpdateId", updateId, "targetBranch", targetBranch, "updateId", newUpdate.UpdateId)
+	status := http.StatusOK
+	if newMetadata.Approval != nil {
+		status = http.StatusAccepted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(PromoteResponse{
+		Update:       *newUpdate,
+		UpdateUUID:   newMetadata.UpdateUUID,
+		PromotedFrom: newMetadata.PromotedFrom,
+		Approval:     newMetadata.Approval,
+	})
+}
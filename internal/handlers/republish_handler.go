@@ -7,100 +7,121 @@ import (
 	"expo-open-ota/internal/services"
 	types2 "expo-open-ota/internal/types"
 	update2 "expo-open-ota/internal/update"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
 func RepublishHandler(w http.ResponseWriter, r *http.Request) {
-	requestID := uuid.New().String()
 	vars := mux.Vars(r)
 	branchName := vars["BRANCH"]
 	platform := r.URL.Query().Get("platform")
 	if platform == "" || (platform != "ios" && platform != "android") {
-		log.Printf("[RequestID: %s] Invalid platform: %s", requestID, platform)
+		slog.WarnContext(r.Context(), "Invalid platform", "platform", platform)
 		http.Error(w, "Invalid platform", http.StatusBadRequest)
 		return
 	}
 	if branchName == "" {
-		log.Printf("[RequestID: %s] No branch provided", requestID)
+		slog.WarnContext(r.Context(), "No branch provided")
 		http.Error(w, "No branch provided", http.StatusBadRequest)
 		return
 	}
 	expoAuth := helpers.GetExpoAuth(r)
-	expoAccount, err := services.FetchExpoUserAccountInformations(expoAuth)
+	expoAccount, err := services.FetchExpoUserAccountInformations(r.Context(), expoAuth)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error fetching expo account informations: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error fetching expo account informations", "error", err)
 		http.Error(w, "Error fetching expo account informations", http.StatusUnauthorized)
 		return
 	}
 	if expoAccount == nil {
-		log.Printf("[RequestID: %s] No expo account found", requestID)
+		slog.WarnContext(r.Context(), "No expo account found")
 		http.Error(w, "No expo account found", http.StatusUnauthorized)
 		return
 	}
-	err = branch.UpsertBranch(branchName)
+	err = branch.UpsertBranch(r.Context(), branchName)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error upserting branch: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error upserting branch", "error", err)
 		http.Error(w, "Error upserting branch", http.StatusInternalServerError)
 		return
 	}
 	runtimeVersion := r.URL.Query().Get("runtimeVersion")
 	if runtimeVersion == "" {
-		log.Printf("[RequestID: %s] No runtime version provided", requestID)
+		slog.WarnContext(r.Context(), "No runtime version provided")
 		http.Error(w, "No runtime version provided", http.StatusBadRequest)
 		return
 	}
 	commitHash := r.URL.Query().Get("commitHash")
 	updateId := r.URL.Query().Get("updateId")
 	if updateId == "" {
-		log.Printf("[RequestID: %s] No updateId provided", requestID)
+		slog.WarnContext(r.Context(), "No updateId provided")
 		http.Error(w, "No updateId provided", http.StatusBadRequest)
 		return
 	}
 	update, err := update2.GetUpdate(branchName, runtimeVersion, updateId)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error getting update: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error getting update", "error", err)
 		http.Error(w, "Error getting update", http.StatusBadRequest)
 		return
 	}
 	if update == nil {
-		log.Printf("[RequestID: %s] No update found for runtimeVersion: %s in branch: %s", requestID, runtimeVersion, branchName)
+		slog.WarnContext(r.Context(), "No update found", "runtimeVersion", runtimeVersion, "branch", branchName)
 		http.Error(w, "No update found", http.StatusNotFound)
 		return
 	}
-	updateType := update2.GetUpdateType(*update)
+	updateType := update2.GetUpdateType(r.Context(), *update)
 	if updateType != types2.NormalUpdate {
-		log.Printf("[RequestID: %s] Update type is not normal update", requestID)
+		slog.WarnContext(r.Context(), "Update type is not normal update")
 		http.Error(w, "Update type is not normal update", http.StatusBadRequest)
 		return
 	}
-	storedMetadata, err := update2.RetrieveUpdateStoredMetadata(*update)
+	storedMetadata, err := update2.RetrieveUpdateStoredMetadata(r.Context(), *update)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error retrieving update commit hash and platform: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error retrieving update commit hash and platform", "error", err)
 		http.Error(w, "Error retrieving update commit hash and platform", http.StatusInternalServerError)
 		return
 	}
 	if storedMetadata == nil {
-		log.Printf("[RequestID: %s] No stored metadata found for update: %s", requestID, updateId)
+		slog.WarnContext(r.Context(), "No stored metadata found for update", "updateId", updateId)
 		http.Error(w, "No stored metadata found for update", http.StatusNotFound)
 		return
 	}
-	isValid := update2.IsUpdateValid(*update)
+	isValid := update2.IsUpdateValid(r.Context(), *update)
 	if !isValid {
-		log.Printf("[RequestID: %s] Update is not valid", requestID)
+		slog.WarnContext(r.Context(), "Update is not valid")
 		http.Error(w, "Update is not valid", http.StatusBadRequest)
 		return
 	}
+	// Republishing a halted update would quietly undo the rollback or crash guard that halted it.
+	if update2.IsUpdateHalted(r.Context(), *update) {
+		slog.WarnContext(r.Context(), "Update is halted", "updateId", updateId)
+		http.Error(w, "Update is halted", http.StatusBadRequest)
+		return
+	}
 	if storedMetadata.Platform != platform {
-		log.Printf("[RequestID: %s] Update platform mismatch: %s != %s", requestID, storedMetadata.Platform, platform)
+		slog.WarnContext(r.Context(), "Update platform mismatch", "updatePlatform", storedMetadata.Platform, "platform", platform)
 		http.Error(w, "Update platform mismatch", http.StatusBadRequest)
 		return
 	}
-	newUpdate, err := update2.RepublishUpdate(update, platform, commitHash)
+	// With group=true every platform of the group of the update is republished as a new group.
+	if r.URL.Query().Get("group") == "true" {
+		if storedMetadata.Group == nil {
+			http.Error(w, "Update is not part of a group", http.StatusBadRequest)
+			return
+		}
+		newUpdates, err := update2.RepublishUpdateGroup(r.Context(), *update, commitHash)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error republishing update group", "error", err)
+			http.Error(w, "Error republishing update group", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(newUpdates)
+		return
+	}
+	newUpdate, err := update2.RepublishUpdate(r.Context(), update, platform, commitHash)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error republishing update: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error republishing update", "error", err)
 		http.Error(w, "Error republishing update", http.StatusInternalServerError)
 		return
 	}
@@ -2,64 +2,139 @@ package handlers
 
 import (
 	"encoding/json"
+	"expo-open-ota/internal/audit"
 	"expo-open-ota/internal/branch"
 	"expo-open-ota/internal/helpers"
 	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/update"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"log"
+	"log/slog"
 	"net/http"
+	"strings"
 )
 
+// RollbackHandler doesn't require an approval on protected branches: it serves the embedded bundle or
+// an update that was already checked, and pending updates are never checked until approved.
 func RollbackHandler(w http.ResponseWriter, r *http.Request) {
-	requestID := uuid.New().String()
 	vars := mux.Vars(r)
 	branchName := vars["BRANCH"]
 	platform := r.URL.Query().Get("platform")
 	if platform == "" || (platform != "ios" && platform != "android") {
-		log.Printf("[RequestID: %s] Invalid platform: %s", requestID, platform)
+		slog.WarnContext(r.Context(), "Invalid platform", "platform", platform)
 		http.Error(w, "Invalid platform", http.StatusBadRequest)
 		return
 	}
 	if branchName == "" {
-		log.Printf("[RequestID: %s] No branch provided", requestID)
+		slog.WarnContext(r.Context(), "No branch provided")
 		http.Error(w, "No branch provided", http.StatusBadRequest)
 		return
 	}
 	expoAuth := helpers.GetExpoAuth(r)
-	expoAccount, err := services.FetchExpoUserAccountInformations(expoAuth)
+	expoAccount, err := services.FetchExpoUserAccountInformations(r.Context(), expoAuth)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error fetching expo account informations: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error fetching expo account informations", "error", err)
 		http.Error(w, "Error fetching expo account informations", http.StatusUnauthorized)
 		return
 	}
 	if expoAccount == nil {
-		log.Printf("[RequestID: %s] No expo account found", requestID)
+		slog.WarnContext(r.Context(), "No expo account found")
 		http.Error(w, "No expo account found", http.StatusUnauthorized)
 		return
 	}
-	errUpsert := branch.UpsertBranch(branchName)
+	errUpsert := branch.UpsertBranch(r.Context(), branchName)
 	if errUpsert != nil {
-		log.Printf("[RequestID: %s] Error upserting branch: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error upserting branch", "error", errUpsert)
 		http.Error(w, "Error upserting branch", http.StatusInternalServerError)
 		return
 	}
 	runtimeVersion := r.URL.Query().Get("runtimeVersion")
 	if runtimeVersion == "" {
-		log.Printf("[RequestID: %s] No runtime version provided", requestID)
+		slog.WarnContext(r.Context(), "No runtime version provided")
 		http.Error(w, "No runtime version provided", http.StatusBadRequest)
 		return
 	}
+	if updateId := r.URL.Query().Get("updateId"); updateId != "" {
+		rollbackToUpdate(w, r, expoAccount.Username, branchName, runtimeVersion, platform, updateId)
+		return
+	}
 	commitHash := r.URL.Query().Get("commitHash")
-	rollback, err := update.CreateRollback(platform, commitHash, runtimeVersion, branchName)
+	rollback, err := update.CreateRollback(r.Context(), platform, commitHash, runtimeVersion, branchName)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error creating rollback: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error creating rollback", "error", err)
 		http.Error(w, "Error creating rollback", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("[RequestID: %s] Rollback created: %s", requestID, rollback.UpdateId)
+	slog.InfoContext(r.Context(), "Rollback created", "updateId", rollback.UpdateId)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(rollback)
 }
+
+// rollbackToUpdate serves a previous update of the branch again instead of the embedded bundle.
+func rollbackToUpdate(w http.ResponseWriter, r *http.Request, actor, branchName, runtimeVersion, platform, updateId string) {
+	target, err := update.GetUpdate(branchName, runtimeVersion, updateId)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Invalid updateId", "updateId", updateId)
+		http.Error(w, "Invalid updateId", http.StatusBadRequest)
+		return
+	}
+	if !update.IsUpdateValid(r.Context(), *target) {
+		http.Error(w, "No update found", http.StatusNotFound)
+		return
+	}
+	if update.GetUpdateType(r.Context(), *target) != types.NormalUpdate {
+		http.Error(w, "Update type is not normal update", http.StatusBadRequest)
+		return
+	}
+	storedMetadata, err := update.RetrieveUpdateStoredMetadata(r.Context(), *target)
+	if err != nil || storedMetadata == nil || storedMetadata.Platform != platform {
+		slog.WarnContext(r.Context(), "Update platform mismatch", "updateId", updateId, "platform", platform)
+		http.Error(w, "Update platform mismatch", http.StatusBadRequest)
+		return
+	}
+	if update.IsUpdateHalted(r.Context(), *target) {
+		http.Error(w, "Update is halted", http.StatusBadRequest)
+		return
+	}
+	// With group=true every platform of the group of the update is rolled back.
+	rollbackGroup := r.URL.Query().Get("group") == "true"
+	if rollbackGroup && storedMetadata.Group == nil {
+		http.Error(w, "Update is not part of a group", http.StatusBadRequest)
+		return
+	}
+	var halted []types.Update
+	details := map[string]string{}
+	if rollbackGroup {
+		halted, err = update.RollbackToUpdateGroup(r.Context(), *target)
+		details["groupId"] = storedMetadata.Group.Id
+	} else {
+		halted, err = update.RollbackToUpdate(r.Context(), *target, platform)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error rolling back to update", "updateId", updateId, "error", err)
+		http.Error(w, "Error rolling back to update", http.StatusInternalServerError)
+		return
+	}
+	haltedIds := make([]string, 0, len(halted))
+	for _, haltedUpdate := range halted {
+		haltedIds = append(haltedIds, haltedUpdate.UpdateId)
+	}
+	details["haltedUpdateIds"] = strings.Join(haltedIds, ",")
+	err = audit.Record(r.Context(), audit.Entry{
+		Action:         audit.RollbackToUpdate,
+		Actor:          actor,
+		Branch:         branchName,
+		RuntimeVersion: runtimeVersion,
+		Platform:       platform,
+		UpdateId:       updateId,
+		Details:        details,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error recording audit entry", "error", err)
+	}
+	slog.InfoContext(r.Context(), "Rolled back to update", "updateId", updateId, "haltedUpdates", len(halted))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(target)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/symbolication"
+	update2 "expo-open-ota/internal/update"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxStackTraceSize bounds the body of a symbolication request.
+const maxStackTraceSize = 1 << 20
+
+type SymbolicateRequest struct {
+	Stack string `json:"stack"`
+}
+
+type SymbolicateResponse struct {
+	UpdateId string `json:"updateId"`
+	Platform string `json:"platform"`
+	symbolication.Result
+}
+
+// SymbolicateHandler maps a minified stack trace, as reported with expo-fatal-error, to the
+// original sources with the source map uploaded for the update and its platform.
+func SymbolicateHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var request SymbolicateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxStackTraceSize)).Decode(&request); err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		http.Error(w, "Error decoding request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(request.Stack) == "" {
+		http.Error(w, "No stack trace provided", http.StatusBadRequest)
+		return
+	}
+	update, err := update2.GetUpdate(vars["BRANCH"], vars["RUNTIME_VERSION"], vars["UPDATE_ID"])
+	if err != nil {
+		http.Error(w, "Update not found", http.StatusNotFound)
+		return
+	}
+	storedMetadata, err := update2.RetrieveUpdateStoredMetadata(r.Context(), *update)
+	if err != nil || storedMetadata == nil {
+		http.Error(w, "Update not found", http.StatusNotFound)
+		return
+	}
+	sourceMap, err := update2.GetSourceMap(r.Context(), *update, storedMetadata.Platform)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting source map", "updateId", update.UpdateId, "platform", storedMetadata.Platform, "error", err)
+		http.Error(w, "Error getting source map", http.StatusInternalServerError)
+		return
+	}
+	if sourceMap == nil {
+		http.Error(w, "No source map uploaded for this update", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(SymbolicateResponse{
+		UpdateId: update.UpdateId,
+		Platform: storedMetadata.Platform,
+		Result:   symbolication.Symbolicate(sourceMap, request.Stack),
+	})
+}
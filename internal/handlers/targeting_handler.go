@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/targeting"
+	"expo-open-ota/internal/types"
+	update2 "expo-open-ota/internal/update"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func writeTargetingRules(w http.ResponseWriter, rules *targeting.Rules) {
+	if rules == nil {
+		rules = &targeting.Rules{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rules)
+}
+
+func decodeTargetingRules(w http.ResponseWriter, r *http.Request) (*targeting.Rules, bool) {
+	var rules targeting.Rules
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		slog.WarnContext(r.Context(), "Error decoding request body", "error", err)
+		http.Error(w, "Error decoding request body", http.StatusBadRequest)
+		return nil, false
+	}
+	if err := rules.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return &rules, true
+}
+
+// resolveTargetedUpdate returns the update of the route, answering 404 when it was never published.
+func resolveTargetedUpdate(w http.ResponseWriter, r *http.Request) (*types.Update, bool) {
+	vars := mux.Vars(r)
+	update, err := update2.GetUpdate(vars["BRANCH"], vars["RUNTIME_VERSION"], vars["UPDATE_ID"])
+	if err != nil || !update2.IsUpdateValid(r.Context(), *update) {
+		http.Error(w, "Update not found", http.StatusNotFound)
+		return nil, false
+	}
+	return update, true
+}
+
+func GetBranchTargetingRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules, err := targeting.GetBranchRules(r.Context(), mux.Vars(r)["BRANCH"])
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting targeting rules", "error", err)
+		http.Error(w, "Error getting targeting rules", http.StatusInternalServerError)
+		return
+	}
+	writeTargetingRules(w, rules)
+}
+
+func SetBranchTargetingRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules, ok := decodeTargetingRules(w, r)
+	if !ok {
+		return
+	}
+	if err := targeting.SetBranchRules(r.Context(), mux.Vars(r)["BRANCH"], rules); err != nil {
+		slog.ErrorContext(r.Context(), "Error storing targeting rules", "error", err)
+		http.Error(w, "Error storing targeting rules", http.StatusInternalServerError)
+		return
+	}
+	writeTargetingRules(w, rules)
+}
+
+func GetUpdateTargetingRulesHandler(w http.ResponseWriter, r *http.Request) {
+	update, ok := resolveTargetedUpdate(w, r)
+	if !ok {
+		return
+	}
+	rules, err := targeting.GetUpdateRules(r.Context(), *update)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error getting targeting rules", "error", err)
+		http.Error(w, "Error getting targeting rules", http.StatusInternalServerError)
+		return
+	}
+	writeTargetingRules(w, rules)
+}
+
+func SetUpdateTargetingRulesHandler(w http.ResponseWriter, r *http.Request) {
+	update, ok := resolveTargetedUpdate(w, r)
+	if !ok {
+		return
+	}
+	rules, ok := decodeTargetingRules(w, r)
+	if !ok {
+		return
+	}
+	if err := update2.SetUpdateTargetingRules(r.Context(), *update, rules); err != nil {
+		slog.ErrorContext(r.Context(), "Error storing targeting rules", "error", err)
+		http.Error(w, "Error storing targeting rules", http.StatusInternalServerError)
+		return
+	}
+	writeTargetingRules(w, rules)
+}
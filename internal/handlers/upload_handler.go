@@ -5,130 +5,206 @@ import (
 	"encoding/json"
 	"expo-open-ota/internal/branch"
 	"expo-open-ota/internal/bucket"
-	cache2 "expo-open-ota/internal/cache"
 	"expo-open-ota/internal/helpers"
 	"expo-open-ota/internal/services"
 	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/update"
 	"fmt"
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"log"
+	"log/slog"
 	"net/http"
 	"path/filepath"
 	"time"
 )
 
 type FileNamesRequest struct {
-	FileNames []string `json:"fileNames"`
+	FileNames  []string          `json:"fileNames"`
+	FileHashes map[string]string `json:"fileHashes,omitempty"`
+	// Message and Metadata describe the update, ManifestFields names the Metadata keys, or
+	// "message", sent to the app in the metadata of the manifest.
+	Message        string            `json:"message,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	ManifestFields []string          `json:"manifestFields,omitempty"`
+	// SourceMaps maps a platform to the file name of the source map of its bundle, uploaded as a
+	// private file of the update.
+	SourceMaps map[string]string `json:"sourceMaps,omitempty"`
+}
+
+// validateDescription answers 400 when the message or custom metadata of the request are invalid.
+func validateDescription(w http.ResponseWriter, r *http.Request, request FileNamesRequest) bool {
+	if err := update.ValidateDescription(request.Message, request.Metadata, request.ManifestFields); err != nil {
+		slog.WarnContext(r.Context(), "Invalid update description", "error", err)
+		http.Error(w, fmt.Sprintf("Invalid update description: %s", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// validateSourceMaps answers 400 when the source maps of the request are invalid.
+func validateSourceMaps(w http.ResponseWriter, r *http.Request, request FileNamesRequest) bool {
+	if err := update.ValidateSourceMaps(request.SourceMaps); err != nil {
+		slog.WarnContext(r.Context(), "Invalid source maps", "error", err)
+		http.Error(w, fmt.Sprintf("Invalid source maps: %s", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// requestSourceMapUploads returns the upload requests of the source maps of an update. They keep
+// the file name given by the client but are stored as private files, never served by /assets.
+func requestSourceMapUploads(r *http.Request, branchName string, runtimeVersion string, updateId string, sourceMaps map[string]string) ([]bucket.FileUploadRequest, error) {
+	requests := make([]bucket.FileUploadRequest, 0, len(sourceMaps))
+	for platform, fileName := range sourceMaps {
+		privateFileName := update.SourceMapFileName(platform)
+		requestUploadUrl, err := bucket.GetBucket().RequestUploadUrlForFileUpdate(r.Context(), branchName, runtimeVersion, updateId, privateFileName)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, bucket.FileUploadRequest{
+			RequestUploadUrl: requestUploadUrl,
+			FileName:         filepath.Base(privateFileName),
+			FilePath:         fileName,
+		})
+	}
+	return requests, nil
+}
+
+// publishUploadedUpdate marks the uploaded update as checked, or holds it pending approval when its
+// branch is protected.
+func publishUploadedUpdate(w http.ResponseWriter, r *http.Request, uploadedUpdate types.Update, uploadedBy string) {
+	if branch.IsBranchProtected(r.Context(), uploadedUpdate.Branch) {
+		err := update.MarkUpdateAsPending(r.Context(), uploadedUpdate, uploadedBy)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error marking update as pending", "error", err)
+			http.Error(w, "Error marking update as pending", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Branch is protected, update pending approval", "branch", uploadedUpdate.Branch)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"status": string(types.ApprovalPending)})
+		return
+	}
+	err := update.MarkUpdateAsChecked(r.Context(), uploadedUpdate)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error marking update as checked", "error", err)
+		http.Error(w, "Error marking update as checked", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Update marked as checked")
+	w.WriteHeader(http.StatusOK)
 }
 
 func MarkUpdateAsUploadedHandler(w http.ResponseWriter, r *http.Request) {
-	requestID := uuid.New().String()
 	vars := mux.Vars(r)
 	branchName := vars["BRANCH"]
 	platform := r.URL.Query().Get("platform")
 	if platform == "" || (platform != "ios" && platform != "android") {
-		log.Printf("[RequestID: %s] Invalid platform: %s", requestID, platform)
+		slog.WarnContext(r.Context(), "Invalid platform", "platform", platform)
 		http.Error(w, "Invalid platform", http.StatusBadRequest)
 		return
 	}
 	if branchName == "" {
-		log.Printf("[RequestID: %s] No branch provided", requestID)
+		slog.WarnContext(r.Context(), "No branch provided")
 		http.Error(w, "No branch provided", http.StatusBadRequest)
 		return
 	}
-	err := branch.UpsertBranch(branchName)
+	err := branch.UpsertBranch(r.Context(), branchName)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error upserting branch: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error upserting branch", "error", err)
 		http.Error(w, "Error upserting branch", http.StatusInternalServerError)
 		return
 	}
 	expoAuth := helpers.GetExpoAuth(r)
-	expoAccount, err := services.ValidateExpoAuth(expoAuth)
+	expoAccount, err := services.ValidateExpoAuth(r.Context(), expoAuth)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error validating expo auth: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error validating expo auth", "error", err)
 		http.Error(w, "Error validating expo auth", http.StatusUnauthorized)
 	}
 	if expoAccount == nil {
-		log.Printf("[RequestID: %s] No expo account found", requestID)
+		slog.WarnContext(r.Context(), "No expo account found")
 		http.Error(w, "No expo account found", http.StatusUnauthorized)
 		return
 	}
 	runtimeVersion := r.URL.Query().Get("runtimeVersion")
 	if runtimeVersion == "" {
-		log.Printf("[RequestID: %s] No runtime version provided", requestID)
+		slog.WarnContext(r.Context(), "No runtime version provided")
 		http.Error(w, "No runtime version provided", http.StatusBadRequest)
 		return
 	}
 	updateId := r.URL.Query().Get("updateId")
 	if updateId == "" {
-		log.Printf("[RequestID: %s] No update id provided", requestID)
+		slog.WarnContext(r.Context(), "No update id provided")
 		http.Error(w, "No update id provided", http.StatusBadRequest)
 		return
 	}
 	currentUpdate, err := update.GetUpdate(branchName, runtimeVersion, updateId)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error getting update: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error getting update", "error", err)
 		http.Error(w, "Error getting update", http.StatusInternalServerError)
 		return
 	}
 	resolvedBucket := bucket.GetBucket()
-	errorVerify := update.VerifyUploadedUpdate(*currentUpdate)
+	group, err := update.GetUpdateGroup(r.Context(), *currentUpdate)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving update group", "error", err)
+		http.Error(w, "Error retrieving update group", http.StatusInternalServerError)
+		return
+	}
+	errorVerify := update.VerifyUploadedUpdate(r.Context(), *currentUpdate)
 	if errorVerify != nil {
-		// Delete folder and throw error
-		log.Printf("[RequestID: %s] Invalid update, deleting folder...", requestID)
-		err := resolvedBucket.DeleteUpdateFolder(branchName, runtimeVersion, updateId)
+		// Delete folder and throw error, the whole group when the update is part of one so that
+		// the other platforms are not left waiting for it.
+		slog.WarnContext(r.Context(), "Invalid update, deleting folder...")
+		if group != nil {
+			err = update.DeleteUpdateGroup(r.Context(), branchName, group)
+		} else {
+			err = resolvedBucket.DeleteUpdateFolder(r.Context(), branchName, runtimeVersion, updateId)
+		}
 		if err != nil {
-			log.Printf("[RequestID: %s] Error deleting update folder: %v", requestID, err)
+			slog.ErrorContext(r.Context(), "Error deleting update folder", "error", err)
 			http.Error(w, "Error deleting update folder", http.StatusInternalServerError)
 			return
 		}
-		log.Printf("[RequestID: %s] Invalid update, folder deleted", requestID)
+		slog.WarnContext(r.Context(), "Invalid update, folder deleted")
 		http.Error(w, fmt.Sprintf("Invalid update %s", errorVerify), http.StatusBadRequest)
 		return
 	}
+	// Updates of a group are never dropped as identical, the group would never be complete.
+	if group != nil {
+		slog.InfoContext(r.Context(), "Grouped update uploaded", "groupId", group.Id)
+		publishUploadedUpdate(w, r, *currentUpdate, expoAccount.Username)
+		return
+	}
 	// Now we have to retrieve the latest update and compare hash changes
-	latestUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(branchName, runtimeVersion, platform)
-	if err != nil || latestUpdate == nil || update.GetUpdateType(*latestUpdate) == types.Rollback {
-		err = update.MarkUpdateAsChecked(*currentUpdate)
-		if err != nil {
-			log.Printf("[RequestID: %s] Error marking update as checked: %v", requestID, err)
-			http.Error(w, "Error marking update as checked", http.StatusInternalServerError)
-			return
-		}
-		log.Printf("[RequestID: %s] No latest update found, update marked as checked", requestID)
-		w.WriteHeader(http.StatusOK)
+	latestUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(r.Context(), branchName, runtimeVersion, platform)
+	if err != nil || latestUpdate == nil || update.GetUpdateType(r.Context(), *latestUpdate) == types.Rollback {
+		slog.InfoContext(r.Context(), "No latest update found")
+		publishUploadedUpdate(w, r, *currentUpdate, expoAccount.Username)
 		return
 	}
 
-	areUpdatesIdentical, err := update.AreUpdatesIdentical(*currentUpdate, *latestUpdate)
+	areUpdatesIdentical, err := update.AreUpdatesIdentical(r.Context(), *currentUpdate, *latestUpdate)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error comparing updates: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error comparing updates", "error", err)
 		http.Error(w, "Error comparing updates", http.StatusInternalServerError)
 		return
 	}
 	if !areUpdatesIdentical {
-		err = update.MarkUpdateAsChecked(*currentUpdate)
-		if err != nil {
-			log.Printf("[RequestID: %s] Error marking update as checked: %v", requestID, err)
-			http.Error(w, "Error marking update as checked", http.StatusInternalServerError)
-			return
-		}
-		log.Printf("[RequestID: %s] Updates are not identical, update marked as checked", requestID)
-		w.WriteHeader(http.StatusOK)
+		slog.InfoContext(r.Context(), "Updates are not identical")
+		publishUploadedUpdate(w, r, *currentUpdate, expoAccount.Username)
 		return
 	}
-	log.Printf("[RequestID: %s] Updates are identical, delete folder...", requestID)
-	err = resolvedBucket.DeleteUpdateFolder(branchName, runtimeVersion, currentUpdate.UpdateId)
+	slog.InfoContext(r.Context(), "Updates are identical, delete folder...")
+	err = resolvedBucket.DeleteUpdateFolder(r.Context(), branchName, runtimeVersion, currentUpdate.UpdateId)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error deleting update folder: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error deleting update folder", "error", err)
 		http.Error(w, "Error deleting update folder", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNotAcceptable)
 	// Send error like json error { error: "No changes detected in the update from the previous one" }
-	log.Printf("[RequestID: %s] Updates are identical, folder deleted", requestID)
+	slog.InfoContext(r.Context(), "Updates are identical, folder deleted")
 	w.Header().Set("Content-Type", "application/json")
 	response := map[string]string{
 		"error": "You have already uploaded this update, no changes detected",
@@ -139,31 +215,30 @@ func MarkUpdateAsUploadedHandler(w http.ResponseWriter, r *http.Request) {
 func RequestUploadLocalFileHandler(w http.ResponseWriter, r *http.Request) {
 	bucketType := bucket.ResolveBucketType()
 	if bucketType != bucket.LocalBucketType {
-		log.Printf("Invalid bucket type: %s", bucketType)
+		slog.ErrorContext(r.Context(), "Invalid bucket type", "bucketType", bucketType)
 		http.Error(w, "Invalid bucket type", http.StatusInternalServerError)
 		return
 	}
-	requestID := uuid.New().String()
 	expoAuth := helpers.GetExpoAuth(r)
-	expoAccount, err := services.ValidateExpoAuth(expoAuth)
+	expoAccount, err := services.ValidateExpoAuth(r.Context(), expoAuth)
 	if err != nil || expoAccount == nil {
-		log.Printf("[RequestID: %s] Error validating expo auth: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error validating expo auth", "error", err)
 		http.Error(w, "Error validating expo auth", http.StatusUnauthorized)
 	}
 	token := r.URL.Query().Get("token")
 	if token == "" {
-		log.Printf("[RequestID: %s] No token provided", requestID)
+		slog.WarnContext(r.Context(), "No token provided")
 		http.Error(w, "No token provided", http.StatusBadRequest)
 		return
 	}
-	filePath, err := bucket.ValidateUploadTokenAndResolveFilePath(token)
+	filePath, err := bucket.ValidateUploadTokenAndResolveFilePath(r.Context(), token)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error validating upload token: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error validating upload token", "error", err)
 		http.Error(w, "Error validating upload token", http.StatusBadRequest)
 		return
 	}
 	if r.Body == nil {
-		log.Printf("[RequestID: %s] Empty request body", requestID)
+		slog.WarnContext(r.Context(), "Empty request body")
 		http.Error(w, "Empty request body", http.StatusBadRequest)
 		return
 	}
@@ -173,19 +248,19 @@ func RequestUploadLocalFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	file, _, err := r.FormFile(fileName)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error retrieving file from form: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error retrieving file from form", "error", err)
 		http.Error(w, "Error retrieving file from form", http.StatusBadRequest)
 		return
 	}
 
 	success, err := bucket.HandleUploadFile(filePath, file)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error handling upload file: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error handling upload file", "error", err)
 		http.Error(w, "Error handling upload file", http.StatusInternalServerError)
 		return
 	}
 	if !success {
-		log.Printf("[RequestID: %s] Error handling upload file", requestID)
+		slog.ErrorContext(r.Context(), "Error handling upload file")
 		http.Error(w, "Error handling upload file", http.StatusInternalServerError)
 		return
 	}
@@ -193,90 +268,124 @@ func RequestUploadLocalFileHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func RequestUploadUrlHandler(w http.ResponseWriter, r *http.Request) {
-	requestID := uuid.New().String()
 	vars := mux.Vars(r)
 	branchName := vars["BRANCH"]
 	if branchName == "" {
-		log.Printf("[RequestID: %s] No branch provided", requestID)
+		slog.WarnContext(r.Context(), "No branch provided")
 		http.Error(w, "No branch provided", http.StatusBadRequest)
 		return
 	}
 
 	expoAuth := helpers.GetExpoAuth(r)
-	expoAccount, err := services.ValidateExpoAuth(expoAuth)
+	expoAccount, err := services.ValidateExpoAuth(r.Context(), expoAuth)
 	if err != nil || expoAccount == nil {
-		log.Printf("[RequestID: %s] Error validating expo auth: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error validating expo auth", "error", err)
 		http.Error(w, "Error validating expo auth", http.StatusUnauthorized)
 	}
 
-	err = branch.UpsertBranch(branchName)
+	err = branch.UpsertBranch(r.Context(), branchName)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error upserting branch: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error upserting branch", "error", err)
 		http.Error(w, "Error upserting branch", http.StatusInternalServerError)
 		return
 	}
 
 	if expoAccount == nil {
-		log.Printf("[RequestID: %s] No expo account found", requestID)
+		slog.WarnContext(r.Context(), "No expo account found")
 		http.Error(w, "No expo account found", http.StatusUnauthorized)
 		return
 	}
 
 	platform := r.URL.Query().Get("platform")
 	if platform != "" && (platform != "ios" && platform != "android") {
-		log.Printf("[RequestID: %s] Invalid platform: %s", requestID, platform)
+		slog.WarnContext(r.Context(), "Invalid platform", "platform", platform)
 		http.Error(w, "Invalid platform", http.StatusBadRequest)
 	}
 	commitHash := r.URL.Query().Get("commitHash")
 	runtimeVersion := r.URL.Query().Get("runtimeVersion")
 	if runtimeVersion == "" {
-		log.Printf("[RequestID: %s] No runtime version provided", requestID)
+		slog.WarnContext(r.Context(), "No runtime version provided")
 		http.Error(w, "No runtime version provided", http.StatusBadRequest)
 		return
 	}
+	activateAt, expireAt, err := update.ParseSchedule(r.URL.Query().Get("activateAt"), r.URL.Query().Get("expireAt"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Invalid schedule", "error", err)
+		http.Error(w, fmt.Sprintf("Invalid schedule: %s", err), http.StatusBadRequest)
+		return
+	}
 
 	var request FileNamesRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		log.Printf("[RequestID: %s] Error decoding JSON body: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error decoding JSON body", "error", err)
 		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
 		return
 	}
 
 	if len(request.FileNames) == 0 {
-		log.Printf("[RequestID: %s] No file names provided", requestID)
+		slog.WarnContext(r.Context(), "No file names provided")
 		http.Error(w, "No file names provided", http.StatusBadRequest)
 		return
 	}
+	if !validateDescription(w, r, request) {
+		return
+	}
+	if !validateSourceMaps(w, r, request) {
+		return
+	}
 
 	updateId := update.GenerateUpdateTimestamp()
-	updateRequests, err := bucket.RequestUploadUrlsForFileUpdates(branchName, runtimeVersion, update.ConvertUpdateTimestampToString(updateId), request.FileNames)
+	updateRequests, err := bucket.RequestUploadUrlsForFileUpdates(r.Context(), branchName, runtimeVersion, update.ConvertUpdateTimestampToString(updateId), request.FileNames)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error requesting upload urls: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error requesting upload urls", "error", err)
 		http.Error(w, "Error requesting upload urls", http.StatusInternalServerError)
 		return
 	}
+	sourceMapRequests, err := requestSourceMapUploads(r, branchName, runtimeVersion, update.ConvertUpdateTimestampToString(updateId), request.SourceMaps)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error requesting source map upload urls", "error", err)
+		http.Error(w, "Error requesting upload urls", http.StatusInternalServerError)
+		return
+	}
+	updateRequests = append(updateRequests, sourceMapRequests...)
 	fileUpdateMetadata := map[string]interface{}{
 		"platform":   platform,
 		"commitHash": commitHash,
 	}
+	if len(request.FileHashes) > 0 {
+		fileUpdateMetadata["fileHashes"] = request.FileHashes
+	}
+	if activateAt != nil {
+		fileUpdateMetadata["activateAt"] = activateAt
+	}
+	if expireAt != nil {
+		fileUpdateMetadata["expireAt"] = expireAt
+	}
+	if request.Message != "" {
+		fileUpdateMetadata["message"] = request.Message
+	}
+	if len(request.Metadata) > 0 {
+		fileUpdateMetadata["metadata"] = request.Metadata
+	}
+	if len(request.ManifestFields) > 0 {
+		fileUpdateMetadata["manifestFields"] = request.ManifestFields
+	}
 	marshalledMetadata, err := json.Marshal(fileUpdateMetadata)
 	if err != nil {
-		log.Printf("[RequestID: %s] Error marshalling file update metadata: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error marshalling file update metadata", "error", err)
 		http.Error(w, "Error marshalling file update metadata", http.StatusInternalServerError)
 		return
 	}
 	metadataReader := bytes.NewReader(marshalledMetadata)
 	resolvedBucket := bucket.GetBucket()
-	err = resolvedBucket.UploadFileIntoUpdate(types.Update{
+	err = resolvedBucket.UploadFileIntoUpdate(r.Context(), types.Update{
 		Branch:         branchName,
 		RuntimeVersion: runtimeVersion,
 		UpdateId:       update.ConvertUpdateTimestampToString(updateId),
 		CreatedAt:      time.Duration(updateId) * time.Millisecond,
 	}, "update-metadata.json", metadataReader)
 
-	cache := cache2.GetCache()
-	cacheKey := update.ComputeLastUpdateCacheKey(branchName, runtimeVersion, platform)
-	cache.Delete(cacheKey)
+	update.InvalidateLatestUpdate(r.Context(), branchName, runtimeVersion, platform)
 
 	response := map[string]interface{}{
 		"updateId":       updateId,
@@ -286,8 +395,143 @@ func RequestUploadUrlHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("expo-update-id", fmt.Sprintf("%d", updateId))
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("[RequestID: %s] Error encoding response: %v", requestID, err)
+		slog.ErrorContext(r.Context(), "Error encoding response", "error", err)
 		http.Error(w, "Error encoding response", http.StatusInternalServerError)
 	}
 	w.WriteHeader(http.StatusOK)
 }
+
+type UpdateGroupRequest struct {
+	FileNamesRequest
+	Updates []types.UpdateGroupMember `json:"updates"`
+}
+
+type UpdateGroupUploadItem struct {
+	types.UpdateGroupMember
+	UploadRequests []bucket.FileUploadRequest `json:"uploadRequests"`
+}
+
+// RequestUploadGroupHandler creates the linked updates of a multi-platform publish in one call,
+// they are served together once every one of them is marked as uploaded.
+func RequestUploadGroupHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	branchName := vars["BRANCH"]
+	if branchName == "" {
+		slog.WarnContext(r.Context(), "No branch provided")
+		http.Error(w, "No branch provided", http.StatusBadRequest)
+		return
+	}
+	expoAuth := helpers.GetExpoAuth(r)
+	expoAccount, err := services.ValidateExpoAuth(r.Context(), expoAuth)
+	if err != nil || expoAccount == nil {
+		slog.ErrorContext(r.Context(), "Error validating expo auth", "error", err)
+		http.Error(w, "Error validating expo auth", http.StatusUnauthorized)
+		return
+	}
+	err = branch.UpsertBranch(r.Context(), branchName)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error upserting branch", "error", err)
+		http.Error(w, "Error upserting branch", http.StatusInternalServerError)
+		return
+	}
+	commitHash := r.URL.Query().Get("commitHash")
+	activateAt, expireAt, err := update.ParseSchedule(r.URL.Query().Get("activateAt"), r.URL.Query().Get("expireAt"))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Invalid schedule", "error", err)
+		http.Error(w, fmt.Sprintf("Invalid schedule: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	var request UpdateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		slog.ErrorContext(r.Context(), "Error decoding JSON body", "error", err)
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(request.FileNames) == 0 {
+		slog.WarnContext(r.Context(), "No file names provided")
+		http.Error(w, "No file names provided", http.StatusBadRequest)
+		return
+	}
+	if !validateDescription(w, r, request.FileNamesRequest) {
+		return
+	}
+	if !validateSourceMaps(w, r, request.FileNamesRequest) {
+		return
+	}
+	if len(request.Updates) == 0 {
+		slog.WarnContext(r.Context(), "No updates provided")
+		http.Error(w, "No updates provided", http.StatusBadRequest)
+		return
+	}
+	platforms := make(map[string]bool)
+	for _, member := range request.Updates {
+		if (member.Platform != "ios" && member.Platform != "android") || platforms[member.Platform] {
+			slog.WarnContext(r.Context(), "Invalid platform", "platform", member.Platform)
+			http.Error(w, "Invalid platform", http.StatusBadRequest)
+			return
+		}
+		if member.RuntimeVersion == "" {
+			slog.WarnContext(r.Context(), "No runtime version provided", "platform", member.Platform)
+			http.Error(w, "No runtime version provided", http.StatusBadRequest)
+			return
+		}
+		platforms[member.Platform] = true
+	}
+
+	group := update.NewUpdateGroup(request.Updates)
+	resolvedBucket := bucket.GetBucket()
+	items := make([]UpdateGroupUploadItem, 0, len(group.Updates))
+	for _, member := range group.Updates {
+		uploadRequests, err := bucket.RequestUploadUrlsForFileUpdates(r.Context(), branchName, member.RuntimeVersion, member.UpdateId, request.FileNames)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error requesting upload urls", "error", err)
+			http.Error(w, "Error requesting upload urls", http.StatusInternalServerError)
+			return
+		}
+		sourceMapRequests, err := requestSourceMapUploads(r, branchName, member.RuntimeVersion, member.UpdateId, request.SourceMaps)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error requesting source map upload urls", "error", err)
+			http.Error(w, "Error requesting upload urls", http.StatusInternalServerError)
+			return
+		}
+		uploadRequests = append(uploadRequests, sourceMapRequests...)
+		marshalledMetadata, err := json.Marshal(types.UpdateStoredMetadata{
+			Platform:       member.Platform,
+			CommitHash:     commitHash,
+			FileHashes:     request.FileHashes,
+			Group:          group,
+			ActivateAt:     activateAt,
+			ExpireAt:       expireAt,
+			Message:        request.Message,
+			Metadata:       request.Metadata,
+			ManifestFields: request.ManifestFields,
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error marshalling file update metadata", "error", err)
+			http.Error(w, "Error marshalling file update metadata", http.StatusInternalServerError)
+			return
+		}
+		memberUpdate, err := update.GetUpdate(branchName, member.RuntimeVersion, member.UpdateId)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error getting update", "error", err)
+			http.Error(w, "Error getting update", http.StatusInternalServerError)
+			return
+		}
+		err = resolvedBucket.UploadFileIntoUpdate(r.Context(), *memberUpdate, "update-metadata.json", bytes.NewReader(marshalledMetadata))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error uploading update metadata", "error", err)
+			http.Error(w, "Error uploading update metadata", http.StatusInternalServerError)
+			return
+		}
+		items = append(items, UpdateGroupUploadItem{UpdateGroupMember: member, UploadRequests: uploadRequests})
+	}
+	slog.InfoContext(r.Context(), "Update group created", "groupId", group.Id, "updates", len(items))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"groupId": group.Id,
+		"updates": items,
+	})
+}
@@ -0,0 +1,177 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/cache"
+	"expo-open-ota/internal/keyStore"
+	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/types"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusOK           Status = "ok"
+	StatusError        Status = "error"
+	StatusShuttingDown Status = "shutting_down"
+)
+
+const (
+	defaultCheckTimeout = 5 * time.Second
+	// expoApiCheckTTL is how long the result of the Expo API check is reused, so that readiness
+	// probes don't call the Expo API every time.
+	expoApiCheckTTL = 30 * time.Second
+)
+
+type CheckResult struct {
+	Status     Status `json:"status"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type dependencyCheck struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+var shuttingDown atomic.Bool
+
+// MarkShuttingDown makes readiness fail so load balancers stop routing new requests while
+// in-flight ones are drained.
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+func IsShuttingDown() bool {
+	return shuttingDown.Load()
+}
+
+// ResetShuttingDown is used by tests.
+func ResetShuttingDown() {
+	shuttingDown.Store(false)
+}
+
+func checkBucket(ctx context.Context) error {
+	_, err := bucket.GetBucket().GetBranches(ctx)
+	return err
+}
+
+func checkCache(ctx context.Context) error {
+	key := "healthcheck:" + uuid.New().String()
+	value := time.Now().UTC().Format(time.RFC3339Nano)
+	ttl := 10
+	c := cache.GetCache()
+	if err := c.Set(ctx, key, value, &ttl); err != nil {
+		return err
+	}
+	defer c.Delete(context.WithoutCancel(ctx), key)
+	if c.Get(ctx, key) != value {
+		return errors.New("value written to the cache could not be read back")
+	}
+	return nil
+}
+
+func checkKeyStore(ctx context.Context) error {
+	if keyStore.GetPublicExpoKey(ctx) == "" || keyStore.GetPrivateExpoKey(ctx) == "" {
+		return errors.New("expo signing keys are not available")
+	}
+	return nil
+}
+
+var expoApiCheck struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// ResetExpoApiCheck forgets the last result of the Expo API check, it is used by tests.
+func ResetExpoApiCheck() {
+	expoApiCheck.mu.Lock()
+	defer expoApiCheck.mu.Unlock()
+	expoApiCheck.checkedAt = time.Time{}
+	expoApiCheck.err = nil
+}
+
+func checkExpoApi(ctx context.Context) error {
+	expoApiCheck.mu.Lock()
+	defer expoApiCheck.mu.Unlock()
+	if !expoApiCheck.checkedAt.IsZero() && time.Since(expoApiCheck.checkedAt) < expoApiCheckTTL {
+		return expoApiCheck.err
+	}
+	token := services.GetExpoAccessToken()
+	_, err := services.FetchExpoUserAccountInformations(ctx, types.ExpoAuth{Token: &token})
+	expoApiCheck.checkedAt = time.Now()
+	expoApiCheck.err = err
+	return err
+}
+
+// isExpoApiCheckEnabled is opt-in: manifests can be served from the cache while the Expo API is
+// down, which must not take every instance out of service at once.
+func isExpoApiCheckEnabled() bool {
+	return config.GetEnv("HEALTH_CHECK_EXPO_API") == "true"
+}
+
+func getDependencyChecks() []dependencyCheck {
+	checks := []dependencyCheck{
+		{name: "bucket", run: checkBucket},
+		{name: "cache", run: checkCache},
+		{name: "keyStore", run: checkKeyStore},
+	}
+	if isExpoApiCheckEnabled() {
+		checks = append(checks, dependencyCheck{name: "expoApi", run: checkExpoApi})
+	}
+	return checks
+}
+
+func runCheck(ctx context.Context, check dependencyCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, config.GetDurationEnv("HEALTH_CHECK_TIMEOUT_MS", defaultCheckTimeout))
+	defer cancel()
+	start := time.Now()
+	err := check.run(ctx)
+	result := CheckResult{Status: StatusOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusError
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// CheckReadiness runs every dependency check concurrently and reports the instance as ready
+// only when all of them succeed.
+func CheckReadiness(ctx context.Context) Report {
+	if IsShuttingDown() {
+		return Report{Status: StatusShuttingDown, Checks: map[string]CheckResult{}}
+	}
+	checks := getDependencyChecks()
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check dependencyCheck) {
+			defer wg.Done()
+			result := runCheck(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusError
+			}
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
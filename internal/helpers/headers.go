@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"sort"
 	"strings"
 )
 
@@ -19,3 +20,20 @@ func ParseExpoExtraParams(header string) map[string]string {
 	}
 	return params
 }
+
+// FormatStructuredDictionary serializes string values as a structured field dictionary, the
+// format of the expo-manifest-filters and expo-server-defined-headers headers. Keys are sorted so
+// that the header is stable.
+func FormatStructuredDictionary(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	members := make([]string, 0, len(keys))
+	for _, key := range keys {
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(values[key])
+		members = append(members, key+`="`+escaped+`"`)
+	}
+	return strings.Join(members, ", ")
+}
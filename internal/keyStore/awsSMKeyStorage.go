@@ -1,6 +1,9 @@
 package keyStore
 
-import "expo-open-ota/internal/services"
+import (
+	"context"
+	"expo-open-ota/internal/services"
+)
 
 type AWSSMKeysStorage struct {
 	publicExpoKeySecretID        string
@@ -8,23 +11,23 @@ type AWSSMKeysStorage struct {
 	privateCloudfrontKeySecretID string
 }
 
-func (c *AWSSMKeysStorage) GetPublicExpoKey() string {
+func (c *AWSSMKeysStorage) GetPublicExpoKey(ctx context.Context) string {
 	if c.publicExpoKeySecretID == "" {
 		return ""
 	}
-	return services.FetchSecret(c.publicExpoKeySecretID)
+	return services.FetchSecret(ctx, c.publicExpoKeySecretID)
 }
 
-func (c *AWSSMKeysStorage) GetPrivateExpoKey() string {
+func (c *AWSSMKeysStorage) GetPrivateExpoKey(ctx context.Context) string {
 	if c.privateExpoKeySecretID == "" {
 		return ""
 	}
-	return services.FetchSecret(c.privateExpoKeySecretID)
+	return services.FetchSecret(ctx, c.privateExpoKeySecretID)
 }
 
-func (c *AWSSMKeysStorage) GetPrivateCloudfrontKey() string {
+func (c *AWSSMKeysStorage) GetPrivateCloudfrontKey(ctx context.Context) string {
 	if c.privateCloudfrontKeySecretID == "" {
 		return ""
 	}
-	return services.FetchSecret(c.privateCloudfrontKeySecretID)
+	return services.FetchSecret(ctx, c.privateCloudfrontKeySecretID)
 }
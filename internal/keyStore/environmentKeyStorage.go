@@ -1,9 +1,10 @@
 package keyStore
 
 import (
+	"context"
 	"encoding/base64"
 	"expo-open-ota/config"
-	"log"
+	"log/slog"
 )
 
 type EnvironmentKeysStorage struct {
@@ -18,20 +19,20 @@ func decodeKey(key string) string {
 	}
 	decoded, err := base64.StdEncoding.DecodeString(key)
 	if err != nil {
-		log.Printf("Failed to decode base64 key: %v", err)
+		slog.Error("Failed to decode base64 key", "error", err)
 		return ""
 	}
 	return string(decoded)
 }
 
-func (c *EnvironmentKeysStorage) GetPublicExpoKey() string {
+func (c *EnvironmentKeysStorage) GetPublicExpoKey(_ context.Context) string {
 	return decodeKey(config.GetEnv(c.publicExpoKeyBase64Key))
 }
 
-func (c *EnvironmentKeysStorage) GetPrivateExpoKey() string {
+func (c *EnvironmentKeysStorage) GetPrivateExpoKey(_ context.Context) string {
 	return decodeKey(config.GetEnv(c.privateExpoKeyBase64Key))
 }
 
-func (c *EnvironmentKeysStorage) GetPrivateCloudfrontKey() string {
+func (c *EnvironmentKeysStorage) GetPrivateCloudfrontKey(_ context.Context) string {
 	return decodeKey(config.GetEnv(c.privateCloudfrontKeyBase64Key))
 }
@@ -1,8 +1,10 @@
 package keyStore
 
 import (
+	"context"
 	"expo-open-ota/config"
 	"fmt"
+	"time"
 )
 
 type KeysStorageType string
@@ -13,10 +15,17 @@ const (
 	Environment       KeysStorageType = "environment"
 )
 
+const defaultTimeout = 10 * time.Second
+
+// withTimeout bounds key retrieval, which may go over the network for remote key stores.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, config.GetDurationEnv("KEYS_STORAGE_TIMEOUT_MS", defaultTimeout))
+}
+
 type KeysStorage interface {
-	GetPublicExpoKey() string
-	GetPrivateExpoKey() string
-	GetPrivateCloudfrontKey() string
+	GetPublicExpoKey(ctx context.Context) string
+	GetPrivateExpoKey(ctx context.Context) string
+	GetPrivateCloudfrontKey(ctx context.Context) string
 }
 
 func getStorage() (KeysStorage, error) {
@@ -65,26 +74,32 @@ func getStorage() (KeysStorage, error) {
 	}
 }
 
-func GetPublicExpoKey() string {
+func GetPublicExpoKey(ctx context.Context) string {
 	storage, err := getStorage()
 	if err != nil {
 		return ""
 	}
-	return storage.GetPublicExpoKey()
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return storage.GetPublicExpoKey(ctx)
 }
 
-func GetPrivateExpoKey() string {
+func GetPrivateExpoKey(ctx context.Context) string {
 	storage, err := getStorage()
 	if err != nil {
 		return ""
 	}
-	return storage.GetPrivateExpoKey()
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return storage.GetPrivateExpoKey(ctx)
 }
 
-func GetPrivateCloudfrontKey() string {
+func GetPrivateCloudfrontKey(ctx context.Context) string {
 	storage, err := getStorage()
 	if err != nil {
 		return ""
 	}
-	return storage.GetPrivateCloudfrontKey()
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return storage.GetPrivateCloudfrontKey(ctx)
 }
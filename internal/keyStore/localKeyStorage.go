@@ -1,8 +1,9 @@
 package keyStore
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"log/slog"
 	"os"
 )
 
@@ -15,27 +16,27 @@ type LocalKeysStorage struct {
 func retrieveFileContent(path string) string {
 	file, err := os.Open(path)
 	if err != nil {
-		fmt.Println("Error opening file:", err)
+		slog.Error("Error opening key file", "path", path, "error", err)
 		return ""
 	}
 	defer file.Close()
 
 	content, err := io.ReadAll(file)
 	if err != nil {
-		fmt.Println("Error reading file:", err)
+		slog.Error("Error reading key file", "path", path, "error", err)
 		return ""
 	}
 
 	return string(content)
 }
-func (c *LocalKeysStorage) GetPublicExpoKey() string {
+func (c *LocalKeysStorage) GetPublicExpoKey(_ context.Context) string {
 	if c.publicExpoKeyPath == "" {
 		return ""
 	}
 	return retrieveFileContent(c.publicExpoKeyPath)
 }
 
-func (c *LocalKeysStorage) GetPrivateExpoKey() string {
+func (c *LocalKeysStorage) GetPrivateExpoKey(_ context.Context) string {
 	if c.privateExpoKeyPath == "" {
 		return ""
 	}
@@ -43,7 +44,7 @@ func (c *LocalKeysStorage) GetPrivateExpoKey() string {
 	return private
 }
 
-func (c *LocalKeysStorage) GetPrivateCloudfrontKey() string {
+func (c *LocalKeysStorage) GetPrivateCloudfrontKey(_ context.Context) string {
 	if c.privateCloudfrontKeyPath == "" {
 		return ""
 	}
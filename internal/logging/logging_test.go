@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	testing2 "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONHandlerAddsRequestID(t *testing2.T) {
+	var buffer bytes.Buffer
+	logger := slog.New(NewHandler(&buffer, "json", slog.LevelInfo))
+	ctx := WithRequestID(context.Background(), "request-1")
+
+	logger.InfoContext(ctx, "Update served", "branch", "main")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &line))
+	assert.Equal(t, "Update served", line["msg"])
+	assert.Equal(t, "request-1", line["requestId"])
+	assert.Equal(t, "main", line["branch"])
+}
+
+func TestHandlerWithoutRequestID(t *testing2.T) {
+	var buffer bytes.Buffer
+	logger := slog.New(NewHandler(&buffer, "json", slog.LevelInfo)).With("component", "test")
+
+	logger.InfoContext(context.Background(), "No request")
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &line))
+	assert.NotContains(t, line, "requestId")
+	assert.Equal(t, "test", line["component"])
+}
+
+func TestHandlerLevel(t *testing2.T) {
+	var buffer bytes.Buffer
+	logger := slog.New(NewHandler(&buffer, "text", ParseLevel("warn")))
+
+	logger.Info("Ignored")
+	assert.Empty(t, buffer.String())
+	logger.Warn("Kept")
+	assert.Contains(t, buffer.String(), "msg=Kept")
+}
+
+func TestParseLevel(t *testing2.T) {
+	assert.Equal(t, slog.LevelDebug, ParseLevel("DEBUG"))
+	assert.Equal(t, slog.LevelWarn, ParseLevel("warning"))
+	assert.Equal(t, slog.LevelError, ParseLevel("error"))
+	assert.Equal(t, slog.LevelInfo, ParseLevel(""))
+}
@@ -1,9 +1,17 @@
 package metrics
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"expo-open-ota/internal/cache"
 	"fmt"
 	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -41,12 +49,20 @@ var (
 		},
 		[]string{"platform", "runtime", "branch", "update"},
 	)
+	updateErrorRateVec = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "update_error_rate",
+			Help: "Ratio of users who encountered an error over active users for a given platform, runtime version, branch and update",
+		},
+		[]string{"platform", "runtime", "branch", "update"},
+	)
 )
 
 func InitMetrics() {
 	prometheus.MustRegister(activeUsersVec)
 	prometheus.MustRegister(updateDownloadsVec)
 	prometheus.MustRegister(updateErrorUsersVec)
+	prometheus.MustRegister(updateErrorRateVec)
 	prometheus.MustRegister(globalActiveUsersVec)
 }
 
@@ -54,50 +70,210 @@ func CleanupMetrics() {
 	prometheus.Unregister(activeUsersVec)
 	prometheus.Unregister(updateDownloadsVec)
 	prometheus.Unregister(updateErrorUsersVec)
+	prometheus.Unregister(updateErrorRateVec)
 	prometheus.Unregister(globalActiveUsersVec)
 }
 
-func TrackUpdateErrorUsers(clientId, platform, runtime, branch, update string) {
+const (
+	usersTTL              = 14400
+	maxErrorMessageLength = 512
+	// maxErrorMessages caps the distinct messages recorded per update, later ones are not recorded.
+	maxErrorMessages = 50
+)
+
+// errorMessageNumberPattern matches the numbers and addresses that make otherwise identical
+// errors distinct.
+var errorMessageNumberPattern = regexp.MustCompile(`\b(0x[0-9a-fA-F]+|\d+)\b`)
+
+type ErrorMessageStats struct {
+	Message string `json:"message"`
+	Users   int64  `json:"users"`
+}
+
+type UpdateErrorStats struct {
+	ActiveUsers int64               `json:"activeUsers"`
+	ErrorUsers  int64               `json:"errorUsers"`
+	ErrorRate   float64             `json:"errorRate"`
+	TopErrors   []ErrorMessageStats `json:"topErrors"`
+}
+
+func computeActiveUsersKey(platform, runtime, branch, update string) string {
+	return fmt.Sprintf("seen_users_hll:%s:%s:%s:%s", branch, platform, runtime, update)
+}
+
+func computeErrorUsersKey(platform, runtime, branch, update string) string {
+	return fmt.Sprintf("update_error_users_hll:%s:%s:%s:%s", branch, platform, runtime, update)
+}
+
+func computeErrorMessagesKey(platform, runtime, branch, update string) string {
+	return fmt.Sprintf("update_error_messages:%s:%s:%s:%s", branch, platform, runtime, update)
+}
+
+func computeErrorMessageUsersKey(platform, runtime, branch, update, message string) string {
+	hash := sha256.Sum256([]byte(message))
+	return fmt.Sprintf("update_error_message_users:%s:%s:%s:%s:%s", branch, platform, runtime, update, hex.EncodeToString(hash[:]))
+}
+
+// normalizeErrorMessage keeps the first line of the message with its numbers masked, so that the
+// errors differing only by an index or an address are grouped, and truncates it on a rune boundary.
+func normalizeErrorMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if index := strings.IndexAny(message, "\r\n"); index >= 0 {
+		message = message[:index]
+	}
+	message = strings.ToValidUTF8(message, "")
+	message = errorMessageNumberPattern.ReplaceAllString(message, "#")
+	message = strings.Join(strings.Fields(message), " ")
+	if len(message) > maxErrorMessageLength {
+		cut := maxErrorMessageLength
+		for cut > 0 && !utf8.RuneStart(message[cut]) {
+			cut--
+		}
+		message = message[:cut]
+	}
+	return message
+}
+
+// admitErrorMessage reports whether the message can be recorded, either because it already was or
+// because fewer than maxErrorMessages messages were recorded for the update.
+func admitErrorMessage(ctx context.Context, resolvedCache cache.Cache, key string, message string) bool {
+	count, err := resolvedCache.Scard(ctx, key)
+	if err != nil {
+		return false
+	}
+	if count < maxErrorMessages {
+		return true
+	}
+	messages, err := resolvedCache.Smembers(ctx, key)
+	return err == nil && slices.Contains(messages, message)
+}
+
+func TrackUpdateErrorUsers(ctx context.Context, clientId, platform, runtime, branch, update, errorMessage string) {
 	computedUpdate := update
 	if computedUpdate == "" {
 		computedUpdate = "unknown"
 	}
-	if clientId == "" || platform == "" || runtime == "" || branch == ""  {
+	if clientId == "" || platform == "" || runtime == "" || branch == "" {
+		return
+	}
+	resolvedCache := cache.GetCache()
+	key := computeErrorUsersKey(platform, runtime, branch, computedUpdate)
+	ttl := usersTTL
+
+	_ = resolvedCache.Pfadd(ctx, key, []string{clientId}, &ttl)
+
+	messagesKey := computeErrorMessagesKey(platform, runtime, branch, computedUpdate)
+	if message := normalizeErrorMessage(errorMessage); message != "" && admitErrorMessage(ctx, resolvedCache, messagesKey, message) {
+		_ = resolvedCache.Sadd(ctx, messagesKey, []string{message}, &ttl)
+		_ = resolvedCache.Pfadd(ctx, computeErrorMessageUsersKey(platform, runtime, branch, computedUpdate, message), []string{clientId}, &ttl)
+	}
+
+	series := admitUpdateSeries(platform, runtime, branch, computedUpdate)
+	count, err := countSeriesUsers(ctx, computeErrorUsersKey, series, key, clientId)
+	if err != nil {
 		return
 	}
+	updateErrorUsersVec.WithLabelValues(series.labels()...).Set(float64(count))
+	refreshUpdateErrorRate(ctx, series)
+}
+
+// countSeriesUsers returns the users of the series the update is exposed with. The overflow series
+// has sketches of its own, where the users of every update folded into it are added.
+func countSeriesUsers(ctx context.Context, computeKey func(platform, runtime, branch, update string) string, series updateSeries, updateKey string, clientId string) (int64, error) {
 	resolvedCache := cache.GetCache()
-	key := fmt.Sprintf("update_error_users:%s:%s:%s:%s", branch, platform, runtime, computedUpdate)
-	ttl := 600
+	seriesKey := computeKey(series.platform, series.runtime, series.branch, series.update)
+	if seriesKey != updateKey {
+		ttl := usersTTL
+		_ = resolvedCache.Pfadd(ctx, seriesKey, []string{clientId}, &ttl)
+	}
+	return resolvedCache.Pfcount(ctx, seriesKey)
+}
 
-	_ = resolvedCache.Sadd(key, []string{runtime}, &ttl)
+func computeErrorRate(activeUsers, errorUsers int64) float64 {
+	// Clients reporting an error on an update they no longer run are not counted as active.
+	if errorUsers > activeUsers {
+		activeUsers = errorUsers
+	}
+	if activeUsers == 0 {
+		return 0
+	}
+	return float64(errorUsers) / float64(activeUsers)
+}
 
-	count, err := resolvedCache.Scard(key)
+func refreshUpdateErrorRate(ctx context.Context, series updateSeries) {
+	resolvedCache := cache.GetCache()
+	errorUsers, err := resolvedCache.Pfcount(ctx, computeErrorUsersKey(series.platform, series.runtime, series.branch, series.update))
+	if err != nil || errorUsers == 0 {
+		return
+	}
+	activeUsers, err := resolvedCache.Pfcount(ctx, computeActiveUsersKey(series.platform, series.runtime, series.branch, series.update))
 	if err != nil {
 		return
 	}
-	updateErrorUsersVec.WithLabelValues(platform, runtime, branch, computedUpdate).Set(float64(count))
+	updateErrorRateVec.WithLabelValues(series.labels()...).Set(computeErrorRate(activeUsers, errorUsers))
 }
 
-func TrackActiveUser(clientId, platform, runtime, branch, update string) {
+// GetUpdateErrorStats returns the error rate of an update and its most frequent error messages.
+func GetUpdateErrorStats(ctx context.Context, platform, runtime, branch, update string, limit int) (UpdateErrorStats, error) {
+	resolvedCache := cache.GetCache()
+	stats := UpdateErrorStats{TopErrors: []ErrorMessageStats{}}
+	activeUsers, err := resolvedCache.Pfcount(ctx, computeActiveUsersKey(platform, runtime, branch, update))
+	if err != nil {
+		return stats, err
+	}
+	errorUsers, err := resolvedCache.Pfcount(ctx, computeErrorUsersKey(platform, runtime, branch, update))
+	if err != nil {
+		return stats, err
+	}
+	stats.ActiveUsers = activeUsers
+	stats.ErrorUsers = errorUsers
+	stats.ErrorRate = computeErrorRate(activeUsers, errorUsers)
+
+	messages, err := resolvedCache.Smembers(ctx, computeErrorMessagesKey(platform, runtime, branch, update))
+	if err != nil {
+		return stats, err
+	}
+	for _, message := range messages {
+		users, err := resolvedCache.Pfcount(ctx, computeErrorMessageUsersKey(platform, runtime, branch, update, message))
+		if err != nil || users == 0 {
+			continue
+		}
+		stats.TopErrors = append(stats.TopErrors, ErrorMessageStats{Message: message, Users: users})
+	}
+	sort.Slice(stats.TopErrors, func(i, j int) bool {
+		if stats.TopErrors[i].Users == stats.TopErrors[j].Users {
+			return stats.TopErrors[i].Message < stats.TopErrors[j].Message
+		}
+		return stats.TopErrors[i].Users > stats.TopErrors[j].Users
+	})
+	if limit > 0 && len(stats.TopErrors) > limit {
+		stats.TopErrors = stats.TopErrors[:limit]
+	}
+	return stats, nil
+}
+
+func TrackActiveUser(ctx context.Context, clientId, platform, runtime, branch, update string) {
 	if clientId == "" || platform == "" || branch == "" || update == "" || runtime == "" {
 		return
 	}
 
 	resolvedCache := cache.GetCache()
-	activeUserKey := fmt.Sprintf("seen_users:%s:%s:%s:%s", branch, platform, runtime, update)
-	ttl := 14400
+	activeUserKey := computeActiveUsersKey(platform, runtime, branch, update)
+	ttl := usersTTL
 
-	_ = resolvedCache.Sadd(activeUserKey, []string{clientId}, &ttl)
+	_ = resolvedCache.Pfadd(ctx, activeUserKey, []string{clientId}, &ttl)
 
-	count, err := resolvedCache.Scard(activeUserKey)
+	series := admitUpdateSeries(platform, runtime, branch, update)
+	count, err := countSeriesUsers(ctx, computeActiveUsersKey, series, activeUserKey, clientId)
 	if err != nil {
 		return
 	}
-	activeUsersVec.WithLabelValues(platform, runtime, branch, update).Set(float64(count))
+	activeUsersVec.WithLabelValues(series.labels()...).Set(float64(count))
+	refreshUpdateErrorRate(ctx, series)
 
-	globalActiveUserKey := fmt.Sprintf("global_active_users:%s", platform)
-	_ = resolvedCache.Sadd(globalActiveUserKey, []string{clientId}, &ttl)
-	count, err = resolvedCache.Scard(globalActiveUserKey)
+	globalActiveUserKey := fmt.Sprintf("global_active_users_hll:%s", platform)
+	_ = resolvedCache.Pfadd(ctx, globalActiveUserKey, []string{clientId}, &ttl)
+	count, err = resolvedCache.Pfcount(ctx, globalActiveUserKey)
 	if err != nil {
 		return
 	}
@@ -108,7 +284,8 @@ func TrackUpdateDownload(platform, runtime, branch, update, updateType string) {
 	if update == "" || platform == "" || branch == "" {
 		return
 	}
-	updateDownloadsVec.WithLabelValues(platform, runtime, branch, update, updateType).Inc()
+	series := admitUpdateSeries(platform, runtime, branch, update)
+	updateDownloadsVec.WithLabelValues(append(series.labels(), updateType)...).Inc()
 }
 
 func PrometheusHandler() http.Handler {
@@ -116,6 +293,7 @@ func PrometheusHandler() http.Handler {
 }
 
 func ResetMetricsForTest() {
+	resetTrackedUpdates()
 	activeUsersVec = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "active_users_total",
@@ -137,6 +315,13 @@ func ResetMetricsForTest() {
 		},
 		[]string{"platform", "runtime", "branch", "update"},
 	)
+	updateErrorRateVec = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "update_error_rate",
+			Help: "Ratio of users who encountered an error over active users for a given platform, runtime version, branch and update",
+		},
+		[]string{"platform", "runtime", "branch", "update"},
+	)
 	globalActiveUsersVec = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "global_active_users_total",
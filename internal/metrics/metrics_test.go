@@ -1,6 +1,7 @@
 package metrics_test
 
 import (
+	"context"
 	"net/http/httptest"
 	"os"
 	"regexp"
@@ -104,7 +105,7 @@ func TestTrackActiveUser(t *testing.T) {
 	runtime := "1.0.0"
 	branch := "stable"
 	update := "update42"
-	metrics.TrackActiveUser(clientId, platform, runtime, branch, update)
+	metrics.TrackActiveUser(context.Background(), clientId, platform, runtime, branch, update)
 	val := getActiveUsers(platform, runtime, branch, update)
 	if val != 1 {
 		t.Errorf("Expected active_users_total to be 1, got %v", val)
@@ -122,15 +123,15 @@ func TestGetActiveUsers(t *testing.T) {
 	if got := getActiveUsers(platform, runtime, branch, update); got != 0 {
 		t.Errorf("Expected getActiveUsers to return 0, got %v", got)
 	}
-	metrics.TrackActiveUser(clientId, platform, runtime, branch, update)
+	metrics.TrackActiveUser(context.Background(), clientId, platform, runtime, branch, update)
 	if got := getActiveUsers(platform, runtime, branch, update); got != 1 {
 		t.Errorf("Expected getActiveUsers to return 1, got %v", got)
 	}
-	metrics.TrackActiveUser(clientId, platform, runtime, branch, update)
+	metrics.TrackActiveUser(context.Background(), clientId, platform, runtime, branch, update)
 	if got := getActiveUsers(platform, runtime, branch, update); got != 1 {
 		t.Errorf("Expected getActiveUsers to still be 1 (Gauge should not increment), got %v", got)
 	}
-	metrics.TrackActiveUser("client2", platform, runtime, branch, update)
+	metrics.TrackActiveUser(context.Background(), "client2", platform, runtime, branch, update)
 	if got := getActiveUsers(platform, runtime, branch, update); got != 2 {
 		t.Errorf("Expected getActiveUsers to increment to 2, got %v", got)
 	}
@@ -175,3 +176,155 @@ func TestPrometheusHandler(t *testing.T) {
 		t.Errorf("Expected update_downloads_total in metrics, got %s", body)
 	}
 }
+
+func getUpdateErrorUsers(platform, runtime, branch, update string) float64 {
+	return getMetricValue("update_error_users_total", map[string]string{
+		"platform": platform,
+		"runtime":  runtime,
+		"branch":   branch,
+		"update":   update,
+	})
+}
+
+func getUpdateErrorRate(platform, runtime, branch, update string) float64 {
+	return getMetricValue("update_error_rate", map[string]string{
+		"platform": platform,
+		"runtime":  runtime,
+		"branch":   branch,
+		"update":   update,
+	})
+}
+
+func TestTrackUpdateErrorUsersCountsDistinctClients(t *testing.T) {
+	teardown := setupMetrics(t)
+	defer teardown()
+	platform := "android"
+	runtime := "2.0.0"
+	branch := "errors-distinct"
+	update := "update43"
+	metrics.TrackUpdateErrorUsers(context.Background(), "client1", platform, runtime, branch, update, "TypeError")
+	metrics.TrackUpdateErrorUsers(context.Background(), "client1", platform, runtime, branch, update, "TypeError")
+	metrics.TrackUpdateErrorUsers(context.Background(), "client2", platform, runtime, branch, update, "TypeError")
+	if got := getUpdateErrorUsers(platform, runtime, branch, update); got != 2 {
+		t.Errorf("Expected update_error_users_total to be 2, got %v", got)
+	}
+}
+
+func TestUpdateErrorRateAndTopErrors(t *testing.T) {
+	teardown := setupMetrics(t)
+	defer teardown()
+	platform := "ios"
+	runtime := "2.0.0"
+	branch := "errors-rate"
+	update := "update44"
+	for _, clientId := range []string{"client1", "client2", "client3", "client4"} {
+		metrics.TrackActiveUser(context.Background(), clientId, platform, runtime, branch, update)
+	}
+	metrics.TrackUpdateErrorUsers(context.Background(), "client1", platform, runtime, branch, update, "TypeError: undefined is not a function")
+	metrics.TrackUpdateErrorUsers(context.Background(), "client2", platform, runtime, branch, update, "TypeError: undefined is not a function")
+	metrics.TrackUpdateErrorUsers(context.Background(), "client3", platform, runtime, branch, update, "ReferenceError: foo is not defined")
+	if got := getUpdateErrorRate(platform, runtime, branch, update); got != 0.75 {
+		t.Errorf("Expected update_error_rate to be 0.75, got %v", got)
+	}
+
+	stats, err := metrics.GetUpdateErrorStats(context.Background(), platform, runtime, branch, update, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stats.ActiveUsers != 4 || stats.ErrorUsers != 3 {
+		t.Errorf("Expected 4 active users and 3 error users, got %d and %d", stats.ActiveUsers, stats.ErrorUsers)
+	}
+	if len(stats.TopErrors) != 1 {
+		t.Fatalf("Expected 1 top error, got %d", len(stats.TopErrors))
+	}
+	if stats.TopErrors[0].Message != "TypeError: undefined is not a function" || stats.TopErrors[0].Users != 2 {
+		t.Errorf("Unexpected top error: %+v", stats.TopErrors[0])
+	}
+}
+
+func TestUpdatesBeyondCapAreFoldedIntoOther(t *testing.T) {
+	teardown := setupMetrics(t)
+	defer teardown()
+	os.Setenv("METRICS_MAX_UPDATES_PER_RUNTIME", "2")
+	defer os.Unsetenv("METRICS_MAX_UPDATES_PER_RUNTIME")
+	platform := "ios"
+	runtime := "3.0.0"
+	branch := "series-cap"
+	metrics.TrackActiveUser(context.Background(), "client1", platform, runtime, branch, "update1")
+	metrics.TrackUpdateDownload(platform, runtime, branch, "update1", "normal")
+	metrics.TrackActiveUser(context.Background(), "client2", platform, runtime, branch, "update2")
+	metrics.TrackActiveUser(context.Background(), "client3", platform, runtime, branch, "update3")
+	metrics.TrackActiveUser(context.Background(), "client4", platform, runtime, branch, "update4")
+	metrics.TrackUpdateDownload(platform, runtime, branch, "update1", "normal")
+	if got := getTotalUpdateDownloads(platform, runtime, branch, "^update1$", "normal"); got != 2 {
+		t.Errorf("Expected downloads of update1 to keep counting, got %v", got)
+	}
+	if got := getActiveUsers(platform, runtime, branch, "^update1$"); got != 1 {
+		t.Errorf("Expected active users of update1 to be 1, got %v", got)
+	}
+	if got := getActiveUsers(platform, runtime, branch, "^update3$"); got != 0 {
+		t.Errorf("Expected no series for updates beyond the cap, got %v", got)
+	}
+	if got := getActiveUsers(platform, runtime, branch, "^other$"); got != 2 {
+		t.Errorf("Expected active users of the overflow update to be 2, got %v", got)
+	}
+}
+
+func TestSeriesBeyondScopeCapAreFoldedIntoOther(t *testing.T) {
+	teardown := setupMetrics(t)
+	defer teardown()
+	os.Setenv("METRICS_MAX_SCOPES", "1")
+	defer os.Unsetenv("METRICS_MAX_SCOPES")
+	platform := "android"
+	branch := "scope-cap"
+	metrics.TrackActiveUser(context.Background(), "client1", platform, "1.0.0", branch, "update1")
+	metrics.TrackActiveUser(context.Background(), "client2", platform, "forged-1", branch, "update2")
+	metrics.TrackActiveUser(context.Background(), "client3", platform, "forged-2", branch, "update3")
+	metrics.TrackUpdateDownload(platform, "forged-3", branch, "update4", "normal")
+	if got := getActiveUsers(platform, "^1.0.0$", branch, "^update1$"); got != 1 {
+		t.Errorf("Expected active users of the first scope to be 1, got %v", got)
+	}
+	if got := getActiveUsers(platform, "^forged-1$", branch, "^update2$"); got != 0 {
+		t.Errorf("Expected no series for scopes beyond the cap, got %v", got)
+	}
+	if got := getActiveUsers(platform, "^other$", "^other$", "^other$"); got != 2 {
+		t.Errorf("Expected active users of the overflow series to be 2, got %v", got)
+	}
+	if got := getTotalUpdateDownloads(platform, "^other$", "^other$", "^other$", "normal"); got != 1 {
+		t.Errorf("Expected downloads of the overflow series to be 1, got %v", got)
+	}
+}
+
+func TestErrorMessagesAreNormalizedAndCapped(t *testing.T) {
+	teardown := setupMetrics(t)
+	defer teardown()
+	platform := "ios"
+	runtime := "2.0.0"
+	branch := "errors-cap"
+	update := "update45"
+	metrics.TrackUpdateErrorUsers(context.Background(), "client1", platform, runtime, branch, update, "Error: Requiring unknown module \"12\"\n    at index.bundle:1:2")
+	metrics.TrackUpdateErrorUsers(context.Background(), "client2", platform, runtime, branch, update, "Error:  Requiring unknown module \"345\"")
+	stats, err := metrics.GetUpdateErrorStats(context.Background(), platform, runtime, branch, update, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stats.TopErrors) != 1 || stats.TopErrors[0].Message != "Error: Requiring unknown module \"#\"" || stats.TopErrors[0].Users != 2 {
+		t.Fatalf("Expected messages differing by numbers to be grouped, got %+v", stats.TopErrors)
+	}
+
+	for i := 0; i < 60; i++ {
+		metrics.TrackUpdateErrorUsers(context.Background(), "client3", platform, runtime, branch, update, "Error "+strings.Repeat("x", i+1)+"y"+strings.Repeat("z", 1024))
+	}
+	stats, err = metrics.GetUpdateErrorStats(context.Background(), platform, runtime, branch, update, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stats.TopErrors) != 50 {
+		t.Errorf("Expected 50 recorded messages, got %d", len(stats.TopErrors))
+	}
+	for _, topError := range stats.TopErrors {
+		if len(topError.Message) > 512 {
+			t.Errorf("Expected messages to be truncated, got %d bytes", len(topError.Message))
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"expo-open-ota/config"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultMaxUpdateSeries = 5
+	defaultMaxSeriesScopes = 50
+	// overflowLabel replaces the runtime version, branch and update of series beyond the scope cap,
+	// and the update of series beyond the update cap of a scope.
+	overflowLabel = "other"
+)
+
+type seriesScope struct {
+	platform string
+	runtime  string
+	branch   string
+}
+
+// updateSeries holds the labels an update is exposed with.
+type updateSeries struct {
+	seriesScope
+	update string
+}
+
+var (
+	seriesMu       sync.Mutex
+	trackedUpdates = map[seriesScope]map[string]time.Time{}
+)
+
+func getMaxUpdateSeries() int {
+	value, err := strconv.Atoi(config.GetEnv("METRICS_MAX_UPDATES_PER_RUNTIME"))
+	if err != nil || value <= 0 {
+		return defaultMaxUpdateSeries
+	}
+	return value
+}
+
+func getMaxSeriesScopes() int {
+	value, err := strconv.Atoi(config.GetEnv("METRICS_MAX_SCOPES"))
+	if err != nil || value <= 0 {
+		return defaultMaxSeriesScopes
+	}
+	return value
+}
+
+func overflowSeries(platform string) updateSeries {
+	return updateSeries{seriesScope: seriesScope{platform: platform, runtime: overflowLabel, branch: overflowLabel}, update: overflowLabel}
+}
+
+func (s updateSeries) labels() []string {
+	return []string{s.platform, s.runtime, s.branch, s.update}
+}
+
+func (s updateSeries) isOverflow() bool {
+	return s.runtime == overflowLabel && s.branch == overflowLabel && s.update == overflowLabel
+}
+
+// admitUpdateSeries marks the update as active for its platform, runtime version and branch, and
+// returns the labels to expose it with. Runtime versions and branches come from request headers,
+// so past the configured number of scopes new ones are folded into the "other" series of their
+// platform. Likewise, past the configured number of updates of a scope, new updates are folded into
+// the "other" update of the scope, so that counters of the tracked updates are never reset. Series
+// are only deleted once not seen for longer than the users window.
+func admitUpdateSeries(platform, runtime, branch, update string) updateSeries {
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+
+	now := time.Now()
+	staleBefore := now.Add(-usersTTL * time.Second)
+	series := updateSeries{seriesScope: seriesScope{platform: platform, runtime: runtime, branch: branch}, update: update}
+	updates, ok := trackedUpdates[series.seriesScope]
+	if !ok && !series.isOverflow() {
+		if countScopes() >= getMaxSeriesScopes() {
+			deleteStaleScopes(staleBefore)
+		}
+		if countScopes() >= getMaxSeriesScopes() {
+			series = overflowSeries(platform)
+			updates, ok = trackedUpdates[series.seriesScope]
+		}
+	}
+	if !ok {
+		updates = map[string]time.Time{}
+		trackedUpdates[series.seriesScope] = updates
+	}
+
+	for trackedUpdate, lastSeen := range updates {
+		if lastSeen.Before(staleBefore) {
+			delete(updates, trackedUpdate)
+			deleteUpdateSeries(series.seriesScope, trackedUpdate)
+		}
+	}
+	if _, tracked := updates[series.update]; !tracked && countUpdates(updates) >= getMaxUpdateSeries() {
+		series.update = overflowLabel
+	}
+	updates[series.update] = now
+	return series
+}
+
+// countUpdates counts the updates tracked in a scope, its overflow update excepted.
+func countUpdates(updates map[string]time.Time) int {
+	count := len(updates)
+	if _, ok := updates[overflowLabel]; ok {
+		count--
+	}
+	return count
+}
+
+// countScopes counts the tracked scopes, the overflow ones excepted.
+func countScopes() int {
+	count := 0
+	for scope := range trackedUpdates {
+		if scope.runtime != overflowLabel || scope.branch != overflowLabel {
+			count++
+		}
+	}
+	return count
+}
+
+// deleteStaleScopes forgets the scopes none of the updates of were seen within the users window.
+func deleteStaleScopes(staleBefore time.Time) {
+	for scope, updates := range trackedUpdates {
+		stale := true
+		for _, lastSeen := range updates {
+			if !lastSeen.Before(staleBefore) {
+				stale = false
+				break
+			}
+		}
+		if stale {
+			for trackedUpdate := range updates {
+				deleteUpdateSeries(scope, trackedUpdate)
+			}
+			delete(trackedUpdates, scope)
+		}
+	}
+}
+
+func deleteUpdateSeries(scope seriesScope, update string) {
+	labels := prometheus.Labels{"platform": scope.platform, "runtime": scope.runtime, "branch": scope.branch, "update": update}
+	activeUsersVec.DeletePartialMatch(labels)
+	updateDownloadsVec.DeletePartialMatch(labels)
+	updateErrorUsersVec.DeletePartialMatch(labels)
+	updateErrorRateVec.DeletePartialMatch(labels)
+}
+
+func resetTrackedUpdates() {
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	trackedUpdates = map[seriesScope]map[string]time.Time{}
+}
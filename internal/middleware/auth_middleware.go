@@ -4,7 +4,7 @@ import (
 	"expo-open-ota/internal/auth"
 	"expo-open-ota/internal/helpers"
 	"expo-open-ota/internal/services"
-	"fmt"
+	"log/slog"
 	"net/http"
 )
 
@@ -13,14 +13,13 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		useExpoAuth := r.Header.Get("Use-Expo-Auth")
 		if useExpoAuth == "true" {
 			expoAuth := helpers.GetExpoAuth(r)
-			fmt.Println(expoAuth)
-			_, err := services.ValidateExpoAuth(expoAuth)
+			expoAccount, err := services.ValidateExpoAuth(r.Context(), expoAuth)
 			if err != nil {
-				fmt.Println("lel", err)
+				slog.WarnContext(r.Context(), "Invalid Expo auth", "error", err)
 				http.Error(w, "Invalid Expo auth", http.StatusUnauthorized)
 				return
 			}
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), auth.Identity{Name: expoAccount.Username})))
 			return
 		}
 		bearerToken, err := helpers.GetBearerToken(r)
@@ -34,12 +33,12 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		authService := auth.NewAuth()
-		_, err = authService.ValidateToken(bearerToken)
+		token, err := authService.ValidateToken(bearerToken)
 		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), auth.IdentityFromToken(token))))
 
 	})
 }
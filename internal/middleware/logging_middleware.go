@@ -1,11 +1,15 @@
 package middleware
 
 import (
-	"log"
+	"expo-open-ota/internal/logging"
+	"expo-open-ota/internal/tracing"
+	"log/slog"
 	"net/http"
 	"runtime/debug"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 func redactHeaders(headers http.Header) http.Header {
@@ -20,30 +24,42 @@ func redactHeaders(headers http.Header) http.Header {
 	return redactedHeaders
 }
 
+// LoggingMiddleware creates the request ID, the trace ID when the request is traced, and attaches it
+// to the request context so every log line written while serving the request carries it.
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		requestID := tracing.TraceID(r.Context())
+		if requestID == "" {
+			requestID = uuid.New().String()
+		}
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		r = r.WithContext(ctx)
+		w.Header().Set(logging.RequestIDHeader, requestID)
+
 		safeHeaders := redactHeaders(r.Header)
 
-		log.Printf("Started %s %s with query: %s and headers: %v", r.Method, r.RequestURI, r.URL.RawQuery, safeHeaders)
+		slog.InfoContext(ctx, "Request started", "method", r.Method, "uri", r.RequestURI)
+		slog.DebugContext(ctx, "Request details", "query", r.URL.RawQuery, "headers", safeHeaders)
 
 		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
 
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("Panic recovered during %s %s\nQuery: %s\nHeaders: %v\nError: %v\nStack Trace:\n%s",
-					r.Method, r.RequestURI, r.URL.RawQuery, safeHeaders, err, debug.Stack())
+				slog.ErrorContext(ctx, "Panic recovered", "method", r.Method, "uri", r.RequestURI, "query", r.URL.RawQuery,
+					"headers", safeHeaders, "error", err, "stack", string(debug.Stack()))
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
 		}()
 
 		next.ServeHTTP(recorder, r)
 
+		level := slog.LevelInfo
 		if recorder.statusCode >= 500 {
-			log.Printf("Error detected: %s %s returned status %d", r.Method, r.RequestURI, recorder.statusCode)
+			level = slog.LevelError
 		}
-		log.Printf("Completed %s %d in %v", r.RequestURI, recorder.statusCode, time.Since(start))
+		slog.Log(ctx, level, "Request completed", "method", r.Method, "uri", r.RequestURI, "status", recorder.statusCode, "duration", time.Since(start))
 	})
 }
 
@@ -1,15 +1,20 @@
 package migration
 
 import (
+	"context"
 	"expo-open-ota/internal/bucket"
 	"expo-open-ota/internal/cache"
 	"fmt"
 	"log"
+	"log/slog"
+
+	"github.com/google/uuid"
 )
 
 func RunMigrations(b bucket.Bucket) error {
+	ctx := context.Background()
 	all := All()
-	applied, err := b.RetrieveMigrationHistory()
+	applied, err := b.RetrieveMigrationHistory(ctx)
 	if err != nil {
 		return fmt.Errorf("read history: %w", err)
 	}
@@ -21,11 +26,11 @@ func RunMigrations(b bucket.Bucket) error {
 		if appliedSet[m.ID()] {
 			continue
 		}
-		fmt.Printf("🔼 Applying migration: %s\n", m.ID())
+		slog.Info("Applying migration", "migration", m.ID())
 		if err := m.Up(b); err != nil {
 			return fmt.Errorf("migration %s failed: %w", m.ID(), err)
 		}
-		if err := b.ApplyMigration(m.ID()); err != nil {
+		if err := b.ApplyMigration(ctx, m.ID()); err != nil {
 			return fmt.Errorf("record migration %s: %w", m.ID(), err)
 		}
 	}
@@ -33,12 +38,13 @@ func RunMigrations(b bucket.Bucket) error {
 }
 
 func RollbackLastMigration(b bucket.Bucket) error {
-	ag, err := b.RetrieveMigrationHistory()
+	ctx := context.Background()
+	ag, err := b.RetrieveMigrationHistory(ctx)
 	if err != nil {
 		return fmt.Errorf("read history: %w", err)
 	}
 	if len(ag) == 0 {
-		fmt.Println("No migration to rollback.")
+		slog.Info("No migration to rollback")
 		return nil
 	}
 	last := ag[len(ag)-1]
@@ -52,28 +58,28 @@ func RollbackLastMigration(b bucket.Bucket) error {
 	if target == nil {
 		return fmt.Errorf("migration %s not found", last)
 	}
-	fmt.Printf("🔽 Rolling back: %s\n", last)
+	slog.Info("Rolling back migration", "migration", last)
 	if err := target.Down(b); err != nil {
 		return fmt.Errorf("rollback %s failed: %w", last, err)
 	}
-	return b.RemoveMigrationFromHistory(last)
+	return b.RemoveMigrationFromHistory(ctx, last)
 }
 
 func RunMigrationsWithLock() {
-	log.Println("🔧 Checking if migrations should run...")
+	slog.Info("Checking if migrations should run")
 	b := bucket.GetBucket()
 	c := cache.GetCache()
-	ok, err := c.TryLock("migration-lock", 120)
+	ok, err := c.TryLock(context.Background(), "migration-lock", uuid.NewString(), 120)
 	if err != nil {
 		log.Fatalf("❌ Failed to acquire migration lock: %v", err)
 	}
 	if !ok {
-		log.Println("⏩ Migration already in progress or completed on another instance – skipping.")
+		slog.Info("Migration already in progress or completed on another instance, skipping")
 		return
 	}
-	log.Println("✅ Migration lock acquired – starting migrations...")
+	slog.Info("Migration lock acquired, starting migrations")
 	if err := RunMigrations(b); err != nil {
 		log.Fatalf("🚨 Migration failed: %v", err)
 	}
-	log.Println("🎉 Migrations completed successfully.")
+	slog.Info("Migrations completed successfully")
 }
@@ -1,6 +1,7 @@
 package _0250417_persist_uuid
 
 import (
+	"context"
 	"encoding/json"
 	"expo-open-ota/internal/bucket"
 	"expo-open-ota/internal/crypto"
@@ -8,6 +9,7 @@ import (
 	"expo-open-ota/internal/types"
 	update2 "expo-open-ota/internal/update"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 )
@@ -17,7 +19,8 @@ func init() {
 		Id:   "20250417_persist_uuid",
 		Time: time.Date(2025, 4, 17, 0, 0, 0, 0, time.UTC),
 		UpFunc: func(b bucket.Bucket) error {
-			branches, err := b.GetBranches()
+			ctx := context.Background()
+			branches, err := b.GetBranches(ctx)
 			if err != nil {
 				return err
 			}
@@ -25,25 +28,25 @@ func init() {
 				return nil
 			}
 			for _, branch := range branches {
-				runtimeVersions, err := b.GetRuntimeVersions(branch)
+				runtimeVersions, err := b.GetRuntimeVersions(ctx, branch)
 				if err != nil {
 					continue
 				}
 				for _, runtimeVersion := range runtimeVersions {
-					updates, err := b.GetUpdates(branch, runtimeVersion.RuntimeVersion)
+					updates, err := b.GetUpdates(ctx, branch, runtimeVersion.RuntimeVersion)
 					if err != nil {
 						continue
 					}
 					for _, update := range updates {
-						fmt.Println("Processing update:", update.UpdateId)
-						storedMetadata, err := update2.RetrieveUpdateStoredMetadata(update)
+						slog.Info("Processing update", "updateId", update.UpdateId)
+						storedMetadata, err := update2.RetrieveUpdateStoredMetadata(ctx, update)
 						if storedMetadata == nil {
-							fmt.Println("Update UUID already exists, skipping:", update.UpdateId)
+							slog.Info("Update UUID already exists, skipping", "updateId", update.UpdateId)
 							continue
 						}
 						var metadata types.UpdateMetadata
 						var metadataJson types.MetadataObject
-						file, _ := b.GetFile(update, "metadata.json")
+						file, _ := b.GetFile(ctx, update, "metadata.json")
 						if file == nil {
 							return fmt.Errorf("metadata.json file not found for update: %s", update.UpdateId)
 						}
@@ -66,26 +69,26 @@ func init() {
 						if updateUUID == "" {
 							return fmt.Errorf("error converting hash to UUID")
 						}
-						updateMetadataFile, _ := b.GetFile(update, "update-metadata.json")
+						updateMetadataFile, _ := b.GetFile(ctx, update, "update-metadata.json")
 						defer file.Reader.Close()
 						storedMetadata = &types.UpdateStoredMetadata{}
 						if updateMetadataFile != nil {
 							err = json.NewDecoder(updateMetadataFile.Reader).Decode(&storedMetadata)
 							if err != nil {
-								fmt.Println("error decoding update-metadata.json:", err)
+								slog.Error("Error decoding update-metadata.json", "updateId", update.UpdateId, "error", err)
 								return err
 							}
 						}
 						storedMetadata.UpdateUUID = updateUUID
 						updatedMetadata, err := json.Marshal(storedMetadata)
 						if err != nil {
-							fmt.Println("error marshaling update-metadata.json:", err)
+							slog.Error("Error marshaling update-metadata.json", "updateId", update.UpdateId, "error", err)
 							return err
 						}
 						reader := strings.NewReader(string(updatedMetadata))
-						err = b.UploadFileIntoUpdate(update, "update-metadata.json", reader)
+						err = b.UploadFileIntoUpdate(ctx, update, "update-metadata.json", reader)
 						if err != nil {
-							fmt.Println("error uploading update-metadata.json:", err)
+							slog.Error("Error uploading update-metadata.json", "updateId", update.UpdateId, "error", err)
 							return err
 						}
 					}
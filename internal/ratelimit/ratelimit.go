@@ -0,0 +1,191 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/cache"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RouteClass groups endpoints sharing the same limit.
+type RouteClass string
+
+const (
+	Manifest RouteClass = "manifest"
+	Assets   RouteClass = "assets"
+	Login    RouteClass = "login"
+	Upload   RouteClass = "upload"
+	Api      RouteClass = "api"
+)
+
+// KeyStrategy defines who a limit applies to.
+type KeyStrategy string
+
+const (
+	ByIP       KeyStrategy = "ip"
+	ByClientID KeyStrategy = "client"
+	BySubject  KeyStrategy = "subject"
+)
+
+type Policy struct {
+	Limit  int64
+	Window time.Duration
+	Key    KeyStrategy
+}
+
+var defaultPolicies = map[RouteClass]string{
+	Login: "10/1m",
+}
+
+var defaultKeyStrategies = map[RouteClass]KeyStrategy{
+	Manifest: ByClientID,
+	Assets:   ByClientID,
+	Login:    ByIP,
+	Upload:   BySubject,
+	Api:      BySubject,
+}
+
+func envPrefix(class RouteClass) string {
+	return "RATE_LIMIT_" + strings.ToUpper(string(class))
+}
+
+// ParsePolicy parses a "<limit>/<window>" definition such as "100/1m" or "5/s".
+func ParsePolicy(definition string) (int64, time.Duration, error) {
+	parts := strings.SplitN(strings.TrimSpace(definition), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid rate limit %q, expected <limit>/<window>", definition)
+	}
+	limit, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit %q, limit must be a positive integer", definition)
+	}
+	windowDefinition := strings.TrimSpace(parts[1])
+	window, err := time.ParseDuration(windowDefinition)
+	if err != nil {
+		window, err = time.ParseDuration("1" + windowDefinition)
+	}
+	if err != nil || window < time.Second {
+		return 0, 0, fmt.Errorf("invalid rate limit %q, window must be a duration of at least 1s", definition)
+	}
+	return limit, window, nil
+}
+
+// GetPolicy returns the policy configured for the route class, or nil when the class is not limited.
+func GetPolicy(class RouteClass) *Policy {
+	definition := config.GetEnv(envPrefix(class))
+	if definition == "" {
+		definition = defaultPolicies[class]
+	}
+	if definition == "" || definition == "off" {
+		return nil
+	}
+	limit, window, err := ParsePolicy(definition)
+	if err != nil {
+		slog.Warn("Ignoring invalid rate limit", "class", class, "error", err)
+		return nil
+	}
+	key := defaultKeyStrategies[class]
+	switch strategy := KeyStrategy(config.GetEnv(envPrefix(class) + "_KEY")); strategy {
+	case ByIP, ByClientID, BySubject:
+		key = strategy
+	case "":
+	default:
+		slog.Warn("Ignoring invalid rate limit key", "class", class, "key", strategy)
+	}
+	return &Policy{Limit: limit, Window: window, Key: key}
+}
+
+func clientIP(r *http.Request) string {
+	if config.GetEnv("RATE_LIMIT_TRUST_PROXY_HEADERS") == "true" {
+		if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+			return strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+		}
+		if realIP := r.Header.Get("X-Real-Ip"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// subject identifies the caller by its credentials without keeping them in the cache.
+func subject(r *http.Request) string {
+	credentials := r.Header.Get("Authorization")
+	if credentials == "" {
+		credentials = r.Header.Get("expo-session")
+	}
+	if credentials == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(credentials))
+	return hex.EncodeToString(hash[:16])
+}
+
+func resolveKey(r *http.Request, strategy KeyStrategy) string {
+	switch strategy {
+	case ByClientID:
+		if clientId := r.Header.Get("EAS-Client-ID"); clientId != "" {
+			return "client:" + clientId
+		}
+	case BySubject:
+		if sub := subject(r); sub != "" {
+			return "subject:" + sub
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+func computeCacheKey(class RouteClass, key string, windowStart int64) string {
+	return fmt.Sprintf("ratelimit:%s:%s:%d", class, key, windowStart)
+}
+
+// Middleware enforces the limit configured for the route class with a fixed window counter kept in
+// the shared cache, so every instance sees the same counts when Redis is used.
+func Middleware(class RouteClass) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy := GetPolicy(class)
+			if policy == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			now := time.Now()
+			windowSeconds := int64(policy.Window / time.Second)
+			windowStart := now.Unix() - now.Unix()%windowSeconds
+			ttl := int(windowSeconds)
+			count, err := cache.GetCache().Incr(r.Context(), computeCacheKey(class, resolveKey(r, policy.Key), windowStart), &ttl)
+			if err != nil {
+				slog.WarnContext(r.Context(), "Rate limit unavailable, request allowed", "class", class, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			reset := int64(math.Ceil(time.Unix(windowStart+windowSeconds, 0).Sub(now).Seconds()))
+			remaining := policy.Limit - count
+			if remaining < 0 {
+				remaining = 0
+			}
+			w.Header().Set("RateLimit-Limit", strconv.FormatInt(policy.Limit, 10))
+			w.Header().Set("RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+			w.Header().Set("RateLimit-Reset", strconv.FormatInt(reset, 10))
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, windowSeconds))
+			if count > policy.Limit {
+				slog.WarnContext(r.Context(), "Rate limit exceeded", "class", class, "key", policy.Key)
+				w.Header().Set("Retry-After", strconv.FormatInt(reset, 10))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
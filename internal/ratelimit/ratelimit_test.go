@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	cache2 "expo-open-ota/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	testing2 "testing"
+	"time"
+)
+
+func setup(t *testing2.T) func() {
+	_ = cache2.GetCache().Clear(context.Background())
+	return func() {
+		os.Unsetenv("RATE_LIMIT_MANIFEST")
+		os.Unsetenv("RATE_LIMIT_MANIFEST_KEY")
+		os.Unsetenv("RATE_LIMIT_LOGIN")
+		os.Unsetenv("RATE_LIMIT_TRUST_PROXY_HEADERS")
+	}
+}
+
+func serve(handler http.Handler, configure func(r *http.Request)) *httptest.ResponseRecorder {
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/manifest", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	if configure != nil {
+		configure(req)
+	}
+	handler.ServeHTTP(respRec, req)
+	return respRec
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestParsePolicy(t *testing2.T) {
+	limit, window, err := ParsePolicy("100/1m")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), limit)
+	assert.Equal(t, time.Minute, window)
+
+	limit, window, err = ParsePolicy("5/s")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), limit)
+	assert.Equal(t, time.Second, window)
+
+	for _, definition := range []string{"100", "0/1m", "abc/1m", "10/100ms", "10/forever"} {
+		_, _, err = ParsePolicy(definition)
+		assert.NotNil(t, err, definition)
+	}
+}
+
+func TestDefaultPolicies(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	assert.Nil(t, GetPolicy(Manifest))
+	policy := GetPolicy(Login)
+	assert.NotNil(t, policy)
+	assert.Equal(t, ByIP, policy.Key)
+	os.Setenv("RATE_LIMIT_LOGIN", "off")
+	assert.Nil(t, GetPolicy(Login))
+}
+
+func TestLimitExceeded(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("RATE_LIMIT_MANIFEST", "2/1h")
+	handler := Middleware(Manifest)(okHandler)
+
+	first := serve(handler, nil)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "2", first.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", first.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=3600", first.Header().Get("RateLimit-Policy"))
+	reset, err := strconv.Atoi(first.Header().Get("RateLimit-Reset"))
+	assert.Nil(t, err)
+	assert.True(t, reset > 0 && reset <= 3600)
+
+	assert.Equal(t, http.StatusOK, serve(handler, nil).Code)
+
+	limited := serve(handler, nil)
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "0", limited.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, limited.Header().Get("RateLimit-Reset"), limited.Header().Get("Retry-After"))
+}
+
+func TestLimitKeyedByClientId(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("RATE_LIMIT_MANIFEST", "1/1h")
+	handler := Middleware(Manifest)(okHandler)
+	withClient := func(clientId string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("EAS-Client-ID", clientId)
+		}
+	}
+	assert.Equal(t, http.StatusOK, serve(handler, withClient("client-1")).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(handler, withClient("client-1")).Code)
+	assert.Equal(t, http.StatusOK, serve(handler, withClient("client-2")).Code)
+}
+
+func TestLimitKeyedBySubject(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("RATE_LIMIT_MANIFEST", "1/1h")
+	os.Setenv("RATE_LIMIT_MANIFEST_KEY", "subject")
+	handler := Middleware(Manifest)(okHandler)
+	withToken := func(token string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	assert.Equal(t, http.StatusOK, serve(handler, withToken("token-1")).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(handler, withToken("token-1")).Code)
+	assert.Equal(t, http.StatusOK, serve(handler, withToken("token-2")).Code)
+}
+
+func TestForwardedForOnlyTrustedWhenEnabled(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("RATE_LIMIT_MANIFEST", "1/1h")
+	os.Setenv("RATE_LIMIT_MANIFEST_KEY", "ip")
+	handler := Middleware(Manifest)(okHandler)
+	forwardedFor := func(ip string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("X-Forwarded-For", ip+", 10.0.0.254")
+		}
+	}
+	assert.Equal(t, http.StatusOK, serve(handler, forwardedFor("1.1.1.1")).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(handler, forwardedFor("2.2.2.2")).Code)
+
+	os.Setenv("RATE_LIMIT_TRUST_PROXY_HEADERS", "true")
+	assert.Equal(t, http.StatusOK, serve(handler, forwardedFor("3.3.3.3")).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(handler, forwardedFor("3.3.3.3")).Code)
+}
@@ -6,9 +6,12 @@ import (
 	"expo-open-ota/internal/handlers"
 	"expo-open-ota/internal/metrics"
 	"expo-open-ota/internal/middleware"
+	"expo-open-ota/internal/ratelimit"
+	"expo-open-ota/internal/tracing"
 	"fmt"
 	"github.com/gorilla/mux"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -33,8 +36,13 @@ func getDashboardPath() string {
 	return filepath.Join(exeDir, "apps", "dashboard", "dist")
 }
 
+func limited(class ratelimit.RouteClass, handler http.HandlerFunc) http.Handler {
+	return ratelimit.Middleware(class)(handler)
+}
+
 func NewRouter() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(tracing.Middleware)
 	r.Use(middleware.LoggingMiddleware)
 
 	r.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
@@ -42,16 +50,20 @@ func NewRouter() *mux.Router {
 	}).Methods(http.MethodGet)
 
 	r.HandleFunc("/hc", HealthCheck).Methods(http.MethodGet)
-	r.HandleFunc("/manifest", handlers.ManifestHandler).Methods(http.MethodGet)
-	r.HandleFunc("/assets", handlers.AssetsHandler).Methods(http.MethodGet)
-	r.HandleFunc("/requestUploadUrl/{BRANCH}", handlers.RequestUploadUrlHandler).Methods(http.MethodPost)
-	r.HandleFunc("/uploadLocalFile", handlers.RequestUploadLocalFileHandler).Methods(http.MethodPut)
-	r.HandleFunc("/markUpdateAsUploaded/{BRANCH}", handlers.MarkUpdateAsUploadedHandler).Methods(http.MethodPost)
-	r.HandleFunc("/rollback/{BRANCH}", handlers.RollbackHandler).Methods(http.MethodPost)
-	r.HandleFunc("/republish/{BRANCH}", handlers.RepublishHandler).Methods(http.MethodPost)
+	r.HandleFunc("/livez", handlers.LivenessHandler).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", handlers.ReadinessHandler).Methods(http.MethodGet)
+	r.Handle("/manifest", limited(ratelimit.Manifest, handlers.ManifestHandler)).Methods(http.MethodGet)
+	r.Handle("/assets", limited(ratelimit.Assets, handlers.AssetsHandler)).Methods(http.MethodGet)
+	r.Handle("/requestUploadUrl/{BRANCH}", limited(ratelimit.Upload, handlers.RequestUploadUrlHandler)).Methods(http.MethodPost)
+	r.Handle("/requestUploadGroup/{BRANCH}", limited(ratelimit.Upload, handlers.RequestUploadGroupHandler)).Methods(http.MethodPost)
+	r.Handle("/uploadLocalFile", limited(ratelimit.Upload, handlers.RequestUploadLocalFileHandler)).Methods(http.MethodPut)
+	r.Handle("/markUpdateAsUploaded/{BRANCH}", limited(ratelimit.Upload, handlers.MarkUpdateAsUploadedHandler)).Methods(http.MethodPost)
+	r.Handle("/rollback/{BRANCH}", limited(ratelimit.Upload, handlers.RollbackHandler)).Methods(http.MethodPost)
+	r.Handle("/republish/{BRANCH}", limited(ratelimit.Upload, handlers.RepublishHandler)).Methods(http.MethodPost)
+	r.Handle("/promote/{BRANCH}", limited(ratelimit.Upload, handlers.PromoteHandler)).Methods(http.MethodPost)
 
 	corsSubrouter := r.PathPrefix("/auth").Subrouter()
-	corsSubrouter.HandleFunc("/login", handlers.LoginHandler).Methods(http.MethodPost)
+	corsSubrouter.Handle("/login", limited(ratelimit.Login, handlers.LoginHandler)).Methods(http.MethodPost)
 	corsSubrouter.HandleFunc("/refreshToken", handlers.RefreshTokenHandler).Methods(http.MethodPost)
 
 	dashboardPath := getDashboardPath()
@@ -80,25 +92,39 @@ func NewRouter() *mux.Router {
 			for _, ext := range staticExtensions {
 				if len(r.URL.Path) > len(ext) && r.URL.Path[len(r.URL.Path)-len(ext):] == ext {
 					filePath := filepath.Join(dashboardPath, r.URL.Path[len("/dashboard/"):])
-					fmt.Println("Serving file", filePath)
+					slog.DebugContext(r.Context(), "Serving file", "path", filePath)
 					http.ServeFile(w, r, filePath)
 					return
 				}
 			}
 			filePath := filepath.Join(dashboardPath, "index.html")
-			fmt.Println("Serving file", filePath)
+			slog.DebugContext(r.Context(), "Serving file", "path", filePath)
 			http.ServeFile(w, r, filePath)
 		}))
 	}
 
 	authSubrouter := r.PathPrefix("/api").Subrouter()
+	authSubrouter.Use(ratelimit.Middleware(ratelimit.Api))
 	authSubrouter.Use(middleware.AuthMiddleware)
 	authSubrouter.HandleFunc("/settings", handlers.GetSettingsHandler).Methods(http.MethodGet)
 	authSubrouter.HandleFunc("/branches", handlers.GetBranchesHandler).Methods(http.MethodGet)
 	authSubrouter.HandleFunc("/channels", handlers.GetChannelsHandler).Methods(http.MethodGet)
 	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersions", handlers.GetRuntimeVersionsHandler).Methods(http.MethodGet)
 	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates", handlers.GetUpdatesHandler).Methods(http.MethodGet)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/adoption", handlers.GetAdoptionHandler).Methods(http.MethodGet)
 	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates/{UPDATE_ID}", handlers.GetUpdateDetails).Methods(http.MethodGet)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates/{UPDATE_ID}/errors", handlers.GetUpdateErrorsHandler).Methods(http.MethodGet)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates/{UPDATE_ID}/symbolicate", handlers.SymbolicateHandler).Methods(http.MethodPost)
 	authSubrouter.HandleFunc("/branch/{BRANCH}/updateChannelBranchMapping", handlers.UpdateChannelBranchMappingHandler).Methods(http.MethodPost)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/targetingRules", handlers.GetBranchTargetingRulesHandler).Methods(http.MethodGet)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/targetingRules", handlers.SetBranchTargetingRulesHandler).Methods(http.MethodPut)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates/{UPDATE_ID}/targetingRules", handlers.GetUpdateTargetingRulesHandler).Methods(http.MethodGet)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates/{UPDATE_ID}/targetingRules", handlers.SetUpdateTargetingRulesHandler).Methods(http.MethodPut)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/protection", handlers.GetBranchProtectionHandler).Methods(http.MethodGet)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/protection", handlers.SetBranchProtectionHandler).Methods(http.MethodPut)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates/{UPDATE_ID}/approve", handlers.ApproveUpdateHandler).Methods(http.MethodPost)
+	authSubrouter.HandleFunc("/branch/{BRANCH}/runtimeVersion/{RUNTIME_VERSION}/updates/{UPDATE_ID}/reject", handlers.RejectUpdateHandler).Methods(http.MethodPost)
+	authSubrouter.HandleFunc("/webhooks/failedDeliveries", handlers.GetWebhookFailedDeliveriesHandler).Methods(http.MethodGet)
+	authSubrouter.HandleFunc("/auditLog", handlers.GetAuditLogHandler).Methods(http.MethodGet)
 	return r
 }
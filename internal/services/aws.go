@@ -5,6 +5,7 @@ import (
 	"expo-open-ota/config"
 	"fmt"
 	"log"
+	"log/slog"
 	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -70,19 +71,20 @@ func GetS3Client() (*s3.Client, error) {
 	return s3Client, nil
 }
 
-func FetchSecret(secretName string) string {
-	cfg, err := awsconfig.LoadDefaultConfig(context.TODO())
+func FetchSecret(ctx context.Context, secretName string) string {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
 	if err != nil {
 		log.Fatalf("Failed to load AWS configuration: %v", err)
 	}
 
 	client := secretsmanager.NewFromConfig(cfg)
 
-	resp, err := client.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
+	resp, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
 		SecretId: aws.String(secretName),
 	})
 	if err != nil {
-		log.Fatalf("Failed to retrieve secret %s: %v", secretName, err)
+		slog.ErrorContext(ctx, "Failed to retrieve secret", "secret", secretName, "error", err)
+		return ""
 	}
 
 	if resp.SecretString == nil {
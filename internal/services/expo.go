@@ -6,10 +6,17 @@ import (
 	"encoding/json"
 	"errors"
 	"expo-open-ota/config"
+	"expo-open-ota/internal/tracing"
 	"expo-open-ota/internal/types"
-	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type ExpoUserAccount struct {
@@ -21,6 +28,21 @@ type ExpoUserAccount struct {
 type ExpoChannelMapping struct {
 	Id         string `json:"id"`
 	BranchName string `json:"branchName"`
+	// Rollouts serve a share of the clients another branch than BranchName, in mapping order.
+	Rollouts []ExpoBranchRollout `json:"rollouts,omitempty"`
+}
+
+type ExpoBranchRollout struct {
+	BranchName string `json:"branchName"`
+	// Percentage is the share of clients served the branch, between 0 and 1.
+	Percentage float64 `json:"percentage"`
+}
+
+// rolloutMappingLogic is the branch mapping logic EAS writes for a branch rollout.
+type rolloutMappingLogic struct {
+	Operand               float64 `json:"operand"`
+	ClientKey             string  `json:"clientKey"`
+	BranchMappingOperator string  `json:"branchMappingOperator"`
 }
 
 type ExpoBranchMapping struct {
@@ -43,11 +65,11 @@ type BranchMapping struct {
 	} `json:"data"`
 }
 
-func ValidateExpoAuth(expoAuth types.ExpoAuth) (*ExpoUserAccount, error) {
+func ValidateExpoAuth(ctx context.Context, expoAuth types.ExpoAuth) (*ExpoUserAccount, error) {
 	if expoAuth.Token == nil && expoAuth.SessionSecret == nil {
 		return nil, errors.New("no valid Expo auth provided")
 	}
-	expoAccount, err := FetchExpoUserAccountInformations(expoAuth)
+	expoAccount, err := FetchExpoUserAccountInformations(ctx, expoAuth)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +96,26 @@ func SetAuthHeaders(expoAuth types.ExpoAuth, req *http.Request) {
 	}
 }
 
-func makeGraphQLRequest(ctx context.Context, query string, variables map[string]interface{}, expoAuth types.ExpoAuth, result interface{}, headers map[string]string) error {
+const defaultExpoApiTimeout = 15 * time.Second
+
+var (
+	httpClient     *http.Client
+	httpClientOnce sync.Once
+)
+
+// getHTTPClient returns the client shared by all Expo API calls. Its timeout caps requests
+// whose context carries no earlier deadline.
+func getHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		httpClient = &http.Client{Timeout: config.GetDurationEnv("EXPO_API_TIMEOUT_MS", defaultExpoApiTimeout)}
+	})
+	return httpClient
+}
+
+func makeGraphQLRequest(ctx context.Context, query string, variables map[string]interface{}, expoAuth types.ExpoAuth, result interface{}, headers map[string]string) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "expo.graphql", attribute.String("server.address", "api.expo.dev"))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	requestBody := map[string]interface{}{
 		"query":     query,
 		"variables": variables,
@@ -95,13 +136,14 @@ func makeGraphQLRequest(ctx context.Context, query string, variables map[string]
 	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := getHTTPClient().Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	if resp.StatusCode != http.StatusOK {
 		// Read error message in response body
@@ -115,7 +157,7 @@ func makeGraphQLRequest(ctx context.Context, query string, variables map[string]
 	return json.NewDecoder(resp.Body).Decode(result)
 }
 
-func FetchExpoChannels() ([]ExpoChannel, error) {
+func FetchExpoChannels(ctx context.Context) ([]ExpoChannel, error) {
 	query := `
 		query FetchAppChannel($appId: String!) {
 			app {
@@ -147,7 +189,6 @@ func FetchExpoChannels() ([]ExpoChannel, error) {
 	if config.IsTestMode() {
 		headers["operationName"] = "FetchExpoChannels"
 	}
-	ctx := context.Background()
 	if err := makeGraphQLRequest(ctx, query, variables, types.ExpoAuth{
 		Token: &expoToken,
 	}, &resp, headers); err != nil {
@@ -156,8 +197,8 @@ func FetchExpoChannels() ([]ExpoChannel, error) {
 	return resp.Data.App.ById.UpdateChannels, nil
 }
 
-func UpdateChannelBranchMapping(channelName, branchId string) error {
-	fmt.Println("Updating channel branch mapping for channel:", channelName, "to branch:", branchId)
+func UpdateChannelBranchMapping(ctx context.Context, channelName, branchId string) error {
+	slog.InfoContext(ctx, "Updating channel branch mapping", "channel", channelName, "branchId", branchId)
 	query := `
 		mutation UpdateChannelBranchMapping($channelId: ID!, $branchMapping: String!) {
 			updateChannel {
@@ -195,14 +236,13 @@ func UpdateChannelBranchMapping(channelName, branchId string) error {
 	if config.IsTestMode() {
 		headers["operationName"] = "UpdateChannelBranchMapping"
 	}
-	ctx := context.Background()
 	resp := struct{}{}
 	return makeGraphQLRequest(ctx, query, variables, types.ExpoAuth{
 		Token: &token,
 	}, &resp, headers)
 }
 
-func FetchExpoBranches() ([]string, error) {
+func FetchExpoBranches(ctx context.Context) ([]string, error) {
 	query := `
 		query FetchAppChannel($appId: String!) {
 			app {
@@ -237,7 +277,6 @@ func FetchExpoBranches() ([]string, error) {
 	if config.IsTestMode() {
 		headers["operationName"] = "FetchExpoBranches"
 	}
-	ctx := context.Background()
 	if err := makeGraphQLRequest(ctx, query, variables, types.ExpoAuth{
 		Token: &expoToken,
 	}, &resp, headers); err != nil {
@@ -250,7 +289,7 @@ func FetchExpoBranches() ([]string, error) {
 	return branches, nil
 }
 
-func FetchExpoUserAccountInformations(expoAuth types.ExpoAuth) (*ExpoUserAccount, error) {
+func FetchExpoUserAccountInformations(ctx context.Context, expoAuth types.ExpoAuth) (*ExpoUserAccount, error) {
 	query := `
 		query GetCurrentUserAccount {
 			me {
@@ -272,7 +311,6 @@ func FetchExpoUserAccountInformations(expoAuth types.ExpoAuth) (*ExpoUserAccount
 		headers["operationName"] = "FetchExpoUserAccountInformations"
 	}
 
-	ctx := context.Background()
 	if err := makeGraphQLRequest(ctx, query, nil, expoAuth, &resp, headers); err != nil {
 		return nil, err
 	}
@@ -280,9 +318,9 @@ func FetchExpoUserAccountInformations(expoAuth types.ExpoAuth) (*ExpoUserAccount
 	return &resp.Data.Me, nil
 }
 
-func FetchSelfExpoUsername() string {
+func FetchSelfExpoUsername(ctx context.Context) string {
 	token := GetExpoAccessToken()
-	expoAccount, err := FetchExpoUserAccountInformations(types.ExpoAuth{
+	expoAccount, err := FetchExpoUserAccountInformations(ctx, types.ExpoAuth{
 		Token: &token,
 	})
 	if err != nil {
@@ -291,7 +329,7 @@ func FetchSelfExpoUsername() string {
 	return expoAccount.Username
 }
 
-func FetchExpoChannelMapping(channelName string) (*ExpoChannelMapping, error) {
+func FetchExpoChannelMapping(ctx context.Context, channelName string) (*ExpoChannelMapping, error) {
 	query := `
 		query FetchAppChannel($appId: String!, $channelName: String!) {
 			app {
@@ -339,7 +377,6 @@ func FetchExpoChannelMapping(channelName string) (*ExpoChannelMapping, error) {
 	if config.IsTestMode() {
 		headers["operationName"] = "FetchExpoChannelMapping"
 	}
-	ctx := context.Background()
 	if err := makeGraphQLRequest(ctx, query, variables, types.ExpoAuth{Token: &expoToken}, &resp, headers); err != nil {
 		return nil, err
 	}
@@ -349,25 +386,31 @@ func FetchExpoChannelMapping(channelName string) (*ExpoChannelMapping, error) {
 		return nil, err
 	}
 
+	branchNames := make(map[string]string, len(resp.Data.App.ById.UpdateBranches))
+	for _, branch := range resp.Data.App.ById.UpdateBranches {
+		branchNames[branch.ID] = branch.Name
+	}
+
 	var branchID string
+	var rollouts []ExpoBranchRollout
 	for _, mapping := range branchMapping.Data {
 		var logic string
 		if json.Unmarshal(mapping.BranchMappingLogic, &logic) == nil && logic == "true" {
 			branchID = mapping.BranchId
 			break
 		}
+		var rollout rolloutMappingLogic
+		if json.Unmarshal(mapping.BranchMappingLogic, &rollout) == nil && rollout.BranchMappingOperator == "hash_lt" {
+			if name, ok := branchNames[mapping.BranchId]; ok {
+				rollouts = append(rollouts, ExpoBranchRollout{BranchName: name, Percentage: rollout.Operand})
+			}
+		}
 	}
 	if branchID == "" {
 		return nil, nil
 	}
 
-	var branchName string
-	for _, branch := range resp.Data.App.ById.UpdateBranches {
-		if branch.ID == branchID {
-			branchName = branch.Name
-			break
-		}
-	}
+	branchName := branchNames[branchID]
 	if branchName == "" {
 		return nil, nil
 	}
@@ -375,10 +418,11 @@ func FetchExpoChannelMapping(channelName string) (*ExpoChannelMapping, error) {
 	return &ExpoChannelMapping{
 		Id:         resp.Data.App.ById.UpdateChannelByName.ID,
 		BranchName: branchName,
+		Rollouts:   rollouts,
 	}, nil
 }
 
-func FetchExpoBranchesMapping() ([]ExpoBranchMapping, error) {
+func FetchExpoBranchesMapping(ctx context.Context) ([]ExpoBranchMapping, error) {
 	query := `
 		query FetchAppChannel($appId: String!) {
 			app {
@@ -425,7 +469,6 @@ func FetchExpoBranchesMapping() ([]ExpoBranchMapping, error) {
 		} `json:"data"`
 	}
 
-	ctx := context.Background()
 	if err := makeGraphQLRequest(ctx, query, variables, types.ExpoAuth{
 		Token: &expoToken,
 	}, &resp, headers); err != nil {
@@ -472,7 +515,7 @@ func FetchExpoBranchesMapping() ([]ExpoBranchMapping, error) {
 	return branchMappings, nil
 }
 
-func CreateBranch(branch string) error {
+func CreateBranch(ctx context.Context, branch string) error {
 	query := `
 		mutation CreateUpdateBranchForAppMutation($appId: ID!, $name: String!) {
 		  updateBranch {
@@ -492,7 +535,6 @@ func CreateBranch(branch string) error {
 	if config.IsTestMode() {
 		headers["operationName"] = "CreateBranch"
 	}
-	ctx := context.Background()
 	resp := struct{}{}
 	return makeGraphQLRequest(ctx, query, variables, types.ExpoAuth{
 		Token: &token,
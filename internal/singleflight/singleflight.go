@@ -0,0 +1,54 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+)
+
+type call[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Group coalesces concurrent calls sharing the same key into a single execution.
+type Group[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*call[T]
+}
+
+// Do runs fn once per key at a time, callers arriving while it runs wait for its result instead of
+// running it again. shared reports whether the result was produced for another caller.
+// fn is detached from the caller's cancellation so one client going away does not fail the others,
+// while each caller still stops waiting as soon as its own context is done.
+func (g *Group[T]) Do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (value T, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+	c, inFlight := g.calls[key]
+	if !inFlight {
+		c = &call[T]{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.run(context.WithoutCancel(ctx), key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, c.err, inFlight
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err(), inFlight
+	}
+}
+
+func (g *Group[T]) run(ctx context.Context, key string, c *call[T], fn func(ctx context.Context) (T, error)) {
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.value, c.err = fn(ctx)
+}
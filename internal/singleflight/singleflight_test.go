@@ -0,0 +1,91 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	testing2 "testing"
+	"time"
+)
+
+func TestConcurrentCallsShareOneExecution(t *testing2.T) {
+	var group Group[string]
+	var executions atomic.Int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		executions.Add(1)
+		<-release
+		return "manifest", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			value, err, _ := group.Do(context.Background(), "key", fn)
+			assert.Nil(t, err)
+			results[index] = value
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), executions.Load())
+	for _, result := range results {
+		assert.Equal(t, "manifest", result)
+	}
+}
+
+func TestDifferentKeysRunIndependently(t *testing2.T) {
+	var group Group[string]
+	a, _, _ := group.Do(context.Background(), "a", func(ctx context.Context) (string, error) { return "a", nil })
+	b, _, _ := group.Do(context.Background(), "b", func(ctx context.Context) (string, error) { return "b", nil })
+	assert.Equal(t, "a", a)
+	assert.Equal(t, "b", b)
+}
+
+func TestErrorsAreShared(t *testing2.T) {
+	var group Group[int]
+	_, err, _ := group.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+		return 0, errors.New("bucket unavailable")
+	})
+	assert.EqualError(t, err, "bucket unavailable")
+
+	value, err, _ := group.Do(context.Background(), "key", func(ctx context.Context) (int, error) { return 1, nil })
+	assert.Nil(t, err)
+	assert.Equal(t, 1, value)
+}
+
+func TestCancelledCallerDoesNotCancelExecution(t *testing2.T) {
+	var group Group[string]
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (string, error) {
+		<-release
+		return "manifest", ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error)
+	go func() {
+		_, err, _ := group.Do(ctx, "key", fn)
+		leaderDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	followerDone := make(chan string)
+	go func() {
+		value, _, shared := group.Do(context.Background(), "key", fn)
+		assert.True(t, shared)
+		followerDone <- value
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	assert.ErrorIs(t, <-leaderDone, context.Canceled)
+	close(release)
+	assert.Equal(t, "manifest", <-followerDone)
+}
@@ -0,0 +1,183 @@
+package symbolication
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// segment maps a generated column to a position in an original source. source is -1 when the
+// generated code has no original position.
+type segment struct {
+	column       int
+	source       int
+	sourceLine   int
+	sourceColumn int
+	name         int
+}
+
+// SourceMap is a decoded version 3 source map.
+type SourceMap struct {
+	sources []string
+	names   []string
+	// lines holds the segments of each generated line, sorted by column.
+	lines [][]segment
+}
+
+// Position is an original position. Line is 1-based and Column 0-based, like in source maps tools.
+type Position struct {
+	Source string `json:"source"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Name   string `json:"name,omitempty"`
+}
+
+type rawSourceMap struct {
+	Version    int               `json:"version"`
+	SourceRoot string            `json:"sourceRoot"`
+	Sources    []string          `json:"sources"`
+	Names      []string          `json:"names"`
+	Mappings   string            `json:"mappings"`
+	Sections   []json.RawMessage `json:"sections"`
+}
+
+// ParseSourceMap decodes a version 3 source map. Index maps, made of sections, are not supported.
+func ParseSourceMap(reader io.Reader) (*SourceMap, error) {
+	var raw rawSourceMap
+	if err := json.NewDecoder(reader).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid source map: %w", err)
+	}
+	if raw.Version != 3 {
+		return nil, fmt.Errorf("unsupported source map version %d", raw.Version)
+	}
+	if len(raw.Sections) > 0 {
+		return nil, errors.New("index source maps are not supported")
+	}
+	sources := make([]string, len(raw.Sources))
+	for i, source := range raw.Sources {
+		if raw.SourceRoot != "" && !path.IsAbs(source) && !strings.Contains(source, "://") {
+			source = strings.TrimSuffix(raw.SourceRoot, "/") + "/" + source
+		}
+		sources[i] = source
+	}
+	lines, err := decodeMappings(raw.Mappings, len(sources), len(raw.Names))
+	if err != nil {
+		return nil, err
+	}
+	return &SourceMap{sources: sources, names: raw.Names, lines: lines}, nil
+}
+
+// decodeVLQ decodes the base64 VLQ value starting at index, returning it with the next index.
+func decodeVLQ(mappings string, index int) (int, int, error) {
+	value, shift := 0, 0
+	for {
+		if index >= len(mappings) {
+			return 0, index, errors.New("invalid source map mappings: truncated value")
+		}
+		digit := strings.IndexByte(base64Chars, mappings[index])
+		if digit < 0 {
+			return 0, index, fmt.Errorf("invalid source map mappings: unexpected %q", mappings[index])
+		}
+		index++
+		value += (digit & 31) << shift
+		if digit&32 == 0 {
+			break
+		}
+		shift += 5
+		if shift > 30 {
+			return 0, index, errors.New("invalid source map mappings: value overflow")
+		}
+	}
+	if value&1 == 1 {
+		return -(value >> 1), index, nil
+	}
+	return value >> 1, index, nil
+}
+
+func decodeMappings(mappings string, sourcesCount int, namesCount int) ([][]segment, error) {
+	lines := [][]segment{nil}
+	source, sourceLine, sourceColumn, name := 0, 0, 0, 0
+	index := 0
+	for index < len(mappings) {
+		switch mappings[index] {
+		case ';':
+			lines = append(lines, nil)
+			index++
+			continue
+		case ',':
+			index++
+			continue
+		}
+		current := &lines[len(lines)-1]
+		fields := make([]int, 0, 5)
+		for index < len(mappings) && mappings[index] != ',' && mappings[index] != ';' {
+			var value int
+			var err error
+			value, index, err = decodeVLQ(mappings, index)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, value)
+		}
+		// The generated column is relative to the previous segment of the same line.
+		column := fields[0]
+		if len(*current) > 0 {
+			column += (*current)[len(*current)-1].column
+		}
+		seg := segment{column: column, source: -1, name: -1}
+		switch len(fields) {
+		case 1:
+		case 4, 5:
+			source += fields[1]
+			sourceLine += fields[2]
+			sourceColumn += fields[3]
+			if source < 0 || source >= sourcesCount {
+				return nil, fmt.Errorf("invalid source map mappings: unknown source %d", source)
+			}
+			seg.source, seg.sourceLine, seg.sourceColumn = source, sourceLine, sourceColumn
+			if len(fields) == 5 {
+				name += fields[4]
+				if name < 0 || name >= namesCount {
+					return nil, fmt.Errorf("invalid source map mappings: unknown name %d", name)
+				}
+				seg.name = name
+			}
+		default:
+			return nil, fmt.Errorf("invalid source map mappings: segment with %d fields", len(fields))
+		}
+		*current = append(*current, seg)
+	}
+	for _, line := range lines {
+		sort.SliceStable(line, func(i, j int) bool { return line[i].column < line[j].column })
+	}
+	return lines, nil
+}
+
+// Lookup returns the original position of a generated position, line being 1-based and column
+// 0-based. It reports false when the position is not mapped.
+func (m *SourceMap) Lookup(line int, column int) (Position, bool) {
+	if line < 1 || line > len(m.lines) || column < 0 {
+		return Position{}, false
+	}
+	segments := m.lines[line-1]
+	index := sort.Search(len(segments), func(i int) bool { return segments[i].column > column }) - 1
+	if index < 0 || segments[index].source < 0 {
+		return Position{}, false
+	}
+	seg := segments[index]
+	position := Position{
+		Source: m.sources[seg.source],
+		Line:   seg.sourceLine + 1,
+		Column: seg.sourceColumn,
+	}
+	if seg.name >= 0 {
+		position.Name = m.names[seg.name]
+	}
+	return position, true
+}
@@ -0,0 +1,100 @@
+package symbolication
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// v8FramePattern matches Hermes and V8 frames: "at fn (file:1:2)", "at file:1:2" and
+	// "at fn (address at file:1:2)".
+	v8FramePattern = regexp.MustCompile(`^(\s*)at (?:(.*?) \()?(?:address at )?([^\s()]+):(\d+):(\d+)\)?\s*$`)
+	// jscFramePattern matches JavaScriptCore frames: "fn@file:1:2".
+	jscFramePattern = regexp.MustCompile(`^(\s*)([^\s@]*)@([^\s@]+):(\d+):(\d+)\s*$`)
+)
+
+// Frame is a frame of a symbolicated stack trace. Original is nil when the frame could not be
+// symbolicated, because it doesn't point into the bundle or isn't mapped.
+type Frame struct {
+	Raw          string    `json:"raw"`
+	FunctionName string    `json:"functionName,omitempty"`
+	File         string    `json:"file,omitempty"`
+	Line         int       `json:"line,omitempty"`
+	Column       int       `json:"column,omitempty"`
+	Original     *Position `json:"original,omitempty"`
+}
+
+// Result is a symbolicated stack trace, with every line of the minified one in Stack.
+type Result struct {
+	Stack  string  `json:"stack"`
+	Frames []Frame `json:"frames"`
+}
+
+type parsedFrame struct {
+	Frame
+	indent string
+	jsc    bool
+}
+
+func parseFrame(line string) (parsedFrame, bool) {
+	frame := parsedFrame{Frame: Frame{Raw: line}}
+	var match []string
+	if match = v8FramePattern.FindStringSubmatch(line); match == nil {
+		if match = jscFramePattern.FindStringSubmatch(line); match == nil {
+			return frame, false
+		}
+		frame.jsc = true
+	}
+	lineNumber, err := strconv.Atoi(match[4])
+	if err != nil {
+		return frame, false
+	}
+	column, err := strconv.Atoi(match[5])
+	if err != nil {
+		return frame, false
+	}
+	frame.indent = match[1]
+	frame.FunctionName = match[2]
+	frame.File = match[3]
+	frame.Line = lineNumber
+	frame.Column = column
+	return frame, true
+}
+
+func (f parsedFrame) format() string {
+	name := f.FunctionName
+	if f.Original.Name != "" {
+		name = f.Original.Name
+	}
+	location := fmt.Sprintf("%s:%d:%d", f.Original.Source, f.Original.Line, f.Original.Column)
+	if f.jsc {
+		return fmt.Sprintf("%s%s@%s", f.indent, name, location)
+	}
+	if name == "" {
+		return fmt.Sprintf("%sat %s", f.indent, location)
+	}
+	return fmt.Sprintf("%sat %s (%s)", f.indent, name, location)
+}
+
+// Symbolicate maps every frame of a minified stack trace to its original position. Frame lines are
+// 1-based and columns 0-based, which is how Hermes reports bytecode offsets. Lines that are not
+// frames, like the error message, are kept as they are.
+func Symbolicate(sourceMap *SourceMap, stack string) Result {
+	lines := strings.Split(strings.ReplaceAll(stack, "\r\n", "\n"), "\n")
+	result := Result{Frames: []Frame{}}
+	for i, line := range lines {
+		frame, ok := parseFrame(line)
+		if !ok {
+			continue
+		}
+		if original, found := sourceMap.Lookup(frame.Line, frame.Column); found {
+			frame.Original = &original
+			lines[i] = frame.format()
+		}
+		result.Frames = append(result.Frames, frame.Frame)
+	}
+	result.Stack = strings.Join(lines, "\n")
+	return result
+}
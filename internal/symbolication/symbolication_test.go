@@ -0,0 +1,82 @@
+package symbolication
+
+import (
+	"strings"
+	testing2 "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSourceMap maps line 1 columns 0, 10 and 20 to src/App.tsx 5:2 (crash), 6:4 and
+// src/utils.ts 1:0 (format), and line 2 column 0 to src/App.tsx 10:0.
+const testSourceMap = `{
+	"version": 3,
+	"sourceRoot": "",
+	"sources": ["src/App.tsx", "src/utils.ts"],
+	"names": ["crash", "format"],
+	"mappings": "AAIEA,UACE,UCLJC;ADSA"
+}`
+
+func TestParseSourceMapLookup(t *testing2.T) {
+	sourceMap, err := ParseSourceMap(strings.NewReader(testSourceMap))
+	require.NoError(t, err)
+
+	position, ok := sourceMap.Lookup(1, 3)
+	require.True(t, ok)
+	assert.Equal(t, Position{Source: "src/App.tsx", Line: 5, Column: 2, Name: "crash"}, position)
+
+	position, ok = sourceMap.Lookup(1, 15)
+	require.True(t, ok)
+	assert.Equal(t, Position{Source: "src/App.tsx", Line: 6, Column: 4}, position)
+
+	position, ok = sourceMap.Lookup(1, 42)
+	require.True(t, ok)
+	assert.Equal(t, Position{Source: "src/utils.ts", Line: 1, Column: 0, Name: "format"}, position)
+
+	position, ok = sourceMap.Lookup(2, 0)
+	require.True(t, ok)
+	assert.Equal(t, Position{Source: "src/App.tsx", Line: 10, Column: 0}, position)
+
+	_, ok = sourceMap.Lookup(3, 0)
+	assert.False(t, ok)
+}
+
+func TestParseSourceMapErrors(t *testing2.T) {
+	_, err := ParseSourceMap(strings.NewReader(`{"version": 2, "sources": [], "mappings": ""}`))
+	assert.Error(t, err)
+	_, err = ParseSourceMap(strings.NewReader(`{"version": 3, "sections": [{}]}`))
+	assert.Error(t, err)
+	_, err = ParseSourceMap(strings.NewReader(`{"version": 3, "sources": ["a.js"], "mappings": "AAC!"}`))
+	assert.Error(t, err)
+	_, err = ParseSourceMap(strings.NewReader(`{"version": 3, "sources": ["a.js"], "mappings": "ACAA"}`))
+	assert.Error(t, err, "Expected a mapping to an unknown source to be refused")
+}
+
+func TestSymbolicate(t *testing2.T) {
+	sourceMap, err := ParseSourceMap(strings.NewReader(testSourceMap))
+	require.NoError(t, err)
+	stack := strings.Join([]string{
+		"TypeError: undefined is not a function",
+		"    at a (address at index.android.bundle:1:3)",
+		"    at index.android.bundle:1:25",
+		"b@main.jsbundle:2:0",
+		"    at native",
+		"    at c (index.android.bundle:7:0)",
+	}, "\n")
+
+	result := Symbolicate(sourceMap, stack)
+	assert.Equal(t, strings.Join([]string{
+		"TypeError: undefined is not a function",
+		"    at crash (src/App.tsx:5:2)",
+		"    at format (src/utils.ts:1:0)",
+		"b@src/App.tsx:10:0",
+		"    at native",
+		"    at c (index.android.bundle:7:0)",
+	}, "\n"), result.Stack)
+	require.Len(t, result.Frames, 4)
+	assert.Equal(t, "a", result.Frames[0].FunctionName)
+	assert.Equal(t, "index.android.bundle", result.Frames[0].File)
+	assert.Equal(t, &Position{Source: "src/App.tsx", Line: 5, Column: 2, Name: "crash"}, result.Frames[0].Original)
+	assert.Nil(t, result.Frames[3].Original, "Expected an unmapped frame to be kept as is")
+}
@@ -0,0 +1,253 @@
+package targeting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/helpers"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/version"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const RulesFileName = "targeting-rules.json"
+
+// AppVersionExtraParam is the extra param read when the client does not send the app version header.
+const AppVersionExtraParam = "appVersion"
+
+// rulesCacheTTL bounds how long rules edited directly in the bucket take to apply.
+const rulesCacheTTL = 1800
+
+// noRules is cached when no rules are stored, so requests don't hit the bucket each time.
+const noRules = "{}"
+
+// Rules restrict which clients are served a branch or an update. Every rule that is set must match.
+type Rules struct {
+	// ExtraParams maps an Expo-Extra-Params key to its accepted values.
+	ExtraParams   map[string][]string `json:"extraParams,omitempty"`
+	MinAppVersion string              `json:"minAppVersion,omitempty"`
+	MaxAppVersion string              `json:"maxAppVersion,omitempty"`
+	ClientIds     []string            `json:"clientIds,omitempty"`
+}
+
+// Client holds what a manifest request tells about the client being targeted.
+type Client struct {
+	ExtraParams map[string]string
+	AppVersion  string
+	ClientId    string
+}
+
+func ClientFromRequest(r *http.Request) Client {
+	extraParams := helpers.ParseExpoExtraParams(r.Header.Get("Expo-Extra-Params"))
+	appVersion := r.Header.Get("Expo-App-Version")
+	if appVersion == "" {
+		appVersion = extraParams[AppVersionExtraParam]
+	}
+	return Client{
+		ExtraParams: extraParams,
+		AppVersion:  appVersion,
+		ClientId:    r.Header.Get("EAS-Client-ID"),
+	}
+}
+
+func (r *Rules) IsEmpty() bool {
+	return r == nil || (len(r.ExtraParams) == 0 && r.MinAppVersion == "" && r.MaxAppVersion == "" && len(r.ClientIds) == 0)
+}
+
+func (r *Rules) Validate() error {
+	if r == nil {
+		return nil
+	}
+	for key, values := range r.ExtraParams {
+		if key == "" || len(values) == 0 {
+			return fmt.Errorf("extra param %q must accept at least one value", key)
+		}
+	}
+	for _, appVersion := range []string{r.MinAppVersion, r.MaxAppVersion} {
+		if appVersion != "" && !isValidVersion(appVersion) {
+			return fmt.Errorf("invalid app version %q", appVersion)
+		}
+	}
+	if r.MinAppVersion != "" && r.MaxAppVersion != "" && CompareVersions(r.MinAppVersion, r.MaxAppVersion) > 0 {
+		return errors.New("minAppVersion is greater than maxAppVersion")
+	}
+	return nil
+}
+
+// Matches reports whether the client is targeted. Clients that don't send the app version or the
+// client ID are not targeted by rules on them.
+func (r *Rules) Matches(client Client) bool {
+	if r.IsEmpty() {
+		return true
+	}
+	for key, accepted := range r.ExtraParams {
+		value, ok := client.ExtraParams[key]
+		if !ok || !helpers.StringInSlice(value, accepted) {
+			return false
+		}
+	}
+	if r.MinAppVersion != "" || r.MaxAppVersion != "" {
+		if !isValidVersion(client.AppVersion) {
+			return false
+		}
+		if r.MinAppVersion != "" && CompareVersions(client.AppVersion, r.MinAppVersion) < 0 {
+			return false
+		}
+		if r.MaxAppVersion != "" && CompareVersions(client.AppVersion, r.MaxAppVersion) > 0 {
+			return false
+		}
+	}
+	if len(r.ClientIds) > 0 {
+		matched := false
+		for _, clientId := range r.ClientIds {
+			if strings.EqualFold(clientId, client.ClientId) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func isValidVersion(v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, part := range strings.Split(v, ".") {
+		if _, err := strconv.Atoi(part); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// CompareVersions compares dot-separated numeric versions, missing parts counting as 0.
+func CompareVersions(a, b string) int {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var numberA, numberB int
+		if i < len(partsA) {
+			numberA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numberB, _ = strconv.Atoi(partsB[i])
+		}
+		if numberA != numberB {
+			if numberA < numberB {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func ComputeBranchRulesCacheKey(branch string) string {
+	return fmt.Sprintf("targetingRules:%s:%s", version.Version, branch)
+}
+
+func ComputeUpdateRulesCacheKey(update types.Update) string {
+	return fmt.Sprintf("targetingRules:%s:%s:%s:%s", version.Version, update.Branch, update.RuntimeVersion, update.UpdateId)
+}
+
+func branchRulesPath(branch string) string {
+	return path.Join(branch, RulesFileName)
+}
+
+// readRules returns the cached rules, or reads them with read and caches the result.
+func readRules(ctx context.Context, cacheKey string, read func() (*types.BucketFile, error)) (*Rules, error) {
+	cache := cache2.GetCache()
+	content := cache.Get(ctx, cacheKey)
+	if content == "" {
+		file, err := read()
+		if err != nil {
+			return nil, err
+		}
+		content = noRules
+		if file != nil {
+			var buffer bytes.Buffer
+			_, err = buffer.ReadFrom(file.Reader)
+			file.Reader.Close()
+			if err != nil {
+				return nil, err
+			}
+			content = buffer.String()
+		}
+		ttl := rulesCacheTTL
+		_ = cache.Set(ctx, cacheKey, content, &ttl)
+	}
+	var rules Rules
+	if err := json.Unmarshal([]byte(content), &rules); err != nil {
+		return nil, err
+	}
+	if rules.IsEmpty() {
+		return nil, nil
+	}
+	return &rules, nil
+}
+
+func encodeRules(rules *Rules) (*bytes.Reader, error) {
+	if rules == nil {
+		rules = &Rules{}
+	}
+	content, err := json.Marshal(rules)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(content), nil
+}
+
+// GetBranchRules returns the rules of the branch, or nil when every client is targeted.
+func GetBranchRules(ctx context.Context, branch string) (*Rules, error) {
+	return readRules(ctx, ComputeBranchRulesCacheKey(branch), func() (*types.BucketFile, error) {
+		return bucket.GetBucket().GetRootFile(ctx, branchRulesPath(branch))
+	})
+}
+
+// SetBranchRules stores the rules next to the branch, empty rules targeting every client.
+func SetBranchRules(ctx context.Context, branch string, rules *Rules) error {
+	reader, err := encodeRules(rules)
+	if err != nil {
+		return err
+	}
+	if err := bucket.GetBucket().UploadRootFile(ctx, branchRulesPath(branch), reader); err != nil {
+		return err
+	}
+	cache2.GetCache().Delete(ctx, ComputeBranchRulesCacheKey(branch))
+	return nil
+}
+
+// GetUpdateRules returns the rules of the update, or nil when every client is targeted.
+func GetUpdateRules(ctx context.Context, update types.Update) (*Rules, error) {
+	return readRules(ctx, ComputeUpdateRulesCacheKey(update), func() (*types.BucketFile, error) {
+		file, err := bucket.GetBucket().GetFile(ctx, update, RulesFileName)
+		if err != nil {
+			// Buckets report a missing file inside an update as an error.
+			return nil, nil
+		}
+		return file, nil
+	})
+}
+
+func SetUpdateRules(ctx context.Context, update types.Update, rules *Rules) error {
+	reader, err := encodeRules(rules)
+	if err != nil {
+		return err
+	}
+	if err := bucket.GetBucket().UploadFileIntoUpdate(ctx, update, RulesFileName, reader); err != nil {
+		return err
+	}
+	cache2.GetCache().Delete(ctx, ComputeUpdateRulesCacheKey(update))
+	return nil
+}
@@ -0,0 +1,55 @@
+package targeting
+
+import (
+	"net/http/httptest"
+	testing2 "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions(t *testing2.T) {
+	assert.Equal(t, 0, CompareVersions("1.2", "1.2.0"))
+	assert.Equal(t, -1, CompareVersions("1.2.9", "1.10"))
+	assert.Equal(t, 1, CompareVersions("2", "1.99.99"))
+}
+
+func TestValidateRules(t *testing2.T) {
+	assert.Nil(t, (*Rules)(nil).Validate())
+	assert.Nil(t, (&Rules{MinAppVersion: "1.0", MaxAppVersion: "1.0.0"}).Validate())
+	assert.NotNil(t, (&Rules{MinAppVersion: "1.0-beta"}).Validate())
+	assert.NotNil(t, (&Rules{MinAppVersion: "2.0", MaxAppVersion: "1.5"}).Validate())
+	assert.NotNil(t, (&Rules{ExtraParams: map[string][]string{"tier": {}}}).Validate())
+}
+
+func TestRulesMatches(t *testing2.T) {
+	client := Client{
+		ExtraParams: map[string]string{"tier": "beta"},
+		AppVersion:  "1.4.2",
+		ClientId:    "Client-A",
+	}
+	assert.True(t, (*Rules)(nil).Matches(client))
+	assert.True(t, (&Rules{}).Matches(Client{}))
+	assert.True(t, (&Rules{ExtraParams: map[string][]string{"tier": {"alpha", "beta"}}}).Matches(client))
+	assert.False(t, (&Rules{ExtraParams: map[string][]string{"tier": {"alpha"}}}).Matches(client))
+	assert.False(t, (&Rules{ExtraParams: map[string][]string{"country": {"fr"}}}).Matches(client))
+	assert.True(t, (&Rules{MinAppVersion: "1.4", MaxAppVersion: "1.4.2"}).Matches(client))
+	assert.False(t, (&Rules{MinAppVersion: "1.5"}).Matches(client))
+	assert.False(t, (&Rules{MaxAppVersion: "1.4.1"}).Matches(client))
+	assert.False(t, (&Rules{MinAppVersion: "1.0"}).Matches(Client{}), "Clients without app version must not match version rules")
+	assert.True(t, (&Rules{ClientIds: []string{"client-a"}}).Matches(client))
+	assert.False(t, (&Rules{ClientIds: []string{"client-b"}}).Matches(client))
+	assert.False(t, (&Rules{ExtraParams: map[string][]string{"tier": {"beta"}}, ClientIds: []string{"client-b"}}).Matches(client))
+}
+
+func TestClientFromRequest(t *testing2.T) {
+	r := httptest.NewRequest("GET", "/manifest", nil)
+	r.Header.Set("Expo-Extra-Params", `tier="beta", appVersion="1.2.0"`)
+	r.Header.Set("EAS-Client-ID", "client-a")
+	client := ClientFromRequest(r)
+	assert.Equal(t, "beta", client.ExtraParams["tier"])
+	assert.Equal(t, "1.2.0", client.AppVersion)
+	assert.Equal(t, "client-a", client.ClientId)
+
+	r.Header.Set("Expo-App-Version", "2.0.0")
+	assert.Equal(t, "2.0.0", ClientFromRequest(r).AppVersion)
+}
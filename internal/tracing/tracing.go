@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"context"
+	"expo-open-ota/config"
+	"expo-open-ota/internal/version"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "expo-open-ota"
+
+func isExportEnabled() bool {
+	return config.GetEnv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || config.GetEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// InitTracing installs the global tracer provider. Spans are always created so every request
+// gets a trace ID, they are only exported when an OTLP endpoint is configured.
+// The returned function flushes pending spans and must be called on shutdown.
+func InitTracing(ctx context.Context) func(context.Context) error {
+	serviceName := config.GetEnv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = tracerName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version.Version),
+	))
+	if err != nil {
+		res = resource.Default()
+	}
+	options := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if isExportEnabled() {
+		// The exporter reads the standard OTEL_EXPORTER_OTLP_* variables (endpoint, headers, protocol...).
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			slog.Error("Error creating OTLP exporter, traces will not be exported", "error", err)
+		} else {
+			options = append(options, sdktrace.WithBatcher(exporter))
+		}
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown
+}
+
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// StartSpan starts a child span of the span carried by ctx.
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Tracer().Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// EndSpan records err on the span, if any, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceID returns the trace ID of the current span, or an empty string when there is none.
+func TraceID(ctx context.Context) string {
+	if ctx != nil {
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			return spanContext.TraceID().String()
+		}
+	}
+	return ""
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware starts a server span for each request, continuing the incoming trace if any.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := Tracer().Start(ctx, r.Method+" "+routeName(r),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+func routeName(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	testing2 "testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareContinuesIncomingTrace(t *testing2.T) {
+	shutdown := InitTracing(context.Background())
+	defer shutdown(context.Background())
+
+	var traceID string
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/manifest", func(w http.ResponseWriter, r *http.Request) {
+		traceID = TraceID(r.Context())
+	})
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/manifest", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(recorder, request)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+}
+
+func TestTraceIDWithoutSpan(t *testing2.T) {
+	assert.Empty(t, TraceID(context.Background()))
+}
@@ -35,11 +35,73 @@ type UpdateMetadata struct {
 }
 
 type UpdateStoredMetadata struct {
-	Platform   string `json:"platform"`
-	CommitHash string `json:"commitHash"`
+	Platform   string            `json:"platform"`
+	CommitHash string            `json:"commitHash"`
+	UpdateUUID string            `json:"updateUUID"`
+	FileHashes map[string]string `json:"fileHashes,omitempty"`
+	// PromotedFrom is set on updates promoted from another branch.
+	PromotedFrom *UpdateProvenance `json:"promotedFrom,omitempty"`
+	// Group is set on updates published together for several platforms.
+	Group *UpdateGroup `json:"group,omitempty"`
+	// ActivateAt and ExpireAt bound the window in which the update can be served.
+	ActivateAt *time.Time `json:"activateAt,omitempty"`
+	ExpireAt   *time.Time `json:"expireAt,omitempty"`
+	// Approval is set on updates published to a protected branch.
+	Approval *UpdateApproval `json:"approval,omitempty"`
+	// Message and Metadata describe the update, the ManifestFields are also sent to the app in the
+	// metadata of its manifest.
+	Message        string            `json:"message,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	ManifestFields []string          `json:"manifestFields,omitempty"`
+}
+
+type ApprovalStatus string
+
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved"
+)
+
+// UpdateApproval records who published an update to a protected branch and who approved it.
+// Rejected updates are deleted.
+type UpdateApproval struct {
+	Status      ApprovalStatus `json:"status"`
+	RequestedBy string         `json:"requestedBy,omitempty"`
+	RequestedAt *time.Time     `json:"requestedAt,omitempty"`
+	ApprovedBy  string         `json:"approvedBy,omitempty"`
+	ApprovedAt  *time.Time     `json:"approvedAt,omitempty"`
+}
+
+// UpdateGroup links the updates of a multi-platform publish, none of them is served before all of
+// them are checked.
+type UpdateGroup struct {
+	Id      string              `json:"id"`
+	Updates []UpdateGroupMember `json:"updates"`
+}
+
+type UpdateGroupMember struct {
+	Platform       string `json:"platform"`
+	RuntimeVersion string `json:"runtimeVersion"`
+	UpdateId       string `json:"updateId"`
+}
+
+type UpdateProvenance struct {
+	Branch     string `json:"branch"`
+	UpdateId   string `json:"updateId"`
 	UpdateUUID string `json:"updateUUID"`
 }
 
+type AssetIndexEntry struct {
+	Hash        string `json:"hash"`
+	Key         string `json:"key"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+type AssetIndex struct {
+	Assets map[string]AssetIndexEntry `json:"assets"`
+}
+
 type UpdateType int
 
 const (
@@ -70,6 +132,11 @@ type UpdateManifest struct {
 	Extra          ExtraManifestData `json:"extra"`
 }
 
+// ManifestExtensions is sent in the extensions part next to a multipart manifest.
+type ManifestExtensions struct {
+	AssetRequestHeaders map[string]map[string]string `json:"assetRequestHeaders"`
+}
+
 type RollbackDirectiveParameters struct {
 	CommitTime string `json:"commitTime"`
 }
@@ -0,0 +1,143 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/dashboard"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/webhooks"
+	"fmt"
+	"strings"
+	"time"
+)
+
+func storeUpdateStoredMetadata(ctx context.Context, update types.Update, storedMetadata *types.UpdateStoredMetadata) error {
+	content, err := json.Marshal(storedMetadata)
+	if err != nil {
+		return err
+	}
+	return bucket.GetBucket().UploadFileIntoUpdate(ctx, update, "update-metadata.json", strings.NewReader(string(content)))
+}
+
+func invalidateDashboardCaches(ctx context.Context, update types.Update) {
+	cache := cache2.GetCache()
+	cache.Delete(ctx, dashboard.ComputeGetBranchesCacheKey())
+	cache.Delete(ctx, dashboard.ComputeGetRuntimeVersionsCacheKey(update.Branch))
+	cache.Delete(ctx, dashboard.ComputeGetUpdatesCacheKey(update.Branch, update.RuntimeVersion))
+	cache.Delete(ctx, dashboard.ComputeGetUpdateDetailsCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId))
+}
+
+// MarkUpdateAsPending holds an update published to a protected branch: it is not checked, so not
+// served, until an approver approves it.
+func MarkUpdateAsPending(ctx context.Context, update types.Update, requestedBy string) error {
+	err := StoreUpdateUUIDInMetadata(ctx, update)
+	if err != nil {
+		return err
+	}
+	storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, update)
+	if err != nil {
+		return err
+	}
+	if storedMetadata == nil {
+		return fmt.Errorf("update %s has no metadata", update.UpdateId)
+	}
+	now := time.Now().UTC()
+	storedMetadata.Approval = &types.UpdateApproval{
+		Status:      types.ApprovalPending,
+		RequestedBy: requestedBy,
+		RequestedAt: &now,
+	}
+	err = storeUpdateStoredMetadata(ctx, update, storedMetadata)
+	if err != nil {
+		return err
+	}
+	invalidateDashboardCaches(ctx, update)
+	webhooks.Dispatch(computeWebhookPayload(webhooks.UpdatePendingApproval, update, storedMetadata))
+	return nil
+}
+
+// IsUpdatePending reports whether the update waits for an approval.
+func IsUpdatePending(ctx context.Context, update types.Update) bool {
+	if IsUpdateValid(ctx, update) {
+		return false
+	}
+	storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, update)
+	return err == nil && storedMetadata != nil && storedMetadata.Approval != nil && storedMetadata.Approval.Status == types.ApprovalPending
+}
+
+// pendingUpdates returns the update with the other updates of its group, which are approved or
+// rejected together. All of them must be pending.
+func pendingUpdates(ctx context.Context, update types.Update) ([]types.Update, *types.UpdateGroup, error) {
+	group, err := GetUpdateGroup(ctx, update)
+	if err != nil {
+		return nil, nil, err
+	}
+	updates := []types.Update{update}
+	if group != nil {
+		updates, err = GetGroupUpdates(update.Branch, group)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, pending := range updates {
+		if !IsUpdatePending(ctx, pending) {
+			return nil, nil, fmt.Errorf("update %s is not pending approval", pending.UpdateId)
+		}
+	}
+	return updates, group, nil
+}
+
+// ApproveUpdate publishes a pending update, with the other updates of its group, and records who
+// approved it. It returns the published updates.
+func ApproveUpdate(ctx context.Context, update types.Update, approvedBy string) ([]types.Update, error) {
+	updates, _, err := pendingUpdates(ctx, update)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	for _, pending := range updates {
+		storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, pending)
+		if err != nil {
+			return nil, err
+		}
+		storedMetadata.Approval.Status = types.ApprovalApproved
+		storedMetadata.Approval.ApprovedBy = approvedBy
+		storedMetadata.Approval.ApprovedAt = &now
+		err = storeUpdateStoredMetadata(ctx, pending, storedMetadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, approved := range updates {
+		storedMetadata, err := markUpdateAsChecked(ctx, approved)
+		if err != nil {
+			return nil, err
+		}
+		invalidateDashboardCaches(ctx, approved)
+		webhooks.Dispatch(computeWebhookPayload(webhooks.UpdatePublished, approved, storedMetadata))
+	}
+	return updates, nil
+}
+
+// RejectUpdate deletes a pending update, with the other updates of its group. It returns the
+// deleted updates.
+func RejectUpdate(ctx context.Context, update types.Update) ([]types.Update, error) {
+	updates, group, err := pendingUpdates(ctx, update)
+	if err != nil {
+		return nil, err
+	}
+	if group != nil {
+		err = DeleteUpdateGroup(ctx, update.Branch, group)
+	} else {
+		err = bucket.GetBucket().DeleteUpdateFolder(ctx, update.Branch, update.RuntimeVersion, update.UpdateId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, rejected := range updates {
+		invalidateDashboardCaches(ctx, rejected)
+	}
+	return updates, nil
+}
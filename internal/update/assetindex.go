@@ -0,0 +1,138 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/crypto"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"strings"
+	"sync"
+)
+
+const AssetIndexFileName = "asset-index.json"
+
+type indexedFile struct {
+	path          string
+	isLaunchAsset bool
+	ext           string
+}
+
+func manifestContentType(ext string, isLaunchAsset bool) string {
+	if isLaunchAsset {
+		return mime.TypeByExtension(ext)
+	}
+	return "application/javascript"
+}
+
+func listUpdateFiles(metadata types.UpdateMetadata) []indexedFile {
+	files := []indexedFile{}
+	for _, platformMetadata := range []types.PlatformMetadata{metadata.MetadataJSON.FileMetadata.IOS, metadata.MetadataJSON.FileMetadata.Android} {
+		if platformMetadata.Bundle == "" {
+			continue
+		}
+		files = append(files, indexedFile{path: platformMetadata.Bundle, isLaunchAsset: true})
+		for _, asset := range platformMetadata.Assets {
+			files = append(files, indexedFile{path: asset.Path, ext: asset.Ext})
+		}
+	}
+	return files
+}
+
+// matchesDeclaredHash accepts a SHA-256 declared as hex, base64 or base64url.
+func matchesDeclaredHash(declared string, sum []byte) bool {
+	declared = strings.TrimSpace(declared)
+	encoded := base64.StdEncoding.EncodeToString(sum)
+	return strings.EqualFold(declared, hex.EncodeToString(sum)) ||
+		declared == encoded ||
+		declared == crypto.GetBase64URLEncoding(encoded)
+}
+
+func indexFile(ctx context.Context, update types.Update, file indexedFile, declaredHash string) (types.AssetIndexEntry, error) {
+	object, err := bucket.GetBucket().GetFile(ctx, update, file.path)
+	if err != nil || object == nil {
+		return types.AssetIndexEntry{}, fmt.Errorf("missing file: %s in update", file.path)
+	}
+	defer object.Reader.Close()
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+	size, err := io.Copy(io.MultiWriter(sha256Hash, md5Hash), object.Reader)
+	if err != nil {
+		return types.AssetIndexEntry{}, fmt.Errorf("unable to read file: %s in update: %w", file.path, err)
+	}
+	sum := sha256Hash.Sum(nil)
+	if declaredHash != "" && !matchesDeclaredHash(declaredHash, sum) {
+		return types.AssetIndexEntry{}, fmt.Errorf("hash mismatch for file: %s in update", file.path)
+	}
+	return types.AssetIndexEntry{
+		Hash:        crypto.GetBase64URLEncoding(base64.StdEncoding.EncodeToString(sum)),
+		Key:         hex.EncodeToString(md5Hash.Sum(nil)),
+		ContentType: manifestContentType(file.ext, file.isLaunchAsset),
+		Size:        size,
+	}, nil
+}
+
+// BuildAssetIndex hashes every file referenced by the update metadata once, checking them against
+// the hashes declared by the client when requesting the upload URLs.
+func BuildAssetIndex(ctx context.Context, update types.Update, metadata types.UpdateMetadata, declaredHashes map[string]string) (*types.AssetIndex, error) {
+	files := listUpdateFiles(metadata)
+	var (
+		index = &types.AssetIndex{Assets: make(map[string]types.AssetIndexEntry, len(files))}
+		mu    sync.Mutex
+		errs  = make(chan error, len(files))
+		wg    sync.WaitGroup
+	)
+	for _, file := range files {
+		wg.Add(1)
+		go func(file indexedFile) {
+			defer wg.Done()
+			entry, err := indexFile(ctx, update, file, declaredHashes[file.path])
+			if err != nil {
+				errs <- err
+				return
+			}
+			mu.Lock()
+			index.Assets[file.path] = entry
+			mu.Unlock()
+		}(file)
+	}
+	wg.Wait()
+	close(errs)
+	if len(errs) > 0 {
+		return nil, <-errs
+	}
+	return index, nil
+}
+
+func storeAssetIndex(ctx context.Context, update types.Update, index *types.AssetIndex) error {
+	content, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return bucket.GetBucket().UploadFileIntoUpdate(ctx, update, AssetIndexFileName, bytes.NewReader(content))
+}
+
+// GetAssetIndex returns the asset index stored with the update, or nil for updates uploaded before
+// indexes existed.
+func GetAssetIndex(ctx context.Context, update types.Update) *types.AssetIndex {
+	file, err := bucket.GetBucket().GetFile(ctx, update, AssetIndexFileName)
+	if err != nil || file == nil {
+		return nil
+	}
+	defer file.Reader.Close()
+	var index types.AssetIndex
+	if err := json.NewDecoder(file.Reader).Decode(&index); err != nil {
+		slog.WarnContext(ctx, "Ignoring unreadable asset index", "branch", update.Branch, "runtimeVersion", update.RuntimeVersion, "updateId", update.UpdateId, "error", err)
+		return nil
+	}
+	return &index
+}
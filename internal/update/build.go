@@ -0,0 +1,81 @@
+package update
+
+import (
+	"context"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/singleflight"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	buildLockTTL      = 30
+	buildLockWait     = 10 * time.Second
+	buildLockInterval = 50 * time.Millisecond
+)
+
+var builds singleflight.Group[string]
+
+func ComputeBuildLockKey(cacheKey string) string {
+	return "buildLock:" + cacheKey
+}
+
+// waitForCachedValue polls the cache while another instance holds the build lock of cacheKey. It gives
+// up early when the lock is released without a value being cached, for instance when the build failed.
+func waitForCachedValue(ctx context.Context, cacheKey string, lockKey string) string {
+	cache := cache2.GetCache()
+	deadline := time.NewTimer(buildLockWait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(buildLockInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-deadline.C:
+			return ""
+		case <-ticker.C:
+			if value := cache.Get(ctx, cacheKey); value != "" {
+				return value
+			}
+			if held, err := cache.LockHeld(ctx, lockKey); err == nil && !held {
+				return ""
+			}
+		}
+	}
+}
+
+// buildOnce rebuilds the value of cacheKey with build, which is expected to store it in the cache.
+// Within the process a single goroutine runs build while concurrent callers share its result, and
+// a cache lock makes other instances wait for the value instead of rebuilding it at the same time.
+func buildOnce(ctx context.Context, cacheKey string, build func(ctx context.Context) (string, error)) (string, error) {
+	value, err, _ := builds.Do(ctx, cacheKey, func(ctx context.Context) (string, error) {
+		cache := cache2.GetCache()
+		lockKey := ComputeBuildLockKey(cacheKey)
+		// A build outliving the lock TTL must not release the lock another instance acquired since.
+		token := uuid.NewString()
+		acquired, err := cache.TryLock(ctx, lockKey, token, buildLockTTL)
+		if err != nil {
+			slog.WarnContext(ctx, "Could not acquire build lock, building without it", "key", cacheKey, "error", err)
+			return build(ctx)
+		}
+		if !acquired {
+			if value := waitForCachedValue(ctx, cacheKey, lockKey); value != "" {
+				return value, nil
+			}
+			return build(ctx)
+		}
+		defer func() {
+			if err := cache.Unlock(context.WithoutCancel(ctx), lockKey, token); err != nil {
+				slog.WarnContext(ctx, "Could not release build lock", "key", cacheKey, "error", err)
+			}
+		}()
+		if value := cache.Get(ctx, cacheKey); value != "" {
+			return value, nil
+		}
+		return build(ctx)
+	})
+	return value, err
+}
@@ -0,0 +1,97 @@
+package update
+
+import (
+	"context"
+	cache2 "expo-open-ota/internal/cache"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	testing2 "testing"
+	"time"
+)
+
+func setup(t *testing2.T) func() {
+	_ = cache2.GetCache().Clear(context.Background())
+	return func() {
+		_ = cache2.GetCache().Clear(context.Background())
+	}
+}
+
+func TestBuildOnceCoalescesConcurrentBuilds(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	var builds atomic.Int32
+	build := func(ctx context.Context) (string, error) {
+		builds.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		_ = cache2.GetCache().Set(ctx, "coalesced", "value", nil)
+		return "value", nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := buildOnce(context.Background(), "coalesced", build)
+			assert.Nil(t, err)
+			assert.Equal(t, "value", value)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), builds.Load())
+}
+
+func TestBuildOnceWaitsForAnotherInstance(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	cache := cache2.GetCache()
+	acquired, err := cache.TryLock(context.Background(), ComputeBuildLockKey("locked"), "other-instance", buildLockTTL)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = cache.Set(context.Background(), "locked", "from-other-instance", nil)
+	}()
+	value, err := buildOnce(context.Background(), "locked", func(ctx context.Context) (string, error) {
+		t.Error("build should not run while another instance holds the lock")
+		return "", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "from-other-instance", value)
+}
+
+func TestBuildOnceBuildsWhenLockReleasedWithoutValue(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	cache := cache2.GetCache()
+	lockKey := ComputeBuildLockKey("released")
+	_, _ = cache.TryLock(context.Background(), lockKey, "other-instance", buildLockTTL)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cache.Delete(context.Background(), lockKey)
+	}()
+	start := time.Now()
+	value, err := buildOnce(context.Background(), "released", func(ctx context.Context) (string, error) {
+		return "rebuilt", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "rebuilt", value)
+	assert.Less(t, time.Since(start), buildLockWait)
+}
+
+func TestBuildOnceKeepsLockTakenOverByAnotherInstance(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	cache := cache2.GetCache()
+	lockKey := ComputeBuildLockKey("slow")
+	_, err := buildOnce(context.Background(), "slow", func(ctx context.Context) (string, error) {
+		// The lock expires during a slow build and another instance acquires it.
+		cache.Delete(ctx, lockKey)
+		acquired, err := cache.TryLock(ctx, lockKey, "other-instance", buildLockTTL)
+		assert.Nil(t, err)
+		assert.True(t, acquired)
+		return "value", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "other-instance", cache.Get(context.Background(), lockKey), "Expected the lock of the other instance to be kept")
+}
@@ -0,0 +1,81 @@
+package update
+
+import (
+	"expo-open-ota/internal/types"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	maxMessageLength       = 1024
+	maxMetadataEntries     = 32
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 4096
+	// MessageManifestField exposes the message of the update in its manifest.
+	MessageManifestField = "message"
+)
+
+// reservedManifestFields are set by the server in the metadata of every manifest.
+var reservedManifestFields = map[string]bool{"branch": true}
+
+// ValidateDescription checks the message and custom metadata given on publish, and that every
+// manifest field is either the message or a key of the metadata.
+func ValidateDescription(message string, metadata map[string]string, manifestFields []string) error {
+	if utf8.RuneCountInString(message) > maxMessageLength {
+		return fmt.Errorf("message is longer than %d characters", maxMessageLength)
+	}
+	if len(metadata) > maxMetadataEntries {
+		return fmt.Errorf("metadata has more than %d entries", maxMetadataEntries)
+	}
+	for key, value := range metadata {
+		if key == "" || utf8.RuneCountInString(key) > maxMetadataKeyLength {
+			return fmt.Errorf("metadata key %q must be between 1 and %d characters", key, maxMetadataKeyLength)
+		}
+		if utf8.RuneCountInString(value) > maxMetadataValueLength {
+			return fmt.Errorf("metadata %q is longer than %d characters", key, maxMetadataValueLength)
+		}
+	}
+	for _, field := range manifestFields {
+		if reservedManifestFields[field] {
+			return fmt.Errorf("manifest field %q is reserved", field)
+		}
+		if field == MessageManifestField {
+			continue
+		}
+		if _, ok := metadata[field]; !ok {
+			return fmt.Errorf("manifest field %q is not a metadata key", field)
+		}
+	}
+	return nil
+}
+
+// copyDescription carries the message and custom metadata of an update over to its copy.
+func copyDescription(from *types.UpdateStoredMetadata, to *types.UpdateStoredMetadata) {
+	if from == nil {
+		return
+	}
+	to.Message = from.Message
+	to.Metadata = from.Metadata
+	to.ManifestFields = from.ManifestFields
+}
+
+// manifestFieldValues returns the manifest fields of the update with their values.
+func manifestFieldValues(storedMetadata *types.UpdateStoredMetadata) map[string]string {
+	values := map[string]string{}
+	if storedMetadata == nil {
+		return values
+	}
+	for _, field := range storedMetadata.ManifestFields {
+		if reservedManifestFields[field] {
+			continue
+		}
+		if field == MessageManifestField && storedMetadata.Message != "" {
+			values[field] = storedMetadata.Message
+			continue
+		}
+		if value, ok := storedMetadata.Metadata[field]; ok {
+			values[field] = value
+		}
+	}
+	return values
+}
@@ -0,0 +1,31 @@
+package update
+
+import (
+	"expo-open-ota/internal/types"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	testing2 "testing"
+)
+
+func TestValidateDescription(t *testing2.T) {
+	metadata := map[string]string{"author": "jane", "releaseNotes": "Fixes the login"}
+	assert.NoError(t, ValidateDescription("Fix login", metadata, []string{"message", "releaseNotes"}))
+	assert.NoError(t, ValidateDescription("", nil, nil))
+
+	assert.Error(t, ValidateDescription(strings.Repeat("a", maxMessageLength+1), nil, nil))
+	assert.Error(t, ValidateDescription("", map[string]string{"": "empty key"}, nil))
+	assert.Error(t, ValidateDescription("", map[string]string{"notes": strings.Repeat("a", maxMetadataValueLength+1)}, nil))
+	assert.Error(t, ValidateDescription("", metadata, []string{"ciRunUrl"}), "Expected a manifest field missing from the metadata to be rejected")
+	assert.Error(t, ValidateDescription("", map[string]string{"branch": "main"}, []string{"branch"}), "Expected the branch manifest field to be reserved")
+}
+
+func TestManifestFieldValues(t *testing2.T) {
+	storedMetadata := &types.UpdateStoredMetadata{
+		Message:        "Fix login",
+		Metadata:       map[string]string{"author": "jane", "releaseNotes": "Fixes the login"},
+		ManifestFields: []string{"message", "releaseNotes"},
+	}
+	assert.Equal(t, map[string]string{"message": "Fix login", "releaseNotes": "Fixes the login"}, manifestFieldValues(storedMetadata))
+	assert.Empty(t, manifestFieldValues(nil))
+	assert.Empty(t, manifestFieldValues(&types.UpdateStoredMetadata{Message: "Fix login"}), "Expected nothing to be sent without manifest fields")
+}
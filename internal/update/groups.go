@@ -0,0 +1,181 @@
+package update
+
+import (
+	"context"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/webhooks"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// NewUpdateGroup allocates an update ID to every member of a multi-platform publish. Members of the
+// same runtime version share a folder, so their IDs are spread over consecutive milliseconds.
+func NewUpdateGroup(members []types.UpdateGroupMember) *types.UpdateGroup {
+	base := GenerateUpdateTimestamp()
+	group := &types.UpdateGroup{
+		Id:      uuid.NewString(),
+		Updates: make([]types.UpdateGroupMember, 0, len(members)),
+	}
+	for i, member := range members {
+		member.UpdateId = ConvertUpdateTimestampToString(base + int64(i))
+		group.Updates = append(group.Updates, member)
+	}
+	return group
+}
+
+// GetUpdateGroup returns the group of the update, or nil when it was published on its own.
+func GetUpdateGroup(ctx context.Context, update types.Update) (*types.UpdateGroup, error) {
+	storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, update)
+	if err != nil || storedMetadata == nil {
+		return nil, err
+	}
+	return storedMetadata.Group, nil
+}
+
+// GetGroupUpdates returns the updates of the group, in the order of its members.
+func GetGroupUpdates(branch string, group *types.UpdateGroup) ([]types.Update, error) {
+	updates := make([]types.Update, 0, len(group.Updates))
+	for _, member := range group.Updates {
+		update, err := GetUpdate(branch, member.RuntimeVersion, member.UpdateId)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, *update)
+	}
+	return updates, nil
+}
+
+// IsUpdateGroupComplete reports whether every other update of the group of the update is checked.
+// An update published on its own is always complete.
+func IsUpdateGroupComplete(ctx context.Context, update types.Update) bool {
+	group, err := GetUpdateGroup(ctx, update)
+	if err != nil {
+		return false
+	}
+	if group == nil {
+		return true
+	}
+	for _, member := range group.Updates {
+		if member.RuntimeVersion == update.RuntimeVersion && member.UpdateId == update.UpdateId {
+			continue
+		}
+		memberUpdate, err := GetUpdate(update.Branch, member.RuntimeVersion, member.UpdateId)
+		if err != nil || !IsUpdateValid(ctx, *memberUpdate) {
+			return false
+		}
+	}
+	return true
+}
+
+// isUpdateServable reports whether the update can be chosen as the latest update of its platform,
+// regardless of its schedule.
+func isUpdateServable(ctx context.Context, update types.Update) bool {
+	return IsUpdateValid(ctx, update) && !IsUpdateHalted(ctx, update) && IsUpdateGroupComplete(ctx, update)
+}
+
+// invalidateGroupCaches drops the latest update of every member, so that checking the last member
+// makes the whole group visible at once.
+func invalidateGroupCaches(ctx context.Context, branch string, group *types.UpdateGroup) {
+	for _, member := range group.Updates {
+		InvalidateLatestUpdate(ctx, branch, member.RuntimeVersion, member.Platform)
+	}
+}
+
+// DeleteUpdateGroup deletes the folder of every update of the group.
+func DeleteUpdateGroup(ctx context.Context, branch string, group *types.UpdateGroup) error {
+	resolvedBucket := bucket.GetBucket()
+	for _, member := range group.Updates {
+		if err := resolvedBucket.DeleteUpdateFolder(ctx, branch, member.RuntimeVersion, member.UpdateId); err != nil {
+			return err
+		}
+	}
+	invalidateGroupCaches(ctx, branch, group)
+	return nil
+}
+
+// checkGroupUpdates returns the updates of the group of the update, all of them must be normal,
+// checked and not halted updates.
+func checkGroupUpdates(ctx context.Context, update types.Update) (*types.UpdateGroup, []types.Update, error) {
+	group, err := GetUpdateGroup(ctx, update)
+	if err != nil {
+		return nil, nil, err
+	}
+	if group == nil {
+		return nil, nil, fmt.Errorf("update %s is not part of a group", update.UpdateId)
+	}
+	updates, err := GetGroupUpdates(update.Branch, group)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, member := range updates {
+		if !IsUpdateValid(ctx, member) || GetUpdateType(ctx, member) != types.NormalUpdate || IsUpdateHalted(ctx, member) {
+			return nil, nil, fmt.Errorf("update %s of group %s is not available", member.UpdateId, group.Id)
+		}
+	}
+	return group, updates, nil
+}
+
+// RollbackToUpdateGroup rolls every platform back to the update of the group. It returns the
+// halted updates.
+func RollbackToUpdateGroup(ctx context.Context, target types.Update) ([]types.Update, error) {
+	group, updates, err := checkGroupUpdates(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	halted := make([]types.Update, 0)
+	for i, member := range updates {
+		memberHalted, err := RollbackToUpdate(ctx, member, group.Updates[i].Platform)
+		halted = append(halted, memberHalted...)
+		if err != nil {
+			return halted, err
+		}
+	}
+	return halted, nil
+}
+
+// RepublishUpdateGroup republishes every update of the group of the source update as a new group,
+// served once all of its updates are checked.
+func RepublishUpdateGroup(ctx context.Context, source types.Update, commitHash string) ([]types.Update, error) {
+	group, updates, err := checkGroupUpdates(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	members := make([]types.UpdateGroupMember, 0, len(group.Updates))
+	for _, member := range group.Updates {
+		members = append(members, types.UpdateGroupMember{Platform: member.Platform, RuntimeVersion: member.RuntimeVersion})
+	}
+	newGroup := NewUpdateGroup(members)
+	resolvedBucket := bucket.GetBucket()
+	newUpdates := make([]types.Update, 0, len(updates))
+	for i, previousUpdate := range updates {
+		newUpdate, err := resolvedBucket.CreateUpdateFrom(ctx, &previousUpdate, previousUpdate.Branch, newGroup.Updates[i].UpdateId)
+		if err != nil {
+			return nil, err
+		}
+		previousMetadata, err := RetrieveUpdateStoredMetadata(ctx, previousUpdate)
+		if err != nil {
+			return nil, err
+		}
+		republishedMetadata := types.UpdateStoredMetadata{
+			Platform:   newGroup.Updates[i].Platform,
+			CommitHash: commitHash,
+			Group:      newGroup,
+		}
+		copyDescription(previousMetadata, &republishedMetadata)
+		err = storeUpdateStoredMetadata(ctx, *newUpdate, &republishedMetadata)
+		if err != nil {
+			return nil, err
+		}
+		newUpdates = append(newUpdates, *newUpdate)
+	}
+	for _, newUpdate := range newUpdates {
+		storedMetadata, err := markUpdateAsChecked(ctx, newUpdate)
+		if err != nil {
+			return nil, err
+		}
+		webhooks.Dispatch(computeWebhookPayload(webhooks.UpdateRepublished, newUpdate, storedMetadata))
+	}
+	return newUpdates, nil
+}
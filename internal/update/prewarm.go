@@ -0,0 +1,103 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/types"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+var prewarms sync.WaitGroup
+
+func ComputeManifestFileName(platform string) string {
+	return "manifest-" + platform + ".json"
+}
+
+// PrewarmUpdate composes the manifest of a freshly published update in the background so the first
+// devices checking in do not pay for hashing its assets.
+func PrewarmUpdate(ctx context.Context, update types.Update, platform string) {
+	prewarms.Add(1)
+	go func() {
+		defer prewarms.Done()
+		ctx := context.WithoutCancel(ctx)
+		if err := prewarmUpdate(ctx, update, platform); err != nil {
+			slog.WarnContext(ctx, "Error pre-warming update", "branch", update.Branch, "runtimeVersion", update.RuntimeVersion, "updateId", update.UpdateId, "error", err)
+		}
+	}()
+}
+
+// WaitPrewarms blocks until every pending pre-warm is done.
+func WaitPrewarms() {
+	prewarms.Wait()
+}
+
+func resolvePrewarmPlatforms(metadata types.UpdateMetadata, platform string) []string {
+	available := map[string]bool{
+		"ios":     metadata.MetadataJSON.FileMetadata.IOS.Bundle != "",
+		"android": metadata.MetadataJSON.FileMetadata.Android.Bundle != "",
+	}
+	if supported, known := available[platform]; known {
+		if supported {
+			return []string{platform}
+		}
+		return nil
+	}
+	platforms := make([]string, 0, len(available))
+	for _, candidate := range []string{"ios", "android"} {
+		if available[candidate] {
+			platforms = append(platforms, candidate)
+		}
+	}
+	return platforms
+}
+
+func prewarmUpdate(ctx context.Context, update types.Update, platform string) error {
+	if GetUpdateType(ctx, update) == types.Rollback {
+		return nil
+	}
+	metadata, err := GetMetadata(ctx, update)
+	if err != nil {
+		return err
+	}
+	resolvedBucket := bucket.GetBucket()
+	for _, platform := range resolvePrewarmPlatforms(metadata, platform) {
+		manifest, err := ComposeUpdateManifest(ctx, &metadata, update, platform)
+		if err != nil {
+			return err
+		}
+		content, err := json.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+		err = resolvedBucket.UploadFileIntoUpdate(ctx, update, ComputeManifestFileName(platform), bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		slog.DebugContext(ctx, "Update pre-warmed", "branch", update.Branch, "runtimeVersion", update.RuntimeVersion, "updateId", update.UpdateId, "platform", platform)
+	}
+	return nil
+}
+
+// loadPersistedManifest reads the manifest stored next to the update at publish time. It is ignored
+// when it was composed for another update, for instance copied by a republish, or another asset
+// endpoint.
+func loadPersistedManifest(ctx context.Context, update types.Update, platform string, updateUUID string) (*types.UpdateManifest, bool) {
+	file, err := bucket.GetBucket().GetFile(ctx, update, ComputeManifestFileName(platform))
+	if err != nil || file == nil {
+		return nil, false
+	}
+	defer file.Reader.Close()
+	var manifest types.UpdateManifest
+	if err := json.NewDecoder(file.Reader).Decode(&manifest); err != nil {
+		slog.WarnContext(ctx, "Ignoring unreadable persisted manifest", "updateId", update.UpdateId, "platform", platform, "error", err)
+		return nil, false
+	}
+	if manifest.Id != updateUUID || !strings.HasPrefix(manifest.LaunchAsset.Url, GetAssetEndpoint()) {
+		return nil, false
+	}
+	return &manifest, true
+}
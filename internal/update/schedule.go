@@ -0,0 +1,77 @@
+package update
+
+import (
+	"context"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"math"
+	"time"
+)
+
+// latestUpdateTTL is how long, in seconds, the latest update of a platform is cached when no
+// scheduled update changes it sooner.
+const latestUpdateTTL = 1800
+
+// ParseSchedule parses the optional RFC3339 activation and expiration dates of an update.
+func ParseSchedule(activateAt string, expireAt string) (*time.Time, *time.Time, error) {
+	var activation, expiration *time.Time
+	if activateAt != "" {
+		parsed, err := time.Parse(time.RFC3339, activateAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid activateAt: %w", err)
+		}
+		activation = &parsed
+	}
+	if expireAt != "" {
+		parsed, err := time.Parse(time.RFC3339, expireAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid expireAt: %w", err)
+		}
+		expiration = &parsed
+	}
+	if activation != nil && expiration != nil && !expiration.After(*activation) {
+		return nil, nil, fmt.Errorf("expireAt must be after activateAt")
+	}
+	return activation, expiration, nil
+}
+
+// IsUpdateActive reports whether the update can be served at the given time.
+func IsUpdateActive(storedMetadata *types.UpdateStoredMetadata, now time.Time) bool {
+	if storedMetadata == nil {
+		return true
+	}
+	if storedMetadata.ActivateAt != nil && storedMetadata.ActivateAt.After(now) {
+		return false
+	}
+	return storedMetadata.ExpireAt == nil || storedMetadata.ExpireAt.After(now)
+}
+
+// isUpdateLive reports whether the schedule of the update lets it be served now.
+func isUpdateLive(ctx context.Context, update types.Update) bool {
+	storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, update)
+	return err == nil && IsUpdateActive(storedMetadata, time.Now())
+}
+
+func earliest(current *time.Time, candidate *time.Time) *time.Time {
+	if current == nil || (candidate != nil && candidate.Before(*current)) {
+		return candidate
+	}
+	return current
+}
+
+// scheduleTTL caps the default TTL so that a cached answer expires at the next boundary, when an
+// update is activated or expires. It is rounded down, a cache can't hold a value for less than a
+// second so an answer resolved within a second of the boundary may outlive it by this second.
+func scheduleTTL(now time.Time, boundary *time.Time) int {
+	if boundary == nil {
+		return latestUpdateTTL
+	}
+	seconds := int(math.Floor(boundary.Sub(now).Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	if seconds > latestUpdateTTL {
+		return latestUpdateTTL
+	}
+	return seconds
+}
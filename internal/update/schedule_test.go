@@ -0,0 +1,48 @@
+package update
+
+import (
+	"expo-open-ota/internal/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testing2 "testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing2.T) {
+	activateAt, expireAt, err := ParseSchedule("2025-06-01T09:00:00Z", "2025-06-02T09:00:00+02:00")
+	require.NoError(t, err)
+	assert.True(t, activateAt.Equal(time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)))
+	assert.True(t, expireAt.Equal(time.Date(2025, 6, 2, 7, 0, 0, 0, time.UTC)))
+
+	activateAt, expireAt, err = ParseSchedule("", "")
+	require.NoError(t, err)
+	assert.Nil(t, activateAt)
+	assert.Nil(t, expireAt)
+
+	_, _, err = ParseSchedule("tomorrow", "")
+	assert.Error(t, err)
+	_, _, err = ParseSchedule("2025-06-02T09:00:00Z", "2025-06-01T09:00:00Z")
+	assert.Error(t, err, "Expected expireAt before activateAt to be rejected")
+}
+
+func TestIsUpdateActive(t *testing2.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	assert.True(t, IsUpdateActive(nil, now))
+	assert.True(t, IsUpdateActive(&types.UpdateStoredMetadata{}, now))
+	assert.True(t, IsUpdateActive(&types.UpdateStoredMetadata{ActivateAt: &past, ExpireAt: &future}, now))
+	assert.False(t, IsUpdateActive(&types.UpdateStoredMetadata{ActivateAt: &future}, now))
+	assert.False(t, IsUpdateActive(&types.UpdateStoredMetadata{ExpireAt: &past}, now))
+	assert.False(t, IsUpdateActive(&types.UpdateStoredMetadata{ExpireAt: &now}, now), "Expected an update to expire at its expireAt")
+}
+
+func TestScheduleTTL(t *testing2.T) {
+	now := time.Now()
+	soon, later, past := now.Add(90*time.Second+time.Millisecond), now.Add(2*time.Hour), now.Add(-time.Minute)
+	assert.Equal(t, latestUpdateTTL, scheduleTTL(now, nil))
+	assert.Equal(t, 90, scheduleTTL(now, &soon))
+	assert.Equal(t, latestUpdateTTL, scheduleTTL(now, &later))
+	assert.Equal(t, 1, scheduleTTL(now, &past))
+	assert.Equal(t, &soon, earliest(earliest(nil, &later), &soon))
+	assert.Equal(t, &soon, earliest(&soon, nil))
+}
@@ -0,0 +1,55 @@
+package update
+
+import (
+	"context"
+	"expo-open-ota/internal/bucket"
+	"expo-open-ota/internal/symbolication"
+	"expo-open-ota/internal/targeting"
+	"expo-open-ota/internal/types"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// privateFolder holds the files of an update that are never served through /assets.
+const privateFolder = "sourcemaps"
+
+// privateFiles are the files of an update written by the server, which may hold client IDs, the
+// approver or custom metadata not meant for the app.
+var privateFiles = []string{"update-metadata.json", targeting.RulesFileName, AssetIndexFileName, "halted"}
+
+// SourceMapFileName is where the source map of the bundle of a platform is stored in an update.
+func SourceMapFileName(platform string) string {
+	return path.Join(privateFolder, platform+".map")
+}
+
+// IsPrivateFile reports whether an asset name points to a private file of an update.
+func IsPrivateFile(assetName string) bool {
+	cleaned := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(assetName, "\\", "/")), "/")
+	return cleaned == privateFolder || strings.HasPrefix(cleaned, privateFolder+"/") || slices.Contains(privateFiles, cleaned)
+}
+
+// ValidateSourceMaps checks the source maps given on publish, keyed by platform.
+func ValidateSourceMaps(sourceMaps map[string]string) error {
+	for platform, fileName := range sourceMaps {
+		if platform != "ios" && platform != "android" {
+			return fmt.Errorf("invalid source map platform %q", platform)
+		}
+		if fileName == "" {
+			return fmt.Errorf("no source map file name for %s", platform)
+		}
+	}
+	return nil
+}
+
+// GetSourceMap returns the parsed source map stored for a platform of the update, or nil when
+// none was uploaded.
+func GetSourceMap(ctx context.Context, update types.Update, platform string) (*symbolication.SourceMap, error) {
+	file, err := bucket.GetBucket().GetFile(ctx, update, SourceMapFileName(platform))
+	if err != nil || file == nil {
+		return nil, err
+	}
+	defer file.Reader.Close()
+	return symbolication.ParseSourceMap(file.Reader)
+}
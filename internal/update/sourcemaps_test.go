@@ -0,0 +1,26 @@
+package update
+
+import (
+	"github.com/stretchr/testify/assert"
+	testing2 "testing"
+)
+
+func TestIsPrivateFile(t *testing2.T) {
+	assert.True(t, IsPrivateFile(SourceMapFileName("ios")))
+	assert.True(t, IsPrivateFile("/sourcemaps/android.map"))
+	assert.True(t, IsPrivateFile("assets/../sourcemaps/android.map"))
+	assert.True(t, IsPrivateFile("sourcemaps\\ios.map"))
+	assert.False(t, IsPrivateFile("_expo/static/js/ios/index.hbc"))
+	assert.False(t, IsPrivateFile("assets/sourcemaps.png"))
+	assert.True(t, IsPrivateFile("targeting-rules.json"))
+	assert.True(t, IsPrivateFile("./update-metadata.json"))
+	assert.True(t, IsPrivateFile("assets/../asset-index.json"))
+	assert.False(t, IsPrivateFile("metadata.json"))
+}
+
+func TestValidateSourceMaps(t *testing2.T) {
+	assert.NoError(t, ValidateSourceMaps(nil))
+	assert.NoError(t, ValidateSourceMaps(map[string]string{"ios": "_expo/static/js/ios/index.hbc.map"}))
+	assert.Error(t, ValidateSourceMaps(map[string]string{"web": "index.js.map"}))
+	assert.Error(t, ValidateSourceMaps(map[string]string{"android": ""}))
+}
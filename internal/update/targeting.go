@@ -0,0 +1,110 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/targeting"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/version"
+	"fmt"
+	"time"
+)
+
+// targetedUpdate is an update clients excluded from the latest one can fall back to.
+type targetedUpdate struct {
+	Update types.Update     `json:"update"`
+	Rules  *targeting.Rules `json:"rules,omitempty"`
+}
+
+func ComputeTargetedUpdatesCacheKey(branch string, runtimeVersion string, platform string) string {
+	return fmt.Sprintf("targetedUpdates:%s:%s:%s:%s", version.Version, branch, runtimeVersion, platform)
+}
+
+// InvalidateLatestUpdate drops the cached latest update of a platform along with the updates
+// targeted clients are matched against and the known update UUIDs.
+func InvalidateLatestUpdate(ctx context.Context, branch string, runtimeVersion string, platform string) {
+	cache := cache2.GetCache()
+	cache.Delete(ctx, ComputeLastUpdateCacheKey(branch, runtimeVersion, platform))
+	cache.Delete(ctx, ComputeTargetedUpdatesCacheKey(branch, runtimeVersion, platform))
+	cache.Delete(ctx, ComputeUpdateUUIDsCacheKey(branch, runtimeVersion, platform))
+}
+
+// SetUpdateTargetingRules stores the rules of the update and drops the cached updates of its platform.
+func SetUpdateTargetingRules(ctx context.Context, update types.Update, rules *targeting.Rules) error {
+	if err := targeting.SetUpdateRules(ctx, update, rules); err != nil {
+		return err
+	}
+	storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, update)
+	if err != nil {
+		return err
+	}
+	if storedMetadata != nil {
+		InvalidateLatestUpdate(ctx, update.Branch, update.RuntimeVersion, storedMetadata.Platform)
+	}
+	return nil
+}
+
+// getTargetedUpdates returns the servable and live updates of a platform, newest first, with their
+// rules. The list stops at the first update without rules since it is served to every client.
+func getTargetedUpdates(ctx context.Context, branch string, runtimeVersion string, platform string) ([]targetedUpdate, error) {
+	cacheKey := ComputeTargetedUpdatesCacheKey(branch, runtimeVersion, platform)
+	cachedValue := cache2.GetCache().Get(ctx, cacheKey)
+	if cachedValue == "" {
+		var err error
+		cachedValue, err = buildOnce(ctx, cacheKey, func(ctx context.Context) (string, error) {
+			return buildTargetedUpdates(ctx, cacheKey, branch, runtimeVersion, platform)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var targetedUpdates []targetedUpdate
+	if err := json.Unmarshal([]byte(cachedValue), &targetedUpdates); err != nil {
+		return nil, err
+	}
+	return targetedUpdates, nil
+}
+
+// buildTargetedUpdates caches the list until the next scheduled activation or expiration, like the
+// latest update.
+func buildTargetedUpdates(ctx context.Context, cacheKey string, branch string, runtimeVersion string, platform string) (string, error) {
+	updates, err := GetAllUpdatesForRuntimeVersion(ctx, branch, runtimeVersion, platform)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	var nextBoundary *time.Time
+	targetedUpdates := []targetedUpdate{}
+	for _, update := range updates {
+		if !isUpdateServable(ctx, update) {
+			continue
+		}
+		storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, update)
+		if err != nil {
+			return "", err
+		}
+		if !IsUpdateActive(storedMetadata, now) {
+			if storedMetadata.ActivateAt != nil && storedMetadata.ActivateAt.After(now) {
+				nextBoundary = earliest(nextBoundary, storedMetadata.ActivateAt)
+			}
+			continue
+		}
+		nextBoundary = earliest(nextBoundary, storedMetadata.ExpireAt)
+		rules, err := targeting.GetUpdateRules(ctx, update)
+		if err != nil {
+			return "", err
+		}
+		targetedUpdates = append(targetedUpdates, targetedUpdate{Update: update, Rules: rules})
+		if rules == nil {
+			break
+		}
+	}
+	cacheValue, err := json.Marshal(targetedUpdates)
+	if err != nil {
+		return "", err
+	}
+	ttl := scheduleTTL(now, nextBoundary)
+	_ = cache2.GetCache().Set(ctx, cacheKey, string(cacheValue), &ttl)
+	return string(cacheValue), nil
+}
@@ -1,22 +1,30 @@
 package update
 
 import (
+	"context"
 	"encoding/json"
 	"expo-open-ota/config"
+	"expo-open-ota/internal/branch"
 	"expo-open-ota/internal/bucket"
 	cache2 "expo-open-ota/internal/cache"
 	"expo-open-ota/internal/crypto"
 	"expo-open-ota/internal/dashboard"
+	"expo-open-ota/internal/targeting"
+	"expo-open-ota/internal/tracing"
 	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/version"
+	"expo-open-ota/internal/webhooks"
 	"fmt"
-	"mime"
+	"io"
+	"log/slog"
 	"net/url"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func sortUpdates(updates []types.Update) []types.Update {
@@ -26,10 +34,10 @@ func sortUpdates(updates []types.Update) []types.Update {
 	return updates
 }
 
-func filterPlatformUpdates(updates []types.Update, platform string) []types.Update {
+func filterPlatformUpdates(ctx context.Context, updates []types.Update, platform string) []types.Update {
 	filteredUpdates := make([]types.Update, 0)
 	for _, update := range updates {
-		storedMetadata, err := RetrieveUpdateStoredMetadata(update)
+		storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, update)
 		if err == nil && storedMetadata.Platform == platform {
 			filteredUpdates = append(filteredUpdates, update)
 		}
@@ -37,19 +45,19 @@ func filterPlatformUpdates(updates []types.Update, platform string) []types.Upda
 	return filteredUpdates
 }
 
-func GetAllUpdatesForRuntimeVersion(branch string, runtimeVersion string, platform string) ([]types.Update, error) {
+func GetAllUpdatesForRuntimeVersion(ctx context.Context, branch string, runtimeVersion string, platform string) ([]types.Update, error) {
 	resolvedBucket := bucket.GetBucket()
-	updates, errGetUpdates := resolvedBucket.GetUpdates(branch, runtimeVersion)
+	updates, errGetUpdates := resolvedBucket.GetUpdates(ctx, branch, runtimeVersion)
 	if errGetUpdates != nil {
 		return nil, errGetUpdates
 	}
-	updates = sortUpdates(filterPlatformUpdates(updates, platform))
+	updates = sortUpdates(filterPlatformUpdates(ctx, updates, platform))
 	return updates, nil
 }
 
-func StoreUpdateUUIDInMetadata(update types.Update) error {
+func StoreUpdateUUIDInMetadata(ctx context.Context, update types.Update) error {
 	resolvedBucket := bucket.GetBucket()
-	file, err := resolvedBucket.GetFile(update, "update-metadata.json")
+	file, err := resolvedBucket.GetFile(ctx, update, "update-metadata.json")
 	if err != nil {
 		return err
 	}
@@ -59,7 +67,7 @@ func StoreUpdateUUIDInMetadata(update types.Update) error {
 	if err != nil {
 		return err
 	}
-	metadata, err := GetMetadata(update)
+	metadata, err := GetMetadata(ctx, update)
 	if err != nil {
 		return err
 	}
@@ -69,46 +77,197 @@ func StoreUpdateUUIDInMetadata(update types.Update) error {
 		return err
 	}
 	reader := strings.NewReader(string(updatedMetadata))
-	err = resolvedBucket.UploadFileIntoUpdate(update, "update-metadata.json", reader)
+	err = resolvedBucket.UploadFileIntoUpdate(ctx, update, "update-metadata.json", reader)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func MarkUpdateAsChecked(ctx context.Context, update types.Update) error {
+	storedMetadata, err := markUpdateAsChecked(ctx, update)
 	if err != nil {
 		return err
 	}
+	webhooks.Dispatch(computeWebhookPayload(webhooks.UpdatePublished, update, storedMetadata))
 	return nil
 }
 
-func MarkUpdateAsChecked(update types.Update) error {
+func computeWebhookPayload(event webhooks.EventType, update types.Update, storedMetadata *types.UpdateStoredMetadata) webhooks.Payload {
+	payload := webhooks.Payload{
+		Event:          event,
+		Branch:         update.Branch,
+		RuntimeVersion: update.RuntimeVersion,
+		UpdateId:       update.UpdateId,
+	}
+	if storedMetadata != nil {
+		payload.UpdateUUID = storedMetadata.UpdateUUID
+		payload.Platform = storedMetadata.Platform
+		payload.CommitHash = storedMetadata.CommitHash
+		if storedMetadata.PromotedFrom != nil {
+			payload.SourceBranch = storedMetadata.PromotedFrom.Branch
+			payload.SourceUpdateId = storedMetadata.PromotedFrom.UpdateId
+		}
+		if storedMetadata.Group != nil {
+			payload.GroupId = storedMetadata.Group.Id
+		}
+	}
+	return payload
+}
+
+func markUpdateAsChecked(ctx context.Context, update types.Update) (*types.UpdateStoredMetadata, error) {
 	cache := cache2.GetCache()
 	branchesCacheKey := dashboard.ComputeGetBranchesCacheKey()
 	runTimeVersionsCacheKey := dashboard.ComputeGetRuntimeVersionsCacheKey(update.Branch)
 	updatesCacheKey := dashboard.ComputeGetUpdatesCacheKey(update.Branch, update.RuntimeVersion)
-	storedMetadata, err := RetrieveUpdateStoredMetadata(update)
+	storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, update)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	cacheKeys := []string{ComputeLastUpdateCacheKey(update.Branch, update.RuntimeVersion, storedMetadata.Platform), branchesCacheKey, runTimeVersionsCacheKey, updatesCacheKey}
+	InvalidateLatestUpdate(ctx, update.Branch, update.RuntimeVersion, storedMetadata.Platform)
+	cacheKeys := []string{branchesCacheKey, runTimeVersionsCacheKey, updatesCacheKey}
 	for _, cacheKey := range cacheKeys {
-		cache.Delete(cacheKey)
+		cache.Delete(ctx, cacheKey)
 	}
 	resolvedBucket := bucket.GetBucket()
-	err = StoreUpdateUUIDInMetadata(update)
+	err = StoreUpdateUUIDInMetadata(ctx, update)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	reader := strings.NewReader(".check")
-	_ = resolvedBucket.UploadFileIntoUpdate(update, ".check", reader)
-	return nil
+	_ = resolvedBucket.UploadFileIntoUpdate(ctx, update, ".check", reader)
+	storedMetadata, err = RetrieveUpdateStoredMetadata(ctx, update)
+	if err != nil {
+		return nil, err
+	}
+	if storedMetadata.Group != nil {
+		invalidateGroupCaches(ctx, update.Branch, storedMetadata.Group)
+	}
+	PrewarmUpdate(ctx, update, storedMetadata.Platform)
+	return storedMetadata, nil
 }
 
-func IsUpdateValid(Update types.Update) bool {
+func IsUpdateValid(ctx context.Context, Update types.Update) bool {
 	resolvedBucket := bucket.GetBucket()
 	// Search for .check file in the update
-	file, _ := resolvedBucket.GetFile(Update, ".check")
+	file, _ := resolvedBucket.GetFile(ctx, Update, ".check")
 	if file != nil {
 		return true
 	}
 	return false
 }
 
+// IsUpdateHalted reports whether the update was halted. HaltUpdate overwrites the cached value.
+func IsUpdateHalted(ctx context.Context, update types.Update) bool {
+	cache := cache2.GetCache()
+	cacheKey := ComputeHaltedCacheKey(update)
+	if cachedValue := cache.Get(ctx, cacheKey); cachedValue != "" {
+		return cachedValue == "true"
+	}
+	resolvedBucket := bucket.GetBucket()
+	file, err := resolvedBucket.GetFile(ctx, update, "halted")
+	if err != nil {
+		return false
+	}
+	halted := file != nil
+	if halted {
+		file.Reader.Close()
+	}
+	_ = cache.Set(ctx, cacheKey, strconv.FormatBool(halted), nil)
+	return halted
+}
+
+// HaltUpdate stops serving the update so clients fall back to the previous valid one.
+func HaltUpdate(ctx context.Context, update types.Update, platform string, reason string) error {
+	resolvedBucket := bucket.GetBucket()
+	err := resolvedBucket.UploadFileIntoUpdate(ctx, update, "halted", strings.NewReader(reason))
+	if err != nil {
+		return err
+	}
+	cache := cache2.GetCache()
+	_ = cache.Set(ctx, ComputeHaltedCacheKey(update), "true", nil)
+	InvalidateLatestUpdate(ctx, update.Branch, update.RuntimeVersion, platform)
+	cache.Delete(ctx, dashboard.ComputeGetUpdatesCacheKey(update.Branch, update.RuntimeVersion))
+	return nil
+}
+
+// rollbackHaltReasonPrefix starts the halt reason of updates halted by a rollback to a previous
+// update, followed by the ID of that update.
+const rollbackHaltReasonPrefix = "rolled back to update "
+
+// Reasons why an update is the one served for its platform.
+const (
+	ServedReasonLatest   = "latest"
+	ServedReasonRollback = "rollback"
+	// ServedReasonFallback means newer updates were halted, by the crash guard for instance.
+	ServedReasonFallback = "fallback"
+)
+
+// GetHaltReason returns why the update was halted, and whether it is.
+func GetHaltReason(ctx context.Context, update types.Update) (string, bool) {
+	file, _ := bucket.GetBucket().GetFile(ctx, update, "halted")
+	if file == nil {
+		return "", false
+	}
+	defer file.Reader.Close()
+	reason, _ := io.ReadAll(file.Reader)
+	return string(reason), true
+}
+
+// RollbackToUpdate serves a previous update again by halting every newer update of its platform,
+// nothing is uploaded. The next published update is served as usual. It returns the halted updates.
+func RollbackToUpdate(ctx context.Context, target types.Update, platform string) ([]types.Update, error) {
+	if !IsUpdateValid(ctx, target) || GetUpdateType(ctx, target) != types.NormalUpdate {
+		return nil, fmt.Errorf("update %s can't be rolled back to", target.UpdateId)
+	}
+	if IsUpdateHalted(ctx, target) {
+		return nil, fmt.Errorf("update %s is halted", target.UpdateId)
+	}
+	updates, err := GetAllUpdatesForRuntimeVersion(ctx, target.Branch, target.RuntimeVersion, platform)
+	if err != nil {
+		return nil, err
+	}
+	halted := make([]types.Update, 0)
+	for _, update := range updates {
+		if update.CreatedAt <= target.CreatedAt || !IsUpdateValid(ctx, update) || IsUpdateHalted(ctx, update) {
+			continue
+		}
+		if err := HaltUpdate(ctx, update, platform, rollbackHaltReasonPrefix+target.UpdateId); err != nil {
+			return halted, err
+		}
+		halted = append(halted, update)
+	}
+	storedMetadata, _ := RetrieveUpdateStoredMetadata(ctx, target)
+	webhooks.Dispatch(computeWebhookPayload(webhooks.UpdateRolledBack, target, storedMetadata))
+	return halted, nil
+}
+
+// GetServedUpdate returns the update served for the platform and why, or nil when none is.
+func GetServedUpdate(ctx context.Context, branch string, runtimeVersion string, platform string) (*types.Update, string, error) {
+	served, err := GetLatestUpdateBundlePathForRuntimeVersion(ctx, branch, runtimeVersion, platform)
+	if err != nil || served == nil {
+		return nil, "", err
+	}
+	updates, err := GetAllUpdatesForRuntimeVersion(ctx, branch, runtimeVersion, platform)
+	if err != nil {
+		return nil, "", err
+	}
+	// Updates are sorted from the newest, the closest newer one tells why the served one is not the latest.
+	var closestNewer *types.Update
+	for i := range updates {
+		if updates[i].CreatedAt > served.CreatedAt && IsUpdateValid(ctx, updates[i]) && IsUpdateGroupComplete(ctx, updates[i]) && isUpdateLive(ctx, updates[i]) {
+			closestNewer = &updates[i]
+		}
+	}
+	if closestNewer == nil {
+		return served, ServedReasonLatest, nil
+	}
+	if reason, halted := GetHaltReason(ctx, *closestNewer); halted && reason == rollbackHaltReasonPrefix+served.UpdateId {
+		return served, ServedReasonRollback, nil
+	}
+	return served, ServedReasonFallback, nil
+}
+
 func ComputeLastUpdateCacheKey(branch string, runtimeVersion string, platform string) string {
 	return fmt.Sprintf("lastUpdate:%s:%s:%s:%s", version.Version, branch, runtimeVersion, platform)
 }
@@ -121,40 +280,37 @@ func ComputeUpdataManifestCacheKey(branch string, runtimeVersion string, updateI
 	return fmt.Sprintf("manifest:%s:%s:%s:%s:%s", version.Version, branch, runtimeVersion, updateId, platform)
 }
 
+func ComputeUpdateTypeCacheKey(update types.Update) string {
+	return fmt.Sprintf("updateType:%s:%s:%s:%s", version.Version, update.Branch, update.RuntimeVersion, update.UpdateId)
+}
+
+func ComputeHaltedCacheKey(update types.Update) string {
+	return fmt.Sprintf("halted:%s:%s:%s:%s", version.Version, update.Branch, update.RuntimeVersion, update.UpdateId)
+}
+
 func ComputeManifestAssetCacheKey(update types.Update, assetPath string) string {
 	return fmt.Sprintf("asset:%s:%s:%s:%s:%s", version.Version, update.Branch, update.RuntimeVersion, update.UpdateId, assetPath)
 }
 
-func VerifyUploadedUpdate(update types.Update) error {
-	metadata, errMetadata := GetMetadata(update)
+// VerifyUploadedUpdate checks every file referenced by the metadata was uploaded, matches the hash
+// declared by the client if any, and stores the resulting asset index next to the update.
+func VerifyUploadedUpdate(ctx context.Context, update types.Update) error {
+	metadata, errMetadata := GetMetadata(ctx, update)
 	if errMetadata != nil {
 		return errMetadata
 	}
 	if metadata.MetadataJSON.FileMetadata.IOS.Bundle == "" && metadata.MetadataJSON.FileMetadata.Android.Bundle == "" {
 		return fmt.Errorf("missing bundle path in metadata")
 	}
-	files := []string{}
-	if metadata.MetadataJSON.FileMetadata.IOS.Bundle != "" {
-		files = append(files, metadata.MetadataJSON.FileMetadata.IOS.Bundle)
-		for _, asset := range metadata.MetadataJSON.FileMetadata.IOS.Assets {
-			files = append(files, asset.Path)
-		}
-	}
-	if metadata.MetadataJSON.FileMetadata.Android.Bundle != "" {
-		files = append(files, metadata.MetadataJSON.FileMetadata.Android.Bundle)
-		for _, asset := range metadata.MetadataJSON.FileMetadata.Android.Assets {
-			files = append(files, asset.Path)
-		}
+	var declaredHashes map[string]string
+	if storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, update); err == nil && storedMetadata != nil {
+		declaredHashes = storedMetadata.FileHashes
 	}
-
-	resolvedBucket := bucket.GetBucket()
-	for _, file := range files {
-		_, err := resolvedBucket.GetFile(update, file)
-		if err != nil {
-			return fmt.Errorf("missing file: %s in update", file)
-		}
+	index, err := BuildAssetIndex(ctx, update, metadata, declaredHashes)
+	if err != nil {
+		return err
 	}
-	return nil
+	return storeAssetIndex(ctx, update, index)
 }
 
 func GetUpdate(branch string, runtimeVersion string, updateId string) (*types.Update, error) {
@@ -170,63 +326,144 @@ func GetUpdate(branch string, runtimeVersion string, updateId string) (*types.Up
 	}, nil
 }
 
-func AreUpdatesIdentical(update1, update2 types.Update) (bool, error) {
-	metadata1, errMetadata1 := GetMetadata(update1)
+func AreUpdatesIdentical(ctx context.Context, update1, update2 types.Update) (bool, error) {
+	metadata1, errMetadata1 := GetMetadata(ctx, update1)
 	if errMetadata1 != nil {
 		return false, errMetadata1
 	}
-	metadata2, errMetadata2 := GetMetadata(update2)
+	metadata2, errMetadata2 := GetMetadata(ctx, update2)
 	if errMetadata2 != nil {
 		return false, errMetadata2
 	}
 	return metadata1.Fingerprint == metadata2.Fingerprint, nil
 }
 
-func GetLatestUpdateBundlePathForRuntimeVersion(branch string, runtimeVersion string, platform string) (*types.Update, error) {
+func GetLatestUpdateBundlePathForRuntimeVersion(ctx context.Context, branch string, runtimeVersion string, platform string) (latestUpdate *types.Update, err error) {
+	ctx, span := tracing.StartSpan(ctx, "update.GetLatestUpdateBundlePathForRuntimeVersion",
+		attribute.String("expo.branch", branch),
+		attribute.String("expo.runtime_version", runtimeVersion),
+		attribute.String("expo.platform", platform),
+	)
+	defer func() { tracing.EndSpan(span, err) }()
 	cache := cache2.GetCache()
 	cacheKey := fmt.Sprintf(ComputeLastUpdateCacheKey(branch, runtimeVersion, platform))
-	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
-		var update types.Update
-		err := json.Unmarshal([]byte(cachedValue), &update)
+	cachedValue := cache.Get(ctx, cacheKey)
+	if cachedValue == "" {
+		cachedValue, err = buildOnce(ctx, cacheKey, func(ctx context.Context) (string, error) {
+			return buildLatestUpdate(ctx, cacheKey, branch, runtimeVersion, platform)
+		})
 		if err != nil {
 			return nil, err
 		}
-		return &update, nil
 	}
-	updates, err := GetAllUpdatesForRuntimeVersion(branch, runtimeVersion, platform)
+	if cachedValue == "" {
+		return nil, nil
+	}
+	var update types.Update
+	err = json.Unmarshal([]byte(cachedValue), &update)
 	if err != nil {
 		return nil, err
 	}
-	filteredUpdates := make([]types.Update, 0)
-	for _, update := range updates {
-		if IsUpdateValid(update) {
-			filteredUpdates = append(filteredUpdates, update)
+	return &update, nil
+}
+
+// GetLatestUpdateForClient returns the latest update of the branch the client is targeted by, or
+// nil when the branch rules exclude it. Updates whose rules exclude the client are skipped.
+func GetLatestUpdateForClient(ctx context.Context, branch string, runtimeVersion string, platform string, client targeting.Client) (*types.Update, error) {
+	branchRules, err := targeting.GetBranchRules(ctx, branch)
+	if err != nil {
+		return nil, err
+	}
+	if !branchRules.Matches(client) {
+		return nil, nil
+	}
+	latestUpdate, err := GetLatestUpdateBundlePathForRuntimeVersion(ctx, branch, runtimeVersion, platform)
+	if err != nil || latestUpdate == nil {
+		return latestUpdate, err
+	}
+	rules, err := targeting.GetUpdateRules(ctx, *latestUpdate)
+	if err != nil {
+		return nil, err
+	}
+	if rules.Matches(client) {
+		return latestUpdate, nil
+	}
+	targetedUpdates, err := getTargetedUpdates(ctx, branch, runtimeVersion, platform)
+	if err != nil {
+		return nil, err
+	}
+	for _, targetedUpdate := range targetedUpdates {
+		if targetedUpdate.Update.UpdateId != latestUpdate.UpdateId && targetedUpdate.Rules.Matches(client) {
+			return &targetedUpdate.Update, nil
 		}
 	}
-	if len(filteredUpdates) > 0 {
-		cacheValue, err := json.Marshal(filteredUpdates[0])
+	return nil, nil
+}
+
+// buildLatestUpdate resolves the latest valid and active update from the bucket and caches it, an
+// empty value means no update is available. The cached value expires when a newer scheduled update
+// is activated or the resolved one expires.
+func buildLatestUpdate(ctx context.Context, cacheKey string, branch string, runtimeVersion string, platform string) (string, error) {
+	updates, err := GetAllUpdatesForRuntimeVersion(ctx, branch, runtimeVersion, platform)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	var nextBoundary *time.Time
+	for _, update := range updates {
+		if !isUpdateServable(ctx, update) {
+			continue
+		}
+		storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, update)
 		if err != nil {
-			return &filteredUpdates[0], nil
+			return "", err
+		}
+		if !IsUpdateActive(storedMetadata, now) {
+			if storedMetadata.ActivateAt != nil && storedMetadata.ActivateAt.After(now) {
+				nextBoundary = earliest(nextBoundary, storedMetadata.ActivateAt)
+			}
+			continue
 		}
-		ttl := 1800
-		err = cache.Set(cacheKey, string(cacheValue), &ttl)
-		return &filteredUpdates[0], nil
+		nextBoundary = earliest(nextBoundary, storedMetadata.ExpireAt)
+		cacheValue, err := json.Marshal(update)
+		if err != nil {
+			return "", err
+		}
+		ttl := scheduleTTL(now, nextBoundary)
+		_ = cache2.GetCache().Set(ctx, cacheKey, string(cacheValue), &ttl)
+		return string(cacheValue), nil
 	}
-	return nil, nil
+	return "", nil
 }
 
-func GetUpdateType(update types.Update) types.UpdateType {
+// GetUpdateType tells rollbacks from normal updates. An update never changes type, so the result
+// is cached without expiration.
+func GetUpdateType(ctx context.Context, update types.Update) types.UpdateType {
+	cache := cache2.GetCache()
+	cacheKey := ComputeUpdateTypeCacheKey(update)
+	if cachedValue := cache.Get(ctx, cacheKey); cachedValue != "" {
+		if cachedValue == "rollback" {
+			return types.Rollback
+		}
+		return types.NormalUpdate
+	}
 	resolvedBucket := bucket.GetBucket()
-	file, _ := resolvedBucket.GetFile(update, "rollback")
+	file, err := resolvedBucket.GetFile(ctx, update, "rollback")
+	if err != nil {
+		return types.NormalUpdate
+	}
+	updateType, cachedValue := types.NormalUpdate, "normal"
 	if file != nil {
-		return types.Rollback
+		file.Reader.Close()
+		updateType, cachedValue = types.Rollback, "rollback"
 	}
-	return types.NormalUpdate
+	_ = cache.Set(ctx, cacheKey, cachedValue, nil)
+	return updateType
 }
 
-func GetExpoConfig(update types.Update) (json.RawMessage, error) {
+func GetExpoConfig(ctx context.Context, update types.Update) (json.RawMessage, error) {
 	resolvedBucket := bucket.GetBucket()
-	resp, err := resolvedBucket.GetFile(update, "expoConfig.json")
+	resp, err := resolvedBucket.GetFile(ctx, update, "expoConfig.json")
 	if err != nil {
 		return nil, err
 	}
@@ -243,10 +480,10 @@ func GetExpoConfig(update types.Update) (json.RawMessage, error) {
 	return expoConfig, nil
 }
 
-func GetMetadata(update types.Update) (types.UpdateMetadata, error) {
+func GetMetadata(ctx context.Context, update types.Update) (types.UpdateMetadata, error) {
 	metadataCacheKey := ComputeMetadataCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId)
 	cache := cache2.GetCache()
-	if cachedValue := cache.Get(metadataCacheKey); cachedValue != "" {
+	if cachedValue := cache.Get(ctx, metadataCacheKey); cachedValue != "" {
 		var metadata types.UpdateMetadata
 		err := json.Unmarshal([]byte(cachedValue), &metadata)
 		if err != nil {
@@ -255,7 +492,7 @@ func GetMetadata(update types.Update) (types.UpdateMetadata, error) {
 		return metadata, nil
 	}
 	resolvedBucket := bucket.GetBucket()
-	file, errFile := resolvedBucket.GetFile(update, "metadata.json")
+	file, errFile := resolvedBucket.GetFile(ctx, update, "metadata.json")
 	if errFile != nil || file == nil {
 		return types.UpdateMetadata{}, errFile
 	}
@@ -265,7 +502,7 @@ func GetMetadata(update types.Update) (types.UpdateMetadata, error) {
 	err := json.NewDecoder(file.Reader).Decode(&metadataJson)
 	defer file.Reader.Close()
 	if err != nil {
-		fmt.Println("error decoding metadata json:", err)
+		slog.ErrorContext(ctx, "Error decoding metadata json", "branch", update.Branch, "runtimeVersion", update.RuntimeVersion, "updateId", update.UpdateId, "error", err)
 		return types.UpdateMetadata{}, err
 	}
 
@@ -292,7 +529,7 @@ func GetMetadata(update types.Update) (types.UpdateMetadata, error) {
 	if err != nil {
 		return metadata, nil
 	}
-	err = cache.Set(metadataCacheKey, string(cacheValue), nil)
+	err = cache.Set(ctx, metadataCacheKey, string(cacheValue), nil)
 	return metadata, nil
 }
 
@@ -315,37 +552,18 @@ func GetAssetEndpoint() string {
 	return config.GetEnv("BASE_URL") + "/assets"
 }
 
-func shapeManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset bool, platform string) (types.ManifestAsset, error) {
-	cacheKey := ComputeManifestAssetCacheKey(update, asset.Path)
-	cache := cache2.GetCache()
-	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
-		var manifestAsset types.ManifestAsset
-		err := json.Unmarshal([]byte(cachedValue), &manifestAsset)
+func shapeManifestAsset(ctx context.Context, update types.Update, index *types.AssetIndex, asset *types.Asset, isLaunchAsset bool, platform string) (types.ManifestAsset, error) {
+	entry, indexed := types.AssetIndexEntry{}, false
+	if index != nil {
+		entry, indexed = index.Assets[asset.Path]
+	}
+	if !indexed {
+		// Updates uploaded before asset indexes existed are hashed on the fly.
+		computed, err := indexFile(ctx, update, indexedFile{path: asset.Path, isLaunchAsset: isLaunchAsset, ext: asset.Ext}, "")
 		if err != nil {
 			return types.ManifestAsset{}, err
 		}
-		return manifestAsset, nil
-	}
-	resolvedBucket := bucket.GetBucket()
-	assetFilePath := asset.Path
-	assetFile, errAssetFile := resolvedBucket.GetFile(update, asset.Path)
-	if errAssetFile != nil {
-		return types.ManifestAsset{}, errAssetFile
-	}
-
-	byteAsset, errAsset := bucket.ConvertReadCloserToBytes(assetFile.Reader)
-	defer assetFile.Reader.Close()
-	if errAsset != nil {
-		return types.ManifestAsset{}, errAsset
-	}
-	assetHash, errHash := crypto.CreateHash(byteAsset, "sha256", "base64")
-	if errHash != nil {
-		return types.ManifestAsset{}, errHash
-	}
-	urlEncodedHash := crypto.GetBase64URLEncoding(assetHash)
-	key, errKey := crypto.CreateHash(byteAsset, "md5", "hex")
-	if errKey != nil {
-		return types.ManifestAsset{}, errKey
+		entry = computed
 	}
 
 	keyExtensionSuffix := asset.Ext
@@ -353,27 +571,81 @@ func shapeManifestAsset(update types.Update, asset *types.Asset, isLaunchAsset b
 		keyExtensionSuffix = "bundle"
 	}
 	keyExtensionSuffix = "." + keyExtensionSuffix
-	contentType := "application/javascript"
-	if isLaunchAsset {
-		contentType = mime.TypeByExtension(asset.Ext)
-	}
-	finalUrl, errUrl := BuildFinalManifestAssetUrlURL(GetAssetEndpoint(), assetFilePath, update.RuntimeVersion, platform, update.Branch)
+	finalUrl, errUrl := BuildFinalManifestAssetUrlURL(GetAssetEndpoint(), asset.Path, update.RuntimeVersion, platform, update.Branch)
 	if errUrl != nil {
 		return types.ManifestAsset{}, errUrl
 	}
-	manifestAsset := types.ManifestAsset{
-		Hash:          urlEncodedHash,
-		Key:           key,
+	return types.ManifestAsset{
+		Hash:          entry.Hash,
+		Key:           entry.Key,
 		FileExtension: keyExtensionSuffix,
-		ContentType:   contentType,
+		ContentType:   entry.ContentType,
 		Url:           finalUrl,
+	}, nil
+}
+
+// shapeManifestAssets reads the cached shape of every asset and of the launch asset in a single
+// round trip, then shapes the missing ones and caches them in a single write.
+func shapeManifestAssets(ctx context.Context, update types.Update, platformMetadata types.PlatformMetadata, platform string) ([]types.ManifestAsset, types.ManifestAsset, error) {
+	toShape := make([]types.Asset, 0, len(platformMetadata.Assets)+1)
+	toShape = append(toShape, platformMetadata.Assets...)
+	toShape = append(toShape, types.Asset{Path: platformMetadata.Bundle, Ext: ""})
+	launchAssetIndex := len(toShape) - 1
+
+	cacheKeys := make([]string, len(toShape))
+	for i, asset := range toShape {
+		cacheKeys[i] = ComputeManifestAssetCacheKey(update, asset.Path)
 	}
-	cacheValue, err := json.Marshal(manifestAsset)
-	if err != nil {
-		return manifestAsset, nil
+	cache := cache2.GetCache()
+	cachedValues := cache.MGet(ctx, cacheKeys)
+
+	var (
+		shaped     = make([]types.ManifestAsset, len(toShape))
+		toCache    = make(map[string]string)
+		assetIndex *types.AssetIndex
+		mu         sync.Mutex
+		errs       = make(chan error, len(toShape))
+		wg         sync.WaitGroup
+	)
+	// The index is read once, before the goroutines start, as only uncached assets need it.
+	for _, cachedValue := range cachedValues {
+		if cachedValue == "" {
+			assetIndex = GetAssetIndex(ctx, update)
+			break
+		}
+	}
+	for i, asset := range toShape {
+		if cachedValues[i] != "" {
+			if err := json.Unmarshal([]byte(cachedValues[i]), &shaped[i]); err != nil {
+				return nil, types.ManifestAsset{}, err
+			}
+			continue
+		}
+		wg.Add(1)
+		go func(index int, asset types.Asset, assetIndex *types.AssetIndex) {
+			defer wg.Done()
+			shapedAsset, errShape := shapeManifestAsset(ctx, update, assetIndex, &asset, index == launchAssetIndex, platform)
+			if errShape != nil {
+				errs <- errShape
+				return
+			}
+			shaped[index] = shapedAsset
+			if cacheValue, err := json.Marshal(shapedAsset); err == nil {
+				mu.Lock()
+				toCache[cacheKeys[index]] = string(cacheValue)
+				mu.Unlock()
+			}
+		}(i, asset, assetIndex)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	if len(errs) > 0 {
+		return nil, types.ManifestAsset{}, <-errs
 	}
-	_ = cache.Set(cacheKey, string(cacheValue), nil)
-	return manifestAsset, nil
+	_ = cache.MSet(ctx, toCache, nil)
+	return shaped[:launchAssetIndex], shaped[launchAssetIndex], nil
 }
 
 func appendChannelOverrideToUrl(urlStr string) string {
@@ -386,10 +658,9 @@ func appendChannelOverrideToUrl(urlStr string) string {
 	return parsedUrl.String()
 }
 
-func computeManifestMetadata(update types.Update) json.RawMessage {
-	metadataMap := map[string]string{
-		"branch": update.Branch,
-	}
+func computeManifestMetadata(update types.Update, storedMetadata *types.UpdateStoredMetadata) json.RawMessage {
+	metadataMap := manifestFieldValues(storedMetadata)
+	metadataMap["branch"] = update.Branch
 
 	metadataBytes, err := json.Marshal(metadataMap)
 	if err != nil {
@@ -399,25 +670,43 @@ func computeManifestMetadata(update types.Update) json.RawMessage {
 }
 
 func ComposeUpdateManifest(
+	ctx context.Context,
 	metadata *types.UpdateMetadata,
 	update types.Update,
 	platform string,
-) (types.UpdateManifest, error) {
+) (manifest types.UpdateManifest, err error) {
+	ctx, span := tracing.StartSpan(ctx, "update.ComposeUpdateManifest",
+		attribute.String("expo.branch", update.Branch),
+		attribute.String("expo.runtime_version", update.RuntimeVersion),
+		attribute.String("expo.update_id", update.UpdateId),
+		attribute.String("expo.platform", platform),
+	)
+	defer func() { tracing.EndSpan(span, err) }()
 	cache := cache2.GetCache()
 	cacheKey := ComputeUpdataManifestCacheKey(update.Branch, update.RuntimeVersion, update.UpdateId, platform)
-	if cachedValue := cache.Get(cacheKey); cachedValue != "" {
-		var manifest types.UpdateManifest
-		err := json.Unmarshal([]byte(cachedValue), &manifest)
+	cachedValue := cache.Get(ctx, cacheKey)
+	if cachedValue == "" {
+		cachedValue, err = buildOnce(ctx, cacheKey, func(ctx context.Context) (string, error) {
+			return buildUpdateManifest(ctx, cacheKey, metadata, update, platform)
+		})
 		if err != nil {
 			return types.UpdateManifest{}, err
 		}
-		return manifest, nil
 	}
-	expoConfig, errConfig := GetExpoConfig(update)
+	err = json.Unmarshal([]byte(cachedValue), &manifest)
+	if err != nil {
+		return types.UpdateManifest{}, err
+	}
+	return manifest, nil
+}
+
+// buildUpdateManifest shapes every asset of the update into a manifest and caches it.
+func buildUpdateManifest(ctx context.Context, cacheKey string, metadata *types.UpdateMetadata, update types.Update, platform string) (string, error) {
+	expoConfig, errConfig := GetExpoConfig(ctx, update)
 	if errConfig != nil {
-		return types.UpdateManifest{}, errConfig
+		return "", errConfig
 	}
-	storedMetadata, _ := RetrieveUpdateStoredMetadata(update)
+	storedMetadata, _ := RetrieveUpdateStoredMetadata(ctx, update)
 	if storedMetadata == nil || storedMetadata.UpdateUUID == "" {
 		storedMetadata = &types.UpdateStoredMetadata{
 			Platform:   platform,
@@ -425,6 +714,14 @@ func ComposeUpdateManifest(
 			UpdateUUID: crypto.ConvertSHA256HashToUUID(metadata.ID),
 		}
 	}
+	if persisted, ok := loadPersistedManifest(ctx, update, platform, storedMetadata.UpdateUUID); ok {
+		cacheValue, err := json.Marshal(persisted)
+		if err != nil {
+			return "", err
+		}
+		_ = cache2.GetCache().Set(ctx, cacheKey, string(cacheValue), nil)
+		return string(cacheValue), nil
+	}
 
 	var platformSpecificMetadata types.PlatformMetadata
 	switch platform {
@@ -434,47 +731,18 @@ func ComposeUpdateManifest(
 		platformSpecificMetadata = metadata.MetadataJSON.FileMetadata.Android
 	}
 	if platformSpecificMetadata.Bundle == "" {
-		return types.UpdateManifest{}, fmt.Errorf("platform %s not supported", platform)
-	}
-	var (
-		assets = make([]types.ManifestAsset, len(platformSpecificMetadata.Assets))
-		errs   = make(chan error, len(platformSpecificMetadata.Assets))
-		wg     sync.WaitGroup
-	)
-
-	for i, a := range platformSpecificMetadata.Assets {
-		wg.Add(1)
-		go func(index int, asset types.Asset) {
-			defer wg.Done()
-			shapedAsset, errShape := shapeManifestAsset(update, &asset, false, platform)
-			if errShape != nil {
-				errs <- errShape
-				return
-			}
-			assets[index] = shapedAsset
-		}(i, a)
-	}
-
-	wg.Wait()
-	close(errs)
-
-	if len(errs) > 0 {
-		return types.UpdateManifest{}, <-errs
+		return "", fmt.Errorf("platform %s not supported", platform)
 	}
-
-	launchAsset, errShape := shapeManifestAsset(update, &types.Asset{
-		Path: platformSpecificMetadata.Bundle,
-		Ext:  "",
-	}, true, platform)
+	assets, launchAsset, errShape := shapeManifestAssets(ctx, update, platformSpecificMetadata, platform)
 	if errShape != nil {
-		return types.UpdateManifest{}, errShape
+		return "", errShape
 	}
 
 	manifest := types.UpdateManifest{
 		Id:             storedMetadata.UpdateUUID,
 		CreatedAt:      metadata.CreatedAt,
 		RunTimeVersion: update.RuntimeVersion,
-		Metadata:       computeManifestMetadata(update),
+		Metadata:       computeManifestMetadata(update, storedMetadata),
 		Extra: types.ExtraManifestData{
 			ExpoClient: expoConfig,
 			Branch:     update.Branch,
@@ -484,16 +752,16 @@ func ComposeUpdateManifest(
 	}
 	cacheValue, err := json.Marshal(manifest)
 	if err != nil {
-		return manifest, nil
+		return "", err
 	}
-	_ = cache.Set(cacheKey, string(cacheValue), nil)
+	_ = cache2.GetCache().Set(ctx, cacheKey, string(cacheValue), nil)
 
-	return manifest, nil
+	return string(cacheValue), nil
 }
 
-func CreateRollbackDirective(update types.Update) (types.RollbackDirective, error) {
+func CreateRollbackDirective(ctx context.Context, update types.Update) (types.RollbackDirective, error) {
 	resolvedBucket := bucket.GetBucket()
-	object, err := resolvedBucket.GetFile(update, "rollback")
+	object, err := resolvedBucket.GetFile(ctx, update, "rollback")
 	if err != nil {
 		return types.RollbackDirective{}, err
 	}
@@ -513,9 +781,9 @@ func CreateNoUpdateAvailableDirective() types.NoUpdateAvailableDirective {
 	}
 }
 
-func RetrieveUpdateStoredMetadata(update types.Update) (*types.UpdateStoredMetadata, error) {
+func RetrieveUpdateStoredMetadata(ctx context.Context, update types.Update) (*types.UpdateStoredMetadata, error) {
 	resolvedBucket := bucket.GetBucket()
-	file, err := resolvedBucket.GetFile(update, "update-metadata.json")
+	file, err := resolvedBucket.GetFile(ctx, update, "update-metadata.json")
 	if err != nil {
 		return nil, err
 	}
@@ -553,7 +821,7 @@ func ConvertUpdateTimestampToString(updateId int64) string {
 	return fmt.Sprintf("%d", updateId)
 }
 
-func CreateRollback(platform, commitHash, runtimeVersion, branchName string) (*types.Update, error) {
+func CreateRollback(ctx context.Context, platform, commitHash, runtimeVersion, branchName string) (*types.Update, error) {
 	updateId := GenerateUpdateTimestamp()
 	update := types.Update{
 		UpdateId:       ConvertUpdateTimestampToString(updateId),
@@ -566,52 +834,114 @@ func CreateRollback(platform, commitHash, runtimeVersion, branchName string) (*t
 	if err != nil {
 		return nil, err
 	}
-	err = resolvedBucket.UploadFileIntoUpdate(update, "update-metadata.json", reader)
+	err = resolvedBucket.UploadFileIntoUpdate(ctx, update, "update-metadata.json", reader)
 	if err != nil {
 		return nil, err
 	}
 	emptyReader := strings.NewReader("")
-	err = resolvedBucket.UploadFileIntoUpdate(update, "rollback", emptyReader)
+	err = resolvedBucket.UploadFileIntoUpdate(ctx, update, "rollback", emptyReader)
 	if err != nil {
 		return nil, err
 	}
-	err = StoreUpdateUUIDInMetadata(update)
+	_ = cache2.GetCache().Set(ctx, ComputeUpdateTypeCacheKey(update), "rollback", nil)
+	err = StoreUpdateUUIDInMetadata(ctx, update)
 	if err != nil {
 		return nil, err
 	}
-	err = MarkUpdateAsChecked(update)
+	storedMetadata, err := markUpdateAsChecked(ctx, update)
 	if err != nil {
 		return nil, err
 	}
+	webhooks.Dispatch(computeWebhookPayload(webhooks.UpdateRolledBack, update, storedMetadata))
 
 	return &update, nil
 }
 
-func RepublishUpdate(previousUpdate *types.Update, platform, commitHash string) (*types.Update, error) {
+func RepublishUpdate(ctx context.Context, previousUpdate *types.Update, platform, commitHash string) (*types.Update, error) {
 	resolvedBucket := bucket.GetBucket()
 	updateId := GenerateUpdateTimestamp()
-	newUpdate, err := resolvedBucket.CreateUpdateFrom(previousUpdate, ConvertUpdateTimestampToString(updateId))
+	previousMetadata, err := RetrieveUpdateStoredMetadata(ctx, *previousUpdate)
 	if err != nil {
 		return nil, err
 	}
-	reader, err := createUpdateMetadata(platform, commitHash)
+	newUpdate, err := resolvedBucket.CreateUpdateFrom(ctx, previousUpdate, previousUpdate.Branch, ConvertUpdateTimestampToString(updateId))
 	if err != nil {
 		return nil, err
 	}
-	err = resolvedBucket.UploadFileIntoUpdate(*newUpdate, "update-metadata.json", reader)
+	republishedMetadata := types.UpdateStoredMetadata{
+		Platform:   platform,
+		CommitHash: commitHash,
+	}
+	copyDescription(previousMetadata, &republishedMetadata)
+	err = storeUpdateStoredMetadata(ctx, *newUpdate, &republishedMetadata)
 	if err != nil {
 		return nil, err
 	}
-	err = StoreUpdateUUIDInMetadata(*newUpdate)
+	err = StoreUpdateUUIDInMetadata(ctx, *newUpdate)
 	if err != nil {
 		return nil, err
 	}
-	err = MarkUpdateAsChecked(*newUpdate)
+	storedMetadata, err := markUpdateAsChecked(ctx, *newUpdate)
 	if err != nil {
 		return nil, err
 	}
-	cache := cache2.GetCache()
-	cacheKey := ComputeLastUpdateCacheKey(newUpdate.Branch, newUpdate.RuntimeVersion, platform)
-	cache.Delete(cacheKey)
+	InvalidateLatestUpdate(ctx, newUpdate.Branch, newUpdate.RuntimeVersion, platform)
+	webhooks.Dispatch(computeWebhookPayload(webhooks.UpdateRepublished, *newUpdate, storedMetadata))
 	return newUpdate, nil
 }
+
+// PromoteUpdate copies a checked update into another branch, with the same assets and
+// expoConfig.json. The copy gets its own update UUID and keeps its source in update-metadata.json.
+// It is pending approval when the target branch is protected.
+func PromoteUpdate(ctx context.Context, source *types.Update, targetBranch string, promotedBy string) (*types.Update, *types.UpdateStoredMetadata, error) {
+	sourceMetadata, err := RetrieveUpdateStoredMetadata(ctx, *source)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sourceMetadata == nil {
+		return nil, nil, fmt.Errorf("update %s has no metadata", source.UpdateId)
+	}
+	resolvedBucket := bucket.GetBucket()
+	updateId := GenerateUpdateTimestamp()
+	newUpdate, err := resolvedBucket.CreateUpdateFrom(ctx, source, targetBranch, ConvertUpdateTimestampToString(updateId))
+	if err != nil {
+		return nil, nil, err
+	}
+	promotedMetadata := types.UpdateStoredMetadata{
+		Platform:   sourceMetadata.Platform,
+		CommitHash: sourceMetadata.CommitHash,
+		FileHashes: sourceMetadata.FileHashes,
+		PromotedFrom: &types.UpdateProvenance{
+			Branch:     source.Branch,
+			UpdateId:   source.UpdateId,
+			UpdateUUID: sourceMetadata.UpdateUUID,
+		},
+	}
+	copyDescription(sourceMetadata, &promotedMetadata)
+	metadata, err := json.Marshal(promotedMetadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = resolvedBucket.UploadFileIntoUpdate(ctx, *newUpdate, "update-metadata.json", strings.NewReader(string(metadata)))
+	if err != nil {
+		return nil, nil, err
+	}
+	err = StoreUpdateUUIDInMetadata(ctx, *newUpdate)
+	if err != nil {
+		return nil, nil, err
+	}
+	if branch.IsBranchProtected(ctx, targetBranch) {
+		err = MarkUpdateAsPending(ctx, *newUpdate, promotedBy)
+		if err != nil {
+			return nil, nil, err
+		}
+		storedMetadata, err := RetrieveUpdateStoredMetadata(ctx, *newUpdate)
+		return newUpdate, storedMetadata, err
+	}
+	storedMetadata, err := markUpdateAsChecked(ctx, *newUpdate)
+	if err != nil {
+		return nil, nil, err
+	}
+	webhooks.Dispatch(computeWebhookPayload(webhooks.UpdatePromoted, *newUpdate, storedMetadata))
+	return newUpdate, storedMetadata, nil
+}
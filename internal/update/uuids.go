@@ -0,0 +1,61 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/crypto"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/version"
+	"fmt"
+)
+
+func ComputeUpdateUUIDsCacheKey(branch string, runtimeVersion string, platform string) string {
+	return fmt.Sprintf("updateUUIDs:%s:%s:%s:%s", version.Version, branch, runtimeVersion, platform)
+}
+
+// GetUpdateUUIDs returns the UUIDs of the updates published for a platform, so that values sent by
+// clients can be checked before being recorded. The list is empty when nothing was published.
+func GetUpdateUUIDs(ctx context.Context, branch string, runtimeVersion string, platform string) ([]string, error) {
+	cacheKey := ComputeUpdateUUIDsCacheKey(branch, runtimeVersion, platform)
+	cachedValue := cache2.GetCache().Get(ctx, cacheKey)
+	if cachedValue == "" {
+		var err error
+		cachedValue, err = buildOnce(ctx, cacheKey, func(ctx context.Context) (string, error) {
+			return buildUpdateUUIDs(ctx, cacheKey, branch, runtimeVersion, platform)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var updateUUIDs []string
+	if err := json.Unmarshal([]byte(cachedValue), &updateUUIDs); err != nil {
+		return nil, err
+	}
+	return updateUUIDs, nil
+}
+
+func buildUpdateUUIDs(ctx context.Context, cacheKey string, branch string, runtimeVersion string, platform string) (string, error) {
+	updates, err := GetAllUpdatesForRuntimeVersion(ctx, branch, runtimeVersion, platform)
+	if err != nil {
+		return "", err
+	}
+	updateUUIDs := []string{}
+	for _, update := range updates {
+		if GetUpdateType(ctx, update) != types.NormalUpdate {
+			continue
+		}
+		metadata, err := GetMetadata(ctx, update)
+		if err != nil {
+			continue
+		}
+		updateUUIDs = append(updateUUIDs, crypto.ConvertSHA256HashToUUID(metadata.ID))
+	}
+	cacheValue, err := json.Marshal(updateUUIDs)
+	if err != nil {
+		return "", err
+	}
+	ttl := latestUpdateTTL
+	_ = cache2.GetCache().Set(ctx, cacheKey, string(cacheValue), &ttl)
+	return string(cacheValue), nil
+}
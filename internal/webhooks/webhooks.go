@@ -0,0 +1,325 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expo-open-ota/config"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/crypto"
+	"expo-open-ota/internal/helpers"
+	"expo-open-ota/internal/version"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type EventType string
+
+const (
+	UpdatePublished           EventType = "update.published"
+	UpdateRolledBack          EventType = "update.rolledBack"
+	UpdateRepublished         EventType = "update.republished"
+	UpdatePromoted            EventType = "update.promoted"
+	UpdateCrashGuardTriggered EventType = "update.crashGuardTriggered"
+	UpdatePendingApproval     EventType = "update.pendingApproval"
+	ChannelRemapped           EventType = "channel.remapped"
+)
+
+// Each event type has its own comma separated list of endpoints.
+var eventEndpointsEnvKeys = map[EventType]string{
+	UpdatePublished:           "WEBHOOK_UPDATE_PUBLISHED_URLS",
+	UpdateRolledBack:          "WEBHOOK_UPDATE_ROLLED_BACK_URLS",
+	UpdateRepublished:         "WEBHOOK_UPDATE_REPUBLISHED_URLS",
+	UpdatePromoted:            "WEBHOOK_UPDATE_PROMOTED_URLS",
+	UpdateCrashGuardTriggered: "WEBHOOK_UPDATE_CRASH_GUARD_TRIGGERED_URLS",
+	UpdatePendingApproval:     "WEBHOOK_UPDATE_PENDING_APPROVAL_URLS",
+	ChannelRemapped:           "WEBHOOK_CHANNEL_REMAPPED_URLS",
+}
+
+const (
+	SignatureHeader = "X-Expo-Open-OTA-Signature"
+	TimestampHeader = "X-Expo-Open-OTA-Timestamp"
+	EventHeader     = "X-Expo-Open-OTA-Event"
+	DeliveryHeader  = "X-Expo-Open-OTA-Delivery"
+
+	defaultMaxAttempts      = 5
+	defaultInitialBackoffMs = 1000
+	maxFailedDeliveries     = 100
+)
+
+type Payload struct {
+	Event          EventType `json:"event"`
+	DeliveryId     string    `json:"deliveryId"`
+	Timestamp      string    `json:"timestamp"`
+	Branch         string    `json:"branch,omitempty"`
+	BranchId       string    `json:"branchId,omitempty"`
+	RuntimeVersion string    `json:"runtimeVersion,omitempty"`
+	UpdateUUID     string    `json:"updateUUID,omitempty"`
+	UpdateId       string    `json:"updateId,omitempty"`
+	Platform       string    `json:"platform,omitempty"`
+	CommitHash     string    `json:"commitHash,omitempty"`
+	Channel        string    `json:"channel,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+	SourceBranch   string    `json:"sourceBranch,omitempty"`
+	SourceUpdateId string    `json:"sourceUpdateId,omitempty"`
+	GroupId        string    `json:"groupId,omitempty"`
+}
+
+type FailedDelivery struct {
+	Endpoint  string  `json:"endpoint"`
+	Attempts  int     `json:"attempts"`
+	LastError string  `json:"lastError"`
+	FailedAt  string  `json:"failedAt"`
+	Payload   Payload `json:"payload"`
+}
+
+// pendingDelivery is a delivery still being attempted, kept so that it can be recorded as failed
+// when the server stops before it completes.
+type pendingDelivery struct {
+	endpoint  string
+	payload   Payload
+	attempts  int
+	lastError string
+}
+
+var (
+	deliveries     sync.WaitGroup
+	pendingMu      sync.Mutex
+	pending        = map[*pendingDelivery]struct{}{}
+	deliveryClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// storedFailedDelivery is kept in one of the maxFailedDeliveries slots of a ring, Sequence telling
+// which failures are the most recent.
+type storedFailedDelivery struct {
+	Sequence int64 `json:"sequence"`
+	FailedDelivery
+}
+
+// ComputeFailedDeliveriesCacheKey is the counter numbering failed deliveries.
+func ComputeFailedDeliveriesCacheKey() string {
+	return fmt.Sprintf("webhooks:%s:failedDeliveries", version.Version)
+}
+
+func ComputeFailedDeliverySlotCacheKey(slot int64) string {
+	return fmt.Sprintf("webhooks:%s:failedDeliveries:%d", version.Version, slot)
+}
+
+func ResolveEndpoints(event EventType) []string {
+	envKey, ok := eventEndpointsEnvKeys[event]
+	if !ok {
+		return nil
+	}
+	var endpoints []string
+	for _, endpoint := range strings.Split(config.GetEnv(envKey), ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint == "" {
+			continue
+		}
+		if !helpers.IsValidURL(endpoint) {
+			slog.Warn("Ignoring invalid webhook endpoint", "event", event, "endpoint", endpoint)
+			continue
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+func getIntEnv(key string, defaultValue int) int {
+	value, err := strconv.Atoi(config.GetEnv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// ComputeSignature signs the timestamp of the attempt along with the body, so a captured request
+// can't be replayed once receivers consider its timestamp too old.
+func ComputeSignature(secret string, timestamp string, body []byte) string {
+	return "sha256=" + crypto.SignHMACSHA256([]byte(timestamp+"."+string(body)), secret)
+}
+
+// Dispatch sends the payload to every endpoint configured for its event.
+// Deliveries run in the background and never block the caller.
+func Dispatch(payload Payload) {
+	endpoints := ResolveEndpoints(payload.Event)
+	if len(endpoints) == 0 {
+		return
+	}
+	secret := config.GetEnv("WEBHOOK_SECRET")
+	if secret == "" {
+		slog.Error("WEBHOOK_SECRET is required to send webhooks, skipping delivery", "event", payload.Event)
+		return
+	}
+	payload.DeliveryId = uuid.New().String()
+	payload.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Error marshalling webhook payload", "event", payload.Event, "error", err)
+		return
+	}
+	for _, endpoint := range endpoints {
+		delivery := &pendingDelivery{endpoint: endpoint, payload: payload}
+		pendingMu.Lock()
+		pending[delivery] = struct{}{}
+		pendingMu.Unlock()
+		deliveries.Add(1)
+		go func() {
+			defer deliveries.Done()
+			deliver(delivery, secret, body)
+		}()
+	}
+}
+
+// Wait blocks until every pending delivery has either succeeded or been recorded as failed. When
+// ctx is done first, the deliveries still pending are recorded as failed and ctx.Err() is returned.
+func Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		deliveries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	pendingMu.Lock()
+	interrupted := make([]*pendingDelivery, 0, len(pending))
+	for delivery := range pending {
+		interrupted = append(interrupted, delivery)
+		delete(pending, delivery)
+	}
+	pendingMu.Unlock()
+	for _, delivery := range interrupted {
+		lastError := "delivery interrupted by shutdown"
+		if delivery.lastError != "" {
+			lastError += ": " + delivery.lastError
+		}
+		recordFailedDelivery(FailedDelivery{
+			Endpoint:  delivery.endpoint,
+			Attempts:  delivery.attempts,
+			LastError: lastError,
+			FailedAt:  time.Now().UTC().Format(time.RFC3339),
+			Payload:   delivery.payload,
+		})
+	}
+	return ctx.Err()
+}
+
+// settle removes the delivery from the pending ones, and reports false when Wait already recorded it.
+func settle(delivery *pendingDelivery) bool {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	_, ok := pending[delivery]
+	delete(pending, delivery)
+	return ok
+}
+
+func deliver(delivery *pendingDelivery, secret string, body []byte) {
+	endpoint, payload := delivery.endpoint, delivery.payload
+	maxAttempts := getIntEnv("WEBHOOK_MAX_ATTEMPTS", defaultMaxAttempts)
+	backoff := time.Duration(getIntEnv("WEBHOOK_INITIAL_BACKOFF_MS", defaultInitialBackoffMs)) * time.Millisecond
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		lastErr = send(endpoint, payload, secret, body)
+		if lastErr == nil {
+			settle(delivery)
+			return
+		}
+		pendingMu.Lock()
+		delivery.attempts = attempt
+		delivery.lastError = lastErr.Error()
+		pendingMu.Unlock()
+		slog.Warn("Webhook delivery attempt failed", "deliveryId", payload.DeliveryId, "event", payload.Event, "attempt", attempt, "maxAttempts", maxAttempts, "endpoint", endpoint, "error", lastErr)
+		if attempt < maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	if !settle(delivery) {
+		return
+	}
+	recordFailedDelivery(FailedDelivery{
+		Endpoint:  endpoint,
+		Attempts:  maxAttempts,
+		LastError: lastErr.Error(),
+		FailedAt:  time.Now().UTC().Format(time.RFC3339),
+		Payload:   payload,
+	})
+}
+
+func send(endpoint string, payload Payload, secret string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(payload.Event))
+	req.Header.Set(DeliveryHeader, payload.DeliveryId)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, ComputeSignature(secret, timestamp, body))
+	resp, err := deliveryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordFailedDelivery numbers the failure with an atomic counter and stores it in its own slot,
+// so that instances recording failures at the same time never overwrite each other. The oldest
+// failure is replaced once every slot is used.
+func recordFailedDelivery(failure FailedDelivery) {
+	ctx := context.Background()
+	cache := cache2.GetCache()
+	sequence, err := cache.Incr(ctx, ComputeFailedDeliveriesCacheKey(), nil)
+	if err != nil {
+		slog.Error("Error recording failed webhook delivery", "error", err)
+		return
+	}
+	cacheValue, err := json.Marshal(storedFailedDelivery{Sequence: sequence, FailedDelivery: failure})
+	if err != nil {
+		slog.Error("Error marshalling failed webhook delivery", "error", err)
+		return
+	}
+	if err := cache.Set(ctx, ComputeFailedDeliverySlotCacheKey(sequence%maxFailedDeliveries), string(cacheValue), nil); err != nil {
+		slog.Error("Error recording failed webhook delivery", "error", err)
+	}
+}
+
+// GetFailedDeliveries returns the most recent failed deliveries, newest first.
+func GetFailedDeliveries(ctx context.Context) []FailedDelivery {
+	keys := make([]string, maxFailedDeliveries)
+	for slot := range keys {
+		keys[slot] = ComputeFailedDeliverySlotCacheKey(int64(slot))
+	}
+	stored := make([]storedFailedDelivery, 0, maxFailedDeliveries)
+	for _, cachedValue := range cache2.GetCache().MGet(ctx, keys) {
+		var failure storedFailedDelivery
+		if cachedValue == "" || json.Unmarshal([]byte(cachedValue), &failure) != nil {
+			continue
+		}
+		stored = append(stored, failure)
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Sequence > stored[j].Sequence })
+	failures := make([]FailedDelivery, len(stored))
+	for i, failure := range stored {
+		failures[i] = failure.FailedDelivery
+	}
+	return failures
+}
@@ -0,0 +1,162 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/crypto"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	testing2 "testing"
+	"time"
+)
+
+func setup(t *testing2.T) func() {
+	os.Setenv("WEBHOOK_SECRET", "test_webhook_secret")
+	os.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	os.Setenv("WEBHOOK_INITIAL_BACKOFF_MS", "1")
+	return func() {
+		os.Unsetenv("WEBHOOK_SECRET")
+		os.Unsetenv("WEBHOOK_MAX_ATTEMPTS")
+		os.Unsetenv("WEBHOOK_INITIAL_BACKOFF_MS")
+		os.Unsetenv("WEBHOOK_UPDATE_PUBLISHED_URLS")
+	}
+}
+
+func TestResolveEndpoints(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("WEBHOOK_UPDATE_PUBLISHED_URLS", "https://hooks.example.com/a, not-a-url ,https://hooks.example.com/b")
+	assert.Equal(t, []string{"https://hooks.example.com/a", "https://hooks.example.com/b"}, ResolveEndpoints(UpdatePublished))
+	assert.Empty(t, ResolveEndpoints(UpdateRolledBack))
+}
+
+func TestDispatchSignsAndRetries(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	var attempts int32
+	var received Payload
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		timestamp := r.Header.Get(TimestampHeader)
+		assert.NotEmpty(t, timestamp)
+		assert.Equal(t, "sha256="+crypto.SignHMACSHA256([]byte(timestamp+"."+string(body)), "test_webhook_secret"), signature)
+		assert.Equal(t, string(UpdatePublished), r.Header.Get(EventHeader))
+		_ = json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	os.Setenv("WEBHOOK_UPDATE_PUBLISHED_URLS", server.URL)
+
+	Dispatch(Payload{
+		Event:          UpdatePublished,
+		Branch:         "branch-1",
+		RuntimeVersion: "1",
+		UpdateUUID:     "uuid",
+		Platform:       "ios",
+		CommitHash:     "hash",
+	})
+	assert.NoError(t, Wait(context.Background()))
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	assert.NotEmpty(t, signature)
+	assert.Equal(t, "branch-1", received.Branch)
+	assert.Equal(t, "ios", received.Platform)
+	assert.Equal(t, "hash", received.CommitHash)
+	assert.NotEmpty(t, received.DeliveryId)
+}
+
+func TestDispatchRecordsFailedDelivery(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	os.Setenv("WEBHOOK_UPDATE_PUBLISHED_URLS", server.URL)
+
+	Dispatch(Payload{Event: UpdatePublished, Branch: "branch-failed"})
+	assert.NoError(t, Wait(context.Background()))
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	failures := GetFailedDeliveries(context.Background())
+	assert.NotEmpty(t, failures)
+	assert.Equal(t, server.URL, failures[0].Endpoint)
+	assert.Equal(t, 3, failures[0].Attempts)
+	assert.Equal(t, "branch-failed", failures[0].Payload.Branch)
+}
+
+func TestWaitRecordsPendingDeliveriesAtDeadline(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer close(release)
+	os.Setenv("WEBHOOK_UPDATE_PUBLISHED_URLS", server.URL)
+
+	Dispatch(Payload{Event: UpdatePublished, Branch: "branch-interrupted"})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, Wait(ctx), context.DeadlineExceeded)
+
+	failures := GetFailedDeliveries(context.Background())
+	assert.NotEmpty(t, failures)
+	assert.Equal(t, "branch-interrupted", failures[0].Payload.Branch)
+	assert.Contains(t, failures[0].LastError, "interrupted by shutdown")
+}
+
+func TestDispatchRequiresSecret(t *testing2.T) {
+	teardown := setup(t)
+	defer teardown()
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	os.Setenv("WEBHOOK_UPDATE_PUBLISHED_URLS", server.URL)
+	os.Unsetenv("WEBHOOK_SECRET")
+
+	Dispatch(Payload{Event: UpdatePublished, Branch: "branch-unsigned"})
+	assert.NoError(t, Wait(context.Background()))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&attempts), "Expected unsigned webhooks not to be sent")
+}
+
+func TestConcurrentFailedDeliveriesAreAllRecorded(t *testing2.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < maxFailedDeliveries+20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			recordFailedDelivery(FailedDelivery{Endpoint: "concurrent", Payload: Payload{Branch: fmt.Sprintf("branch-%d", i)}})
+		}(i)
+	}
+	wg.Wait()
+	failures := GetFailedDeliveries(context.Background())
+	assert.Len(t, failures, maxFailedDeliveries)
+	branches := map[string]struct{}{}
+	for _, failure := range failures {
+		branches[failure.Payload.Branch] = struct{}{}
+	}
+	assert.Len(t, branches, maxFailedDeliveries, "Expected no failure to overwrite another one")
+
+	recordFailedDelivery(FailedDelivery{Endpoint: "latest", Payload: Payload{Branch: "branch-latest"}})
+	assert.Equal(t, "branch-latest", GetFailedDeliveries(context.Background())[0].Payload.Branch)
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/audit"
+	"expo-open-ota/internal/auth"
+	"expo-open-ota/internal/branch"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/middleware"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func dashboardToken(t *testing.T, username, password string) string {
+	authResponse, err := auth.NewAuth().Login(username, password)
+	require.NoError(t, err)
+	return authResponse.Token
+}
+
+func reviewUpdate(t *testing.T, handler http.HandlerFunc, action, token, branch, runtimeVersion, updateId string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", fmt.Sprintf("http://localhost:3000/api/branch/%s/runtimeVersion/%s/updates/%s/%s", branch, runtimeVersion, updateId, action), nil)
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": branch, "RUNTIME_VERSION": runtimeVersion, "UPDATE_ID": updateId})
+	r.Header.Set("Authorization", "Bearer "+token)
+	middleware.AuthMiddleware(handler).ServeHTTP(w, r)
+	return w
+}
+
+func uploadPendingUpdate(t *testing.T, projectRoot string) string {
+	samplePath := filepath.Join(projectRoot, "/test/test-updates/branch-4/1/1674170952")
+	updateId := performUpload(t, projectRoot, "DO_NOT_USE", "1", samplePath, "android")
+	require.NoError(t, branch.SetProtection(context.Background(), "DO_NOT_USE", &branch.Protection{Protected: true}))
+	w := markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId, "android")
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	return updateId
+}
+
+func TestProtectedBranchUpdateIsServedOnceApproved(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	os.Setenv("DASHBOARD_USERS", "alice:approver:alice_password,bob:member:bob_password")
+	defer os.Unsetenv("DASHBOARD_USERS")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	updateId := uploadPendingUpdate(t, projectRoot)
+	pending, err := update.GetUpdate("DO_NOT_USE", "1", updateId)
+	require.NoError(t, err)
+	assert.True(t, update.IsUpdatePending(ctx, *pending))
+	assertServedUpdate(t, "DO_NOT_USE", "android", "")
+
+	w := reviewUpdate(t, handlers.ApproveUpdateHandler, "approve", dashboardToken(t, "bob", "bob_password"), "DO_NOT_USE", "1", updateId)
+	assert.Equal(t, http.StatusForbidden, w.Code, "Expected a member not to be allowed to approve")
+	assertServedUpdate(t, "DO_NOT_USE", "android", "")
+
+	w = reviewUpdate(t, handlers.ApproveUpdateHandler, "approve", dashboardToken(t, "alice", "alice_password"), "DO_NOT_USE", "1", updateId)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assertServedUpdate(t, "DO_NOT_USE", "android", updateId)
+
+	storedMetadata, err := update.RetrieveUpdateStoredMetadata(ctx, *pending)
+	require.NoError(t, err)
+	require.NotNil(t, storedMetadata.Approval)
+	assert.Equal(t, types.ApprovalApproved, storedMetadata.Approval.Status)
+	assert.Equal(t, "test_username", storedMetadata.Approval.RequestedBy)
+	assert.Equal(t, "alice", storedMetadata.Approval.ApprovedBy)
+	assert.NotNil(t, storedMetadata.Approval.ApprovedAt)
+
+	page, err := audit.GetEntries(ctx, "DO_NOT_USE", "", 10)
+	require.NoError(t, err)
+	entries := page.Entries
+	require.NotEmpty(t, entries)
+	assert.Equal(t, audit.ApproveUpdate, entries[0].Action)
+	assert.Equal(t, "alice", entries[0].Actor)
+	assert.Equal(t, updateId, entries[0].UpdateId)
+
+	w = reviewUpdate(t, handlers.ApproveUpdateHandler, "approve", dashboardToken(t, "", "admin"), "DO_NOT_USE", "1", updateId)
+	assert.Equal(t, http.StatusConflict, w.Code, "Expected an approved update not to be approved again")
+}
+
+func TestRejectedUpdateIsDeleted(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+
+	updateId := uploadPendingUpdate(t, projectRoot)
+	w := reviewUpdate(t, handlers.RejectUpdateHandler, "reject", dashboardToken(t, "", "admin"), "DO_NOT_USE", "1", updateId)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	_, err = os.Stat(filepath.Join(projectRoot, "updates", "DO_NOT_USE", "1", updateId))
+	assert.True(t, os.IsNotExist(err), "Expected the rejected update to be deleted")
+
+	page, err := audit.GetEntries(context.Background(), "DO_NOT_USE", "", 10)
+	require.NoError(t, err)
+	entries := page.Entries
+	require.NotEmpty(t, entries)
+	assert.Equal(t, audit.RejectUpdate, entries[0].Action)
+	assert.Equal(t, auth.AdminUsername, entries[0].Actor)
+}
+
+func TestExpoAuthCannotApproveOrProtect(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+
+	updateId := uploadPendingUpdate(t, projectRoot)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", fmt.Sprintf("http://localhost:3000/api/branch/DO_NOT_USE/runtimeVersion/1/updates/%s/approve", updateId), nil)
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "DO_NOT_USE", "RUNTIME_VERSION": "1", "UPDATE_ID": updateId})
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	r.Header.Set("Use-Expo-Auth", "true")
+	middleware.AuthMiddleware(http.HandlerFunc(handlers.ApproveUpdateHandler)).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assertServedUpdate(t, "DO_NOT_USE", "android", "")
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "http://localhost:3000/api/branch/DO_NOT_USE/protection", strings.NewReader(`{"protected":false}`))
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "DO_NOT_USE"})
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	r.Header.Set("Use-Expo-Auth", "true")
+	middleware.AuthMiddleware(http.HandlerFunc(handlers.SetBranchProtectionHandler)).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	protection, err := branch.GetProtection(context.Background(), "DO_NOT_USE")
+	require.NoError(t, err)
+	assert.True(t, protection.Protected, "Expected Expo auth not to be allowed to unprotect the branch")
+}
+
+func TestPromoteToProtectedBranchIsPending(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	copyTestUpdates(t)
+	ctx := context.Background()
+	servedBefore, err := update.GetLatestUpdateBundlePathForRuntimeVersion(ctx, "branch-1", "1", "ios")
+	require.NoError(t, err)
+	servedBeforeId := ""
+	if servedBefore != nil {
+		servedBeforeId = servedBefore.UpdateId
+	}
+	require.NoError(t, branch.SetProtection(ctx, "branch-1", &branch.Protection{Protected: true}))
+
+	w := createPromoteRequest("branch-2", "1", "ios", "1737455526", "branch-1")
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var body handlers.PromoteResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.NotNil(t, body.Approval)
+	assert.Equal(t, types.ApprovalPending, body.Approval.Status)
+	assertServedUpdate(t, "branch-1", "ios", servedBeforeId)
+
+	w = reviewUpdate(t, handlers.ApproveUpdateHandler, "approve", dashboardToken(t, "", "admin"), "branch-1", "1", body.Update.UpdateId)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assertServedUpdate(t, "branch-1", "ios", body.Update.UpdateId)
+}
@@ -3,6 +3,7 @@ package test
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"expo-open-ota/internal/assets"
 	"expo-open-ota/internal/cdn"
 	"expo-open-ota/internal/handlers"
@@ -28,11 +29,10 @@ func TestEmptyAssetNameForAssets(t *testing.T) {
 		AssetName:      "",
 		RuntimeVersion: "1",
 		Platform:       "ios",
-		RequestID:      "test",
 	}
 	projectRoot, _ := findProjectRoot()
-	testEmptyAssetName := func(t *testing.T, handlerFunc func(assets.AssetsRequest) (assets.AssetsResponse, error)) {
-		response, err := handlerFunc(request)
+	testEmptyAssetName := func(t *testing.T, handlerFunc func(context.Context, assets.AssetsRequest) (assets.AssetsResponse, error)) {
+		response, err := handlerFunc(context.Background(), request)
 		assert.Nil(t, err, "Expected no error")
 		assert.Equal(t, 400, response.StatusCode, "Expected status code 400 for an empty asset name")
 		assert.Equal(t, "No asset name provided", string(response.Body), "Expected 'No asset name provided' message")
@@ -42,11 +42,11 @@ func TestEmptyAssetNameForAssets(t *testing.T) {
 	})
 
 	t.Run("Test HandleAssetsWithURL", func(t *testing.T) {
-		testEmptyAssetName(t, func(req assets.AssetsRequest) (assets.AssetsResponse, error) {
+		testEmptyAssetName(t, func(ctx context.Context, req assets.AssetsRequest) (assets.AssetsResponse, error) {
 			os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 			os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 			os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-			return assets.HandleAssetsWithURL(req, &cdn.CloudfrontCDN{})
+			return assets.HandleAssetsWithURL(ctx, req, &cdn.CloudfrontCDN{})
 		})
 	})
 }
@@ -60,11 +60,10 @@ func TestBadPlatformForAssets(t *testing.T) {
 		AssetName:      "/assets/4f1cb2cac2370cd5050681232e8575a8",
 		RuntimeVersion: "1",
 		Platform:       "blackberry",
-		RequestID:      "test",
 	}
 	projectRoot, _ := findProjectRoot()
-	testInvalidPlatform := func(t *testing.T, handlerFunc func(assets.AssetsRequest) (assets.AssetsResponse, error)) {
-		response, err := handlerFunc(request)
+	testInvalidPlatform := func(t *testing.T, handlerFunc func(context.Context, assets.AssetsRequest) (assets.AssetsResponse, error)) {
+		response, err := handlerFunc(context.Background(), request)
 		assert.Nil(t, err, "Expected no error")
 		assert.Equal(t, 400, response.StatusCode, "Expected status code 400 for an invalid platform")
 		assert.Equal(t, "Invalid platform", string(response.Body), "Expected 'Invalid platform' message")
@@ -73,11 +72,11 @@ func TestBadPlatformForAssets(t *testing.T) {
 		testInvalidPlatform(t, assets.HandleAssetsWithFile)
 	})
 	t.Run("Test HandleAssetsWithURL", func(t *testing.T) {
-		testInvalidPlatform(t, func(req assets.AssetsRequest) (assets.AssetsResponse, error) {
+		testInvalidPlatform(t, func(ctx context.Context, req assets.AssetsRequest) (assets.AssetsResponse, error) {
 			os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 			os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 			os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-			return assets.HandleAssetsWithURL(req, &cdn.CloudfrontCDN{})
+			return assets.HandleAssetsWithURL(ctx, req, &cdn.CloudfrontCDN{})
 		})
 	})
 }
@@ -91,10 +90,9 @@ func TestMissingRuntimeVersionForAssets(t *testing.T) {
 		AssetName:      "/assets/4f1cb2cac2370cd5050681232e8575a8",
 		RuntimeVersion: "",
 		Platform:       "ios",
-		RequestID:      "test",
 	}
-	testMissingRuntimeVersion := func(t *testing.T, handlerFunc func(assets.AssetsRequest) (assets.AssetsResponse, error)) {
-		response, err := handlerFunc(request)
+	testMissingRuntimeVersion := func(t *testing.T, handlerFunc func(context.Context, assets.AssetsRequest) (assets.AssetsResponse, error)) {
+		response, err := handlerFunc(context.Background(), request)
 		assert.Nil(t, err, "Expected no error")
 		assert.Equal(t, 400, response.StatusCode, "Expected status code 400 for a missing runtime version")
 		assert.Equal(t, "No runtime version provided", string(response.Body), "Expected 'No runtime version provided' message")
@@ -104,11 +102,11 @@ func TestMissingRuntimeVersionForAssets(t *testing.T) {
 		testMissingRuntimeVersion(t, assets.HandleAssetsWithFile)
 	})
 	t.Run("Test HandleAssetsWithURL", func(t *testing.T) {
-		testMissingRuntimeVersion(t, func(req assets.AssetsRequest) (assets.AssetsResponse, error) {
+		testMissingRuntimeVersion(t, func(ctx context.Context, req assets.AssetsRequest) (assets.AssetsResponse, error) {
 			os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 			os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 			os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-			return assets.HandleAssetsWithURL(req, &cdn.CloudfrontCDN{})
+			return assets.HandleAssetsWithURL(ctx, req, &cdn.CloudfrontCDN{})
 		})
 	})
 }
@@ -122,10 +120,9 @@ func TestEmptyUpdatesForAssets(t *testing.T) {
 		AssetName:      "/assets/4f1cb2cac2370cd5050681232e8575a8",
 		RuntimeVersion: "1",
 		Platform:       "ios",
-		RequestID:      "test",
 	}
-	testEmptyUpdates := func(t *testing.T, handlerFunc func(assets.AssetsRequest) (assets.AssetsResponse, error)) {
-		response, err := handlerFunc(request)
+	testEmptyUpdates := func(t *testing.T, handlerFunc func(context.Context, assets.AssetsRequest) (assets.AssetsResponse, error)) {
+		response, err := handlerFunc(context.Background(), request)
 		assert.Nil(t, err, "Expected no error")
 		assert.Equal(t, 404, response.StatusCode, "Expected status code 404 for an empty update")
 		assert.Equal(t, "No update found", string(response.Body), "Expected 'No update found' message")
@@ -135,11 +132,11 @@ func TestEmptyUpdatesForAssets(t *testing.T) {
 		testEmptyUpdates(t, assets.HandleAssetsWithFile)
 	})
 	t.Run("Test HandleAssetsWithURL", func(t *testing.T) {
-		testEmptyUpdates(t, func(req assets.AssetsRequest) (assets.AssetsResponse, error) {
+		testEmptyUpdates(t, func(ctx context.Context, req assets.AssetsRequest) (assets.AssetsResponse, error) {
 			os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 			os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 			os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-			return assets.HandleAssetsWithURL(req, &cdn.CloudfrontCDN{})
+			return assets.HandleAssetsWithURL(ctx, req, &cdn.CloudfrontCDN{})
 		})
 	})
 }
@@ -153,10 +150,9 @@ func TestBadRuntimeVersion(t *testing.T) {
 		AssetName:      "/assets/4f1cb2cac2370cd5050681232e8575a8",
 		RuntimeVersion: "never",
 		Platform:       "ios",
-		RequestID:      "test",
 	}
-	testBadRuntimeVersion := func(t *testing.T, handlerFunc func(assets.AssetsRequest) (assets.AssetsResponse, error)) {
-		response, err := handlerFunc(request)
+	testBadRuntimeVersion := func(t *testing.T, handlerFunc func(context.Context, assets.AssetsRequest) (assets.AssetsResponse, error)) {
+		response, err := handlerFunc(context.Background(), request)
 		assert.Nil(t, err, "Expected no error")
 		assert.Equal(t, 404, response.StatusCode, "Expected status code 404 for a bad runtime version")
 		assert.Equal(t, "No update found", string(response.Body), "Expected 'No update found' message")
@@ -166,11 +162,11 @@ func TestBadRuntimeVersion(t *testing.T) {
 		testBadRuntimeVersion(t, assets.HandleAssetsWithFile)
 	})
 	t.Run("Test HandleAssetsWithURL", func(t *testing.T) {
-		testBadRuntimeVersion(t, func(req assets.AssetsRequest) (assets.AssetsResponse, error) {
+		testBadRuntimeVersion(t, func(ctx context.Context, req assets.AssetsRequest) (assets.AssetsResponse, error) {
 			os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 			os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 			os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-			return assets.HandleAssetsWithURL(req, &cdn.CloudfrontCDN{})
+			return assets.HandleAssetsWithURL(ctx, req, &cdn.CloudfrontCDN{})
 		})
 	})
 }
@@ -184,18 +180,17 @@ func TestToRetrieveBundleAsset(t *testing.T) {
 		AssetName:      "bundles/android-82adadb1fb6e489d04ad95fd79670deb.js",
 		RuntimeVersion: "1",
 		Platform:       "android",
-		RequestID:      "test",
 	}
 	projectRoot, _ := findProjectRoot()
 	os.Setenv("PRIVATE_CLOUDFRONT_KEY_PATH", filepath.Join(projectRoot, "/test/keys/private-key-cloudfront-test.pem"))
 	os.Setenv("CLOUDFRONT_DOMAIN", "https://cdn.expoopenota.com")
 	os.Setenv("CLOUDFRONT_KEY_PAIR_ID", "test")
-	response, err := assets.HandleAssetsWithFile(asset)
+	response, err := assets.HandleAssetsWithFile(context.Background(), asset)
 	assert.Nil(t, err, "Expected no error")
 	assert.Equal(t, 200, response.StatusCode, "Expected status code 200")
 	assert.Equal(t, "application/javascript", response.ContentType, "Expected content type 'application/javascript'")
 	assert.Empty(t, response.URL, "Expected URL to be empty")
-	responseWithUrl, err := assets.HandleAssetsWithURL(asset, &cdn.CloudfrontCDN{})
+	responseWithUrl, err := assets.HandleAssetsWithURL(context.Background(), asset, &cdn.CloudfrontCDN{})
 	assert.Nil(t, err, "Expected no error")
 	assert.Equal(t, 200, responseWithUrl.StatusCode, "Expected status code 200")
 	assert.Empty(t, responseWithUrl.Body, "Expected empty body")
@@ -365,3 +360,19 @@ func TestPreventCDNRedirectionHeader(t *testing.T) {
 
 	assert.Equal(t, 200, w.Code, "Expected status code 200")
 }
+
+func TestUpdateInternalFilesAreNotServed(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockWorkingExpoResponse("staging")
+	for _, assetName := range []string{"update-metadata.json", "targeting-rules.json", "asset-index.json", "halted", "./update-metadata.json"} {
+		response, err := assets.HandleAssetsWithFile(context.Background(), assets.AssetsRequest{
+			Branch:         "branch-1",
+			AssetName:      assetName,
+			RuntimeVersion: "1",
+			Platform:       "android",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 404, response.StatusCode, "Expected %s not to be served", assetName)
+	}
+}
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/assignment"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/types"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func mockRolloutChannelMapping(percentage float64) {
+	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql",
+		func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("operationName") != "FetchExpoChannelMapping" {
+				return httpmock.NewStringResponse(404, "Unknown operation"), nil
+			}
+			return MockExpoChannelMapping(
+				[]map[string]interface{}{
+					{"id": "branch-1-id", "name": "branch-1"},
+					{"id": "branch-2-id", "name": "branch-2"},
+				},
+				map[string]interface{}{
+					"id":   "staging-id",
+					"name": "staging",
+					"branchMapping": StringifyBranchMapping(map[string]interface{}{
+						"version": 0,
+						"data": []map[string]interface{}{
+							{
+								"branchId": "branch-2-id",
+								"branchMappingLogic": map[string]interface{}{
+									"operand":               percentage,
+									"clientKey":             "rolloutToken",
+									"branchMappingOperator": "hash_lt",
+								},
+							},
+							{
+								"branchId":           "branch-1-id",
+								"branchMappingLogic": "true",
+							},
+						},
+					}),
+				},
+			)
+		})
+}
+
+func requestAssignedManifest(t *testing.T, headers map[string]string) (types.UpdateManifest, http.Header) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://localhost:3000/manifest", nil)
+	r.Header.Add("expo-platform", "android")
+	r.Header.Add("expo-runtime-version", "1")
+	r.Header.Add("expo-protocol-version", "1")
+	r.Header.Add("expo-channel-name", "staging")
+	r.Header.Add("accept", "application/expo+json")
+	for key, value := range headers {
+		r.Header.Add(key, value)
+	}
+	handlers.ManifestHandler(w, r)
+	require.Equal(t, 200, w.Code)
+	var manifest types.UpdateManifest
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &manifest))
+	return manifest, w.Header()
+}
+
+func TestRolloutAssignmentIsPinned(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockRolloutChannelMapping(0.5)
+
+	manifest, headers := requestAssignedManifest(t, map[string]string{assignment.CohortHeader: "0.25"})
+	assert.Equal(t, "branch-2", manifest.Extra.Branch)
+	assert.Equal(t, `expo-open-ota-branch="branch-2", expo-open-ota-cohort="0.25"`, headers.Get("expo-server-defined-headers"))
+	assert.Equal(t, `branch="branch-2"`, headers.Get("expo-manifest-filters"))
+
+	manifest, headers = requestAssignedManifest(t, map[string]string{assignment.CohortHeader: "0.75"})
+	assert.Equal(t, "branch-1", manifest.Extra.Branch)
+	assert.Equal(t, `expo-open-ota-branch="branch-1", expo-open-ota-cohort="0.75"`, headers.Get("expo-server-defined-headers"))
+	assert.Equal(t, `branch="branch-1"`, headers.Get("expo-manifest-filters"))
+
+	// Lowering the rollout doesn't move clients already pinned to it back.
+	mockRolloutChannelMapping(0.1)
+	manifest, _ = requestAssignedManifest(t, map[string]string{assignment.CohortHeader: "0.25", assignment.BranchHeader: "branch-2"})
+	assert.Equal(t, "branch-2", manifest.Extra.Branch)
+	manifest, _ = requestAssignedManifest(t, map[string]string{assignment.CohortHeader: "0.25"})
+	assert.Equal(t, "branch-1", manifest.Extra.Branch)
+}
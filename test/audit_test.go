@@ -0,0 +1,50 @@
+package test
+
+import (
+	"context"
+	"expo-open-ota/internal/audit"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestAuditLogConcurrentRecordsAndPagination(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, audit.Record(ctx, audit.Entry{Action: audit.Promote, Actor: "ci", Branch: "audit", UpdateId: fmt.Sprintf("%d", i)}))
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, audit.Record(ctx, audit.Entry{Action: audit.Promote, Actor: "ci", Branch: "other"}))
+	require.NoError(t, audit.Record(ctx, audit.Entry{Action: audit.ProtectBranch, Actor: "admin", Branch: "audit"}))
+
+	seen := map[string]bool{}
+	var entries []audit.Entry
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		page, err := audit.GetEntries(ctx, "audit", cursor, 2)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Entries), 2)
+		entries = append(entries, page.Entries...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	require.Len(t, entries, 6, "Expected no entry to be lost by concurrent records")
+	assert.Equal(t, audit.ProtectBranch, entries[0].Action, "Expected the newest entry first")
+	for _, entry := range entries[1:] {
+		assert.Equal(t, "audit", entry.Branch)
+		seen[entry.UpdateId] = true
+	}
+	assert.Len(t, seen, 5)
+}
@@ -0,0 +1,135 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/audit"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/crashguard"
+	"expo-open-ota/internal/crypto"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func createCrashGuardManifestRequest(currentUpdateId, clientId string, fatalError bool) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://localhost:3000/manifest", nil)
+	r.Header.Add("expo-platform", "android")
+	r.Header.Add("expo-runtime-version", "1")
+	r.Header.Add("expo-protocol-version", "1")
+	r.Header.Add("expo-expect-signature", "true")
+	r.Header.Add("expo-channel-name", "staging")
+	r.Header.Add("EAS-Client-ID", clientId)
+	r.Header.Add("expo-current-update-id", currentUpdateId)
+	if fatalError {
+		r.Header.Add("expo-fatal-error", "TypeError: undefined is not a function")
+	}
+	handlers.ManifestHandler(w, r)
+	return w
+}
+
+func TestCrashGuardHaltsFaultyUpdate(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockWorkingExpoResponse("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	haltedPath := filepath.Join(projectRoot, "./test/test-updates/branch-1/1/1674170951/halted")
+	defer os.Remove(haltedPath)
+	os.Setenv("CRASH_GUARD_CONFIG", `{"branch-1":{"threshold":0.5,"minActiveUsers":2,"action":"fallback"}}`)
+	crashguard.ResetSettings()
+	defer os.Unsetenv("CRASH_GUARD_CONFIG")
+	currentUpdate, err := update.GetUpdate("branch-1", "1", "1674170951")
+	require.NoError(t, err)
+	metadata, err := update.GetMetadata(context.Background(), *currentUpdate)
+	require.NoError(t, err)
+	currentUpdateId := crypto.ConvertSHA256HashToUUID(metadata.ID)
+
+	w := createCrashGuardManifestRequest(currentUpdateId, "client-1", false)
+	assert.Equal(t, 200, w.Code)
+	_, err = os.Stat(haltedPath)
+	assert.True(t, os.IsNotExist(err), "Expected update not to be halted below the minimum number of users")
+
+	w = createCrashGuardManifestRequest(currentUpdateId, "client-2", true)
+	assert.Equal(t, 200, w.Code)
+	_, err = os.Stat(haltedPath)
+	assert.NoError(t, err, "Expected update to be halted")
+
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), "branch-1", "1", "android")
+	require.NoError(t, err)
+	assert.Nil(t, lastUpdate, "Expected halted update not to be served anymore")
+
+	w = createCrashGuardManifestRequest(currentUpdateId, "client-3", false)
+	parts, err := ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(parts))
+	var directive types.NoUpdateAvailableDirective
+	require.NoError(t, json.Unmarshal([]byte(parts[0].Body), &directive))
+	assert.Equal(t, "noUpdateAvailable", directive.Type)
+
+	page, err := audit.GetEntries(context.Background(), "branch-1", "", 10)
+	require.NoError(t, err)
+	entries := page.Entries
+	require.Equal(t, 1, len(entries))
+	assert.Equal(t, audit.CrashGuardHalt, entries[0].Action)
+	assert.Equal(t, "1674170951", entries[0].UpdateId)
+	assert.Equal(t, "2", entries[0].Details["activeUsers"])
+}
+
+func TestCrashGuardIgnoresUnguardedBranch(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockWorkingExpoResponse("staging")
+	os.Setenv("CRASH_GUARD_CONFIG", `{"production":{"threshold":0.01,"minActiveUsers":1}}`)
+	crashguard.ResetSettings()
+	defer os.Unsetenv("CRASH_GUARD_CONFIG")
+
+	w := createCrashGuardManifestRequest("04b793a0-b6ab-fd4f-308c-b91d812adec2", "client-1", true)
+	assert.Equal(t, 200, w.Code)
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), "branch-1", "1", "android")
+	require.NoError(t, err)
+	require.NotNil(t, lastUpdate)
+	assert.Equal(t, "1674170951", lastUpdate.UpdateId)
+}
+
+func TestCrashGuardCountsCurrentAndPreviousWindows(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockWorkingExpoResponse("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	haltedPath := filepath.Join(projectRoot, "./test/test-updates/branch-1/1/1674170951/halted")
+	defer os.Remove(haltedPath)
+	os.Setenv("CRASH_GUARD_CONFIG", `{"branch-1":{"threshold":0.3,"minActiveUsers":3,"windowSeconds":3600}}`)
+	crashguard.ResetSettings()
+	defer os.Unsetenv("CRASH_GUARD_CONFIG")
+	ctx := context.Background()
+	currentUpdate, err := update.GetUpdate("branch-1", "1", "1674170951")
+	require.NoError(t, err)
+	metadata, err := update.GetMetadata(ctx, *currentUpdate)
+	require.NoError(t, err)
+	currentUpdateId := crypto.ConvertSHA256HashToUUID(metadata.ID)
+
+	cache := cache2.GetCache()
+	window := crashguard.Window(3600, time.Now())
+	expiredErrorUsers := []string{"expired-1", "expired-2"}
+	require.NoError(t, cache.Pfadd(ctx, crashguard.ComputeActiveUsersCacheKey("branch-1", "1", "android", currentUpdateId, window-2), expiredErrorUsers, nil))
+	require.NoError(t, cache.Pfadd(ctx, crashguard.ComputeErrorUsersCacheKey("branch-1", "1", "android", currentUpdateId, window-2), expiredErrorUsers, nil))
+	require.NoError(t, cache.Pfadd(ctx, crashguard.ComputeActiveUsersCacheKey("branch-1", "1", "android", currentUpdateId, window-1), []string{"client-1"}, nil))
+
+	createCrashGuardManifestRequest(currentUpdateId, "client-2", false)
+	_, err = os.Stat(haltedPath)
+	assert.True(t, os.IsNotExist(err), "Expected users of expired windows not to be counted")
+
+	createCrashGuardManifestRequest(currentUpdateId, "client-3", true)
+	_, err = os.Stat(haltedPath)
+	assert.NoError(t, err, "Expected users of the previous window to be counted")
+}
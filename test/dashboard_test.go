@@ -28,6 +28,25 @@ func TestLoginDashboardNotEnabled(t *testing.T) {
 
 }
 
+func TestRefreshTokenIsNotCountedInLoginRateLimit(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	t.Setenv("RATE_LIMIT_LOGIN", "1/1h")
+	router := infrastructure.NewRouter()
+	post := func(path string) int {
+		respRec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		router.ServeHTTP(respRec, req)
+		return respRec.Code
+	}
+	for i := 0; i < 3; i++ {
+		assert.NotEqual(t, http.StatusTooManyRequests, post("/auth/refreshToken"))
+	}
+	assert.NotEqual(t, http.StatusTooManyRequests, post("/auth/login"))
+	assert.Equal(t, http.StatusTooManyRequests, post("/auth/login"))
+}
+
 func TestLoginInvalidPassword(t *testing.T) {
 	teardown := setup(t)
 	defer teardown()
@@ -226,7 +245,7 @@ func TestUpdatesRegularBranch1(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer "+login().Token)
 	router.ServeHTTP(respRec, req)
 	assert.Equal(t, http.StatusOK, respRec.Code)
-	assert.Equal(t, "[{\"updateUUID\":\"04b793a0-b6ab-fd4f-308c-b91d812adec2\",\"updateId\":\"1674170951\",\"createdAt\":\"1970-01-20T09:02:50Z\",\"commitHash\":\"1674170951\",\"platform\":\"android\"}]", strings.TrimSpace(string(respRec.Body.Bytes())))
+	assert.Equal(t, "[{\"updateUUID\":\"04b793a0-b6ab-fd4f-308c-b91d812adec2\",\"updateId\":\"1674170951\",\"createdAt\":\"1970-01-20T09:02:50Z\",\"commitHash\":\"1674170951\",\"platform\":\"android\",\"isServed\":true,\"servedReason\":\"latest\"}]", strings.TrimSpace(string(respRec.Body.Bytes())))
 }
 
 func TestUpdatesMultiBranch2(t *testing.T) {
@@ -242,7 +261,7 @@ func TestUpdatesMultiBranch2(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer "+login().Token)
 	router.ServeHTTP(respRec, req)
 	assert.Equal(t, http.StatusOK, respRec.Code)
-	assert.Equal(t, "[{\"updateUUID\":\"68e096e2-a619-9d56-7f7c-89f97bc27312\",\"updateId\":\"1737455526\",\"createdAt\":\"1970-01-21T02:37:35Z\",\"commitHash\":\"\",\"platform\":\"ios\"},{\"updateUUID\":\"fdc14544-9e15-732f-cd9c-e3e26c55cbea\",\"updateId\":\"1674170951\",\"createdAt\":\"1970-01-20T09:02:50Z\",\"commitHash\":\"\",\"platform\":\"android\"},{\"updateUUID\":\"d100f19f-e0be-45c4-212a-27d1f067552b\",\"updateId\":\"1666629107\",\"createdAt\":\"1970-01-20T06:57:09Z\",\"commitHash\":\"1674170951\",\"platform\":\"android\"},{\"updateUUID\":\"Rollback to embedded\",\"updateId\":\"1666629141\",\"createdAt\":\"1970-01-20T06:57:09Z\",\"commitHash\":\"1674170951\",\"platform\":\"ios\"},{\"updateUUID\":\"Rollback to embedded\",\"updateId\":\"1666304169\",\"createdAt\":\"1970-01-20T06:51:44Z\",\"commitHash\":\"1674170951\",\"platform\":\"ios\"}]", strings.TrimSpace(string(respRec.Body.Bytes())))
+	assert.Equal(t, "[{\"updateUUID\":\"68e096e2-a619-9d56-7f7c-89f97bc27312\",\"updateId\":\"1737455526\",\"createdAt\":\"1970-01-21T02:37:35Z\",\"commitHash\":\"\",\"platform\":\"ios\",\"isServed\":true,\"servedReason\":\"latest\"},{\"updateUUID\":\"fdc14544-9e15-732f-cd9c-e3e26c55cbea\",\"updateId\":\"1674170951\",\"createdAt\":\"1970-01-20T09:02:50Z\",\"commitHash\":\"\",\"platform\":\"android\",\"isServed\":true,\"servedReason\":\"latest\"},{\"updateUUID\":\"d100f19f-e0be-45c4-212a-27d1f067552b\",\"updateId\":\"1666629107\",\"createdAt\":\"1970-01-20T06:57:09Z\",\"commitHash\":\"1674170951\",\"platform\":\"android\",\"isServed\":false},{\"updateUUID\":\"Rollback to embedded\",\"updateId\":\"1666629141\",\"createdAt\":\"1970-01-20T06:57:09Z\",\"commitHash\":\"1674170951\",\"platform\":\"ios\",\"isServed\":false},{\"updateUUID\":\"Rollback to embedded\",\"updateId\":\"1666304169\",\"createdAt\":\"1970-01-20T06:51:44Z\",\"commitHash\":\"1674170951\",\"platform\":\"ios\",\"isServed\":false}]", strings.TrimSpace(string(respRec.Body.Bytes())))
 }
 
 func TestUpdatesSomeNotValidBranch4(t *testing.T) {
@@ -258,5 +277,30 @@ func TestUpdatesSomeNotValidBranch4(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer "+login().Token)
 	router.ServeHTTP(respRec, req)
 	assert.Equal(t, http.StatusOK, respRec.Code)
-	assert.Equal(t, "[{\"updateUUID\":\"3f23a8c4-cd0e-a5a4-63f2-bb2841e95a01\",\"updateId\":\"1674170951\",\"createdAt\":\"1970-01-20T09:02:50Z\",\"commitHash\":\"1674170951\",\"platform\":\"android\"}]", strings.TrimSpace(string(respRec.Body.Bytes())))
+	assert.Equal(t, "[{\"updateUUID\":\"3f23a8c4-cd0e-a5a4-63f2-bb2841e95a01\",\"updateId\":\"1674170951\",\"createdAt\":\"1970-01-20T09:02:50Z\",\"commitHash\":\"1674170951\",\"platform\":\"android\",\"isServed\":true,\"servedReason\":\"latest\"}]", strings.TrimSpace(string(respRec.Body.Bytes())))
+}
+
+func TestLoginRateLimited(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Setenv("RATE_LIMIT_LOGIN", "3/1h")
+	defer os.Unsetenv("RATE_LIMIT_LOGIN")
+	router := infrastructure.NewRouter()
+	login := func() *httptest.ResponseRecorder {
+		respRec := httptest.NewRecorder()
+		formData := url.Values{}
+		formData.Set("password", "wrongpassword")
+		req, _ := http.NewRequest("POST", "/auth/login", strings.NewReader(formData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "192.0.2.10:5000"
+		router.ServeHTTP(respRec, req)
+		return respRec
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login().Code)
+	}
+	respRec := login()
+	assert.Equal(t, http.StatusTooManyRequests, respRec.Code)
+	assert.NotEmpty(t, respRec.Header().Get("Retry-After"))
+	assert.Equal(t, "3", respRec.Header().Get("RateLimit-Limit"))
 }
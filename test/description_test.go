@@ -0,0 +1,95 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestPublishWithMessageAndMetadata(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	samplePath := filepath.Join(projectRoot, "/test/test-updates/branch-4/1/1674170952")
+	input := ComputeUploadRequestsInput(samplePath)
+	input.Message = "Fix the login screen"
+	input.Metadata = map[string]string{
+		"author":       "jane",
+		"ciRunUrl":     "https://ci.example.com/runs/42",
+		"releaseNotes": "You can log in again",
+	}
+	input.ManifestFields = []string{"message", "releaseNotes"}
+	updateId := performUploadWithInput(t, projectRoot, "DO_NOT_USE", "1", samplePath, "android", input)
+	require.Equal(t, 200, markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId, "android").Code)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://localhost:3000/api/branch/DO_NOT_USE/runtimeVersion/1/updates", nil)
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "DO_NOT_USE", "RUNTIME_VERSION": "1"})
+	handlers.GetUpdatesHandler(w, r)
+	require.Equal(t, 200, w.Code)
+	var items []handlers.UpdateItem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	require.Len(t, items, 1)
+	assert.Equal(t, input.Message, items[0].Message)
+	assert.Equal(t, input.Metadata, items[0].Metadata)
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", fmt.Sprintf("http://localhost:3000/api/branch/DO_NOT_USE/runtimeVersion/1/updates/%s", updateId), nil)
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "DO_NOT_USE", "RUNTIME_VERSION": "1", "UPDATE_ID": updateId})
+	handlers.GetUpdateDetails(w, r)
+	require.Equal(t, 200, w.Code)
+	var details handlers.UpdateDetails
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, input.Message, details.Message)
+	assert.Equal(t, input.Metadata, details.Metadata)
+	assert.Equal(t, input.ManifestFields, details.ManifestFields)
+
+	published, err := update.GetUpdate("DO_NOT_USE", "1", updateId)
+	require.NoError(t, err)
+	metadata, err := update.GetMetadata(ctx, *published)
+	require.NoError(t, err)
+	manifest, err := update.ComposeUpdateManifest(ctx, &metadata, *published, "android")
+	require.NoError(t, err)
+	var manifestMetadata map[string]string
+	require.NoError(t, json.Unmarshal(manifest.Metadata, &manifestMetadata))
+	assert.Equal(t, map[string]string{
+		"branch":       "DO_NOT_USE",
+		"message":      "Fix the login screen",
+		"releaseNotes": "You can log in again",
+	}, manifestMetadata, "Expected only the manifest fields to be sent to the app")
+}
+
+func TestPublishWithInvalidManifestField(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+
+	samplePath := filepath.Join(projectRoot, "/test/test-updates/branch-4/1/1674170952")
+	input := ComputeUploadRequestsInput(samplePath)
+	input.Metadata = map[string]string{"author": "jane"}
+	input.ManifestFields = []string{"releaseNotes"}
+	body, err := json.Marshal(input)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "http://localhost:3000/requestUploadUrl/DO_NOT_USE?runtimeVersion=1&platform=android&commitHash=abc123", bytes.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "DO_NOT_USE"})
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	handlers.RequestUploadUrlHandler(w, r)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid update description")
+}
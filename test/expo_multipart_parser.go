@@ -2,6 +2,7 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -82,7 +83,7 @@ func IsMultipartPartWithName(part MultipartPart, name string) bool {
 }
 
 func ValidateSignatureHeader(signature string, content string) bool {
-	publicCert := keyStore.GetPublicExpoKey()
+	publicCert := keyStore.GetPublicExpoKey(context.Background())
 	signatureParts := strings.Split(signature, ",")
 	if len(signatureParts) != 2 {
 		fmt.Println("Invalid signature format")
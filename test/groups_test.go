@@ -0,0 +1,130 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type updateGroupResponse struct {
+	GroupId string                           `json:"groupId"`
+	Updates []handlers.UpdateGroupUploadItem `json:"updates"`
+}
+
+func requestUploadGroup(t *testing.T, projectRoot, branch, sampleUpdatePath string) updateGroupResponse {
+	os.Setenv("LOCAL_BUCKET_BASE_PATH", filepath.Join(projectRoot, "./updates"))
+	body, err := json.Marshal(handlers.UpdateGroupRequest{
+		FileNamesRequest: ComputeUploadRequestsInput(sampleUpdatePath),
+		Updates: []types.UpdateGroupMember{
+			{Platform: "ios", RuntimeVersion: "1"},
+			{Platform: "android", RuntimeVersion: "1"},
+		},
+	})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", fmt.Sprintf("http://localhost:3000/requestUploadGroup/%s?commitHash=abc123", branch), bytes.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": branch})
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	handlers.RequestUploadGroupHandler(w, r)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var response updateGroupResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Updates, 2)
+	assert.NotEqual(t, response.Updates[0].UpdateId, response.Updates[1].UpdateId)
+	return response
+}
+
+func assertServedUpdate(t *testing.T, branch, platform, expectedUpdateId string) {
+	t.Helper()
+	served, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), branch, "1", platform)
+	require.NoError(t, err)
+	if expectedUpdateId == "" {
+		assert.Nil(t, served, "Expected no %s update to be served", platform)
+		return
+	}
+	require.NotNil(t, served, "Expected a %s update to be served", platform)
+	assert.Equal(t, expectedUpdateId, served.UpdateId)
+}
+
+func TestUpdateGroupIsServedOnceComplete(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	sampleUpdatePath := filepath.Join(projectRoot, "/test/test-updates/branch-1/1/1674170951")
+	group := requestUploadGroup(t, projectRoot, "DO_NOT_USE", sampleUpdatePath)
+	ios, android := group.Updates[0], group.Updates[1]
+	for _, member := range group.Updates {
+		uploadUpdateFiles(t, projectRoot, "DO_NOT_USE", "1", member.UpdateId, sampleUpdatePath, member.UploadRequests)
+	}
+
+	w := markUpdateAsUploaded(t, "DO_NOT_USE", "1", ios.UpdateId, "ios")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assertServedUpdate(t, "DO_NOT_USE", "ios", "")
+
+	w = markUpdateAsUploaded(t, "DO_NOT_USE", "1", android.UpdateId, "android")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assertServedUpdate(t, "DO_NOT_USE", "ios", ios.UpdateId)
+	assertServedUpdate(t, "DO_NOT_USE", "android", android.UpdateId)
+
+	iosUpdate, err := update.GetUpdate("DO_NOT_USE", "1", ios.UpdateId)
+	require.NoError(t, err)
+	storedGroup, err := update.GetUpdateGroup(context.Background(), *iosUpdate)
+	require.NoError(t, err)
+	require.NotNil(t, storedGroup)
+	assert.Equal(t, group.GroupId, storedGroup.Id)
+
+	// Republishing the group publishes both platforms again as a new group.
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", fmt.Sprintf("http://localhost:3000/republish/DO_NOT_USE?runtimeVersion=1&platform=ios&updateId=%s&group=true", ios.UpdateId), nil)
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "DO_NOT_USE"})
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	handlers.RepublishHandler(w, r)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var republished []types.Update
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &republished))
+	require.Len(t, republished, 2)
+	assertServedUpdate(t, "DO_NOT_USE", "ios", republished[0].UpdateId)
+	assertServedUpdate(t, "DO_NOT_USE", "android", republished[1].UpdateId)
+
+	// Rolling back to the first group serves it again on both platforms.
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", fmt.Sprintf("http://localhost:3000/rollback/DO_NOT_USE?runtimeVersion=1&platform=android&updateId=%s&group=true", android.UpdateId), nil)
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "DO_NOT_USE"})
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	handlers.RollbackHandler(w, r)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assertServedUpdate(t, "DO_NOT_USE", "ios", ios.UpdateId)
+	assertServedUpdate(t, "DO_NOT_USE", "android", android.UpdateId)
+}
+
+func TestInvalidGroupedUpdateDeletesTheGroup(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	sampleUpdatePath := filepath.Join(projectRoot, "/test/test-updates/branch-1/1/1674170951")
+	group := requestUploadGroup(t, projectRoot, "DO_NOT_USE", sampleUpdatePath)
+	ios, android := group.Updates[0], group.Updates[1]
+	uploadUpdateFiles(t, projectRoot, "DO_NOT_USE", "1", android.UpdateId, sampleUpdatePath, android.UploadRequests)
+
+	w := markUpdateAsUploaded(t, "DO_NOT_USE", "1", ios.UpdateId, "ios")
+	assert.Equal(t, 400, w.Code)
+	for _, member := range group.Updates {
+		_, err := os.Stat(filepath.Join(projectRoot, "updates", "DO_NOT_USE", "1", member.UpdateId))
+		assert.True(t, os.IsNotExist(err), "Expected update %s of the group to be deleted", member.UpdateId)
+	}
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"encoding/json"
+	"expo-open-ota/internal/health"
+	infrastructure "expo-open-ota/internal/router"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestLivenessProbe(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	router := infrastructure.NewRouter()
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/livez", nil)
+	router.ServeHTTP(respRec, req)
+	assert.Equal(t, http.StatusOK, respRec.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, respRec.Body.String())
+}
+
+func getReadiness(t *testing.T) (int, health.Report) {
+	router := infrastructure.NewRouter()
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(respRec, req)
+	var report health.Report
+	assert.Nil(t, json.Unmarshal(respRec.Body.Bytes(), &report))
+	return respRec.Code, report
+}
+
+func enableExpoApiCheck(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_EXPO_API", "true")
+	health.ResetExpoApiCheck()
+	t.Cleanup(health.ResetExpoApiCheck)
+}
+
+func TestReadinessProbeWithHealthyDependencies(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	enableExpoApiCheck(t)
+	mockWorkingExpoResponse("staging")
+	code, report := getReadiness(t)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOK, report.Status)
+	for _, name := range []string{"bucket", "cache", "keyStore", "expoApi"} {
+		assert.Equal(t, health.StatusOK, report.Checks[name].Status, name)
+	}
+}
+
+func TestReadinessProbeWithUnreachableExpoApi(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	enableExpoApiCheck(t)
+	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql",
+		httpmock.NewStringResponder(http.StatusBadGateway, "Bad Gateway"))
+	code, report := getReadiness(t)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusError, report.Status)
+	assert.Equal(t, health.StatusError, report.Checks["expoApi"].Status)
+	assert.NotEmpty(t, report.Checks["expoApi"].Error)
+	assert.Equal(t, health.StatusOK, report.Checks["bucket"].Status)
+}
+
+func TestReadinessProbeReusesExpoApiResult(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	enableExpoApiCheck(t)
+	mockWorkingExpoResponse("staging")
+	code, _ := getReadiness(t)
+	assert.Equal(t, http.StatusOK, code)
+	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql",
+		httpmock.NewStringResponder(http.StatusBadGateway, "Bad Gateway"))
+	code, report := getReadiness(t)
+	assert.Equal(t, http.StatusOK, code, "Expected the last Expo API result to be reused")
+	assert.Equal(t, health.StatusOK, report.Checks["expoApi"].Status)
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+}
+
+func TestReadinessProbeSkipsExpoApiByDefault(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	os.Unsetenv("HEALTH_CHECK_EXPO_API")
+	httpmock.RegisterResponder("POST", "https://api.expo.dev/graphql",
+		httpmock.NewStringResponder(http.StatusBadGateway, "Bad Gateway"))
+	code, report := getReadiness(t)
+	assert.Equal(t, http.StatusOK, code)
+	_, hasExpoCheck := report.Checks["expoApi"]
+	assert.False(t, hasExpoCheck)
+}
+
+func TestReadinessProbeWhileShuttingDown(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	health.MarkShuttingDown()
+	defer health.ResetShuttingDown()
+	router := infrastructure.NewRouter()
+	respRec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	router.ServeHTTP(respRec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, respRec.Code)
+	assert.JSONEq(t, `{"status":"shutting_down","checks":{}}`, respRec.Body.String())
+}
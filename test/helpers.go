@@ -1,13 +1,16 @@
 package test
 
 import (
+	"context"
 	"encoding/json"
 	"expo-open-ota/internal/bucket"
 	cache2 "expo-open-ota/internal/cache"
 	"expo-open-ota/internal/cdn"
+	"expo-open-ota/internal/crashguard"
 	"expo-open-ota/internal/handlers"
 	"expo-open-ota/internal/metrics"
 	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
 	"github.com/jarcoal/httpmock"
 	"net/http"
 	"os"
@@ -31,7 +34,7 @@ func setup(t *testing.T) func() {
 func GlobalBeforeEach() {
 	metrics.CleanupMetrics()
 	cache := cache2.GetCache()
-	_ = cache.Clear()
+	_ = cache.Clear(context.Background())
 	newTime := time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC)
 
 	ChangeModTimeRecursively(os.Getenv("LOCAL_BUCKET_BASE_PATH"), newTime)
@@ -40,8 +43,10 @@ func GlobalBeforeEach() {
 func GlobalAfterEach(t *testing.T) {
 	t.Helper()
 	t.Cleanup(func() {
+		update.WaitPrewarms()
 		bucket.ResetBucketInstance()
 		cdn.ResetCDNInstance()
+		crashguard.ResetSettings()
 		projectRoot, err := findProjectRoot()
 		if err != nil {
 			t.Errorf("Error finding project root: %v", err)
@@ -59,6 +64,12 @@ func GlobalAfterEach(t *testing.T) {
 				}
 			}
 		}
+		_ = os.Remove(filepath.Join(projectRoot, "./test/test-updates/.auditlog"))
+		_ = os.Remove(filepath.Join(projectRoot, "./updates/.auditlog"))
+		_ = os.Remove(filepath.Join(projectRoot, "./updates/DO_NOT_USE/.auditlog"))
+		_ = os.RemoveAll(filepath.Join(projectRoot, "./test/test-updates/auditlog"))
+		_ = os.RemoveAll(filepath.Join(projectRoot, "./updates/auditlog"))
+		_ = os.Remove(filepath.Join(projectRoot, "./updates/DO_NOT_USE/branch-protection.json"))
 		// Also remove all folders > 1674170951 in ./test/test-updates/branch-1/1
 		updatesPath = filepath.Join(projectRoot, "./test/test-updates/branch-1/1")
 		updates, err = os.ReadDir(updatesPath)
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"encoding/json"
 	"expo-open-ota/internal/bucket"
 	cache2 "expo-open-ota/internal/cache"
@@ -273,17 +274,17 @@ func TestSkippingNotValidUpdatesAndCache(t *testing.T) {
 
 			return httpmock.NewStringResponse(404, "Unknown operation"), nil
 		})
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion("branch-4", "1", "android")
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), "branch-4", "1", "android")
 	if err != nil {
 		t.Errorf("Error getting latest update: %v", err)
 	}
 	assert.Equal(t, "1674170951", lastUpdate.UpdateId, "Expected a specific update id")
 	resolvedBucket := bucket.GetBucket()
-	file, _ := resolvedBucket.GetFile(*lastUpdate, ".check")
+	file, _ := resolvedBucket.GetFile(context.Background(), *lastUpdate, ".check")
 	defer file.Reader.Close()
 	cache := cache2.GetCache()
 	cacheKey := update.ComputeLastUpdateCacheKey("branch-4", "1", "android")
-	value := cache.Get(cacheKey)
+	value := cache.Get(context.Background(), cacheKey)
 	assert.Equal(t, "{\"branch\":\"branch-4\",\"runtimeVersion\":\"1\",\"updateId\":\"1674170951\",\"createdAt\":1674170951000000}", value, "Expected a specific value")
 	assert.NotNil(t, file.Reader, "Expected a file")
 }
@@ -308,11 +309,12 @@ func TestValidRequestForStagingManifest(t *testing.T) {
 	if err != nil {
 		t.Errorf("Error parsing response: %v", err)
 	}
-	assert.Equal(t, 1, len(parts), "Expected 1 parts in the response")
+	assert.Equal(t, 2, len(parts), "Expected 2 parts in the response")
 
 	manifestPart := parts[0]
 
 	assert.Equal(t, true, IsMultipartPartWithName(manifestPart, "manifest"), "Expected a part with name 'manifest'")
+	assert.Equal(t, true, IsMultipartPartWithName(parts[1], "extensions"), "Expected a part with name 'extensions'")
 	body := manifestPart.Body
 
 	signature := manifestPart.Headers["Expo-Signature"]
@@ -459,6 +461,16 @@ func TestRollbackResponseforManifest(t *testing.T) {
 		t.Errorf("Error parsing json body: %v", err)
 	}
 	assert.Equal(t, "rollBackToEmbedded", directive.Type, "rollBackToEmbedded")
+
+	w = httptest.NewRecorder()
+	r.Header.Set("accept", "application/expo+json")
+	handlers.ManifestHandler(w, r)
+	assert.Equal(t, 200, w.Code, "Expected the directive to be served as JSON")
+	assert.Equal(t, "application/expo+json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, true, ValidateSignatureHeader(w.Header().Get("expo-signature"), w.Body.String()), "Expected a valid signature header")
+	directive = types.RollbackDirective{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &directive))
+	assert.Equal(t, "rollBackToEmbedded", directive.Type)
 }
 
 func TestValidRequestForProductionManifest(t *testing.T) {
@@ -527,11 +539,12 @@ func TestValidRequestForProductionManifest(t *testing.T) {
 	if err != nil {
 		t.Errorf("Error parsing response: %v", err)
 	}
-	assert.Equal(t, 1, len(parts), "Expected 1 parts in the response")
+	assert.Equal(t, 2, len(parts), "Expected 2 parts in the response")
 
 	manifestPart := parts[0]
 
 	assert.Equal(t, true, IsMultipartPartWithName(manifestPart, "manifest"), "Expected a part with name 'manifest'")
+	assert.Equal(t, true, IsMultipartPartWithName(parts[1], "extensions"), "Expected a part with name 'extensions'")
 	body := manifestPart.Body
 
 	signature := manifestPart.Headers["Expo-Signature"]
@@ -635,3 +648,77 @@ func TestEmptyRequestForAndroid(t *testing.T) {
 	}
 	assert.Equal(t, "{\"type\":\"noUpdateAvailable\"}", body)
 }
+
+func createNegotiatedManifestRequest(channel string, accept string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://localhost:3000/manifest", nil)
+	r.Header.Add("expo-platform", "android")
+	r.Header.Add("expo-runtime-version", "1")
+	r.Header.Add("expo-protocol-version", "1")
+	r.Header.Add("expo-expect-signature", "true")
+	r.Header.Add("expo-channel-name", channel)
+	r.Header.Add("accept", accept)
+	handlers.ManifestHandler(w, r)
+	return w
+}
+
+func TestJSONManifestWhenMultipartIsNotAccepted(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockWorkingExpoResponse("staging")
+
+	w := createNegotiatedManifestRequest("staging", "application/expo+json;q=0.9, application/json;q=0.8, multipart/mixed;q=0.1")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/expo+json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "1", w.Header().Get("expo-protocol-version"))
+	body := w.Body.String()
+	assert.Equal(t, true, ValidateSignatureHeader(w.Header().Get("expo-signature"), body), "Expected a valid signature header")
+	var updateManifest types.UpdateManifest
+	assert.Nil(t, json.Unmarshal([]byte(body), &updateManifest))
+	assert.Equal(t, "04b793a0-b6ab-fd4f-308c-b91d812adec2", updateManifest.Id)
+
+	w = createNegotiatedManifestRequest("staging", "application/json")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestMultipartManifestIsPreferredWhenAccepted(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockWorkingExpoResponse("staging")
+
+	w := createNegotiatedManifestRequest("staging", "application/expo+json;q=0.9, application/json;q=0.8, multipart/mixed")
+	assert.Equal(t, 200, w.Code)
+	parts, err := ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(parts))
+	assert.Equal(t, true, IsMultipartPartWithName(parts[1], "extensions"), "Expected a part with name 'extensions'")
+	var extensions types.ManifestExtensions
+	assert.Nil(t, json.Unmarshal([]byte(parts[1].Body), &extensions))
+	assert.Equal(t, 2, len(extensions.AssetRequestHeaders))
+	for _, key := range []string{"4f1cb2cac2370cd5050681232e8575a8", "82adadb1fb6e489d04ad95fd79670deb"} {
+		assert.Equal(t, "staging", extensions.AssetRequestHeaders[key]["expo-channel-name"])
+		assert.Equal(t, "branch-1", extensions.AssetRequestHeaders[key]["expo-open-ota-branch"])
+		assert.NotEmpty(t, extensions.AssetRequestHeaders[key]["expo-open-ota-cohort"])
+	}
+}
+
+func TestNoUpdateAvailableWhenMultipartIsNotAccepted(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockWorkingExpoResponse("staging")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://localhost:3000/manifest", nil)
+	r.Header.Add("expo-platform", "android")
+	r.Header.Add("expo-runtime-version", "404")
+	r.Header.Add("expo-protocol-version", "1")
+	r.Header.Add("expo-channel-name", "staging")
+	r.Header.Add("accept", "application/expo+json")
+	handlers.ManifestHandler(w, r)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/expo+json; charset=utf-8", w.Header().Get("Content-Type"))
+	var directive types.NoUpdateAvailableDirective
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &directive))
+	assert.Equal(t, "noUpdateAvailable", directive.Type)
+}
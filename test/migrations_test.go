@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"expo-open-ota/internal/bucket"
 	"expo-open-ota/internal/migration"
 	"expo-open-ota/internal/types"
@@ -14,46 +15,58 @@ type dummyMigrationsBucket struct {
 	actionsRecorded   []string
 }
 
-func (b *dummyMigrationsBucket) DeleteUpdateFolder(_, _, _ string) error {
+func (b *dummyMigrationsBucket) DeleteUpdateFolder(_ context.Context, _, _, _ string) error {
 	b.actionsRecorded = append(b.actionsRecorded, "DeleteUpdateFolder")
 	return nil
 }
-func (b *dummyMigrationsBucket) RequestUploadUrlForFileUpdate(_, _, _, _ string) (string, error) {
+func (b *dummyMigrationsBucket) RequestUploadUrlForFileUpdate(_ context.Context, _, _, _, _ string) (string, error) {
 	b.actionsRecorded = append(b.actionsRecorded, "RequestUploadUrlForFileUpdate")
 	return "", nil
 }
-func (b *dummyMigrationsBucket) GetUpdates(_, _ string) ([]types.Update, error) {
+func (b *dummyMigrationsBucket) GetUpdates(_ context.Context, _, _ string) ([]types.Update, error) {
 	b.actionsRecorded = append(b.actionsRecorded, "GetUpdates")
 	return nil, nil
 }
-func (b *dummyMigrationsBucket) GetFile(_ types.Update, _ string) (*types.BucketFile, error) {
+func (b *dummyMigrationsBucket) GetFile(_ context.Context, _ types.Update, _ string) (*types.BucketFile, error) {
 	b.actionsRecorded = append(b.actionsRecorded, "GetFile")
 	return nil, nil
 }
-func (b *dummyMigrationsBucket) GetBranches() ([]string, error) {
+func (b *dummyMigrationsBucket) GetBranches(_ context.Context) ([]string, error) {
 	b.actionsRecorded = append(b.actionsRecorded, "GetBranches")
 	return nil, nil
 }
-func (b *dummyMigrationsBucket) GetRuntimeVersions(_ string) ([]bucket.RuntimeVersionWithStats, error) {
+func (b *dummyMigrationsBucket) GetRuntimeVersions(_ context.Context, _ string) ([]bucket.RuntimeVersionWithStats, error) {
 	b.actionsRecorded = append(b.actionsRecorded, "GetRuntimeVersions")
 	return nil, nil
 }
-func (b *dummyMigrationsBucket) UploadFileIntoUpdate(_ types.Update, _ string, _ io.Reader) error {
+func (b *dummyMigrationsBucket) UploadFileIntoUpdate(_ context.Context, _ types.Update, _ string, _ io.Reader) error {
 	b.actionsRecorded = append(b.actionsRecorded, "UploadFileIntoUpdate")
 	return nil
 }
-func (b *dummyMigrationsBucket) CreateUpdateFrom(_ *types.Update, _ string) (*types.Update, error) {
+func (b *dummyMigrationsBucket) CreateUpdateFrom(_ context.Context, _ *types.Update, _ string, _ string) (*types.Update, error) {
 	b.actionsRecorded = append(b.actionsRecorded, "CreateUpdateFrom")
 	return nil, nil
 }
-func (b *dummyMigrationsBucket) RetrieveMigrationHistory() ([]string, error) {
+func (b *dummyMigrationsBucket) GetRootFile(_ context.Context, _ string) (*types.BucketFile, error) {
+	b.actionsRecorded = append(b.actionsRecorded, "GetRootFile")
+	return nil, nil
+}
+func (b *dummyMigrationsBucket) UploadRootFile(_ context.Context, _ string, _ io.Reader) error {
+	b.actionsRecorded = append(b.actionsRecorded, "UploadRootFile")
+	return nil
+}
+func (b *dummyMigrationsBucket) ListRootFiles(_ context.Context, _ string, _ string, _ int) ([]string, error) {
+	b.actionsRecorded = append(b.actionsRecorded, "ListRootFiles")
+	return nil, nil
+}
+func (b *dummyMigrationsBucket) RetrieveMigrationHistory(_ context.Context) ([]string, error) {
 	return b.migrationsHistory, nil
 }
-func (b *dummyMigrationsBucket) ApplyMigration(migrationId string) error {
+func (b *dummyMigrationsBucket) ApplyMigration(_ context.Context, migrationId string) error {
 	b.migrationsHistory = append(b.migrationsHistory, migrationId)
 	return nil
 }
-func (b *dummyMigrationsBucket) RemoveMigrationFromHistory(migrationId string) error {
+func (b *dummyMigrationsBucket) RemoveMigrationFromHistory(_ context.Context, migrationId string) error {
 	for i, id := range b.migrationsHistory {
 		if id == migrationId {
 			b.migrationsHistory = append(b.migrationsHistory[:i], b.migrationsHistory[i+1:]...)
@@ -68,11 +81,11 @@ func TestShouldNotRunAppliedMigrations(t *testing.T) {
 		Id:   "20250415_fake_migrationA",
 		Time: time.Date(2025, 4, 15, 0, 0, 0, 0, time.UTC),
 		UpFunc: func(b bucket.Bucket) error {
-			b.DeleteUpdateFolder("", "", "")
+			b.DeleteUpdateFolder(context.Background(), "", "", "")
 			return nil
 		},
 		DownFunc: func(b bucket.Bucket) error {
-			b.GetBranches()
+			b.GetBranches(context.Background())
 			return nil
 		},
 	}
@@ -108,11 +121,11 @@ func TestShouldRunMultipleMigrationsAsc(t *testing.T) {
 		Id:   "20250415_fake_migrationA",
 		Time: time.Date(2025, 4, 15, 0, 0, 0, 0, time.UTC),
 		UpFunc: func(b bucket.Bucket) error {
-			b.DeleteUpdateFolder("", "", "")
+			b.DeleteUpdateFolder(context.Background(), "", "", "")
 			return nil
 		},
 		DownFunc: func(b bucket.Bucket) error {
-			b.GetBranches()
+			b.GetBranches(context.Background())
 			return nil
 		},
 	}
@@ -120,11 +133,11 @@ func TestShouldRunMultipleMigrationsAsc(t *testing.T) {
 		Id:   "20250416_fake_migrationB",
 		Time: time.Date(2025, 4, 16, 0, 0, 0, 0, time.UTC),
 		UpFunc: func(b bucket.Bucket) error {
-			b.GetFile(types.Update{}, "")
+			b.GetFile(context.Background(), types.Update{}, "")
 			return nil
 		},
 		DownFunc: func(b bucket.Bucket) error {
-			b.GetRuntimeVersions("")
+			b.GetRuntimeVersions(context.Background(), "")
 			return nil
 		},
 	}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createPromoteRequest(branch, runtimeVersion, platform, updateId, targetBranch string) *httptest.ResponseRecorder {
+	q := fmt.Sprintf("http://localhost:3000/promote/%s?runtimeVersion=%s&platform=%s&updateId=%s&targetBranch=%s", branch, runtimeVersion, platform, updateId, targetBranch)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", q, nil)
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": branch})
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	handlers.PromoteHandler(w, r)
+	return w
+}
+
+func copyTestUpdates(t *testing.T) {
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	os.Setenv("LOCAL_BUCKET_BASE_PATH", filepath.Join(projectRoot, "./updates", "DO_NOT_USE"))
+	require.NoError(t, copyDir(filepath.Join(projectRoot, "test", "test-updates"), filepath.Join(projectRoot, "updates", "DO_NOT_USE")))
+}
+
+func TestPromoteUpdate(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	copyTestUpdates(t)
+
+	w := createPromoteRequest("branch-2", "1", "ios", "1737455526", "branch-1")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var body handlers.PromoteResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "branch-1", body.Update.Branch)
+	assert.NotEmpty(t, body.UpdateUUID)
+	require.NotNil(t, body.PromotedFrom)
+	assert.Equal(t, "branch-2", body.PromotedFrom.Branch)
+	assert.Equal(t, "1737455526", body.PromotedFrom.UpdateId)
+
+	ctx := context.Background()
+	source, err := update.GetUpdate("branch-2", "1", "1737455526")
+	require.NoError(t, err)
+	sourceMetadata, err := update.RetrieveUpdateStoredMetadata(ctx, *source)
+	require.NoError(t, err)
+	assert.Equal(t, sourceMetadata.UpdateUUID, body.PromotedFrom.UpdateUUID)
+	assert.NotEqual(t, sourceMetadata.UpdateUUID, body.UpdateUUID, "Expected the promoted update to get its own UUID")
+
+	latest, err := update.GetLatestUpdateBundlePathForRuntimeVersion(ctx, "branch-1", "1", "ios")
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, body.Update.UpdateId, latest.UpdateId, "Expected the promoted update to be served on the target branch")
+	storedMetadata, err := update.RetrieveUpdateStoredMetadata(ctx, *latest)
+	require.NoError(t, err)
+	require.NotNil(t, storedMetadata.PromotedFrom)
+	assert.Equal(t, "branch-2", storedMetadata.PromotedFrom.Branch)
+	assert.Equal(t, body.UpdateUUID, storedMetadata.UpdateUUID)
+
+	sourceExpoMetadata, err := update.GetMetadata(ctx, *source)
+	require.NoError(t, err)
+	promotedExpoMetadata, err := update.GetMetadata(ctx, *latest)
+	require.NoError(t, err)
+	assert.Equal(t, sourceExpoMetadata.MetadataJSON, promotedExpoMetadata.MetadataJSON, "Expected the same assets")
+}
+
+func TestPromoteUpdateToSameBranch(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	w := createPromoteRequest("branch-2", "1", "ios", "1737455526", "branch-2")
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestPromoteUpdateWithPlatformMismatch(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	copyTestUpdates(t)
+	w := createPromoteRequest("branch-2", "1", "android", "1737455526", "branch-1")
+	assert.Equal(t, 400, w.Code)
+	assert.Equal(t, "Update platform mismatch\n", w.Body.String())
+}
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"encoding/json"
 	"expo-open-ota/internal/handlers"
 	"expo-open-ota/internal/types"
@@ -114,12 +115,12 @@ func TestGoodRepublish(t *testing.T) {
 	assert.NotEmpty(t, body.RuntimeVersion, "Expected non-empty runtimeVersion")
 	assert.NotEmpty(t, body.Branch, "Expected non-empty branch")
 	assert.NotEmpty(t, body.CreatedAt, "Expected non-empty createdAt")
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion("branch-2", "1", "ios")
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), "branch-2", "1", "ios")
 	if err != nil {
 		t.Fatalf("Error getting latest update: %v", err)
 	}
 	assert.Equal(t, body.UpdateId, lastUpdate.UpdateId, "Expected updateId to match the latest update")
-	updateType := update.GetUpdateType(*lastUpdate)
+	updateType := update.GetUpdateType(context.Background(), *lastUpdate)
 	assert.Equal(t, updateType, types.NormalUpdate, "Expected update type to be normal")
 
 	previousUpdate, err := update.GetUpdate("branch-2", "1", "1737455526")
@@ -129,11 +130,11 @@ func TestGoodRepublish(t *testing.T) {
 	if previousUpdate == nil {
 		t.Fatalf("Expected previous update to exist")
 	}
-	previousMetadata, err := update.GetMetadata(*previousUpdate)
+	previousMetadata, err := update.GetMetadata(context.Background(), *previousUpdate)
 	if err != nil {
 		t.Fatalf("Error getting previous update metadata: %v", err)
 	}
-	lastMetadata, err := update.GetMetadata(*lastUpdate)
+	lastMetadata, err := update.GetMetadata(context.Background(), *lastUpdate)
 	if err != nil {
 		t.Fatalf("Error getting last update metadata: %v", err)
 	}
@@ -178,12 +179,12 @@ func TestGoodRepublishWithoutCommitHash(t *testing.T) {
 	assert.NotEmpty(t, body.RuntimeVersion, "Expected non-empty runtimeVersion")
 	assert.NotEmpty(t, body.Branch, "Expected non-empty branch")
 	assert.NotEmpty(t, body.CreatedAt, "Expected non-empty createdAt")
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion("branch-2", "1", "ios")
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), "branch-2", "1", "ios")
 	if err != nil {
 		t.Fatalf("Error getting latest update: %v", err)
 	}
 	assert.Equal(t, body.UpdateId, lastUpdate.UpdateId, "Expected updateId to match the latest update")
-	updateType := update.GetUpdateType(*lastUpdate)
+	updateType := update.GetUpdateType(context.Background(), *lastUpdate)
 	assert.Equal(t, updateType, types.NormalUpdate, "Expected update type to be normal")
 
 	previousUpdate, err := update.GetUpdate("branch-2", "1", "1737455526")
@@ -193,11 +194,11 @@ func TestGoodRepublishWithoutCommitHash(t *testing.T) {
 	if previousUpdate == nil {
 		t.Fatalf("Expected previous update to exist")
 	}
-	previousMetadata, err := update.GetMetadata(*previousUpdate)
+	previousMetadata, err := update.GetMetadata(context.Background(), *previousUpdate)
 	if err != nil {
 		t.Fatalf("Error getting previous update metadata: %v", err)
 	}
-	lastMetadata, err := update.GetMetadata(*lastUpdate)
+	lastMetadata, err := update.GetMetadata(context.Background(), *lastUpdate)
 	if err != nil {
 		t.Fatalf("Error getting last update metadata: %v", err)
 	}
@@ -300,3 +301,35 @@ func TestToRepublishARollback(t *testing.T) {
 	assert.Equal(t, 400, w.Code, "Expected status code 400")
 	assert.Equal(t, "Update type is not normal update\n", w.Body.String(), "Expected error message")
 }
+
+func TestRepublishHaltedUpdate(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	os.Setenv("LOCAL_BUCKET_BASE_PATH", filepath.Join(projectRoot, "./updates", "DO_NOT_USE"))
+	src := filepath.Join(projectRoot, "test", "test-updates")
+	dst := filepath.Join(projectRoot, "updates", "DO_NOT_USE")
+
+	err = copyDir(src, dst)
+	if err != nil {
+		panic(err)
+	}
+	haltedUpdate, err := update.GetUpdate("branch-2", "1", "1737455526")
+	require.NoError(t, err)
+	require.NotNil(t, haltedUpdate)
+	require.NoError(t, update.HaltUpdate(context.Background(), *haltedUpdate, "ios", "crash guard"))
+	updatesBefore, err := update.GetAllUpdatesForRuntimeVersion(context.Background(), "branch-2", "1", "ios")
+	require.NoError(t, err)
+
+	w, _, _, r := createRepublishRequest("branch-2", "1", "Authorization", "Bearer expo_test_token", "ios", "hash", "1737455526")
+	handlers.RepublishHandler(w, r)
+	assert.Equal(t, 400, w.Code, "Expected status code 400")
+	assert.Equal(t, "Update is halted\n", w.Body.String(), "Expected error message")
+	updatesAfter, err := update.GetAllUpdatesForRuntimeVersion(context.Background(), "branch-2", "1", "ios")
+	require.NoError(t, err)
+	assert.Len(t, updatesAfter, len(updatesBefore), "Expected no update to be republished")
+}
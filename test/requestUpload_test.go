@@ -2,6 +2,9 @@ package test
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -18,6 +21,7 @@ import (
 	cache2 "expo-open-ota/internal/cache"
 	"expo-open-ota/internal/handlers"
 	"expo-open-ota/internal/services"
+	"expo-open-ota/internal/types"
 	"expo-open-ota/internal/update"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
@@ -41,13 +45,20 @@ func createUploadRequest(t *testing.T, projectRoot, branch, runtimeVersion, samp
 }
 
 func performUpload(t *testing.T, projectRoot, branch, runtimeVersion, sampleUpdatePath, platform string) string {
+	return performUploadWithInput(t, projectRoot, branch, runtimeVersion, sampleUpdatePath, platform, ComputeUploadRequestsInput(sampleUpdatePath))
+}
+
+func performUploadWithInput(t *testing.T, projectRoot, branch, runtimeVersion, sampleUpdatePath, platform string, uploadRequestsInput handlers.FileNamesRequest) string {
+	return performUploadWithQuery(t, projectRoot, branch, runtimeVersion, sampleUpdatePath, platform, uploadRequestsInput, "")
+}
+
+func performUploadWithQuery(t *testing.T, projectRoot, branch, runtimeVersion, sampleUpdatePath, platform string, uploadRequestsInput handlers.FileNamesRequest, extraQuery string) string {
 	os.Setenv("LOCAL_BUCKET_BASE_PATH", filepath.Join(projectRoot, "./updates"))
-	requestURL := fmt.Sprintf("http://localhost:3000/requestUploadUrl/%s?runtimeVersion=%s&platform=%s&commitHash=abc123", branch, runtimeVersion, platform)
+	requestURL := fmt.Sprintf("http://localhost:3000/requestUploadUrl/%s?runtimeVersion=%s&platform=%s&commitHash=abc123%s", branch, runtimeVersion, platform, extraQuery)
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("POST", requestURL, nil)
 	r = mux.SetURLVars(r, map[string]string{"BRANCH": branch})
 	r.Header.Set("Authorization", "Bearer expo_test_token")
-	uploadRequestsInput := ComputeUploadRequestsInput(sampleUpdatePath)
 	uploadRequestsInputJSON, err := json.Marshal(uploadRequestsInput)
 	if err != nil {
 		t.Fatalf("Error marshalling uploadRequestsInput: %v", err)
@@ -65,7 +76,24 @@ func performUpload(t *testing.T, projectRoot, branch, runtimeVersion, sampleUpda
 		t.Fatalf("Error decoding response body: %v", err)
 	}
 	updateId := fmt.Sprintf("%d", responseBody.UpdateId)
-	fileUploadRequests := responseBody.UploadRequests
+	uploadUpdateFiles(t, projectRoot, branch, runtimeVersion, updateId, sampleUpdatePath, responseBody.UploadRequests)
+	metadataPath := filepath.Join(projectRoot, "updates", branch, runtimeVersion, updateId, "update-metadata.json")
+	metadataContent, err := os.ReadFile(metadataPath)
+	if err != nil {
+		t.Fatalf("Error opening update-metadata.json file at %s: %v", metadataPath, err)
+	}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(metadataContent, &metadata); err != nil {
+		t.Fatalf("Error unmarshalling update-metadata.json: %v", err)
+	}
+	if metadata["platform"] != platform || metadata["commitHash"] != "abc123" {
+		t.Fatalf("Metadata values not as expected, got: %v", metadata)
+	}
+	return updateId
+}
+
+// uploadUpdateFiles uploads the files of the sample update through the local file upload endpoint.
+func uploadUpdateFiles(t *testing.T, projectRoot, branch, runtimeVersion, updateId, sampleUpdatePath string, fileUploadRequests []bucket.FileUploadRequest) {
 	ws := make([]*httptest.ResponseRecorder, len(fileUploadRequests))
 	errs := make(chan error, len(fileUploadRequests))
 	var wg sync.WaitGroup
@@ -126,19 +154,6 @@ func performUpload(t *testing.T, projectRoot, branch, runtimeVersion, sampleUpda
 			t.Fatalf("Error opening uploaded file %s: %v", expectedFilePath, err)
 		}
 	}
-	metadataPath := filepath.Join(projectRoot, "updates", branch, runtimeVersion, updateId, "update-metadata.json")
-	metadataContent, err := os.ReadFile(metadataPath)
-	if err != nil {
-		t.Fatalf("Error opening update-metadata.json file at %s: %v", metadataPath, err)
-	}
-	var metadata map[string]interface{}
-	if err := json.Unmarshal(metadataContent, &metadata); err != nil {
-		t.Fatalf("Error unmarshalling update-metadata.json: %v", err)
-	}
-	if metadata["platform"] != platform || metadata["commitHash"] != "abc123" {
-		t.Fatalf("Metadata values not as expected, got: %v", metadata)
-	}
-	return updateId
 }
 
 func markUpdateAsUploaded(t *testing.T, branch, runtimeVersion, updateId, platform string) *httptest.ResponseRecorder {
@@ -366,7 +381,7 @@ func TestRequestUploadUrlWithSampleUpdate(t *testing.T) {
 			assert.Nil(t, err, "Expected no errors when opening uploaded file")
 		}
 	}
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion("DO_NOT_USE", "1", "android")
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), "DO_NOT_USE", "1", "android")
 	if err != nil {
 		t.Fatalf("Error getting latest update: %v", err)
 	}
@@ -378,7 +393,7 @@ func TestRequestUploadUrlWithSampleUpdate(t *testing.T) {
 	rMark = mux.SetURLVars(rMark, map[string]string{"BRANCH": "DO_NOT_USE"})
 	handlers.MarkUpdateAsUploadedHandler(wMark, rMark)
 	assert.Equal(t, 200, wMark.Code, "Expected status code 200")
-	lastUpdate, err = update.GetLatestUpdateBundlePathForRuntimeVersion("DO_NOT_USE", "1", "android")
+	lastUpdate, err = update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), "DO_NOT_USE", "1", "android")
 	if err != nil {
 		t.Fatalf("Error getting latest update: %v", err)
 	}
@@ -441,7 +456,7 @@ func TestShouldClearCache(t *testing.T) {
 	sampleUpdatePath := filepath.Join(projectRoot, "/test/test-updates/branch-1/1/1674170951")
 	cache := cache2.GetCache()
 	cacheKey := update.ComputeLastUpdateCacheKey("branch-1", "1", "android")
-	value := cache.Get(cacheKey)
+	value := cache.Get(context.Background(), cacheKey)
 	expectedValue := "{\"branch\":\"branch-1\",\"runtimeVersion\":\"1\",\"updateId\":\"1674170951\",\"createdAt\":1674170951000000}"
 	assert.Equal(t, expectedValue, value, "Expected a specific cache value")
 	uploadRequestsInput := ComputeUploadRequestsInput(sampleUpdatePath)
@@ -453,7 +468,7 @@ func TestShouldClearCache(t *testing.T) {
 	handlers.RequestUploadUrlHandler(w, r)
 	assert.Equal(t, 200, w.Code, "Expected status code 200")
 	assert.NotEmpty(t, w.Header().Get("expo-update-id"), "Expected non-empty update ID")
-	value = cache.Get(cacheKey)
+	value = cache.Get(context.Background(), cacheKey)
 	assert.Empty(t, value, "Expected an empty cache value")
 }
 
@@ -504,7 +519,7 @@ func TestIdenticalUpload(t *testing.T) {
 	if w2.Code == 200 {
 		t.Fatalf("Second mark as uploaded should have failed (non-200), got %d", w2.Code)
 	}
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(branch, runtimeVersion, "ios")
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), branch, runtimeVersion, "ios")
 	if err != nil {
 		t.Fatalf("Error getting latest update: %v", err)
 	}
@@ -532,10 +547,122 @@ func TestDifferentUpload(t *testing.T) {
 	updateId2 := performUpload(t, projectRoot, branch, runtimeVersion, sampleOtherUpdatePath, "android")
 	w2 := markUpdateAsUploaded(t, branch, runtimeVersion, updateId2, "android")
 	assert.Equal(t, 200, w2.Code, "Expected status code 200")
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(branch, runtimeVersion, "android")
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), branch, runtimeVersion, "android")
 	if err != nil {
 		t.Fatalf("Error getting latest update: %v", err)
 	}
 	assert.NotNil(t, lastUpdate, "Expected non-nil")
 	assert.Equal(t, updateId2, lastUpdate.UpdateId, "Expected update ID to match")
 }
+
+func TestPublishPersistsPrewarmedManifest(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "test", "test-updates", "branch-4", "1", "1674170952")
+	branch := "DO_NOT_USE"
+	runtimeVersion := "1"
+	updateId := performUpload(t, projectRoot, branch, runtimeVersion, sampleUpdatePath, "android")
+	w := markUpdateAsUploaded(t, branch, runtimeVersion, updateId, "android")
+	assert.Equal(t, 200, w.Code)
+	update.WaitPrewarms()
+
+	updateFolder := filepath.Join(projectRoot, "updates", branch, runtimeVersion, updateId)
+	content, err := os.ReadFile(filepath.Join(updateFolder, update.ComputeManifestFileName("android")))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(updateFolder, update.ComputeManifestFileName("ios")))
+	assert.True(t, os.IsNotExist(err))
+
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), branch, runtimeVersion, "android")
+	assert.Nil(t, err)
+	metadata, err := update.GetMetadata(context.Background(), *lastUpdate)
+	assert.Nil(t, err)
+	manifest, err := update.ComposeUpdateManifest(context.Background(), &metadata, *lastUpdate, "android")
+	assert.Nil(t, err)
+	persisted, err := json.Marshal(manifest)
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(persisted), string(content))
+
+	// Cold start: the bundle is gone from the bucket, so the manifest can only come from the persisted file.
+	_ = cache2.GetCache().Clear(context.Background())
+	assert.Nil(t, os.Remove(filepath.Join(updateFolder, metadata.MetadataJSON.FileMetadata.Android.Bundle)))
+	coldManifest, err := update.ComposeUpdateManifest(context.Background(), &metadata, *lastUpdate, "android")
+	assert.Nil(t, err)
+	assert.Equal(t, manifest, coldManifest)
+}
+
+func TestMarkUpdateAsUploadedStoresAssetIndex(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "test", "test-updates", "branch-4", "1", "1674170952")
+	branch := "DO_NOT_USE"
+	runtimeVersion := "1"
+	input := ComputeUploadRequestsInput(sampleUpdatePath)
+	input.FileHashes = map[string]string{}
+	for _, fileName := range input.FileNames {
+		content, err := os.ReadFile(filepath.Join(sampleUpdatePath, fileName))
+		assert.Nil(t, err)
+		sum := sha256.Sum256(content)
+		input.FileHashes[fileName] = hex.EncodeToString(sum[:])
+	}
+	updateId := performUploadWithInput(t, projectRoot, branch, runtimeVersion, sampleUpdatePath, "android", input)
+	w := markUpdateAsUploaded(t, branch, runtimeVersion, updateId, "android")
+	assert.Equal(t, 200, w.Code)
+	update.WaitPrewarms()
+
+	updateFolder := filepath.Join(projectRoot, "updates", branch, runtimeVersion, updateId)
+	content, err := os.ReadFile(filepath.Join(updateFolder, update.AssetIndexFileName))
+	assert.Nil(t, err)
+	var index types.AssetIndex
+	assert.Nil(t, json.Unmarshal(content, &index))
+
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), branch, runtimeVersion, "android")
+	assert.Nil(t, err)
+	metadata, err := update.GetMetadata(context.Background(), *lastUpdate)
+	assert.Nil(t, err)
+	bundle := metadata.MetadataJSON.FileMetadata.Android.Bundle
+	assert.Len(t, index.Assets, len(metadata.MetadataJSON.FileMetadata.Android.Assets)+1)
+	assert.Contains(t, index.Assets, bundle)
+
+	// Without the persisted manifest nor the bundle, the manifest can only be shaped from the index.
+	_ = cache2.GetCache().Clear(context.Background())
+	assert.Nil(t, os.Remove(filepath.Join(updateFolder, update.ComputeManifestFileName("android"))))
+	assert.Nil(t, os.Remove(filepath.Join(updateFolder, bundle)))
+	manifest, err := update.ComposeUpdateManifest(context.Background(), &metadata, *lastUpdate, "android")
+	assert.Nil(t, err)
+	assert.Equal(t, index.Assets[bundle].Hash, manifest.LaunchAsset.Hash)
+	assert.Equal(t, index.Assets[bundle].Key, manifest.LaunchAsset.Key)
+	assert.Len(t, manifest.Assets, len(metadata.MetadataJSON.FileMetadata.Android.Assets))
+}
+
+func TestMarkUpdateAsUploadedWithHashMismatch(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	if err != nil {
+		t.Fatalf("Error finding project root: %v", err)
+	}
+	sampleUpdatePath := filepath.Join(projectRoot, "test", "test-updates", "branch-4", "1", "1674170952")
+	branch := "DO_NOT_USE"
+	runtimeVersion := "1"
+	input := ComputeUploadRequestsInput(sampleUpdatePath)
+	sum := sha256.Sum256([]byte("not the bundle"))
+	// The android bundle is listed right before metadata.json and expoConfig.json.
+	input.FileHashes = map[string]string{input.FileNames[len(input.FileNames)-3]: hex.EncodeToString(sum[:])}
+	updateId := performUploadWithInput(t, projectRoot, branch, runtimeVersion, sampleUpdatePath, "android", input)
+	w := markUpdateAsUploaded(t, branch, runtimeVersion, updateId, "android")
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "hash mismatch")
+	_, err = os.Stat(filepath.Join(projectRoot, "updates", branch, runtimeVersion, updateId))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"encoding/json"
 	"expo-open-ota/internal/handlers"
 	"expo-open-ota/internal/types"
@@ -71,12 +72,12 @@ func TestGoodRollback(t *testing.T) {
 	assert.NotEmpty(t, body.RuntimeVersion, "Expected non-empty runtimeVersion")
 	assert.NotEmpty(t, body.Branch, "Expected non-empty branch")
 	assert.NotEmpty(t, body.CreatedAt, "Expected non-empty createdAt")
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion("DO_NOT_USE", "1", "ios")
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), "DO_NOT_USE", "1", "ios")
 	if err != nil {
 		t.Fatalf("Error getting latest update: %v", err)
 	}
 	assert.Equal(t, body.UpdateId, lastUpdate.UpdateId, "Expected updateId to match the latest update")
-	updateType := update.GetUpdateType(*lastUpdate)
+	updateType := update.GetUpdateType(context.Background(), *lastUpdate)
 	assert.Equal(t, updateType, types.Rollback, "Expected update type to be rollback")
 }
 
@@ -106,11 +107,69 @@ func TestGoodRollbackWithoutCommitHash(t *testing.T) {
 	assert.NotEmpty(t, body.RuntimeVersion, "Expected non-empty runtimeVersion")
 	assert.NotEmpty(t, body.Branch, "Expected non-empty branch")
 	assert.NotEmpty(t, body.CreatedAt, "Expected non-empty createdAt")
-	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion("DO_NOT_USE", "1", "ios")
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), "DO_NOT_USE", "1", "ios")
 	if err != nil {
 		t.Fatalf("Error getting latest update: %v", err)
 	}
 	assert.Equal(t, body.UpdateId, lastUpdate.UpdateId, "Expected updateId to match the latest update")
-	updateType := update.GetUpdateType(*lastUpdate)
+	updateType := update.GetUpdateType(context.Background(), *lastUpdate)
 	assert.Equal(t, updateType, types.Rollback, "Expected update type to be rollback")
 }
+
+func createRollbackToUpdateRequest(branch, runtimeVersion, platform, updateId string) (*httptest.ResponseRecorder, *http.Request) {
+	q := fmt.Sprintf("http://localhost:3000/rollback/%s?runtimeVersion=%s&platform=%s&updateId=%s", branch, runtimeVersion, platform, updateId)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", q, nil)
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": branch})
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	return w, r
+}
+
+func TestRollbackToPreviousUpdate(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	branch := "DO_NOT_USE"
+	runtimeVersion := "1"
+	previousUpdateId := performUpload(t, projectRoot, branch, runtimeVersion, filepath.Join(projectRoot, "test", "test-updates", "branch-4", "1", "1674170952"), "android")
+	require.Equal(t, 200, markUpdateAsUploaded(t, branch, runtimeVersion, previousUpdateId, "android").Code)
+	badUpdateId := performUpload(t, projectRoot, branch, runtimeVersion, filepath.Join(projectRoot, "test", "test-updates", "branch-4", "1", "1674170951"), "android")
+	require.Equal(t, 200, markUpdateAsUploaded(t, branch, runtimeVersion, badUpdateId, "android").Code)
+
+	w, r := createRollbackToUpdateRequest(branch, runtimeVersion, "ios", previousUpdateId)
+	handlers.RollbackHandler(w, r)
+	assert.Equal(t, 400, w.Code, "Expected the platform of the update to be checked")
+
+	w, r = createRollbackToUpdateRequest(branch, runtimeVersion, "android", "1")
+	handlers.RollbackHandler(w, r)
+	assert.Equal(t, 404, w.Code)
+
+	w, r = createRollbackToUpdateRequest(branch, runtimeVersion, "android", previousUpdateId)
+	handlers.RollbackHandler(w, r)
+	require.Equal(t, 200, w.Code)
+
+	lastUpdate, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), branch, runtimeVersion, "android")
+	require.NoError(t, err)
+	require.NotNil(t, lastUpdate)
+	assert.Equal(t, previousUpdateId, lastUpdate.UpdateId, "Expected the previous update to be served")
+	assert.Equal(t, types.NormalUpdate, update.GetUpdateType(context.Background(), *lastUpdate))
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", fmt.Sprintf("http://localhost:3000/api/branch/%s/runtimeVersion/%s/updates", branch, runtimeVersion), nil)
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": branch, "RUNTIME_VERSION": runtimeVersion})
+	handlers.GetUpdatesHandler(w, r)
+	require.Equal(t, 200, w.Code)
+	var items []handlers.UpdateItem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	require.Equal(t, 2, len(items))
+	itemsById := map[string]handlers.UpdateItem{}
+	for _, item := range items {
+		itemsById[item.UpdateId] = item
+	}
+	assert.False(t, itemsById[badUpdateId].IsServed)
+	assert.Equal(t, "rolled back to update "+previousUpdateId, itemsById[badUpdateId].HaltedReason)
+	assert.True(t, itemsById[previousUpdateId].IsServed)
+	assert.Equal(t, update.ServedReasonRollback, itemsById[previousUpdateId].ServedReason)
+}
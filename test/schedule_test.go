@@ -0,0 +1,66 @@
+package test
+
+import (
+	"context"
+	"expo-open-ota/internal/update"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScheduledUpdateIsServedOnceActivated(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	currentPath := filepath.Join(projectRoot, "/test/test-updates/branch-4/1/1674170951")
+	currentId := performUpload(t, projectRoot, "DO_NOT_USE", "1", currentPath, "android")
+	require.Equal(t, 200, markUpdateAsUploaded(t, "DO_NOT_USE", "1", currentId, "android").Code)
+
+	activateAt := time.Now().Add(2 * time.Second).UTC().Truncate(time.Second).Add(time.Second)
+	scheduledPath := filepath.Join(projectRoot, "/test/test-updates/branch-4/1/1674170952")
+	scheduledId := performUploadWithQuery(t, projectRoot, "DO_NOT_USE", "1", scheduledPath, "android", ComputeUploadRequestsInput(scheduledPath), fmt.Sprintf("&activateAt=%s", url.QueryEscape(activateAt.Format(time.RFC3339))))
+	require.Equal(t, 200, markUpdateAsUploaded(t, "DO_NOT_USE", "1", scheduledId, "android").Code)
+
+	latest, err := update.GetLatestUpdateBundlePathForRuntimeVersion(ctx, "DO_NOT_USE", "1", "android")
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, currentId, latest.UpdateId, "Expected the scheduled update not to be served before its activation")
+
+	// The cached latest update expires at the activation without any invalidation, within the one
+	// second granularity of cache TTLs.
+	time.Sleep(time.Until(activateAt) + 1100*time.Millisecond)
+	latest, err = update.GetLatestUpdateBundlePathForRuntimeVersion(ctx, "DO_NOT_USE", "1", "android")
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, scheduledId, latest.UpdateId, "Expected the scheduled update to be served once activated")
+}
+
+func TestExpiredUpdateIsNotServed(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+
+	currentPath := filepath.Join(projectRoot, "/test/test-updates/branch-4/1/1674170951")
+	currentId := performUpload(t, projectRoot, "DO_NOT_USE", "1", currentPath, "android")
+	require.Equal(t, 200, markUpdateAsUploaded(t, "DO_NOT_USE", "1", currentId, "android").Code)
+
+	expireAt := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	expiredPath := filepath.Join(projectRoot, "/test/test-updates/branch-4/1/1674170952")
+	expiredId := performUploadWithQuery(t, projectRoot, "DO_NOT_USE", "1", expiredPath, "android", ComputeUploadRequestsInput(expiredPath), fmt.Sprintf("&expireAt=%s", url.QueryEscape(expireAt)))
+	require.Equal(t, 200, markUpdateAsUploaded(t, "DO_NOT_USE", "1", expiredId, "android").Code)
+
+	latest, err := update.GetLatestUpdateBundlePathForRuntimeVersion(context.Background(), "DO_NOT_USE", "1", "android")
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	assert.Equal(t, currentId, latest.UpdateId, "Expected the expired update to fall back to the previous one")
+}
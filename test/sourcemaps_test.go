@@ -0,0 +1,108 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expo-open-ota/internal/assets"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/middleware"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sampleSourceMap maps line 1 column 0 of the bundle to src/App.tsx 5:2, in function crash.
+const sampleSourceMap = `{"version":3,"sources":["src/App.tsx"],"names":["crash"],"mappings":"AAIEA"}`
+
+func symbolicate(token, branch, runtimeVersion, updateId, stack string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(handlers.SymbolicateRequest{Stack: stack})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", fmt.Sprintf("http://localhost:3000/api/branch/%s/runtimeVersion/%s/updates/%s/symbolicate", branch, runtimeVersion, updateId), bytes.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": branch, "RUNTIME_VERSION": runtimeVersion, "UPDATE_ID": updateId})
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	middleware.AuthMiddleware(http.HandlerFunc(handlers.SymbolicateHandler)).ServeHTTP(w, r)
+	return w
+}
+
+func TestSymbolicateWithUploadedSourceMap(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+
+	samplePath := t.TempDir()
+	require.NoError(t, os.CopyFS(samplePath, os.DirFS(filepath.Join(projectRoot, "/test/test-updates/branch-4/1/1674170952"))))
+	require.NoError(t, os.WriteFile(filepath.Join(samplePath, "bundles", "android.js.map"), []byte(sampleSourceMap), 0644))
+	input := ComputeUploadRequestsInput(samplePath)
+	input.SourceMaps = map[string]string{"android": "bundles/android.js.map"}
+	updateId := performUploadWithInput(t, projectRoot, "DO_NOT_USE", "1", samplePath, "android", input)
+	require.Equal(t, http.StatusOK, markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId, "android").Code)
+
+	stored, err := os.ReadFile(filepath.Join(projectRoot, "updates", "DO_NOT_USE", "1", updateId, "sourcemaps", "android.map"))
+	require.NoError(t, err, "Expected the source map to be stored as a private file")
+	assert.Equal(t, sampleSourceMap, string(stored))
+
+	for _, assetName := range []string{"sourcemaps/android.map", "assets/../sourcemaps/android.map"} {
+		resp, err := assets.HandleAssetsWithFile(context.Background(), assets.AssetsRequest{
+			Branch:         "DO_NOT_USE",
+			AssetName:      assetName,
+			RuntimeVersion: "1",
+			Platform:       "android",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Expected %s not to be served", assetName)
+	}
+
+	stack := "TypeError: undefined is not a function\n    at a (address at index.android.bundle:1:4)"
+	w := symbolicate("", "DO_NOT_USE", "1", updateId, stack)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = symbolicate(dashboardToken(t, "", "admin"), "DO_NOT_USE", "1", updateId, stack)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response handlers.SymbolicateResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "android", response.Platform)
+	assert.Equal(t, "TypeError: undefined is not a function\n    at crash (src/App.tsx:5:2)", response.Stack)
+	require.Len(t, response.Frames, 1)
+	require.NotNil(t, response.Frames[0].Original)
+	assert.Equal(t, "src/App.tsx", response.Frames[0].Original.Source)
+}
+
+func TestSymbolicateWithoutSourceMap(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockExpoForRequestUploadUrlTest("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+
+	samplePath := filepath.Join(projectRoot, "/test/test-updates/branch-4/1/1674170952")
+	updateId := performUpload(t, projectRoot, "DO_NOT_USE", "1", samplePath, "android")
+	require.Equal(t, http.StatusOK, markUpdateAsUploaded(t, "DO_NOT_USE", "1", updateId, "android").Code)
+
+	w := symbolicate(dashboardToken(t, "", "admin"), "DO_NOT_USE", "1", updateId, "    at a (index.android.bundle:1:4)")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = symbolicate(dashboardToken(t, "", "admin"), "DO_NOT_USE", "1", "1674170999", "    at a (index.android.bundle:1:4)")
+	assert.Equal(t, http.StatusNotFound, w.Code, "Expected an unknown update to be refused")
+
+	input := ComputeUploadRequestsInput(samplePath)
+	input.SourceMaps = map[string]string{"web": "bundles/web.js.map"}
+	body, err := json.Marshal(input)
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "http://localhost:3000/requestUploadUrl/DO_NOT_USE?runtimeVersion=1&platform=android&commitHash=abc123", bytes.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "DO_NOT_USE"})
+	r.Header.Set("Authorization", "Bearer expo_test_token")
+	handlers.RequestUploadUrlHandler(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid source maps")
+}
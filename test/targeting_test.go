@@ -0,0 +1,120 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	cache2 "expo-open-ota/internal/cache"
+	"expo-open-ota/internal/handlers"
+	"expo-open-ota/internal/targeting"
+	"expo-open-ota/internal/types"
+	"expo-open-ota/internal/update"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createTargetedManifestRequest(extraParams string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "http://localhost:3000/manifest", nil)
+	r.Header.Add("expo-platform", "android")
+	r.Header.Add("expo-runtime-version", "1")
+	r.Header.Add("expo-protocol-version", "1")
+	r.Header.Add("expo-expect-signature", "true")
+	r.Header.Add("expo-channel-name", "staging")
+	if extraParams != "" {
+		r.Header.Add("expo-extra-params", extraParams)
+	}
+	handlers.ManifestHandler(w, r)
+	return w
+}
+
+func TestBranchTargetingRulesForManifest(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	mockWorkingExpoResponse("staging")
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	defer os.Remove(filepath.Join(projectRoot, "./test/test-updates/branch-1", targeting.RulesFileName))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "http://localhost:3000/api/branch/branch-1/targetingRules", bytes.NewBufferString(`{"extraParams":{"tier":["beta"]}}`))
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "branch-1"})
+	handlers.SetBranchTargetingRulesHandler(w, r)
+	require.Equal(t, 200, w.Code)
+
+	w = createTargetedManifestRequest("")
+	require.Equal(t, 200, w.Code)
+	parts, err := ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(parts))
+	assert.True(t, IsMultipartPartWithName(parts[0], "directive"), "Expected untargeted clients not to be served")
+	var directive types.NoUpdateAvailableDirective
+	require.NoError(t, json.Unmarshal([]byte(parts[0].Body), &directive))
+	assert.Equal(t, "noUpdateAvailable", directive.Type)
+
+	w = createTargetedManifestRequest(`tier="beta"`)
+	require.Equal(t, 200, w.Code)
+	parts, err = ParseMultipartMixedResponse(w.Header().Get("Content-Type"), w.Body.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, 2, len(parts))
+	assert.True(t, IsMultipartPartWithName(parts[0], "manifest"), "Expected targeted clients to be served")
+}
+
+func TestInvalidTargetingRules(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "http://localhost:3000/api/branch/branch-1/targetingRules", bytes.NewBufferString(`{"minAppVersion":"2.0","maxAppVersion":"1.0"}`))
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "branch-1"})
+	handlers.SetBranchTargetingRulesHandler(w, r)
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestUpdateTargetingRulesFallBackToPreviousUpdate(t *testing.T) {
+	teardown := setup(t)
+	defer teardown()
+	projectRoot, err := findProjectRoot()
+	require.NoError(t, err)
+	defer os.Remove(filepath.Join(projectRoot, "./test/test-updates/branch-2/1/1737455526", targeting.RulesFileName))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "http://localhost:3000/api/branch/branch-2/runtimeVersion/1/updates/1737455526/targetingRules", bytes.NewBufferString(`{"clientIds":["client-a"]}`))
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "branch-2", "RUNTIME_VERSION": "1", "UPDATE_ID": "1737455526"})
+	handlers.SetUpdateTargetingRulesHandler(w, r)
+	require.Equal(t, 200, w.Code)
+
+	ctx := context.Background()
+	targeted, err := update.GetLatestUpdateForClient(ctx, "branch-2", "1", "ios", targeting.Client{ClientId: "client-a"})
+	require.NoError(t, err)
+	require.NotNil(t, targeted)
+	assert.Equal(t, "1737455526", targeted.UpdateId)
+
+	other, err := update.GetLatestUpdateForClient(ctx, "branch-2", "1", "ios", targeting.Client{ClientId: "client-b"})
+	require.NoError(t, err)
+	require.NotNil(t, other)
+	assert.NotEqual(t, "1737455526", other.UpdateId, "Expected other clients to get the previous update")
+	assert.NotEmpty(t, cache2.GetCache().Get(ctx, update.ComputeTargetedUpdatesCacheKey("branch-2", "1", "ios")), "Expected the targeted updates to be cached")
+
+	defer os.Remove(filepath.Join(projectRoot, "./test/test-updates/branch-2/1", other.UpdateId, targeting.RulesFileName))
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "http://localhost:3000/api/branch/branch-2/runtimeVersion/1/updates/"+other.UpdateId+"/targetingRules", bytes.NewBufferString(`{"clientIds":["client-a"]}`))
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "branch-2", "RUNTIME_VERSION": "1", "UPDATE_ID": other.UpdateId})
+	handlers.SetUpdateTargetingRulesHandler(w, r)
+	require.Equal(t, 200, w.Code)
+	next, err := update.GetLatestUpdateForClient(ctx, "branch-2", "1", "ios", targeting.Client{ClientId: "client-b"})
+	require.NoError(t, err)
+	if next != nil {
+		assert.NotEqual(t, other.UpdateId, next.UpdateId, "Expected new rules to invalidate the cached targeted updates")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "http://localhost:3000/api/branch/branch-2/runtimeVersion/1/updates/404/targetingRules", nil)
+	r = mux.SetURLVars(r, map[string]string{"BRANCH": "branch-2", "RUNTIME_VERSION": "1", "UPDATE_ID": "404"})
+	handlers.GetUpdateTargetingRulesHandler(w, r)
+	assert.Equal(t, 404, w.Code)
+}